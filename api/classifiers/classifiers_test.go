@@ -72,3 +72,14 @@ func TestBuildClassifiers_AllRules_PositiveAndNegative(t *testing.T) {
 		}
 	}
 }
+
+func TestValueShapeAndFingerprint(t *testing.T) {
+	assert.Equal(t, "999-99-9999", classifiers.ValueShape("123-45-6789"))
+	assert.Equal(t, "Aaaa@aaaa.aaa", classifiers.ValueShape("John@mail.com"))
+
+	// Order and duplicates do not change the fingerprint
+	a := classifiers.ShapeFingerprint([]string{"123-45-6789", "John@mail.com", "987-65-4321"})
+	b := classifiers.ShapeFingerprint([]string{"Anna@site.org", "555-12-3456"})
+	assert.Equal(t, a, b)
+	assert.Equal(t, "999-99-9999|Aaaa@aaaa.aaa", a)
+}
@@ -0,0 +1,52 @@
+package classifiers
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxShapeLen caps the shape length so long free-text values do not produce huge fingerprints.
+const maxShapeLen = 64
+
+// ValueShape reduces a value to its character-class shape: digits become '9',
+// upper-case letters 'A' and lower-case letters 'a'. Any other rune is kept as is,
+// so "123-45-6789" becomes "999-99-9999" and "John@mail.com" becomes "Aaaa@aaaa.aaa".
+func ValueShape(v string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range v {
+		if n >= maxShapeLen {
+			break
+		}
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteRune('9')
+		case unicode.IsUpper(r):
+			b.WriteRune('A')
+		case unicode.IsLetter(r):
+			b.WriteRune('a')
+		default:
+			b.WriteRune(r)
+		}
+		n++
+	}
+	return b.String()
+}
+
+// ShapeFingerprint returns the sorted, de-duplicated shapes of the given samples joined by '|'.
+// Two sample sets with the same shapes produce the same fingerprint regardless of their order.
+func ShapeFingerprint(samples []string) string {
+	seen := make(map[string]struct{}, len(samples))
+	shapes := make([]string, 0, len(samples))
+	for _, s := range samples {
+		shape := ValueShape(s)
+		if _, ok := seen[shape]; ok {
+			continue
+		}
+		seen[shape] = struct{}{}
+		shapes = append(shapes, shape)
+	}
+	sort.Strings(shapes)
+	return strings.Join(shapes, "|")
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	Service services.APIKeyService
+}
+
+func NewAPIKeyController(s services.APIKeyService) *APIKeyController {
+	return &APIKeyController{Service: s}
+}
+
+// apiKeyRequest is the body of POST /keys; without expires_in_days the key does not expire,
+// and without tenant_id it belongs to the caller's tenant.
+type apiKeyRequest struct {
+	TenantID      int64    `json:"tenant_id"`
+	Name          string   `json:"name" binding:"required"`
+	Owner         string   `json:"owner" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreateKey mints an API key. The response is the only one that includes the key.
+func (ctrl *APIKeyController) CreateKey(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	caller, _ := middleware.CurrentIdentity(c)
+	k := models.APIKey{TenantID: req.TenantID, Name: req.Name, Owner: req.Owner, Scopes: req.Scopes}
+	created, err := ctrl.Service.CreateKey(k, time.Duration(req.ExpiresInDays)*24*time.Hour, caller)
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditAPIKeyCreate, created.ID, nil, created)
+	c.JSON(http.StatusCreated, created)
+}
+
+func (ctrl *APIKeyController) ListKeys(c *gin.Context) {
+	keys, err := ctrl.Service.ListKeys(middleware.CurrentTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (ctrl *APIKeyController) RevokeKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := ctrl.Service.RevokeKey(middleware.CurrentTenant(c), id); err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditAPIKeyRevoke, id, nil, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// WhoAmI returns the identity of the caller
+func (ctrl *APIKeyController) WhoAmI(c *gin.Context) {
+	identity, _ := middleware.CurrentIdentity(c)
+	c.JSON(http.StatusOK, identity)
+}
+
+func apiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAPIKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
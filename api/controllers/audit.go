@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	Service services.AuditService
+}
+
+func NewAuditController(s services.AuditService) *AuditController {
+	return &AuditController{Service: s}
+}
+
+// ListAudit returns audit entries of the caller's tenant, newest first. Filters: actor, action, resource_type,
+// resource_id, from and to (RFC 3339), before_id and limit. With format=jsonl it exports every
+// matching entry as JSON lines instead of one page.
+func (ctrl *AuditController) ListAudit(c *gin.Context) {
+	f, err := auditFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f.TenantID = middleware.CurrentTenant(c)
+	if c.Query("format") == "jsonl" {
+		ctrl.exportAudit(c, f)
+		return
+	}
+
+	entries, err := ctrl.Service.List(f)
+	if err != nil {
+		auditError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (ctrl *AuditController) exportAudit(c *gin.Context, f models.AuditFilter) {
+	f.Limit = services.MaxAuditLimit
+	entries, err := ctrl.Service.List(f)
+	if err != nil {
+		auditError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditLogExport, "", nil, nil)
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for {
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		if len(entries) < f.Limit {
+			return
+		}
+		c.Writer.Flush()
+		f.BeforeID = entries[len(entries)-1].ID
+		if entries, err = ctrl.Service.List(f); err != nil {
+			// the status is already sent: a last line with the error tells a truncated export
+			// from a complete one
+			_ = enc.Encode(gin.H{"error": "export truncated: " + err.Error()})
+			c.Error(err)
+			c.Abort()
+			return
+		}
+	}
+}
+
+func auditFilterFromQuery(c *gin.Context) (models.AuditFilter, error) {
+	f := models.AuditFilter{
+		Actor:        c.Query("actor"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, errors.New(p.name + " must be an RFC 3339 time")
+			}
+			*p.dst = &t
+		}
+	}
+	if v := c.Query("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return f, errors.New("before_id must be a positive integer")
+		}
+		f.BeforeID = id
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return f, errors.New("limit must be a positive integer")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+func auditError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidAuditFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,114 @@
+package controllers_test
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/controllers"
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+// pagedAuditService serves one full page of entries and then fails.
+type pagedAuditService struct{ calls int }
+
+func (s *pagedAuditService) Record(models.AuditEntry) error { return nil }
+
+func (s *pagedAuditService) List(f models.AuditFilter) ([]models.AuditEntry, error) {
+	s.calls++
+	if s.calls > 1 {
+		return nil, errors.New("connection lost")
+	}
+	entries := make([]models.AuditEntry, f.Limit)
+	for i := range entries {
+		entries[i] = models.AuditEntry{ID: int64(f.Limit - i), TenantID: f.TenantID, Action: models.AuditScanStart}
+	}
+	return entries, nil
+}
+
+func TestListAudit_TruncatedExportEndsWithError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/audit", func(c *gin.Context) {
+		middleware.SetIdentity(c, models.Identity{TenantID: 1, Name: "ana"})
+	}, controllers.NewAuditController(&pagedAuditService{}).ListAudit)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/audit?format=jsonl", nil))
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Len(t, lines, services.MaxAuditLimit+1)
+	assert.JSONEq(t, `{"error": "export truncated: connection lost"}`, lines[len(lines)-1])
+}
+
+// recordedAudit keeps the entries recorded through middleware.Audit.
+type recordedAudit struct{ entries []models.AuditEntry }
+
+func (r *recordedAudit) Record(e models.AuditEntry) error {
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+func TestRenderScanReport_AuditsOnlyServedReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &recordedAudit{}
+	r := gin.New()
+	r.Use(middleware.AuditTrail(rec))
+	r.GET("/scan/:id/report", func(c *gin.Context) {
+		middleware.SetIdentity(c, models.Identity{TenantID: 1, Name: "ana"})
+	}, controllers.NewScanController(&DummyScanService{}, nil).RenderScanReport)
+
+	// a scan missing from the caller's tenant is not a report view
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scan/999/report", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, rec.entries)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scan/123/report", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, rec.entries, 1) {
+		assert.Equal(t, models.AuditReportView, rec.entries[0].Action)
+		assert.Equal(t, "123", rec.entries[0].ResourceID)
+	}
+}
+
+func TestCancelScan_AuditsOnlyCancelledScans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &recordedAudit{}
+	svc := &DummyScanService{}
+	r := gin.New()
+	r.Use(middleware.AuditTrail(rec))
+	r.POST("/scan/:id/cancel", func(c *gin.Context) {
+		middleware.SetIdentity(c, models.Identity{TenantID: 1, Name: "ana"})
+	}, controllers.NewScanController(svc, nil).CancelScan)
+
+	for path, code := range map[string]int{"/scan/999/cancel": http.StatusNotFound, "/scan/120/cancel": http.StatusConflict} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+	assert.Empty(t, rec.entries)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scan/123/cancel", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, []int64{123}, svc.Cancelled)
+	if assert.Len(t, rec.entries, 1) {
+		assert.Equal(t, models.AuditScanCancel, rec.entries[0].Action)
+		assert.Equal(t, "123", rec.entries[0].ResourceID)
+		assert.Equal(t, "ana", rec.entries[0].Actor)
+	}
+}
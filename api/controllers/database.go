@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"database/sql"
+	"errors"
+	"meli-challenge/api/middleware"
 	"meli-challenge/api/models"
 	"meli-challenge/api/services"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,18 +24,152 @@ func NewDatabaseController(service services.DatabaseService) *DatabaseController
 	return &DatabaseController{service: service}
 }
 
+// CreateDatabase registers a database. With ?probe=true it first connects to the target and
+// rejects it when the connection fails; the probe result is included in the response.
 func (ctrl *DatabaseController) CreateDatabase(c *gin.Context) {
 	var req models.Database
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	probe, err := strconv.ParseBool(c.DefaultQuery("probe", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid probe value"})
+		return
+	}
 
-	id, err := ctrl.service.RegisterDatabase(req)
+	id, test, err := ctrl.service.RegisterDatabase(middleware.CurrentTenant(c), req, probe)
+	if errors.Is(err, services.ErrProbeFailed) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "probe": test})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		databaseError(c, err)
 		return
 	}
+	created, _ := ctrl.service.GetDatabase(middleware.CurrentTenant(c), id)
+	middleware.Audit(c, models.AuditDatabaseCreate, id, nil, created)
 
+	if test != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id, "probe": test})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"id": id})
 }
+
+func (ctrl *DatabaseController) ListDatabases(c *gin.Context) {
+	dbs, err := ctrl.service.ListDatabases(middleware.CurrentTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dbs)
+}
+
+func (ctrl *DatabaseController) GetDatabase(c *gin.Context) {
+	id, ok := databaseID(c)
+	if !ok {
+		return
+	}
+	t, err := ctrl.service.GetDatabase(middleware.CurrentTenant(c), id)
+	if err != nil {
+		databaseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// UpdateDatabase replaces the settings of a database. Omitting the password keeps the
+// current one; sending a new one rotates it.
+func (ctrl *DatabaseController) UpdateDatabase(c *gin.Context) {
+	id, ok := databaseID(c)
+	if !ok {
+		return
+	}
+	var req models.Database
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := ctrl.service.GetDatabase(middleware.CurrentTenant(c), id)
+	if err != nil {
+		databaseError(c, err)
+		return
+	}
+	if err := ctrl.service.UpdateDatabase(middleware.CurrentTenant(c), id, req); err != nil {
+		databaseError(c, err)
+		return
+	}
+	t, err := ctrl.service.GetDatabase(middleware.CurrentTenant(c), id)
+	if err != nil {
+		databaseError(c, err)
+		return
+	}
+	changes := any(t)
+	if req.Password != "" {
+		// rotations show up as a change of the (redacted) password
+		changes = struct {
+			models.Database
+			Password string `json:"password"`
+		}{t, req.Password}
+	}
+	middleware.Audit(c, models.AuditDatabaseUpdate, id, before, changes)
+	c.JSON(http.StatusOK, t)
+}
+
+func (ctrl *DatabaseController) DeleteDatabase(c *gin.Context) {
+	id, ok := databaseID(c)
+	if !ok {
+		return
+	}
+	before, err := ctrl.service.GetDatabase(middleware.CurrentTenant(c), id)
+	if err != nil {
+		databaseError(c, err)
+		return
+	}
+	if err := ctrl.service.DeleteDatabase(middleware.CurrentTenant(c), id); err != nil {
+		databaseError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditDatabaseDelete, id, before, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// TestConnection reports whether the scanner can connect and what it may read. Connection
+// failures are part of the result (ok=false), not an HTTP error.
+func (ctrl *DatabaseController) TestConnection(c *gin.Context) {
+	id, ok := databaseID(c)
+	if !ok {
+		return
+	}
+	res, err := ctrl.service.TestConnection(middleware.CurrentTenant(c), id)
+	if err != nil {
+		databaseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func databaseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func databaseError(c *gin.Context, err error) {
+	var invalid *services.ValidationError
+	var duplicate *services.DuplicateError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": invalid.Fields})
+	case errors.As(err, &duplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": duplicate.Error(), "existing_id": duplicate.ExistingID})
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
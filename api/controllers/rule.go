@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"database/sql"
+	"errors"
+	"meli-challenge/api/middleware"
 	"meli-challenge/api/models"
 	"meli-challenge/api/services"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,8 +20,10 @@ func NewRuleController(s services.RuleService) *RuleController {
 	return &RuleController{Service: s}
 }
 
+// GetAllRules returns the effective rules of the caller's tenant: inherited pack rules with
+// the tenant's overrides applied.
 func (ctrl *RuleController) GetAllRules(c *gin.Context) {
-	rules, err := ctrl.Service.GetAllRules()
+	rules, err := ctrl.Service.GetAllRules(middleware.CurrentTenant(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -26,6 +32,8 @@ func (ctrl *RuleController) GetAllRules(c *gin.Context) {
 	c.JSON(http.StatusOK, rules)
 }
 
+// CreateRule adds a rule to the caller's tenant. It overrides the inherited rules with the
+// same type_name; "disabled": true switches that type off.
 func (ctrl *RuleController) CreateRule(c *gin.Context) {
 	var req models.ClassificationRule
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,11 +41,93 @@ func (ctrl *RuleController) CreateRule(c *gin.Context) {
 		return
 	}
 
-	id, err := ctrl.Service.CreateRule(req)
+	id, err := ctrl.Service.CreateRule(middleware.CurrentTenant(c), req)
+	if err != nil {
+		ruleError(c, err)
+		return
+	}
+	req.ID = id
+	middleware.Audit(c, models.AuditRuleCreate, id, nil, req)
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (ctrl *RuleController) ListPacks(c *gin.Context) {
+	packs, err := ctrl.Service.ListPacks()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, packs)
+}
+
+func (ctrl *RuleController) GetPack(c *gin.Context) {
+	id, ok := packID(c)
+	if !ok {
+		return
+	}
+	pack, err := ctrl.Service.GetPack(id)
+	if err != nil {
+		ruleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pack)
+}
 
+// CreatePack creates a global rule pack with its initial rules
+func (ctrl *RuleController) CreatePack(c *gin.Context) {
+	var req models.RulePack
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := ctrl.Service.CreatePack(req)
+	if err != nil {
+		ruleError(c, err)
+		return
+	}
+	req.ID = id
+	middleware.Audit(c, models.AuditRulePackCreate, id, nil, req)
 	c.JSON(http.StatusCreated, gin.H{"id": id})
 }
+
+// CreatePackRule adds a rule to a global pack, for every tenant that inherits it
+func (ctrl *RuleController) CreatePackRule(c *gin.Context) {
+	id, ok := packID(c)
+	if !ok {
+		return
+	}
+	var req models.ClassificationRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ruleID, err := ctrl.Service.CreatePackRule(id, req)
+	if err != nil {
+		ruleError(c, err)
+		return
+	}
+	req.ID, req.PackID = ruleID, &id
+	middleware.Audit(c, models.AuditRuleCreate, ruleID, nil, req)
+	c.JSON(http.StatusCreated, gin.H{"id": ruleID})
+}
+
+func packID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func ruleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule pack not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,10 +1,18 @@
 package controllers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
+	"meli-challenge/api/diff"
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/sampling"
 	"meli-challenge/api/services"
+	"meli-challenge/api/targetdb"
 	"meli-challenge/logger"
 	"net/http"
 	"strconv"
@@ -15,6 +23,8 @@ import (
 type ScanController struct {
 	Service services.ScanService
 	DB      *sql.DB // Connection to internal Database
+	// Shares signs the event stream URL of live reports; without it they only work through share links
+	Shares services.ShareService
 }
 
 func NewScanController(service services.ScanService, db *sql.DB) *ScanController {
@@ -29,31 +39,49 @@ func (ctrl *ScanController) ExecuteScan(c *gin.Context) {
 		return
 	}
 
+	opts, err := scanOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// obtain database connection details from internal DB
-	row := ctrl.DB.QueryRow("SELECT host, port, username, password FROM `external_databases` WHERE id = ?", dbID)
-	var host, username, password string
-	var port int
-	if err := row.Scan(&host, &port, &username, &password); err != nil {
+	tenantID := middleware.CurrentTenant(c)
+	target, err := ctrl.lookupTarget(tenantID, dbID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
 		return
 	}
+	opts.Sampling = sampling.Merge(target.Sampling, opts.Sampling)
 
-	// Always connect to information_schema so the service can query any schema on the server.
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/information_schema", username, password, host, port)
-	externalDB, err := sql.Open("mysql", dsn)
+	// Quotas are checked, and the scan recorded, before anything connects to the target
+	scanID, err := ctrl.Service.StartScan(tenantID, dbID, "v1")
+	if quotaRefused(c, err) {
+		return
+	}
 	if err != nil {
+		logger.Errorf("Scan could not start for database id=%d: %v", dbID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	externalDB, err := targetdb.Open(target)
+	if err != nil {
+		_ = ctrl.Service.UpdateScanStatus(scanID, "failed")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	defer externalDB.Close()
 
+	host, port := targetdb.Address(target)
 	logger.Infof("Starting scan for database id=%d host=%s port=%d", dbID, host, port)
+	middleware.Audit(c, models.AuditScanStart, scanID, nil, gin.H{"api": "v1", "database_id": dbID, "options": opts})
 
 	// Execute scan; service will scan all non-system schemas by connecting to information_schema
-	scanID, err := ctrl.Service.ExecuteScan(dbID, externalDB)
-	if err != nil {
-		// Ensure scan history is marked as failed even if the error occurred before service updated it
-		_ = ctrl.Service.UpdateScanStatus(scanID, "failed")
+	if err := ctrl.Service.RunScan(tenantID, dbID, scanID, "v1", externalDB, opts); err != nil {
+		if scanCancelled(c, scanID, err) {
+			return
+		}
 		logger.Errorf("Scan failed for database id=%d: %v", dbID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -71,7 +99,7 @@ func (ctrl *ScanController) GetScanResults(c *gin.Context) {
 		return
 	}
 
-	dbResult, err := ctrl.Service.GetScanResults(scanID)
+	dbResult, err := ctrl.Service.GetScanResults(middleware.CurrentTenant(c), scanID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -85,7 +113,60 @@ func (ctrl *ScanController) GetScanResults(c *gin.Context) {
 	c.JSON(http.StatusOK, dbResult)
 }
 
+// GetScanStatus returns the scan_history record for a scan, including LLM cache and usage counters.
+func (ctrl *ScanController) GetScanStatus(c *gin.Context) {
+	idParam := c.Param("id")
+	scanID, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	history, err := ctrl.Service.GetScanStatus(middleware.CurrentTenant(c), scanID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scan not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// DiffScans compares the results of two scans: GET /scans/diff?from=:a&to=:b[&format=html].
+func (ctrl *ScanController) DiffScans(c *gin.Context) {
+	fromID, errFrom := strconv.ParseInt(c.Query("from"), 10, 64)
+	toID, errTo := strconv.ParseInt(c.Query("to"), 10, 64)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be scan ids"})
+		return
+	}
+
+	d, err := ctrl.Service.DiffScans(middleware.CurrentTenant(c), fromID, toID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scan not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "html" {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		if err := diff.WriteHTML(c.Writer, d); err != nil {
+			logger.Errorf("template execute error: %v", err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
 // RenderScanReport returns an HTML report summarizing a scan results with metrics.
+// With ?compare=<scan_id> it adds a section with the changes since that scan, and with
+// ?live=true a running scan streams its progress into the page and reloads it when done.
 func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 	idParam := c.Param("id")
 	scanID, err := strconv.ParseInt(idParam, 10, 64)
@@ -94,22 +175,44 @@ func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 		return
 	}
 
-	dbResult, err := ctrl.Service.GetScanResults(scanID)
+	// Scan status and LLM accounting from internal scan_history; it also confirms the scan
+	// belongs to the caller's tenant
+	history, err := ctrl.Service.GetScanStatus(middleware.CurrentTenant(c), scanID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "scan not found")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	scanStatus := history.Status
+
+	dbResult, err := ctrl.Service.GetScanResults(middleware.CurrentTenant(c), scanID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Fetch scan status from internal scan_history
-	var scanStatus string
-	row := ctrl.DB.QueryRow("SELECT status FROM scan_history WHERE id = ?", scanID)
-	if err := row.Scan(&scanStatus); err != nil {
-		// default when not found or error
-		scanStatus = "unknown"
+	// Optional "changes since" section
+	var changes *models.ScanDiff
+	if v := c.Query("compare"); v != "" {
+		fromID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid compare id")
+			return
+		}
+		d, err := ctrl.Service.DiffScans(middleware.CurrentTenant(c), fromID, scanID)
+		if err != nil {
+			logger.Warnf("Report diff %d -> %d failed: %v", fromID, scanID, err)
+		} else {
+			changes = &d
+		}
 	}
 
 	// Compute overall counts and per-table breakdown
 	totalCols := 0
+	flagged := 0
 	typeCounts := make(map[string]int)
 	typeOrder := make([]string, 0)
 
@@ -127,6 +230,9 @@ func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 			ts := tableSummary{Schema: schema.SchemaName, Table: tbl.TableName, TypeCounts: make(map[string]int)}
 			for _, col := range tbl.Columns {
 				totalCols++
+				if col.InjectionSuspected {
+					flagged++
+				}
 				ts.Total++
 				ts.TypeCounts[col.InfoType]++
 				if _, ok := typeCounts[col.InfoType]; !ok {
@@ -139,15 +245,55 @@ func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 	}
 
 	// Build template
-	const tpl = `<!doctype html>
+	const tpl = diff.SectionTemplate + `<!doctype html>
 <html>
 <head><meta charset="utf-8"><title>Scan Report {{.ScanID}}</title>
-<style>body{font-family:Arial,Helvetica,sans-serif}table{border-collapse:collapse;width:100%}th,td{border:1px solid #ddd;padding:8px}th{background:#f2f2f2;text-align:left}</style>
+<style>` + diff.ReportStyle + `</style>
 </head>
 <body>
 	<h1>Scan Report {{.ScanID}}</h1>
 	<p>Scan status: <strong style="color:{{.StatusColor}}">{{.Status}}</strong></p>
 	<p>Total columns scanned: {{.Total}}</p>
+	{{if .Flagged}}<p style="color:red">Columns with suspected prompt injection in sampled data: {{.Flagged}}</p>{{end}}
+
+	{{if .Usage.Calls}}
+	<h2>LLM Usage</h2>
+	<table>
+		<tr><th>Calls</th><th>Prompt tokens</th><th>Completion tokens</th><th>Avg latency (ms)</th><th>Retries</th><th>Errors</th><th>Estimated cost (USD)</th><th>Budget (USD)</th></tr>
+		<tr><td>{{.Usage.Calls}}</td><td>{{.Usage.PromptTokens}}</td><td>{{.Usage.CompletionTokens}}</td><td>{{.Usage.AvgLatencyMs}}</td><td>{{.Usage.Retries}}</td><td>{{.Usage.Errors}}</td><td>{{printf "%.6f" .Usage.CostUSD}}{{if .Usage.CostUnknown}} (incomplete: unpriced model){{end}}</td><td>{{if .Usage.BudgetUSD}}{{printf "%.2f" .Usage.BudgetUSD}}{{if .Usage.BudgetExhausted}} (exhausted){{end}}{{else}}unlimited{{end}}</td></tr>
+	</table>
+	{{end}}
+
+	{{if .Live}}
+	<h2>Live progress</h2>
+	<ul id="live-events"></ul>
+	<script>
+	(function () {
+		var list = document.getElementById("live-events");
+		var source = new EventSource({{if .EventsURL}}{{.EventsURL}}{{else}}window.location.pathname + "/events"{{end}});
+		function add(text) {
+			var li = document.createElement("li");
+			li.textContent = text;
+			list.insertBefore(li, list.firstChild);
+		}
+		function on(type, format) {
+			source.addEventListener(type, function (e) { add(format(JSON.parse(e.data))); });
+		}
+		on("table_started", function (d) { return "Scanning " + d.schema + "." + d.table; });
+		on("table_reused", function (d) { return "Unchanged, reused " + d.schema + "." + d.table; });
+		on("column_classified", function (d) { return d.schema + "." + d.table + "." + d.column + ": " + d.info_type; });
+		on("llm_error", function (d) { return "LLM error on " + d.schema + "." + d.table + "." + d.column + ": " + d.message; });
+		source.addEventListener("scan_finished", function () {
+			source.close();
+			var params = new URLSearchParams(window.location.search);
+			params.delete("live");
+			window.location.search = params.toString();
+		});
+	})();
+	</script>
+	{{end}}
+
+	{{with .Changes}}{{template "diff" .}}{{end}}
 
 	<h2>By Info Type</h2>
 	<table>
@@ -193,8 +339,13 @@ func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 		Status      string
 		StatusColor string
 		Total       int
+		Flagged     int
 		TypeCounts  map[string]int
 		Tables      []tableSummary
+		Usage       models.LLMUsage
+		Changes     *models.ScanDiff
+		Live        bool
+		EventsURL   string
 	}{
 		ScanID: scanID,
 		Status: scanStatus,
@@ -211,14 +362,25 @@ func (ctrl *ScanController) RenderScanReport(c *gin.Context) {
 			}
 		}(),
 		Total:      totalCols,
+		Flagged:    flagged,
 		TypeCounts: typeCounts,
 		Tables:     tables,
+		Usage:      history.LLMUsage,
+		Changes:    changes,
+		Live:       c.Query("live") == "true" && scanStatus == "running",
+	}
+	// EventSource cannot send the API key: outside share links (whose stream is under the link
+	// itself) the report connects to a stream URL signed for this scan
+	if identity, _ := middleware.CurrentIdentity(c); data.Live && identity.Owner != "share" && ctrl.Shares != nil {
+		data.EventsURL = liveEventsURL(ctrl.Shares, middleware.CurrentTenant(c), scanID)
 	}
 
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	if err := t.Execute(c.Writer, data); err != nil {
 		logger.Errorf("template execute error: %v", err)
+		return
 	}
+	middleware.Audit(c, models.AuditReportView, scanID, nil, nil)
 }
 
 // ExecuteScanV2 runs column-based + data sampling classification using LLM
@@ -230,29 +392,47 @@ func (ctrl *ScanController) ExecuteScanV2(c *gin.Context) {
 		return
 	}
 
+	opts, err := scanOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// obtain database connection details from internal DB
-	row := ctrl.DB.QueryRow("SELECT host, port, username, password FROM `external_databases` WHERE id = ?", dbID)
-	var host, username, password string
-	var port int
-	if err := row.Scan(&host, &port, &username, &password); err != nil {
+	tenantID := middleware.CurrentTenant(c)
+	target, err := ctrl.lookupTarget(tenantID, dbID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Database not found"})
 		return
 	}
+	opts.Sampling = sampling.Merge(target.Sampling, opts.Sampling)
 
-	// Always connect to information_schema so the service can query any schema on the server.
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/information_schema", username, password, host, port)
-	externalDB, err := sql.Open("mysql", dsn)
+	scanID, err := ctrl.Service.StartScan(tenantID, dbID, "v2")
+	if quotaRefused(c, err) {
+		return
+	}
 	if err != nil {
+		logger.Errorf("Scan v2 could not start for database id=%d: %v", dbID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer externalDB.Close()
-
-	logger.Infof("Starting scan v2 for database id=%d host=%s port=%d", dbID, host, port)
 
-	scanID, err := ctrl.Service.ExecuteScanV2(dbID, externalDB)
+	externalDB, err := targetdb.Open(target)
 	if err != nil {
 		_ = ctrl.Service.UpdateScanStatus(scanID, "failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer externalDB.Close()
+
+	host, port := targetdb.Address(target)
+	logger.Infof("Starting scan v2 for database id=%d host=%s port=%d sampling=%s", dbID, host, port, opts.Sampling.Strategy)
+	middleware.Audit(c, models.AuditScanStart, scanID, nil, gin.H{"api": "v2", "database_id": dbID, "options": opts})
+
+	if err := ctrl.Service.RunScan(tenantID, dbID, scanID, "v2", externalDB, opts); err != nil {
+		if scanCancelled(c, scanID, err) {
+			return
+		}
 		logger.Errorf("Scan v2 failed for database id=%d: %v", dbID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -261,3 +441,82 @@ func (ctrl *ScanController) ExecuteScanV2(c *gin.Context) {
 	logger.Infof("Scan v2 completed for database id=%d scan_id=%d", dbID, scanID)
 	c.JSON(http.StatusCreated, gin.H{"scan_id": scanID})
 }
+
+// CancelScan stops a running scan of the tenant: POST /scan/:id/cancel. The scan finishes as
+// "cancelled" and the request that started it answers 409.
+func (ctrl *ScanController) CancelScan(c *gin.Context) {
+	scanID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	err = ctrl.Service.CancelScan(middleware.CurrentTenant(c), scanID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "scan not found"})
+		return
+	case errors.Is(err, services.ErrScanNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Infof("Scan scan_id=%d cancelled", scanID)
+	middleware.Audit(c, models.AuditScanCancel, scanID, nil, nil)
+	c.JSON(http.StatusAccepted, gin.H{"scan_id": scanID, "status": "cancelling"})
+}
+
+// scanCancelled answers 409 when a scan was stopped with CancelScan while running.
+func scanCancelled(c *gin.Context, scanID int64, err error) bool {
+	if !errors.Is(err, context.Canceled) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"scan_id": scanID, "status": "cancelled", "error": "scan cancelled"})
+	return true
+}
+
+// quotaRefused answers 429 when a scan quota refused the scan; nothing was started then.
+func quotaRefused(c *gin.Context, err error) bool {
+	var quota *services.QuotaError
+	if !errors.As(err, &quota) {
+		return false
+	}
+	logger.Warnf("Scan refused for tenant %d: %v", middleware.CurrentTenant(c), err)
+	middleware.TooManyRequests(c, quota.RetryAfter, quota.Error())
+	return true
+}
+
+// scanOptionsFromQuery reads optional scan stages from the query string
+// (e.g. ?profile=true&incremental=true&sampling=pk-random).
+func scanOptionsFromQuery(c *gin.Context) (models.ScanOptions, error) {
+	var opts models.ScanOptions
+	if v := c.Query("profile"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid profile value %q", v)
+		}
+		opts.Profile = b
+	}
+	if v := c.Query("incremental"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid incremental value %q", v)
+		}
+		opts.Incremental = b
+	}
+	if v := c.Query("sampling"); v != "" {
+		if _, err := sampling.New(v); err != nil {
+			return opts, err
+		}
+		opts.Sampling.Strategy = v
+	}
+	return opts, nil
+}
+
+// lookupTarget loads the connection, sampling and load settings of a registered database of the tenant.
+func (ctrl *ScanController) lookupTarget(tenantID, dbID int64) (models.Database, error) {
+	return repositories.NewDatabaseRepository(ctrl.DB).GetByID(tenantID, dbID)
+}
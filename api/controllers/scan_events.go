@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment so proxies keep it open.
+const sseKeepAlive = 15 * time.Second
+
+// StreamScanEvents streams the progress of a scan as Server-Sent Events until it finishes.
+// Reconnecting clients send Last-Event-ID to skip the events they already received. A scan
+// that is not running in this process only gets its final status.
+func (ctrl *ScanController) StreamScanEvents(c *gin.Context) {
+	scanID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	// Subscribe before reading the status so an event published in between is not lost
+	sub := ctrl.Service.SubscribeEvents(scanID)
+	defer sub.Close()
+
+	history, err := ctrl.Service.GetScanStatus(middleware.CurrentTenant(c), scanID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scan not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	lastSeq, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, e := range sub.History {
+		if e.Seq > lastSeq {
+			writeSSE(c.Writer, e)
+		}
+	}
+	if len(sub.History) == 0 && history.Status != "running" {
+		// the scan ran before this process started (or on another replica)
+		writeSSE(c.Writer, models.ScanEvent{ScanID: scanID, Type: models.ScanEventFinished, Status: history.Status, Time: time.Now().UTC()})
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeSSE(c.Writer, e)
+		case <-keepAlive.C:
+			_, _ = io.WriteString(c.Writer, ": keep-alive\n\n")
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(w io.Writer, e models.ScanEvent) {
+	data, _ := json.Marshal(e)
+	if e.Seq > 0 {
+		fmt.Fprintf(w, "id: %d\n", e.Seq)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
@@ -4,27 +4,47 @@ import (
 	"database/sql"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
 	"meli-challenge/api/controllers"
+	"meli-challenge/api/events"
+	"meli-challenge/api/middleware"
 	"meli-challenge/api/models"
+	"meli-challenge/api/services"
 )
 
 // DummyScanService implements ScanService for testing
-type DummyScanService struct{}
+type DummyScanService struct {
+	// Bus, when set, serves the scan events
+	Bus *events.Bus
+	// Cancelled lists the scans passed to CancelScan
+	Cancelled []int64
+	// Status is the status of scan 123, "success" when empty
+	Status string
+}
+
+func (d *DummyScanService) StartScan(tenantID, databaseID int64, apiVersion string) (int64, error) {
+	return 123, nil
+}
+
+func (d *DummyScanService) RunScan(tenantID, databaseID, scanID int64, apiVersion string, externalDB *sql.DB, opts models.ScanOptions) error {
+	return nil
+}
 
-func (d *DummyScanService) ExecuteScan(databaseID int64, externalDB *sql.DB) (int64, error) {
+func (d *DummyScanService) ExecuteScan(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error) {
 	return 123, nil
 }
 
-func (d *DummyScanService) ExecuteScanV2(databaseID int64, externalDB *sql.DB) (int64, error) {
+func (d *DummyScanService) ExecuteScanV2(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error) {
 	return 123, nil
 }
 
-func (d *DummyScanService) GetScanResults(scanID int64) (models.DatabaseResult, error) {
+func (d *DummyScanService) GetScanResults(tenantID, scanID int64) (models.DatabaseResult, error) {
 	return models.DatabaseResult{
 		Database: []models.SchemaView{
 			{
@@ -46,6 +66,48 @@ func (d *DummyScanService) UpdateScanStatus(scanID int64, status string) error {
 	return nil
 }
 
+func (d *DummyScanService) DiffScans(tenantID, fromScanID, toScanID int64) (models.ScanDiff, error) {
+	if fromScanID != 120 || toScanID != 123 {
+		return models.ScanDiff{}, sql.ErrNoRows
+	}
+	return models.ScanDiff{FromScanID: 120, ToScanID: 123,
+		ChangedColumns: []models.ColumnChange{{SchemaName: "target_sample_db", TableName: "users", ColumnName: "username", FromInfoType: "N/A", ToInfoType: "USERNAME"}},
+		NewlySensitive: []models.ColumnChange{{SchemaName: "target_sample_db", TableName: "users", ColumnName: "username", FromInfoType: "N/A", ToInfoType: "USERNAME"}},
+	}, nil
+}
+
+func (d *DummyScanService) SubscribeEvents(scanID int64) *events.Subscription {
+	if d.Bus == nil {
+		d.Bus = events.NewBus()
+	}
+	return d.Bus.Subscribe(scanID)
+}
+
+// CancelScan treats scan 123 as running and scan 120 as finished; others do not exist in the tenant.
+func (d *DummyScanService) CancelScan(tenantID, scanID int64) error {
+	switch scanID {
+	case 123:
+		d.Cancelled = append(d.Cancelled, scanID)
+		return nil
+	case 120:
+		return services.ErrScanNotRunning
+	default:
+		return sql.ErrNoRows
+	}
+}
+
+func (d *DummyScanService) GetScanStatus(tenantID, scanID int64) (models.ScanHistory, error) {
+	if scanID != 123 {
+		return models.ScanHistory{}, sql.ErrNoRows
+	}
+	status := d.Status
+	if status == "" {
+		status = "success"
+	}
+	return models.ScanHistory{ID: 123, DatabaseID: 1, Status: status, LLMCacheHits: 7, LLMCacheMisses: 3,
+		LLMUsage: models.LLMUsage{Calls: 3, PromptTokens: 300, CompletionTokens: 12, LatencyMs: 900, CostUSD: 0.0000522}}, nil
+}
+
 func TestGetScanResults(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
@@ -61,3 +123,181 @@ func TestGetScanResults(t *testing.T) {
 	assert.Equal(t, 200, w.Code)
 	assert.Contains(t, w.Body.String(), "USERNAME")
 }
+
+func TestGetScanStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	ctrl := controllers.NewScanController(&DummyScanService{}, nil)
+	r.GET("/api/v1/database/scan/:id/status", ctrl.GetScanStatus)
+
+	req, _ := http.NewRequest("GET", "/api/v1/database/scan/123/status", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"llm_cache_hits":7`)
+	assert.Contains(t, w.Body.String(), `"llm_cache_misses":3`)
+	assert.Contains(t, w.Body.String(), `"llm_prompt_tokens":300`)
+
+	req, _ = http.NewRequest("GET", "/api/v1/database/scan/999/status", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestRenderScanReport_ShowsLLMUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	ctrl := controllers.NewScanController(&DummyScanService{}, nil)
+	r.GET("/api/v1/database/scan/:id/report", ctrl.RenderScanReport)
+
+	req, _ := http.NewRequest("GET", "/api/v1/database/scan/123/report", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "LLM Usage")
+	assert.Contains(t, w.Body.String(), "<td>300</td><td>12</td><td>300</td>") // avg latency 900ms / 3 calls
+}
+
+func TestDiffScans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	ctrl := controllers.NewScanController(&DummyScanService{}, nil)
+	r.GET("/api/v1/scans/diff", ctrl.DiffScans)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scans/diff?from=120&to=123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"newly_sensitive":[{"schema_name":"target_sample_db","table_name":"users","column_name":"username","from_info_type":"N/A","to_info_type":"USERNAME"}]`)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scans/diff?from=120&to=123&format=html", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Newly sensitive columns (1)")
+
+	req, _ = http.NewRequest("GET", "/api/v1/scans/diff?from=1&to=123", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scans/diff?from=abc", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestRenderScanReport_WithCompareShowsChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	ctrl := controllers.NewScanController(&DummyScanService{}, nil)
+	r.GET("/api/v1/database/scan/:id/report", ctrl.RenderScanReport)
+
+	req, _ := http.NewRequest("GET", "/api/v1/database/scan/123/report?compare=120", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Changes since scan 120")
+	assert.Contains(t, w.Body.String(), "<td>target_sample_db.users.username</td><td>N/A</td><td>USERNAME</td>")
+}
+
+func TestStreamScanEvents_ReplaysProgressUntilFinished(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	bus := events.NewBus()
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventStarted, Status: "running"})
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventTableStarted, Schema: "target_sample_db", Table: "users"})
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventColumnClassified, Schema: "target_sample_db", Table: "users", Column: "username", InfoType: "USERNAME"})
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventFinished, Status: "success"})
+	ctrl := controllers.NewScanController(&DummyScanService{Bus: bus}, nil)
+	r.GET("/api/v1/scan/:id/events", ctrl.StreamScanEvents)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scan/123/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.NotContains(t, body, "event: scan_started")
+	assert.Contains(t, body, "id: 2\nevent: table_started\n")
+	assert.Contains(t, body, `"info_type":"USERNAME"`)
+	assert.True(t, strings.HasSuffix(body, "\n\n"))
+	assert.Contains(t, body, "id: 4\nevent: scan_finished\n")
+}
+
+func TestStreamScanEvents_FinishedScanFromAnotherProcess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+
+	ctrl := controllers.NewScanController(&DummyScanService{}, nil)
+	r.GET("/api/v1/scan/:id/events", ctrl.StreamScanEvents)
+
+	req, _ := http.NewRequest("GET", "/api/v1/scan/123/events", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "event: scan_finished\n")
+	assert.Contains(t, w.Body.String(), `"status":"success"`)
+
+	req, _ = http.NewRequest("GET", "/api/v1/scan/999/events", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestRenderScanReport_LiveReportStreamsThroughSignedURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	bus := events.NewBus()
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventTableStarted, Schema: "target_sample_db", Table: "users"})
+	bus.Publish(models.ScanEvent{ScanID: 123, Type: models.ScanEventFinished, Status: "success"})
+	shares := services.NewShareService(nil, nil, []byte("test-share-secret"))
+	ctrl := controllers.NewScanController(&DummyScanService{Bus: bus, Status: "running"}, nil)
+	ctrl.Shares = shares
+	// the authenticated report route, as after the API key middleware
+	r.GET("/api/v1/database/scan/:id/report", func(c *gin.Context) {
+		middleware.SetIdentity(c, models.Identity{TenantID: models.DefaultTenantID, Name: "ana"})
+	}, ctrl.RenderScanReport)
+	r.GET(controllers.LiveEventsPath+":id/events", controllers.NewShareController(shares).AuthorizeEvents, ctrl.StreamScanEvents)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/database/scan/123/report?live=true", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	m := regexp.MustCompile(`new EventSource\("([^"]+)"\)`).FindStringSubmatch(w.Body.String())
+	if !assert.Len(t, m, 2, "the live report embeds a signed stream URL") {
+		return
+	}
+	eventsURL := strings.ReplaceAll(m[1], `\/`, "/")
+	assert.True(t, strings.HasPrefix(eventsURL, controllers.LiveEventsPath+"123/events?token="), eventsURL)
+
+	// the URL opens the stream without the API key
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, eventsURL, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "event: table_started\n")
+
+	// but not without its token, with a forged one, or for another scan
+	token := strings.TrimPrefix(eventsURL, controllers.LiveEventsPath+"123/events?token=")
+	for _, path := range []string{
+		controllers.LiveEventsPath + "123/events",
+		controllers.LiveEventsPath + "123/events?token=" + token + "x",
+		controllers.LiveEventsPath + "124/events?token=" + token,
+	} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleController struct {
+	Service services.ScheduleService
+}
+
+func NewScheduleController(s services.ScheduleService) *ScheduleController {
+	return &ScheduleController{Service: s}
+}
+
+// scheduleRequest is the body of POST/PUT /schedules; enabled defaults to true.
+type scheduleRequest struct {
+	DatabaseID int64              `json:"database_id"`
+	Cron       string             `json:"cron" binding:"required"`
+	Timezone   string             `json:"timezone"`
+	Version    string             `json:"version"`
+	Options    models.ScanOptions `json:"options"`
+	Enabled    *bool              `json:"enabled"`
+}
+
+func (r scheduleRequest) schedule() models.ScanSchedule {
+	s := models.ScanSchedule{DatabaseID: r.DatabaseID, Cron: r.Cron, Timezone: r.Timezone, Version: r.Version, Options: r.Options, Enabled: true}
+	if r.Enabled != nil {
+		s.Enabled = *r.Enabled
+	}
+	return s
+}
+
+func (ctrl *ScheduleController) CreateSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := ctrl.Service.CreateSchedule(middleware.CurrentTenant(c), req.schedule())
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	created, _ := ctrl.Service.GetSchedule(middleware.CurrentTenant(c), id)
+	middleware.Audit(c, models.AuditScheduleCreate, id, nil, created)
+
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (ctrl *ScheduleController) ListSchedules(c *gin.Context) {
+	schedules, err := ctrl.Service.ListSchedules(middleware.CurrentTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func (ctrl *ScheduleController) GetSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	s, err := ctrl.Service.GetSchedule(middleware.CurrentTenant(c), id)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (ctrl *ScheduleController) UpdateSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before, err := ctrl.Service.GetSchedule(middleware.CurrentTenant(c), id)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	if err := ctrl.Service.UpdateSchedule(middleware.CurrentTenant(c), id, req.schedule()); err != nil {
+		scheduleError(c, err)
+		return
+	}
+	s, err := ctrl.Service.GetSchedule(middleware.CurrentTenant(c), id)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditScheduleUpdate, id, before, s)
+	c.JSON(http.StatusOK, s)
+}
+
+func (ctrl *ScheduleController) DeleteSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	before, err := ctrl.Service.GetSchedule(middleware.CurrentTenant(c), id)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	if err := ctrl.Service.DeleteSchedule(middleware.CurrentTenant(c), id); err != nil {
+		scheduleError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditScheduleDelete, id, before, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ListRuns returns the latest runs of a schedule (?limit=, default 50).
+func (ctrl *ScheduleController) ListRuns(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	runs, err := ctrl.Service.ListRuns(middleware.CurrentTenant(c), id, limit)
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func scheduleID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func scheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
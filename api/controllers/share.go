@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SharedReportPath is the public prefix of report share links
+	SharedReportPath = "/api/v1/shared/reports/"
+	// LiveEventsPath is the prefix of the event streams of live reports, authorized by ?token=
+	LiveEventsPath = "/api/v1/live/scan/"
+)
+
+type ShareController struct {
+	Service services.ShareService
+}
+
+func NewShareController(s services.ShareService) *ShareController {
+	return &ShareController{Service: s}
+}
+
+// shareRequest is the body of POST /scan/:id/share; expires_in_hours defaults to 72.
+type shareRequest struct {
+	ExpiresInHours int    `json:"expires_in_hours"`
+	Note           string `json:"note"`
+}
+
+// CreateShare creates a signed link to the report of a scan. The response is the only one
+// that includes the token.
+func (ctrl *ShareController) CreateShare(c *gin.Context) {
+	scanID, ok := shareID(c)
+	if !ok {
+		return
+	}
+	var req shareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.ExpiresInHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_hours must be positive"})
+		return
+	}
+
+	share, err := ctrl.Service.CreateShare(middleware.CurrentTenant(c), scanID, time.Duration(req.ExpiresInHours)*time.Hour, req.Note)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditShareCreate, share.ID, nil, share)
+	share.URL = publicBaseURL(c) + SharedReportPath + share.Token
+	c.JSON(http.StatusCreated, share)
+}
+
+func (ctrl *ShareController) ListShares(c *gin.Context) {
+	scanID, ok := shareID(c)
+	if !ok {
+		return
+	}
+	shares, err := ctrl.Service.ListShares(middleware.CurrentTenant(c), scanID)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+func (ctrl *ShareController) RevokeShare(c *gin.Context) {
+	id, ok := shareID(c)
+	if !ok {
+		return
+	}
+	if err := ctrl.Service.RevokeShare(middleware.CurrentTenant(c), id); err != nil {
+		shareError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditShareRevoke, id, nil, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ListAccesses returns the latest accesses through a share link (?limit=, default 50).
+func (ctrl *ShareController) ListAccesses(c *gin.Context) {
+	id, ok := shareID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	accesses, err := ctrl.Service.ListAccesses(middleware.CurrentTenant(c), id, limit)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, accesses)
+}
+
+// Authorize checks the :token of a share link, records the access and hands the request to
+// the report handlers as if it were for /database/scan/:id, with "share:<id>" of the link's
+// tenant as the caller.
+// ?compare is dropped so a link only discloses the shared scan.
+func (ctrl *ShareController) Authorize(c *gin.Context) {
+	ua := c.Request.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	access := models.ReportShareAccess{IP: c.ClientIP(), UserAgent: ua, Path: c.FullPath()}
+	share, err := ctrl.Service.OpenShare(c.Param("token"), access)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrShareExpired), errors.Is(err, services.ErrShareRevoked):
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidShare):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "report not found"})
+		return
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	q := c.Request.URL.Query()
+	q.Del("compare")
+	c.Request.URL.RawQuery = q.Encode()
+	c.Params = append(c.Params, gin.Param{Key: "id", Value: strconv.FormatInt(share.ScanID, 10)})
+	middleware.SetIdentity(c, models.Identity{TenantID: share.TenantID, Name: "share:" + strconv.FormatInt(share.ID, 10), Owner: "share"})
+	c.Next()
+}
+
+// AuthorizeEvents checks the ?token of the event stream URL embedded in a live report and
+// hands the request to StreamScanEvents with "events:<scan id>" of the token's tenant as the
+// caller. The token only opens the stream of the scan it was signed for.
+func (ctrl *ShareController) AuthorizeEvents(c *gin.Context) {
+	tenantID, scanID, err := ctrl.Service.OpenEventsToken(c.Query("token"))
+	if err == nil && c.Param("id") != strconv.FormatInt(scanID, 10) {
+		err = services.ErrInvalidEventsToken
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.SetIdentity(c, models.Identity{TenantID: tenantID, Name: "events:" + strconv.FormatInt(scanID, 10), Owner: "events"})
+	c.Next()
+}
+
+// liveEventsURL is the stream URL a live report served to an API caller connects to.
+func liveEventsURL(shares services.ShareService, tenantID, scanID int64) string {
+	return LiveEventsPath + strconv.FormatInt(scanID, 10) + "/events?token=" + url.QueryEscape(shares.EventsToken(tenantID, scanID))
+}
+
+func shareID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// publicBaseURL is PUBLIC_BASE_URL, or the scheme and host the request came in with.
+func publicBaseURL(c *gin.Context) string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func shareError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidShare):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
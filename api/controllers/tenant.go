@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantController struct {
+	Service services.TenantService
+}
+
+func NewTenantController(s services.TenantService) *TenantController {
+	return &TenantController{Service: s}
+}
+
+// CreateTenant creates a tenant. Without rule_packs it inherits the baseline pack.
+func (ctrl *TenantController) CreateTenant(c *gin.Context) {
+	var req models.Tenant
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	created, err := ctrl.Service.CreateTenant(req)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditTenantCreate, created.ID, nil, created)
+	c.JSON(http.StatusCreated, created)
+}
+
+func (ctrl *TenantController) ListTenants(c *gin.Context) {
+	tenants, err := ctrl.Service.ListTenants()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
+
+func (ctrl *TenantController) GetTenant(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctrl.respondTenant(c, id)
+}
+
+// CurrentTenant returns the caller's tenant and the rule packs it inherits
+func (ctrl *TenantController) CurrentTenant(c *gin.Context) {
+	ctrl.respondTenant(c, middleware.CurrentTenant(c))
+}
+
+// SetRulePacks replaces the global rule packs the caller's tenant inherits
+func (ctrl *TenantController) SetRulePacks(c *gin.Context) {
+	var req struct {
+		RulePacks []int64 `json:"rule_packs" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantID := middleware.CurrentTenant(c)
+	before, err := ctrl.Service.GetTenant(tenantID)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+	if err := ctrl.Service.SetRulePacks(tenantID, req.RulePacks); err != nil {
+		tenantError(c, err)
+		return
+	}
+	after, err := ctrl.Service.GetTenant(tenantID)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditTenantPacks, tenantID, before, after)
+	c.JSON(http.StatusOK, after)
+}
+
+func (ctrl *TenantController) respondTenant(c *gin.Context, id int64) {
+	t, err := ctrl.Service.GetTenant(id)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func tenantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTenant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
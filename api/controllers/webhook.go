@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	Service services.WebhookService
+}
+
+func NewWebhookController(s services.WebhookService) *WebhookController {
+	return &WebhookController{Service: s}
+}
+
+// webhookRequest is the body of POST /webhooks; enabled defaults to true.
+type webhookRequest struct {
+	DatabaseID *int64   `json:"database_id"`
+	URL        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret"`
+	Events     []string `json:"events"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// CreateWebhook registers a webhook. The response is the only one that includes the secret.
+func (ctrl *WebhookController) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w := models.Webhook{DatabaseID: req.DatabaseID, URL: req.URL, Secret: req.Secret, Events: req.Events, Enabled: true}
+	if req.Enabled != nil {
+		w.Enabled = *req.Enabled
+	}
+
+	created, err := ctrl.Service.CreateWebhook(middleware.CurrentTenant(c), w)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditWebhookCreate, created.ID, nil, created)
+	c.JSON(http.StatusCreated, created)
+}
+
+func (ctrl *WebhookController) ListWebhooks(c *gin.Context) {
+	hooks, err := ctrl.Service.ListWebhooks(middleware.CurrentTenant(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+func (ctrl *WebhookController) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	w, err := ctrl.Service.GetWebhook(middleware.CurrentTenant(c), id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+func (ctrl *WebhookController) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	before, err := ctrl.Service.GetWebhook(middleware.CurrentTenant(c), id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	if err := ctrl.Service.DeleteWebhook(middleware.CurrentTenant(c), id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	middleware.Audit(c, models.AuditWebhookDelete, id, before, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries returns the latest delivery attempts of a webhook (?limit=, default 50).
+func (ctrl *WebhookController) ListDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	deliveries, err := ctrl.Service.ListDeliveries(middleware.CurrentTenant(c), id, limit)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func webhookID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
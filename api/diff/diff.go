@@ -0,0 +1,106 @@
+// Package diff compares the results of two scans.
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"meli-challenge/api/models"
+)
+
+// Sensitive reports whether an info type denotes sensitive data: anything but "N/A" and the
+// UNCLASSIFIED_* markers.
+func Sensitive(infoType string) bool {
+	return infoType != "" && infoType != "N/A" && !strings.HasPrefix(infoType, "UNCLASSIFIED")
+}
+
+type columnKey struct{ schema, table, column string }
+
+type tableKey struct{ schema, table string }
+
+// Compare lists what changed between the results of scan fromID and scan toID. Columns of
+// added or removed tables are not repeated in AddedColumns/RemovedColumns.
+func Compare(fromID int64, from []models.ScanResult, toID int64, to []models.ScanResult) models.ScanDiff {
+	d := models.ScanDiff{
+		FromScanID:     fromID,
+		ToScanID:       toID,
+		AddedTables:    []models.TableRef{},
+		RemovedTables:  []models.TableRef{},
+		AddedColumns:   []models.ColumnChange{},
+		RemovedColumns: []models.ColumnChange{},
+		ChangedColumns: []models.ColumnChange{},
+		NewlySensitive: []models.ColumnChange{},
+	}
+
+	oldCols, oldTables := index(from)
+	newCols, newTables := index(to)
+
+	for t := range newTables {
+		if !oldTables[t] {
+			d.AddedTables = append(d.AddedTables, models.TableRef{SchemaName: t.schema, TableName: t.table})
+		}
+	}
+	for t := range oldTables {
+		if !newTables[t] {
+			d.RemovedTables = append(d.RemovedTables, models.TableRef{SchemaName: t.schema, TableName: t.table})
+		}
+	}
+
+	for k, newType := range newCols {
+		oldType, existed := oldCols[k]
+		change := models.ColumnChange{SchemaName: k.schema, TableName: k.table, ColumnName: k.column, FromInfoType: oldType, ToInfoType: newType}
+		switch {
+		case !existed && oldTables[tableKey{k.schema, k.table}]:
+			d.AddedColumns = append(d.AddedColumns, change)
+		case existed && oldType != newType:
+			d.ChangedColumns = append(d.ChangedColumns, change)
+		}
+		if Sensitive(newType) && !Sensitive(oldType) {
+			d.NewlySensitive = append(d.NewlySensitive, change)
+		}
+	}
+	for k, oldType := range oldCols {
+		if _, ok := newCols[k]; !ok && newTables[tableKey{k.schema, k.table}] {
+			d.RemovedColumns = append(d.RemovedColumns, models.ColumnChange{SchemaName: k.schema, TableName: k.table, ColumnName: k.column, FromInfoType: oldType})
+		}
+	}
+
+	sortTables(d.AddedTables)
+	sortTables(d.RemovedTables)
+	for _, cs := range [][]models.ColumnChange{d.AddedColumns, d.RemovedColumns, d.ChangedColumns, d.NewlySensitive} {
+		sortColumns(cs)
+	}
+	return d
+}
+
+func index(results []models.ScanResult) (map[columnKey]string, map[tableKey]bool) {
+	cols := make(map[columnKey]string, len(results))
+	tables := make(map[tableKey]bool)
+	for _, r := range results {
+		cols[columnKey{r.SchemaName, r.TableName, r.ColumnName}] = r.InfoType
+		tables[tableKey{r.SchemaName, r.TableName}] = true
+	}
+	return cols, tables
+}
+
+func sortTables(ts []models.TableRef) {
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].SchemaName != ts[j].SchemaName {
+			return ts[i].SchemaName < ts[j].SchemaName
+		}
+		return ts[i].TableName < ts[j].TableName
+	})
+}
+
+func sortColumns(cs []models.ColumnChange) {
+	sort.Slice(cs, func(i, j int) bool {
+		a, b := cs[i], cs[j]
+		if a.SchemaName != b.SchemaName {
+			return a.SchemaName < b.SchemaName
+		}
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		return a.ColumnName < b.ColumnName
+	})
+}
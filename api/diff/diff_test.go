@@ -0,0 +1,52 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/diff"
+	"meli-challenge/api/models"
+)
+
+func TestCompare(t *testing.T) {
+	from := []models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "email", InfoType: "EMAIL_ADDRESS"},
+		{SchemaName: "shop", TableName: "users", ColumnName: "nick", InfoType: "N/A"},
+		{SchemaName: "shop", TableName: "users", ColumnName: "fax", InfoType: "N/A"},
+		{SchemaName: "shop", TableName: "legacy", ColumnName: "ssn", InfoType: "SSN"},
+	}
+	to := []models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "email", InfoType: "EMAIL_ADDRESS"},
+		{SchemaName: "shop", TableName: "users", ColumnName: "nick", InfoType: "USERNAME"},
+		{SchemaName: "shop", TableName: "users", ColumnName: "phone", InfoType: "PHONE_NUMBER"},
+		{SchemaName: "shop", TableName: "payments", ColumnName: "card", InfoType: "CREDIT_CARD_NUMBER"},
+		{SchemaName: "shop", TableName: "payments", ColumnName: "amount", InfoType: "N/A"},
+	}
+
+	d := diff.Compare(1, from, 2, to)
+
+	assert.Equal(t, []models.TableRef{{SchemaName: "shop", TableName: "payments"}}, d.AddedTables)
+	assert.Equal(t, []models.TableRef{{SchemaName: "shop", TableName: "legacy"}}, d.RemovedTables)
+	assert.Equal(t, []models.ColumnChange{{SchemaName: "shop", TableName: "users", ColumnName: "phone", ToInfoType: "PHONE_NUMBER"}}, d.AddedColumns)
+	assert.Equal(t, []models.ColumnChange{{SchemaName: "shop", TableName: "users", ColumnName: "fax", FromInfoType: "N/A"}}, d.RemovedColumns)
+	assert.Equal(t, []models.ColumnChange{{SchemaName: "shop", TableName: "users", ColumnName: "nick", FromInfoType: "N/A", ToInfoType: "USERNAME"}}, d.ChangedColumns)
+
+	var sensitive []string
+	for _, c := range d.NewlySensitive {
+		sensitive = append(sensitive, c.TableName+"."+c.ColumnName)
+	}
+	assert.Equal(t, []string{"payments.card", "users.nick", "users.phone"}, sensitive)
+	assert.False(t, d.Empty())
+}
+
+func TestCompare_IdenticalScansAndUnclassified(t *testing.T) {
+	same := []models.ScanResult{{SchemaName: "s", TableName: "t", ColumnName: "c", InfoType: "SSN"}}
+	assert.True(t, diff.Compare(1, same, 2, same).Empty())
+
+	// an LLM error is a change, but not a newly sensitive column
+	d := diff.Compare(1, []models.ScanResult{{SchemaName: "s", TableName: "t", ColumnName: "c", InfoType: "N/A"}},
+		2, []models.ScanResult{{SchemaName: "s", TableName: "t", ColumnName: "c", InfoType: models.InfoTypeClassificationError}})
+	assert.Len(t, d.ChangedColumns, 1)
+	assert.Empty(t, d.NewlySensitive)
+}
@@ -0,0 +1,68 @@
+package diff
+
+import (
+	"html/template"
+	"io"
+
+	"meli-challenge/api/models"
+)
+
+// ReportStyle is the stylesheet shared by the scan report and the diff pages.
+const ReportStyle = `body{font-family:Arial,Helvetica,sans-serif}table{border-collapse:collapse;width:100%}th,td{border:1px solid #ddd;padding:8px}th{background:#f2f2f2;text-align:left}`
+
+// SectionTemplate renders a models.ScanDiff as an HTML section; it is embedded in the scan report.
+const SectionTemplate = `{{define "diff"}}
+	<h2>Changes since scan {{.FromScanID}}</h2>
+	{{if .Empty}}<p>No changes between scan {{.FromScanID}} and scan {{.ToScanID}}.</p>{{else}}
+	{{if .NewlySensitive}}
+	<h3 style="color:red">Newly sensitive columns ({{len .NewlySensitive}})</h3>
+	<table>
+		<tr><th>Column</th><th>Before</th><th>Now</th></tr>
+		{{range .NewlySensitive}}<tr><td>{{.SchemaName}}.{{.TableName}}.{{.ColumnName}}</td><td>{{if .FromInfoType}}{{.FromInfoType}}{{else}}(new){{end}}</td><td>{{.ToInfoType}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{if .ChangedColumns}}
+	<h3>Info type changes ({{len .ChangedColumns}})</h3>
+	<table>
+		<tr><th>Column</th><th>Before</th><th>Now</th></tr>
+		{{range .ChangedColumns}}<tr><td>{{.SchemaName}}.{{.TableName}}.{{.ColumnName}}</td><td>{{.FromInfoType}}</td><td>{{.ToInfoType}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{if or .AddedTables .RemovedTables}}
+	<h3>Tables</h3>
+	<table>
+		<tr><th>Table</th><th>Change</th></tr>
+		{{range .AddedTables}}<tr><td>{{.SchemaName}}.{{.TableName}}</td><td>added</td></tr>
+		{{end}}{{range .RemovedTables}}<tr><td>{{.SchemaName}}.{{.TableName}}</td><td>removed</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{if or .AddedColumns .RemovedColumns}}
+	<h3>Columns</h3>
+	<table>
+		<tr><th>Column</th><th>Change</th><th>Info Type</th></tr>
+		{{range .AddedColumns}}<tr><td>{{.SchemaName}}.{{.TableName}}.{{.ColumnName}}</td><td>added</td><td>{{.ToInfoType}}</td></tr>
+		{{end}}{{range .RemovedColumns}}<tr><td>{{.SchemaName}}.{{.TableName}}.{{.ColumnName}}</td><td>removed</td><td>{{.FromInfoType}}</td></tr>
+		{{end}}
+	</table>
+	{{end}}
+	{{end}}
+{{end}}`
+
+var page = template.Must(template.New("page").Parse(SectionTemplate + `<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Scan Diff {{.FromScanID}} → {{.ToScanID}}</title>
+<style>` + ReportStyle + `</style>
+</head>
+<body>
+	<h1>Scan Diff {{.FromScanID}} → {{.ToScanID}}</h1>
+	{{template "diff" .}}
+</body>
+</html>`))
+
+// WriteHTML renders d as a standalone HTML page.
+func WriteHTML(w io.Writer, d models.ScanDiff) error {
+	return page.Execute(w, d)
+}
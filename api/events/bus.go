@@ -0,0 +1,136 @@
+// Package events is an in-process bus for scan progress. Scans publish to it as they work and
+// HTTP handlers subscribe to stream the events to clients.
+//
+// The bus keeps the recent events of each scan so late subscribers (or reconnecting ones) can
+// catch up. It is per process: with several API replicas only the replica running a scan sees
+// its events.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"meli-challenge/api/models"
+)
+
+const (
+	// maxHistory caps the events kept per scan; older ones are dropped first
+	maxHistory = 1000
+	// keepFinished is how many finished scans keep their history
+	keepFinished = 100
+	// subscriberBuffer is the backlog a slow subscriber may accumulate before losing events
+	subscriberBuffer = 256
+)
+
+type stream struct {
+	seq     int64
+	history []models.ScanEvent
+	subs    map[chan models.ScanEvent]struct{}
+	done    bool
+}
+
+// Bus fans out scan events to subscribers. The zero value is not usable; use NewBus.
+type Bus struct {
+	mu       sync.Mutex
+	scans    map[int64]*stream
+	finished []int64 // finished scans, oldest first
+}
+
+func NewBus() *Bus {
+	return &Bus{scans: make(map[int64]*stream)}
+}
+
+// Subscription receives the events of one scan.
+type Subscription struct {
+	// History holds the events published before Subscribe, oldest first
+	History []models.ScanEvent
+	// C delivers later events; it is closed after the scan_finished event or by Close
+	C <-chan models.ScanEvent
+
+	bus    *Bus
+	scanID int64
+	ch     chan models.ScanEvent
+}
+
+// Publish stamps e with its sequence number (and time, if unset) and delivers it. It never
+// blocks: a subscriber whose buffer is full misses the event.
+func (b *Bus) Publish(e models.ScanEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stream(e.ScanID)
+	if s.done {
+		return
+	}
+	s.seq++
+	e.Seq = s.seq
+	s.history = append(s.history, e)
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+	for ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+
+	if e.Type == models.ScanEventFinished {
+		s.done = true
+		for ch := range s.subs {
+			close(ch)
+		}
+		s.subs = nil
+		b.finished = append(b.finished, e.ScanID)
+		if len(b.finished) > keepFinished {
+			delete(b.scans, b.finished[0])
+			b.finished = b.finished[1:]
+		}
+	}
+}
+
+// Subscribe returns the events of scanID published so far and a channel with the next ones.
+// The caller must Close the subscription.
+func (b *Bus) Subscribe(scanID int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stream(scanID)
+
+	ch := make(chan models.ScanEvent, subscriberBuffer)
+	sub := &Subscription{History: append([]models.ScanEvent(nil), s.history...), C: ch, bus: b, scanID: scanID, ch: ch}
+	if s.done {
+		close(ch)
+	} else {
+		s.subs[ch] = struct{}{}
+	}
+	return sub
+}
+
+// Close stops the subscription; it is safe to call more than once.
+func (sub *Subscription) Close() {
+	b := sub.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.scans[sub.scanID]; ok && s.subs != nil {
+		if _, ok := s.subs[sub.ch]; ok {
+			delete(s.subs, sub.ch)
+			close(sub.ch)
+		}
+	}
+	// streams of scans this process never ran only exist for their subscribers
+	if s, ok := b.scans[sub.scanID]; ok && !s.done && s.seq == 0 && len(s.subs) == 0 {
+		delete(b.scans, sub.scanID)
+	}
+}
+
+func (b *Bus) stream(scanID int64) *stream {
+	s, ok := b.scans[scanID]
+	if !ok {
+		s = &stream{subs: make(map[chan models.ScanEvent]struct{})}
+		b.scans[scanID] = s
+	}
+	return s
+}
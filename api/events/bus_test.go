@@ -0,0 +1,62 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/events"
+	"meli-challenge/api/models"
+)
+
+func TestBus_ReplaysHistoryAndStreamsUntilFinished(t *testing.T) {
+	bus := events.NewBus()
+	bus.Publish(models.ScanEvent{ScanID: 1, Type: models.ScanEventStarted})
+	bus.Publish(models.ScanEvent{ScanID: 2, Type: models.ScanEventStarted})
+
+	sub := bus.Subscribe(1)
+	defer sub.Close()
+	require.Len(t, sub.History, 1)
+	assert.Equal(t, int64(1), sub.History[0].Seq)
+	assert.False(t, sub.History[0].Time.IsZero())
+
+	bus.Publish(models.ScanEvent{ScanID: 1, Type: models.ScanEventTableStarted, Table: "users"})
+	bus.Publish(models.ScanEvent{ScanID: 1, Type: models.ScanEventFinished, Status: "success"})
+	bus.Publish(models.ScanEvent{ScanID: 1, Type: models.ScanEventTableStarted, Table: "late"})
+
+	var got []models.ScanEvent
+	for e := range sub.C {
+		got = append(got, e)
+	}
+	require.Len(t, got, 2)
+	assert.Equal(t, "users", got[0].Table)
+	assert.Equal(t, int64(2), got[0].Seq)
+	assert.Equal(t, models.ScanEventFinished, got[1].Type)
+}
+
+func TestBus_SubscribeAfterFinishGetsHistoryAndClosedChannel(t *testing.T) {
+	bus := events.NewBus()
+	bus.Publish(models.ScanEvent{ScanID: 7, Type: models.ScanEventStarted})
+	bus.Publish(models.ScanEvent{ScanID: 7, Type: models.ScanEventFinished, Status: "failed"})
+
+	sub := bus.Subscribe(7)
+	sub.Close()
+	sub.Close()
+
+	assert.Len(t, sub.History, 2)
+	_, open := <-sub.C
+	assert.False(t, open)
+}
+
+func TestBus_SlowSubscriberDoesNotBlockPublisher(t *testing.T) {
+	bus := events.NewBus()
+	sub := bus.Subscribe(3)
+	defer sub.Close()
+
+	for i := 0; i < 1000; i++ {
+		bus.Publish(models.ScanEvent{ScanID: 3, Type: models.ScanEventColumnClassified})
+	}
+
+	assert.Len(t, sub.C, cap(sub.C))
+}
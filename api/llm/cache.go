@@ -0,0 +1,23 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// CacheKey builds the lookup key for a cached classification. It hashes every input that can
+// change the LLM answer: the column name and data type, the shape fingerprint of its samples,
+// the list of categories offered to the model and the model name itself.
+func CacheKey(column, dataType, shapeFingerprint string, categories []string, model string) string {
+	cats := append([]string(nil), categories...)
+	sort.Strings(cats)
+
+	h := sha256.New()
+	for _, part := range []string{column, dataType, shapeFingerprint, strings.Join(cats, ","), model} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
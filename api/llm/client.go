@@ -4,27 +4,71 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
+
+	"meli-challenge/config"
 )
 
 // LLMClient defines the behavior for any LLM provider (OpenAI, Gemini, etc.)
 type LLMClient interface {
-	// ClassifySample receives a data row sample and a list of classification categories.
-	// It should return the matched InfoType or "N/A".
-	ClassifySample(ctx context.Context, sample string, rules []string) (string, error)
+	// ClassifySample receives a column sample and a list of classification categories.
+	// It should return the matched InfoType or "N/A", plus the token usage of the call.
+	// Implementations must keep sample data apart from instructions (see BuildMessages).
+	ClassifySample(ctx context.Context, sample ColumnSample, rules []string) (string, Usage, error)
+	// Model returns the model name used for classification (part of the cache key).
+	Model() string
 }
 
-// NewLLMClientFromEnv selects provider and initializes it from environment variables.
-//   - LLM_PROVIDER=openai|gemini
+// NewLLMClientFromEnv selects provider and initializes it from environment variables, wrapped
+// with retries, a circuit breaker and an optional fallback provider.
+//   - LLM_PROVIDER=openai|fake (fake answers from DefaultFakeRules, for offline development)
 //   - LLM_MODEL=model-name
+//   - LLM_FALLBACK_PROVIDER, LLM_FALLBACK_MODEL, LLM_FALLBACK_API_KEY, LLM_FALLBACK_BASE_URL
+//   - LLM_TIMEOUT_MS (per attempt), LLM_MAX_RETRIES, LLM_RETRY_BASE_MS, LLM_RETRY_MAX_MS
+//   - LLM_BREAKER_THRESHOLD (0 disables), LLM_BREAKER_COOLDOWN_MS
+//   - LLM_CA_BUNDLE, LLM_PROXY_URL, LLM_TLS_INSECURE_SKIP_VERIFY (see HTTPConfig)
 func NewLLMClientFromEnv() (LLMClient, error) {
-	provider := os.Getenv("LLM_PROVIDER")
+	httpCfg := HTTPConfigFromEnv()
+	primary, err := newProvider(os.Getenv("LLM_PROVIDER"), os.Getenv("OPENAI_API_KEY"), os.Getenv("LLM_MODEL"), os.Getenv("OPENAI_BASE_URL"), httpCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback LLMClient
+	if provider := os.Getenv("LLM_FALLBACK_PROVIDER"); provider != "" {
+		apiKey := os.Getenv("LLM_FALLBACK_API_KEY")
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		fallback, err = newProvider(provider, apiKey, os.Getenv("LLM_FALLBACK_MODEL"), os.Getenv("LLM_FALLBACK_BASE_URL"), httpCfg)
+		if err != nil {
+			return nil, fmt.Errorf("fallback provider: %w", err)
+		}
+	}
+
+	cfg := ResilienceConfig{
+		Retry: RetryPolicy{
+			MaxRetries: config.EnvInt("LLM_MAX_RETRIES", 3, 0),
+			BaseDelay:  time.Duration(config.EnvInt("LLM_RETRY_BASE_MS", 500, 0)) * time.Millisecond,
+			MaxDelay:   time.Duration(config.EnvInt("LLM_RETRY_MAX_MS", 10000, 0)) * time.Millisecond,
+		},
+		AttemptTimeout:   time.Duration(config.EnvInt("LLM_TIMEOUT_MS", 8000, 0)) * time.Millisecond,
+		BreakerThreshold: config.EnvInt("LLM_BREAKER_THRESHOLD", 5, 0),
+		BreakerCooldown:  time.Duration(config.EnvInt("LLM_BREAKER_COOLDOWN_MS", 30000, 0)) * time.Millisecond,
+	}
+	return NewResilientClient(primary, fallback, cfg), nil
+}
+
+func newProvider(provider, apiKey, model, baseURL string, httpCfg HTTPConfig) (LLMClient, error) {
 	if provider == "" {
 		provider = "openai" // default provider
 	}
 
 	switch provider {
 	case "openai":
-		return NewOpenAIClient(), nil
+		return newOpenAIClient(apiKey, model, baseURL, httpCfg)
+	case "fake":
+		return NewFakeClient(model).WithRules(DefaultFakeRules()...), nil
 	// case "gemini":
 	//	return NewGeminiClient(), nil
 	default:
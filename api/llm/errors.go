@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("llm provider circuit breaker is open")
+
+// ProviderError wraps an error returned by an LLM provider with the HTTP details needed to decide on retries.
+type ProviderError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("llm provider error (status %d): %v", e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("llm provider error: %v", e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether err is transient: rate limiting (429), server errors (5xx),
+// timeouts and transport failures such as refused connections, DNS errors or resets. A provider
+// that cannot be reached at all must count against its circuit breaker, so traffic moves to
+// the fallback. Failed certificate checks are not transient.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) && pe.StatusCode > 0 {
+		return pe.StatusCode == http.StatusTooManyRequests || pe.StatusCode >= 500
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	// *url.Error, *net.OpError and *net.DNSError all implement net.Error; a response with a
+	// status code was handled above
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// RetryAfterOf returns the Retry-After hint carried by err, or 0.
+func RetryAfterOf(err error) time.Duration {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.RetryAfter
+	}
+	return 0
+}
+
+// ParseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func ParseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
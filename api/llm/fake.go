@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FakeResponse is a scripted answer of the FakeClient. A non-nil Err is returned instead of Label,
+// after waiting Delay (or until the context is done).
+type FakeResponse struct {
+	Label string
+	Err   error
+	Delay time.Duration
+	Usage Usage
+}
+
+// FakeRule labels a column when its name matches Column or any sample value matches Value.
+// Rules only answer with categories that were offered in the request.
+type FakeRule struct {
+	Column *regexp.Regexp
+	Value  *regexp.Regexp
+	Label  string
+}
+
+// DefaultFakeRules recognise common PII shapes in sample values; used for offline development.
+func DefaultFakeRules() []FakeRule {
+	return []FakeRule{
+		{Value: regexp.MustCompile(`^[\w.+-]+@[\w-]+(\.[\w-]+)+$`), Label: "EMAIL_ADDRESS"},
+		{Value: regexp.MustCompile(`^\d{3}-\d{2}-\d{4}$`), Label: "SSN"},
+		{Value: regexp.MustCompile(`^\d{4}([ -]?\d{4}){3}$`), Label: "CREDIT_CARD_NUMBER"},
+		{Value: regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}$`), Label: "IP_ADDRESS"},
+		{Value: regexp.MustCompile(`^([0-9a-fA-F]{2}[:-]){5}[0-9a-fA-F]{2}$`), Label: "MAC_ADDRESS"},
+		{Value: regexp.MustCompile(`^\+?[\d() -]{7,20}$`), Label: "PHONE_NUMBER"},
+		{Value: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([ T]\d{2}:\d{2}(:\d{2})?)?$`), Label: "DATE"},
+	}
+}
+
+// FakeClient is a deterministic, scriptable LLMClient for tests and offline development.
+// Responses are resolved in order: per-column scripts (consumed one by one, the last one
+// repeats), then rules, then the default response.
+type FakeClient struct {
+	model string
+
+	mu          sync.Mutex
+	scripts     map[string][]FakeResponse
+	rules       []FakeRule
+	def         FakeResponse
+	calls       []ColumnSample
+	inFlight    int
+	maxInFlight int
+}
+
+func NewFakeClient(model string) *FakeClient {
+	if model == "" {
+		model = "fake"
+	}
+	return &FakeClient{model: model, scripts: make(map[string][]FakeResponse), def: FakeResponse{Label: "N/A"}}
+}
+
+// On scripts the responses returned for a column, in order.
+func (f *FakeClient) On(column string, responses ...FakeResponse) *FakeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[column] = append(f.scripts[column], responses...)
+	return f
+}
+
+// WithRules appends rule-based answers.
+func (f *FakeClient) WithRules(rules ...FakeRule) *FakeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, rules...)
+	return f
+}
+
+// Default sets the response used when no script or rule applies.
+func (f *FakeClient) Default(resp FakeResponse) *FakeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.def = resp
+	return f
+}
+
+func (f *FakeClient) Model() string {
+	return f.model
+}
+
+// Calls returns the samples received so far.
+func (f *FakeClient) Calls() []ColumnSample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ColumnSample(nil), f.calls...)
+}
+
+// MaxConcurrent returns the highest number of calls that were in flight at the same time.
+func (f *FakeClient) MaxConcurrent() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maxInFlight
+}
+
+func (f *FakeClient) ClassifySample(ctx context.Context, sample ColumnSample, rules []string) (string, Usage, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, sample)
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	resp := f.resolve(sample, rules)
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-ctx.Done():
+			return "", Usage{Model: f.model}, ctx.Err()
+		}
+	}
+
+	usage := resp.Usage
+	usage.Model = f.model
+	if resp.Err != nil {
+		return "", usage, resp.Err
+	}
+	return resp.Label, usage, nil
+}
+
+// resolve picks the response for sample; f.mu must be held.
+func (f *FakeClient) resolve(sample ColumnSample, categories []string) FakeResponse {
+	if script := f.scripts[sample.Column]; len(script) > 0 {
+		resp := script[0]
+		if len(script) > 1 {
+			f.scripts[sample.Column] = script[1:]
+		}
+		return resp
+	}
+
+	offered := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		offered[c] = true
+	}
+	for _, r := range f.rules {
+		if !offered[r.Label] {
+			continue
+		}
+		if r.Column != nil && r.Column.MatchString(sample.Column) {
+			return FakeResponse{Label: r.Label}
+		}
+		if r.Value != nil {
+			for _, v := range sample.Values {
+				if r.Value.MatchString(v) {
+					return FakeResponse{Label: r.Label}
+				}
+			}
+		}
+	}
+	return f.def
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"meli-challenge/logger"
+)
+
+// NewFakeServer returns an http.Handler that speaks the OpenAI chat-completions protocol
+// (POST /v1/chat/completions) and answers by delegating to client, usually a FakeClient.
+// Errors of type *ProviderError are returned with their HTTP status and Retry-After header,
+// so the real OpenAIClient (and its retry logic) can be exercised without network access.
+func NewFakeServer(client LLMClient) http.Handler {
+	var seq int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeFakeError(w, http.StatusMethodNotAllowed, 0, "method not allowed")
+			return
+		}
+
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeFakeError(w, http.StatusBadRequest, 0, "invalid JSON body")
+			return
+		}
+
+		var categories []string
+		var sample ColumnSample
+		var found bool
+		for _, m := range req.Messages {
+			switch m.Role {
+			case "system":
+				categories = ParseCategories(m.Content)
+			case "user":
+				if s, err := ParseSampleBlock(m.Content); err == nil {
+					sample, found = s, true
+				}
+			}
+		}
+		if !found {
+			writeFakeError(w, http.StatusBadRequest, 0, "no <column_sample> block in user message")
+			return
+		}
+
+		label, usage, err := client.ClassifySample(r.Context(), sample, categories)
+		if err != nil {
+			var pe *ProviderError
+			if errors.As(err, &pe) && pe.StatusCode > 0 {
+				writeFakeError(w, pe.StatusCode, pe.RetryAfter, pe.Err.Error())
+				return
+			}
+			writeFakeError(w, http.StatusInternalServerError, 0, err.Error())
+			return
+		}
+
+		if usage.TotalTokens == 0 {
+			// Rough but deterministic token estimate (~4 characters per token)
+			for _, m := range req.Messages {
+				usage.PromptTokens += len(m.Content)/4 + 1
+			}
+			usage.CompletionTokens = len(label)/4 + 1
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+
+		id := atomic.AddInt64(&seq, 1)
+		resp := map[string]any{
+			"id":      "chatcmpl-fake-" + strconv.FormatInt(id, 10),
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   req.Model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": label},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]int{
+				"prompt_tokens":     usage.PromptTokens,
+				"completion_tokens": usage.CompletionTokens,
+				"total_tokens":      usage.TotalTokens,
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Errorf("fake LLM server: encode response: %v", err)
+		}
+	})
+	return mux
+}
+
+func writeFakeError(w http.ResponseWriter, status int, retryAfter time.Duration, msg string) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": msg, "type": "fake_error", "code": status},
+	})
+}
+
+// ParseCategories extracts the allowed categories from a system message built by BuildMessages.
+func ParseCategories(system string) []string {
+	const marker = "Allowed categories: "
+	i := strings.LastIndex(system, marker)
+	if i < 0 {
+		return nil
+	}
+	var cats []string
+	for _, c := range strings.Split(system[i+len(marker):], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cats = append(cats, c)
+		}
+	}
+	return cats
+}
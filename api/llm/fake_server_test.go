@@ -0,0 +1,77 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/llm"
+)
+
+func newClientForFakeServer(t *testing.T, fake *llm.FakeClient) *llm.OpenAIClient {
+	srv := httptest.NewServer(llm.NewFakeServer(fake))
+	t.Cleanup(srv.Close)
+	t.Setenv("OPENAI_API_KEY", "offline")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("LLM_MODEL", "fake-model")
+	return llm.NewOpenAIClient()
+}
+
+func TestFakeServer_AnswersChatCompletionsFromRules(t *testing.T) {
+	fake := llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...)
+	client := newClientForFakeServer(t, fake)
+
+	label, usage, err := client.ClassifySample(context.Background(),
+		llm.ColumnSample{Column: "contact", DataType: "varchar", Values: []string{"ana@example.com"}},
+		[]string{"EMAIL_ADDRESS", "SSN"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+	assert.Equal(t, "fake-model", usage.Model)
+	assert.Positive(t, usage.PromptTokens)
+
+	// the server decoded the structured sample and the offered categories
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "contact", calls[0].Column)
+	assert.Equal(t, []string{"ana@example.com"}, calls[0].Values)
+}
+
+func TestFakeServer_OnlyAnswersOfferedCategories(t *testing.T) {
+	fake := llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...)
+	client := newClientForFakeServer(t, fake)
+
+	label, _, err := client.ClassifySample(context.Background(),
+		llm.ColumnSample{Column: "contact", Values: []string{"ana@example.com"}},
+		[]string{"SSN"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "N/A", label)
+}
+
+func TestFakeServer_ReturnsScriptedErrorsAndDelays(t *testing.T) {
+	fake := llm.NewFakeClient("fake").On("email",
+		llm.FakeResponse{Err: &llm.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second, Err: errors.New("slow down")}},
+		llm.FakeResponse{Label: "EMAIL_ADDRESS", Delay: 20 * time.Millisecond},
+	)
+	client := newClientForFakeServer(t, fake)
+	sample := llm.ColumnSample{Column: "email", Values: []string{"x"}}
+
+	_, _, err := client.ClassifySample(context.Background(), sample, []string{"EMAIL_ADDRESS"})
+	var pe *llm.ProviderError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, http.StatusTooManyRequests, pe.StatusCode)
+	assert.Equal(t, 2*time.Second, pe.RetryAfter)
+
+	started := time.Now()
+	label, _, err := client.ClassifySample(context.Background(), sample, []string{"EMAIL_ADDRESS"})
+	require.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+	assert.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond)
+}
@@ -2,10 +2,13 @@ package llm
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"meli-challenge/logger"
 
@@ -17,60 +20,137 @@ type OpenAIClient struct {
 	model  string
 }
 
-// NewOpenAIClient loads credentials and model name from environment variables.
-// TLS certificate verification is disabled (INSECURE).
+// NewOpenAIClient loads credentials, model name and HTTP settings (see HTTPConfigFromEnv)
+// from environment variables.
 func NewOpenAIClient() *OpenAIClient {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		panic("OPENAI_API_KEY not set")
+	c, err := newOpenAIClient(os.Getenv("OPENAI_API_KEY"), os.Getenv("LLM_MODEL"), os.Getenv("OPENAI_BASE_URL"), HTTPConfigFromEnv())
+	if err != nil {
+		panic(err)
 	}
+	return c
+}
 
-	model := os.Getenv("LLM_MODEL")
+// newOpenAIClient builds a client for an OpenAI-compatible endpoint. An empty baseURL uses the public API.
+func newOpenAIClient(apiKey, model, baseURL string, httpCfg HTTPConfig) (*OpenAIClient, error) {
+	if apiKey == "" {
+		return nil, errors.New("OPENAI_API_KEY not set")
+	}
 	if model == "" {
 		model = "gpt-4o-mini" // default model
 	}
 
-	// Custom HTTP client with TLS verification disabled
-	insecureTransport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // ⚠️ TODO: Configure properly for production
+	transport, err := NewHTTPTransport(httpCfg)
+	if err != nil {
+		return nil, err
 	}
-	httpClient := &http.Client{Transport: insecureTransport}
+	httpClient := &http.Client{Transport: &retryAfterTransport{base: transport}}
 
 	cfg := openai.DefaultConfig(apiKey)
 	cfg.HTTPClient = httpClient
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
 
 	return &OpenAIClient{
 		client: openai.NewClientWithConfig(cfg),
 		model:  model,
-	}
+	}, nil
 }
 
-// ClassifySample sends the row sample to OpenAI and asks it to classify based on rules.
-func (c *OpenAIClient) ClassifySample(ctx context.Context, sample string, rules []string) (string, error) {
-	prompt := "You are a strict data classifier. Given a row sample, identify if it contains any of these categories: "
-	prompt += strings.Join(rules, ", ")
-	prompt += ". If none apply, return 'N/A'.\nSample: " + sample
-	// Log the prompt for debugging (note: may contain sensitive sample data)
-	logger.Debugf("LLM prompt: %s", prompt)
+// Model returns the configured OpenAI model name.
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
 
+// ClassifySample sends the column sample to OpenAI and asks it to classify based on rules.
+func (c *OpenAIClient) ClassifySample(ctx context.Context, sample ColumnSample, rules []string) (string, Usage, error) {
+	msgs, err := BuildMessages(sample, rules)
+	if err != nil {
+		return "", Usage{Model: c.model}, err
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, m := range msgs {
+		// Log the prompt for debugging (note: may contain sensitive sample data)
+		logger.Debugf("LLM prompt (%s): %s", m.Role, m.Content)
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+
+	hint := &retryAfterHint{}
 	resp, err := c.client.CreateChatCompletion(
-		ctx,
+		context.WithValue(ctx, retryAfterKey{}, hint),
 		openai.ChatCompletionRequest{
-			Model: c.model,
-			Messages: []openai.ChatCompletionMessage{
-				{Role: "system", Content: "You are a strict data classifier. Only respond with the matching category or 'N/A'."},
-				{Role: "user", Content: prompt},
-			},
+			Model:    c.model,
+			Messages: messages,
 		},
 	)
 	if err != nil {
-		return "", err
+		return "", Usage{Model: c.model}, wrapOpenAIError(err, hint.get())
+	}
+
+	usage := Usage{
+		Model:            c.model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+	if len(resp.Choices) == 0 {
+		return "", usage, errors.New("LLM response has no choices")
 	}
 
 	// Log the raw LLM response for debugging/inspection
-	if len(resp.Choices) > 0 {
-		logger.Debugf("LLM response (raw): %s", resp.Choices[0].Message.Content)
+	logger.Debugf("LLM response (raw): %s", resp.Choices[0].Message.Content)
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content), usage, nil
+}
+
+// wrapOpenAIError converts go-openai errors into a ProviderError carrying the HTTP status and Retry-After hint.
+func wrapOpenAIError(err error, retryAfter time.Duration) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &ProviderError{StatusCode: apiErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
 	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return &ProviderError{StatusCode: reqErr.HTTPStatusCode, RetryAfter: retryAfter, Err: err}
+	}
+	return fmt.Errorf("openai request failed: %w", err)
+}
+
+// retryAfterKey carries a *retryAfterHint in the request context.
+type retryAfterKey struct{}
+
+// retryAfterHint receives the Retry-After header of a failed response; go-openai does not expose headers on errors.
+type retryAfterHint struct {
+	mu    sync.Mutex
+	value time.Duration
+}
+
+func (h *retryAfterHint) set(d time.Duration) {
+	h.mu.Lock()
+	h.value = d
+	h.mu.Unlock()
+}
+
+func (h *retryAfterHint) get() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.value
+}
+
+// retryAfterTransport records Retry-After on 429/5xx responses into the hint found in the request context.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
 
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok {
+			hint.set(ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		}
+	}
+	return resp, nil
 }
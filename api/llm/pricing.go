@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"encoding/json"
+	"os"
+
+	"meli-challenge/logger"
+)
+
+// Usage is the token usage reported by the provider for a classification. Model names the model
+// that answered (it differs from the primary one when a fallback was used) and Retries counts the
+// extra attempts made. When the fallback answered, Primary holds what the failed primary attempts
+// consumed; those tokens are also included in the totals.
+type Usage struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Retries          int
+	Primary          *Usage
+}
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	InputPerMTok  float64 `json:"input_per_mtok"`
+	OutputPerMTok float64 `json:"output_per_mtok"`
+}
+
+// PriceTable maps a model name to its price.
+type PriceTable map[string]Price
+
+// defaultPrices holds list prices for the models we use out of the box.
+var defaultPrices = PriceTable{
+	"gpt-4o-mini":  {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+	"gpt-4o":       {InputPerMTok: 2.50, OutputPerMTok: 10.00},
+	"gpt-4.1-mini": {InputPerMTok: 0.40, OutputPerMTok: 1.60},
+	"gpt-4.1":      {InputPerMTok: 2.00, OutputPerMTok: 8.00},
+}
+
+// LoadPriceTable returns the default prices overridden by LLM_PRICE_TABLE, a JSON object such as
+// {"gpt-4o-mini":{"input_per_mtok":0.15,"output_per_mtok":0.6}}.
+func LoadPriceTable() PriceTable {
+	table := make(PriceTable, len(defaultPrices))
+	for m, p := range defaultPrices {
+		table[m] = p
+	}
+
+	raw := os.Getenv("LLM_PRICE_TABLE")
+	if raw == "" {
+		return table
+	}
+	var custom PriceTable
+	if err := json.Unmarshal([]byte(raw), &custom); err != nil {
+		logger.Warnf("Ignoring invalid LLM_PRICE_TABLE: %v", err)
+		return table
+	}
+	for m, p := range custom {
+		table[m] = p
+	}
+	return table
+}
+
+// Has reports whether the table has a price for model.
+func (t PriceTable) Has(model string) bool {
+	_, ok := t[model]
+	return ok
+}
+
+// Cost estimates the USD cost of usage answered by model. Tokens spent on a failed primary are
+// priced at the primary's model. ok is false when some of those models have no price: their
+// tokens are left out, so the cost is a lower bound.
+func (t PriceTable) Cost(model string, u Usage) (cost float64, ok bool) {
+	ok = true
+	if u.Primary != nil {
+		primaryCost, primaryOK := t.Cost(u.Primary.Model, *u.Primary)
+		cost, ok = primaryCost, primaryOK
+		u.PromptTokens -= u.Primary.PromptTokens
+		u.CompletionTokens -= u.Primary.CompletionTokens
+	}
+	p, found := t[model]
+	if !found {
+		return cost, ok && u.PromptTokens == 0 && u.CompletionTokens == 0
+	}
+	return cost + (float64(u.PromptTokens)*p.InputPerMTok+float64(u.CompletionTokens)*p.OutputPerMTok)/1e6, ok
+}
@@ -0,0 +1,49 @@
+package llm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/llm"
+)
+
+func TestPriceTable_Cost(t *testing.T) {
+	t.Setenv("LLM_PRICE_TABLE", `{"custom-model":{"input_per_mtok":1,"output_per_mtok":2}}`)
+	table := llm.LoadPriceTable()
+
+	cost, ok := table.Cost("custom-model", llm.Usage{PromptTokens: 1, CompletionTokens: 1})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.000003, cost, 1e-12)
+	// defaults are kept alongside custom entries
+	cost, ok = table.Cost("gpt-4o-mini", llm.Usage{PromptTokens: 1_000_000})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.15, cost, 1e-9)
+	// an unknown model is reported rather than silently free
+	cost, ok = table.Cost("unknown-model", llm.Usage{PromptTokens: 1000})
+	assert.False(t, ok)
+	assert.Zero(t, cost)
+}
+
+func TestPriceTable_CostPricesFallbackAndPrimaryTokensSeparately(t *testing.T) {
+	table := llm.LoadPriceTable()
+	primary := llm.Usage{Model: "gpt-4o", PromptTokens: 1_000_000}
+	// the fallback answered: totals include the primary's tokens
+	u := llm.Usage{Model: "gpt-4o-mini", PromptTokens: 2_000_000, Primary: &primary}
+
+	cost, ok := table.Cost(u.Model, u)
+	assert.True(t, ok)
+	assert.InDelta(t, 2.50+0.15, cost, 1e-9)
+
+	primary.Model = "unknown-model"
+	cost, ok = table.Cost(u.Model, u)
+	assert.False(t, ok)
+	assert.InDelta(t, 0.15, cost, 1e-9)
+}
+
+func TestLoadPriceTable_InvalidJSONFallsBackToDefaults(t *testing.T) {
+	t.Setenv("LLM_PRICE_TABLE", `not json`)
+	table := llm.LoadPriceTable()
+
+	assert.Contains(t, table, "gpt-4o-mini")
+}
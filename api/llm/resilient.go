@@ -0,0 +1,203 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"meli-challenge/logger"
+)
+
+// maxRetryAfter bounds how long a provider's Retry-After hint can stall a single column.
+const maxRetryAfter = time.Minute
+
+// RetryPolicy configures exponential backoff with jitter between attempts.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Backoff returns the delay before retry number attempt (0-based). The exponential delay is
+// jittered between half and full value; a larger Retry-After hint from the provider wins.
+func (p RetryPolicy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+	if retryAfter > delay {
+		delay = min(retryAfter, maxRetryAfter)
+	}
+	return delay
+}
+
+// CircuitBreaker stops calling a provider after threshold consecutive transient failures.
+// Once cooldown has elapsed a single trial call is let through: success closes the circuit,
+// failure opens it again, and any other outcome (Release) lets the next call be the trial.
+// A threshold of 0 disables the breaker.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a call may be made now.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Success closes the circuit.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// Release ends a call whose outcome says nothing about the provider's health (a rejected
+// request, a cancelled context), so a pending trial does not keep the circuit open forever.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Failure records a transient failure and opens the circuit once the threshold is reached.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		if time.Now().After(b.openUntil) {
+			logger.Warnf("LLM circuit breaker for %s opened after %d consecutive failures", b.name, b.failures)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// ResilientClient wraps a primary provider (and an optional fallback) with per-attempt timeouts,
+// retries and a circuit breaker per provider.
+type ResilientClient struct {
+	primary         LLMClient
+	fallback        LLMClient
+	primaryBreaker  *CircuitBreaker
+	fallbackBreaker *CircuitBreaker
+	policy          RetryPolicy
+	attemptTimeout  time.Duration
+}
+
+// ResilienceConfig holds the tuning knobs of a ResilientClient.
+type ResilienceConfig struct {
+	Retry            RetryPolicy
+	AttemptTimeout   time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+func NewResilientClient(primary, fallback LLMClient, cfg ResilienceConfig) *ResilientClient {
+	c := &ResilientClient{
+		primary:        primary,
+		fallback:       fallback,
+		primaryBreaker: NewCircuitBreaker("primary:"+primary.Model(), cfg.BreakerThreshold, cfg.BreakerCooldown),
+		policy:         cfg.Retry,
+		attemptTimeout: cfg.AttemptTimeout,
+	}
+	if fallback != nil {
+		c.fallbackBreaker = NewCircuitBreaker("fallback:"+fallback.Model(), cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return c
+}
+
+// Model returns the primary provider's model name.
+func (c *ResilientClient) Model() string {
+	return c.primary.Model()
+}
+
+// ClassifySample tries the primary provider with retries and, if it still fails, the fallback.
+// The returned usage adds up every attempt and names the model that produced the answer; after a
+// fallback, Primary keeps the primary's share so each model's tokens are priced separately.
+func (c *ResilientClient) ClassifySample(ctx context.Context, sample ColumnSample, rules []string) (string, Usage, error) {
+	label, usage, err := c.classifyWith(ctx, c.primary, c.primaryBreaker, sample, rules)
+	if err == nil || c.fallback == nil || ctx.Err() != nil {
+		return label, usage, err
+	}
+
+	logger.Warnf("Primary LLM failed (%v), trying fallback model %s", err, c.fallback.Model())
+	label, fallbackUsage, fallbackErr := c.classifyWith(ctx, c.fallback, c.fallbackBreaker, sample, rules)
+	fallbackUsage.PromptTokens += usage.PromptTokens
+	fallbackUsage.CompletionTokens += usage.CompletionTokens
+	fallbackUsage.TotalTokens += usage.TotalTokens
+	fallbackUsage.Retries += usage.Retries
+	fallbackUsage.Primary = &usage
+	if fallbackErr != nil {
+		return "", fallbackUsage, errors.Join(err, fallbackErr)
+	}
+	return label, fallbackUsage, nil
+}
+
+func (c *ResilientClient) classifyWith(ctx context.Context, client LLMClient, breaker *CircuitBreaker, sample ColumnSample, rules []string) (string, Usage, error) {
+	total := Usage{Model: client.Model()}
+	for attempt := 0; ; attempt++ {
+		if !breaker.Allow() {
+			return "", total, ErrCircuitOpen
+		}
+
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if c.attemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, c.attemptTimeout)
+		}
+		label, u, err := client.ClassifySample(actx, sample, rules)
+		cancel()
+
+		total.PromptTokens += u.PromptTokens
+		total.CompletionTokens += u.CompletionTokens
+		total.TotalTokens += u.TotalTokens
+		if err == nil {
+			breaker.Success()
+			return label, total, nil
+		}
+
+		retryable := IsRetryable(err) && ctx.Err() == nil
+		if retryable {
+			breaker.Failure()
+		} else {
+			breaker.Release()
+		}
+		if !retryable || attempt >= c.policy.MaxRetries {
+			return "", total, err
+		}
+
+		delay := c.policy.Backoff(attempt, RetryAfterOf(err))
+		logger.Debugf("LLM attempt %d on %s failed (%v), retrying in %s", attempt+1, client.Model(), err, delay)
+		total.Retries++
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", total, ctx.Err()
+		}
+	}
+}
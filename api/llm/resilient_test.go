@@ -0,0 +1,192 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/llm"
+)
+
+// stubClient returns the scripted errors in order, then succeeds with label.
+type stubClient struct {
+	model string
+	label string
+	errs  []error
+	calls int32
+}
+
+func (s *stubClient) Model() string { return s.model }
+
+func (s *stubClient) ClassifySample(ctx context.Context, sample llm.ColumnSample, rules []string) (string, llm.Usage, error) {
+	n := int(atomic.AddInt32(&s.calls, 1)) - 1
+	u := llm.Usage{Model: s.model, PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11}
+	if n < len(s.errs) {
+		return "", u, s.errs[n]
+	}
+	return s.label, u, nil
+}
+
+func fastConfig() llm.ResilienceConfig {
+	return llm.ResilienceConfig{
+		Retry:            llm.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+		AttemptTimeout:   time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func TestResilientClient_RetriesTransientErrorsHonouringRetryAfter(t *testing.T) {
+	primary := &stubClient{model: "primary", label: "EMAIL_ADDRESS", errs: []error{
+		&llm.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Millisecond, Err: errors.New("slow down")},
+		&llm.ProviderError{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")},
+	}}
+	c := llm.NewResilientClient(primary, nil, fastConfig())
+
+	started := time.Now()
+	label, usage, err := c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, []string{"EMAIL_ADDRESS"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+	assert.Equal(t, 2, usage.Retries)
+	assert.Equal(t, 30, usage.PromptTokens) // tokens of every attempt are accounted
+	assert.GreaterOrEqual(t, time.Since(started), 30*time.Millisecond)
+}
+
+func TestResilientClient_DoesNotRetryClientErrors(t *testing.T) {
+	primary := &stubClient{model: "primary", errs: []error{
+		&llm.ProviderError{StatusCode: http.StatusBadRequest, Err: errors.New("bad request")},
+	}}
+	c := llm.NewResilientClient(primary, nil, fastConfig())
+
+	_, usage, err := c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primary.calls))
+	assert.Zero(t, usage.Retries)
+}
+
+func TestResilientClient_CircuitBreakerOpensAndFallbackAnswers(t *testing.T) {
+	unavailable := &llm.ProviderError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("down")}
+	primary := &stubClient{model: "primary", errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	fallback := &stubClient{model: "fallback", label: "PHONE_NUMBER"}
+	cfg := fastConfig()
+	cfg.Retry.MaxRetries = 1
+	cfg.BreakerThreshold = 2
+	c := llm.NewResilientClient(primary, fallback, cfg)
+
+	label, usage, err := c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "PHONE_NUMBER", label)
+	assert.Equal(t, "fallback", usage.Model)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&primary.calls))
+	// the primary's share is kept apart so it is priced at the primary's model
+	require.NotNil(t, usage.Primary)
+	assert.Equal(t, "primary", usage.Primary.Model)
+	assert.Equal(t, 20, usage.Primary.PromptTokens)
+	assert.Equal(t, 30, usage.PromptTokens)
+
+	// The breaker is now open: the primary is skipped entirely
+	label, _, err = c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "PHONE_NUMBER", label)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&primary.calls))
+}
+
+func TestResilientClient_ReturnsErrorWithoutFallback(t *testing.T) {
+	unavailable := &llm.ProviderError{StatusCode: http.StatusInternalServerError, Err: errors.New("boom")}
+	primary := &stubClient{model: "primary", errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	c := llm.NewResilientClient(primary, nil, fastConfig())
+
+	_, usage, err := c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, usage.Retries)
+}
+
+func TestOpenAIClient_SurfacesStatusAndRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"rate limited","type":"rate_limit"}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	c := llm.NewOpenAIClient()
+
+	_, _, err := c.ClassifySample(context.Background(), llm.ColumnSample{Column: "c", Values: []string{"v"}}, []string{"EMAIL_ADDRESS"})
+
+	var pe *llm.ProviderError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, http.StatusTooManyRequests, pe.StatusCode)
+	assert.Equal(t, 7*time.Second, pe.RetryAfter)
+	assert.True(t, llm.IsRetryable(err))
+}
+
+func TestResilientClient_TrialEndingInClientErrorDoesNotWedgeBreaker(t *testing.T) {
+	primary := &stubClient{model: "primary", label: "EMAIL_ADDRESS", errs: []error{
+		&llm.ProviderError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("down")},
+		&llm.ProviderError{StatusCode: http.StatusBadRequest, Err: errors.New("bad request")},
+	}}
+	cfg := fastConfig()
+	cfg.Retry.MaxRetries = 0
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Millisecond
+	c := llm.NewResilientClient(primary, nil, cfg)
+	sample := llm.ColumnSample{Column: "c", Values: []string{"v"}}
+
+	_, _, err := c.ClassifySample(context.Background(), sample, nil)
+	assert.Error(t, err, "the circuit opens")
+	time.Sleep(2 * time.Millisecond)
+	_, _, err = c.ClassifySample(context.Background(), sample, nil)
+	assert.Error(t, err, "the trial call is rejected by the provider")
+	time.Sleep(2 * time.Millisecond)
+
+	label, _, err := c.ClassifySample(context.Background(), sample, nil)
+	assert.NoError(t, err, "a new trial is let through")
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&primary.calls))
+}
+
+// countingClient counts the calls that reach client.
+type countingClient struct {
+	llm.LLMClient
+	calls int32
+}
+
+func (c *countingClient) ClassifySample(ctx context.Context, sample llm.ColumnSample, rules []string) (string, llm.Usage, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.LLMClient.ClassifySample(ctx, sample, rules)
+}
+
+func TestResilientClient_UnreachableProviderOpensCircuit(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // nothing listens there any more: every dial is refused
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	primary := &countingClient{LLMClient: llm.NewOpenAIClient()}
+	fallback := &stubClient{model: "fallback", label: "EMAIL_ADDRESS"}
+	cfg := fastConfig()
+	cfg.Retry.MaxRetries = 1
+	cfg.BreakerThreshold = 2
+	c := llm.NewResilientClient(primary, fallback, cfg)
+	sample := llm.ColumnSample{Column: "c", Values: []string{"v"}}
+
+	for i := 0; i < 3; i++ {
+		label, _, err := c.ClassifySample(context.Background(), sample, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "EMAIL_ADDRESS", label, "the fallback answers")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&primary.calls), "refused connections are retried, then the circuit opens")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fallback.calls))
+}
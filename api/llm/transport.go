@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"meli-challenge/logger"
+)
+
+// HTTPConfig controls how provider APIs are reached. Sampled column values travel in every
+// request, so the server certificate is verified unless InsecureSkipVerify is set explicitly.
+type HTTPConfig struct {
+	// CABundle is a PEM file trusted in addition to the system roots (e.g. a corporate proxy CA)
+	CABundle string
+	// ProxyURL overrides the HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables
+	ProxyURL string
+	// InsecureSkipVerify disables certificate verification; for development only
+	InsecureSkipVerify bool
+}
+
+// HTTPConfigFromEnv reads LLM_CA_BUNDLE, LLM_PROXY_URL and LLM_TLS_INSECURE_SKIP_VERIFY.
+func HTTPConfigFromEnv() HTTPConfig {
+	insecure, _ := strconv.ParseBool(os.Getenv("LLM_TLS_INSECURE_SKIP_VERIFY"))
+	return HTTPConfig{
+		CABundle:           os.Getenv("LLM_CA_BUNDLE"),
+		ProxyURL:           os.Getenv("LLM_PROXY_URL"),
+		InsecureSkipVerify: insecure,
+	}
+}
+
+// NewHTTPTransport builds the transport used by provider clients.
+func NewHTTPTransport(cfg HTTPConfig) (*http.Transport, error) {
+	// keeps the default dial/idle timeouts and the proxy from the environment
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("LLM_CA_BUNDLE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("LLM_CA_BUNDLE %s has no PEM certificates", cfg.CABundle)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("LLM_PROXY_URL must be an http(s) URL")
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.InsecureSkipVerify {
+		logger.Warnf("!!! LLM_TLS_INSECURE_SKIP_VERIFY is set: TLS certificates of the LLM provider are NOT verified and sampled data can be intercepted. Never use this outside development !!!")
+		t.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return t, nil
+}
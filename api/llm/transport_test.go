@@ -0,0 +1,100 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/llm"
+)
+
+var emailSample = llm.ColumnSample{Column: "contact", DataType: "varchar", Values: []string{"ana@example.com"}}
+
+// newTLSProvider starts a fake OpenAI-compatible provider over TLS with a self-signed certificate.
+func newTLSProvider(t *testing.T) *httptest.Server {
+	srv := httptest.NewTLSServer(llm.NewFakeServer(llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...)))
+	t.Cleanup(srv.Close)
+	t.Setenv("OPENAI_API_KEY", "offline")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	return srv
+}
+
+func classify(t *testing.T) (string, error) {
+	client, err := llm.NewLLMClientFromEnv()
+	require.NoError(t, err)
+	label, _, err := client.ClassifySample(context.Background(), emailSample, []string{"EMAIL_ADDRESS"})
+	return label, err
+}
+
+func TestHTTPClient_VerifiesProviderCertificate(t *testing.T) {
+	newTLSProvider(t)
+
+	_, err := classify(t)
+	assert.ErrorContains(t, err, "certificate")
+}
+
+func TestHTTPClient_TrustsCustomCABundle(t *testing.T) {
+	srv := newTLSProvider(t)
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600))
+	t.Setenv("LLM_CA_BUNDLE", bundle)
+
+	label, err := classify(t)
+	require.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+
+	require.NoError(t, os.WriteFile(bundle, []byte("not a certificate"), 0o600))
+	_, err = llm.NewLLMClientFromEnv()
+	assert.ErrorContains(t, err, "LLM_CA_BUNDLE")
+}
+
+func TestHTTPClient_InsecureOptOut(t *testing.T) {
+	newTLSProvider(t)
+	t.Setenv("LLM_TLS_INSECURE_SKIP_VERIFY", "true")
+
+	label, err := classify(t)
+	require.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+}
+
+func TestHTTPClient_UsesConfiguredProxy(t *testing.T) {
+	// the proxy receives absolute-form requests for the provider and answers them itself
+	fake := llm.NewFakeServer(llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...))
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "llm.internal.example" {
+			proxied.Add(1)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	t.Setenv("OPENAI_API_KEY", "offline")
+	t.Setenv("OPENAI_BASE_URL", "http://llm.internal.example/v1")
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	t.Setenv("LLM_PROXY_URL", proxy.URL)
+
+	label, err := classify(t)
+	require.NoError(t, err)
+	assert.Equal(t, "EMAIL_ADDRESS", label)
+	assert.Equal(t, int32(1), proxied.Load())
+
+	t.Setenv("LLM_PROXY_URL", "socks5://proxy:1080")
+	_, err = llm.NewLLMClientFromEnv()
+	assert.ErrorContains(t, err, "LLM_PROXY_URL")
+}
+
+func TestNewHTTPTransport_VerifiesByDefault(t *testing.T) {
+	tr, err := llm.NewHTTPTransport(llm.HTTPConfig{})
+	require.NoError(t, err)
+	assert.False(t, tr.TLSClientConfig.InsecureSkipVerify)
+	assert.NotNil(t, tr.Proxy, "honours HTTPS_PROXY/NO_PROXY from the environment")
+}
@@ -1,27 +1,118 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"os"
+	"strings"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/oidc"
+	"meli-challenge/api/services"
+	"meli-challenge/logger"
 
 	"github.com/gin-gonic/gin"
 )
 
-// APIKeyAuthMiddleware checks the X-API-Key header against the API_KEY env var
-func APIKeyAuthMiddleware() gin.HandlerFunc {
+// identityKey is the gin context key of the authenticated models.Identity
+const identityKey = "identity"
+
+// anonymous is the caller when authentication is disabled
+var anonymous = models.Identity{TenantID: models.DefaultTenantID, Name: "anonymous", Owner: "dev", Scopes: models.Scopes}
+
+// Authenticator resolves the X-API-Key header to the calling identity
+type Authenticator interface {
+	Authenticate(key string) (models.Identity, error)
+}
+
+// BearerAuthenticator resolves an "Authorization: Bearer" token to the calling identity
+type BearerAuthenticator interface {
+	AuthenticateBearer(ctx context.Context, token string) (models.Identity, error)
+}
+
+// AuthMiddleware authenticates the caller with a bearer token (when bearer is not nil) or
+// the X-API-Key header, and attaches it to the context (see CurrentIdentity).
+// AUTH_DISABLED=true skips authentication for local development.
+func AuthMiddleware(auth Authenticator, bearer BearerAuthenticator) gin.HandlerFunc {
+	disabled := os.Getenv("AUTH_DISABLED") == "true"
+	if disabled {
+		logger.Warnf("AUTH_DISABLED=true: API requests are not authenticated, do not use this outside development")
+	}
 	return func(c *gin.Context) {
-		expected := os.Getenv("API_KEY")
-		if expected == "" {
-			// no key configured -> allow (dev mode)
+		if disabled {
+			c.Set(identityKey, anonymous)
 			c.Next()
 			return
 		}
 
-		key := c.GetHeader("X-API-Key")
-		if key == "" || key != expected {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		var identity models.Identity
+		var err error
+		if scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			if bearer == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "bearer tokens are not accepted"})
+				return
+			}
+			identity, err = bearer.AuthenticateBearer(c.Request.Context(), strings.TrimSpace(token))
+			if errors.Is(err, oidc.ErrInvalidToken) {
+				logger.Warnf("Bearer token rejected from %s: %v", c.ClientIP(), err)
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+				return
+			}
+		} else {
+			identity, err = auth.Authenticate(c.GetHeader("X-API-Key"))
+			if errors.Is(err, services.ErrUnauthorized) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+				return
+			}
+		}
+		if err != nil {
+			logger.Errorf("Authentication failed: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "authentication unavailable"})
+			return
+		}
+		if identity.TenantID == 0 {
+			logger.Errorf("Identity %s has no tenant", identity)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "caller has no tenant"})
 			return
 		}
+		c.Set(identityKey, identity)
 		c.Next()
 	}
 }
+
+// RequireScope rejects callers whose identity lacks scope. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := CurrentIdentity(c)
+		if !ok || !identity.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// SetIdentity attaches the caller when it is authenticated by other means (share links)
+func SetIdentity(c *gin.Context, identity models.Identity) {
+	c.Set(identityKey, identity)
+}
+
+// CurrentTenant returns the tenant of the caller. Handlers scope every lookup of tenant-owned
+// data by it; it is 0 (no tenant, so nothing matches) for unauthenticated requests.
+func CurrentTenant(c *gin.Context) int64 {
+	identity, _ := CurrentIdentity(c)
+	return identity.TenantID
+}
+
+// CurrentIdentity returns the caller authenticated by AuthMiddleware (API key or OIDC bearer
+// token) or attached with SetIdentity
+func CurrentIdentity(c *gin.Context) (models.Identity, bool) {
+	v, ok := c.Get(identityKey)
+	if !ok {
+		return models.Identity{}, false
+	}
+	identity, ok := v.(models.Identity)
+	return identity, ok
+}
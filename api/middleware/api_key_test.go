@@ -0,0 +1,86 @@
+package middleware_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/oidc"
+	"meli-challenge/api/services"
+)
+
+type fakeKeys map[string]models.Identity
+
+func (f fakeKeys) Authenticate(key string) (models.Identity, error) {
+	if id, ok := f[key]; ok {
+		return id, nil
+	}
+	return models.Identity{}, services.ErrUnauthorized
+}
+
+type fakeBearer map[string]models.Identity
+
+func (f fakeBearer) AuthenticateBearer(_ context.Context, token string) (models.Identity, error) {
+	if id, ok := f[token]; ok {
+		return id, nil
+	}
+	return models.Identity{}, fmt.Errorf("%w: bad signature", oidc.ErrInvalidToken)
+}
+
+func newRouter(bearer middleware.BearerAuthenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys := fakeKeys{"svc-key": {KeyID: 1, TenantID: 1, Name: "etl", Owner: "data", Scopes: []string{models.ScopeScanRun}}}
+	r.GET("/run", middleware.AuthMiddleware(keys, bearer), middleware.RequireScope(models.ScopeScanRun), func(c *gin.Context) {
+		identity, _ := middleware.CurrentIdentity(c)
+		c.String(http.StatusOK, identity.Name)
+	})
+	return r
+}
+
+func do(r *gin.Engine, header, value string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/run", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddleware_BearerAndAPIKeys(t *testing.T) {
+	r := newRouter(fakeBearer{
+		"good":     {TenantID: 1, Name: "ana@example.com", Owner: "oidc", Scopes: []string{models.ScopeScanRun}},
+		"readonly": {TenantID: 1, Name: "bob@example.com", Owner: "oidc", Scopes: []string{models.ScopeScanRead}},
+		"orphan":   {Name: "eve@example.com", Owner: "oidc", Scopes: []string{models.ScopeScanRun}},
+	})
+
+	w := do(r, "Authorization", "Bearer good")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ana@example.com", w.Body.String())
+
+	w = do(r, "X-API-Key", "svc-key")
+	assert.Equal(t, http.StatusOK, w.Code, "API keys keep working next to SSO")
+	assert.Equal(t, "etl", w.Body.String())
+
+	w = do(r, "Authorization", "Bearer forged")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+
+	assert.Equal(t, http.StatusForbidden, do(r, "Authorization", "Bearer readonly").Code)
+	assert.Equal(t, http.StatusForbidden, do(r, "Authorization", "Bearer orphan").Code, "callers without a tenant see nothing")
+	assert.Equal(t, http.StatusUnauthorized, do(r, "", "").Code)
+}
+
+func TestAuthMiddleware_BearerWithoutOIDC(t *testing.T) {
+	r := newRouter(nil)
+	assert.Equal(t, http.StatusUnauthorized, do(r, "Authorization", "Bearer good").Code)
+	assert.Equal(t, http.StatusOK, do(r, "X-API-Key", "svc-key").Code)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditKey = "audit"
+
+// AuditRecorder stores audit entries
+type AuditRecorder interface {
+	Record(e models.AuditEntry) error
+}
+
+// AuditTrail makes rec available to handlers through Audit.
+func AuditTrail(rec AuditRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auditKey, rec)
+		c.Next()
+	}
+}
+
+// Audit records action on resourceID by the current caller, with the fields that changed
+// between before and after. Without AuditTrail (e.g. in tests) it does nothing.
+func Audit(c *gin.Context, action string, resourceID any, before, after any) {
+	v, _ := c.Get(auditKey)
+	rec, ok := v.(AuditRecorder)
+	if !ok {
+		return
+	}
+	identity, _ := CurrentIdentity(c)
+	// errors are logged by the recorder; the action itself already happened
+	_ = rec.Record(models.AuditEntry{
+		TenantID:   identity.TenantID,
+		Actor:      identity.Name,
+		ActorOwner: identity.Owner,
+		ActorKeyID: identity.KeyID,
+		Action:     action,
+		ResourceID: fmt.Sprint(resourceID),
+		RequestID:  CurrentRequestID(c),
+		IP:         c.ClientIP(),
+		Changes:    services.AuditChanges(before, after),
+	})
+}
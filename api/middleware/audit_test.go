@@ -0,0 +1,63 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+)
+
+type recorder []models.AuditEntry
+
+func (r *recorder) Record(e models.AuditEntry) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestAudit_RecordsCallerAndRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var rec recorder
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.AuditTrail(&rec))
+	keys := fakeKeys{"svc-key": {KeyID: 9, TenantID: 4, Name: "etl", Owner: "data"}}
+	r.DELETE("/database/:id", middleware.AuthMiddleware(keys, nil), func(c *gin.Context) {
+		middleware.Audit(c, models.AuditDatabaseDelete, 7, models.Database{ID: 7, Host: "db1"}, nil)
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/database/7", nil)
+	req.Header.Set("X-API-Key", "svc-key")
+	req.Header.Set("X-Request-ID", "req-123")
+	req.RemoteAddr = "10.1.2.3:5555"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "req-123", w.Header().Get("X-Request-ID"))
+	assert.Len(t, rec, 1)
+	e := rec[0]
+	assert.Equal(t, "etl", e.Actor)
+	assert.Equal(t, int64(9), e.ActorKeyID)
+	assert.Equal(t, int64(4), e.TenantID)
+	assert.Equal(t, "7", e.ResourceID)
+	assert.Equal(t, "req-123", e.RequestID)
+	assert.Equal(t, "10.1.2.3", e.IP)
+	assert.Equal(t, "db1", e.Changes["host"].Before)
+}
+
+func TestRequestID_ReplacesUnsafeValues(t *testing.T) {
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, middleware.CurrentRequestID(c)) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\nwith newline")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Len(t, w.Body.String(), 32)
+	assert.Equal(t, w.Body.String(), w.Header().Get("X-Request-ID"))
+}
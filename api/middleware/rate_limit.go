@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meli-challenge/api/ratelimit"
+	"meli-challenge/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit throttles each caller of the routes it guards with limiter (a nil limiter lets
+// everything through). Callers are told apart by API key or, for SSO users and share links,
+// by identity; it must run after AuthMiddleware or the share link check.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		key := rateKey(c)
+		if ok, retryAfter := limiter.Allow(key); !ok {
+			logger.Warnf("Rate limit exceeded by %s on %s %s", key, c.Request.Method, c.FullPath())
+			TooManyRequests(c, retryAfter, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// TooManyRequests aborts with 429 and a Retry-After of whole seconds (at least 1)
+func TooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after_seconds": seconds})
+}
+
+// rateKey identifies the caller whose bucket a request takes from
+func rateKey(c *gin.Context) string {
+	identity, ok := CurrentIdentity(c)
+	switch {
+	case !ok:
+		return "ip:" + c.ClientIP()
+	case identity.KeyID != 0:
+		return fmt.Sprintf("key:%d", identity.KeyID)
+	default:
+		return fmt.Sprintf("tenant:%d:%s:%s", identity.TenantID, identity.Owner, identity.Name)
+	}
+}
@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/ratelimit"
+)
+
+func TestRateLimit_ThrottlesEachCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(ratelimit.Limit{Requests: 2, Period: time.Minute}, ratelimit.WithClock(func() time.Time { return now }))
+	keys := fakeKeys{
+		"a": {KeyID: 1, TenantID: 1, Name: "etl", Owner: "data"},
+		"b": {KeyID: 2, TenantID: 1, Name: "etl", Owner: "data"},
+	}
+	r := gin.New()
+	r.POST("/scan", middleware.AuthMiddleware(keys, nil), middleware.RateLimit(limiter), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	post := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/scan", nil)
+		req.Header.Set("X-API-Key", key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, post("a").Code)
+	assert.Equal(t, http.StatusCreated, post("a").Code)
+	w := post("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error": "rate limit exceeded", "retry_after_seconds": 30}`, w.Body.String())
+
+	assert.Equal(t, http.StatusCreated, post("b").Code, "another key of the same owner has its own budget")
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusCreated, post("a").Code)
+}
+
+func TestRateLimit_NilLimiterAllowsEverything(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", func(c *gin.Context) {
+		middleware.SetIdentity(c, models.Identity{TenantID: 1, Name: "ana"})
+	}, middleware.RateLimit(nil), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// API key scopes
+const (
+	ScopeScanRun        = "scan:run"
+	ScopeScanRead       = "scan:read"
+	ScopeRulesWrite     = "rules:write"
+	ScopeDatabasesAdmin = "databases:admin"
+	// ScopeKeysAdmin allows minting and revoking API keys
+	ScopeKeysAdmin = "keys:admin"
+	ScopeAuditRead = "audit:read"
+	// ScopeSharesWrite allows creating and revoking links that expose a report without a key
+	ScopeSharesWrite = "shares:write"
+	// ScopeTenantsAdmin allows managing tenants and global rule packs, and minting keys for
+	// other tenants. It grants no access to the data of other tenants.
+	ScopeTenantsAdmin = "tenants:admin"
+)
+
+// Scopes lists every scope an API key can be granted
+var Scopes = []string{ScopeScanRun, ScopeScanRead, ScopeRulesWrite, ScopeDatabasesAdmin, ScopeKeysAdmin, ScopeAuditRead, ScopeSharesWrite, ScopeTenantsAdmin}
+
+// APIKey is a credential for the API. Only a hash of the key is stored; the key itself is
+// returned once, when it is created.
+type APIKey struct {
+	ID       int64  `json:"id"`
+	TenantID int64  `json:"tenant_id"`
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	// Prefix is the public part of the key, used to find it and to tell keys apart in logs
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Hash       string     `json:"-"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// Identity is the caller of an API request, attached to the request context by the auth middleware.
+type Identity struct {
+	// KeyID is 0 for the bootstrap API_KEY and when authentication is disabled
+	KeyID int64 `json:"key_id"`
+	// TenantID is the tenant whose data the caller sees; every tenant-owned query is scoped by it
+	TenantID int64    `json:"tenant_id"`
+	Name     string   `json:"name"`
+	Owner    string   `json:"owner"`
+	Scopes   []string `json:"scopes"`
+}
+
+// HasScope reports whether the identity was granted scope
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// String identifies the caller in logs
+func (i Identity) String() string {
+	if i.KeyID == 0 {
+		return i.Name
+	}
+	return i.Name + " (" + i.Owner + ")"
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Audited actions. The part before the dot is the resource type.
+const (
+	AuditDatabaseCreate = "database.create"
+	AuditDatabaseUpdate = "database.update"
+	AuditDatabaseDelete = "database.delete"
+	AuditRuleCreate     = "rule.create"
+	AuditScanStart      = "scan.start"
+	AuditScanCancel     = "scan.cancel"
+	AuditReportView     = "report.view"
+	AuditScheduleCreate = "schedule.create"
+	AuditScheduleUpdate = "schedule.update"
+	AuditScheduleDelete = "schedule.delete"
+	AuditWebhookCreate  = "webhook.create"
+	AuditWebhookDelete  = "webhook.delete"
+	AuditAPIKeyCreate   = "api_key.create"
+	AuditAPIKeyRevoke   = "api_key.revoke"
+	AuditShareCreate    = "report_share.create"
+	AuditShareRevoke    = "report_share.revoke"
+	AuditLogExport      = "audit.export"
+	AuditTenantCreate   = "tenant.create"
+	AuditTenantPacks    = "tenant.rule_packs"
+	AuditRulePackCreate = "rule_pack.create"
+)
+
+// AuditEntry is one row of the append-only audit log.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	TenantID   int64     `json:"tenant_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Actor, ActorOwner and ActorKeyID come from the Identity of the request
+	Actor        string `json:"actor"`
+	ActorOwner   string `json:"actor_owner"`
+	ActorKeyID   int64  `json:"actor_key_id,omitempty"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	RequestID    string `json:"request_id"`
+	IP           string `json:"ip"`
+	// Changes maps each changed field to its values before and after the action
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the before/after value of a field; Before is nil for created fields and
+// After for deleted ones.
+type FieldChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// AuditFilter selects audit entries; zero fields do not filter. Entries are returned newest
+// first, and BeforeID pages through them.
+type AuditFilter struct {
+	// TenantID is required: the log of a tenant is only readable by that tenant
+	TenantID     int64
+	Actor        string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	From         *time.Time
+	To           *time.Time
+	BeforeID     int64
+	Limit        int
+}
@@ -1,9 +1,126 @@
 package models
 
 type Database struct {
-	ID       int64  `json:"id"`
+	ID int64 `json:"id"`
+	// TenantID is set from the caller's identity; a value sent by the client is ignored
+	TenantID int64 `json:"tenant_id"`
+	// Name is an optional friendly name, unique among registered databases
+	Name string `json:"name,omitempty"`
+	// Environment is one of production, staging, development or test (optional)
+	Environment string `json:"environment,omitempty"`
+	// Owner is the team or person responsible for the data (optional)
+	Owner    string `json:"owner,omitempty"`
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+	// Password is accepted on create/update but never returned by the API. Stored passwords
+	// are in EncryptedPassword unless no master key is configured.
+	Password          string           `json:"password,omitempty"`
+	EncryptedPassword *EncryptedSecret `json:"-"`
+	// PasswordRef points to a secret resolved at connection time instead of a stored password,
+	// e.g. env:SCANNER_SECRET_T1_SALES, file:sales/password or vault:secret/scanner/tenants/1/sales#password
+	PasswordRef string         `json:"password_ref,omitempty"`
+	Sampling    SamplingConfig `json:"sampling"`
+	// ReplicaHost/ReplicaPort, when set, are used by scans instead of the primary
+	ReplicaHost string       `json:"replica_host,omitempty"`
+	ReplicaPort int          `json:"replica_port,omitempty"`
+	Limits      TargetLimits `json:"limits"`
+	TLS         TLSSettings  `json:"tls"`
+	// SSH, when its host is set, tunnels every connection through a bastion host
+	SSH SSHTunnel `json:"ssh"`
+}
+
+// TLS modes of TLSSettings.Mode, named after MySQL's --ssl-mode
+const (
+	TLSDisabled       = "disabled"
+	TLSPreferred      = "preferred"
+	TLSRequired       = "required"
+	TLSVerifyCA       = "verify-ca"
+	TLSVerifyIdentity = "verify-identity"
+)
+
+// TLSModes accepted in TLSSettings.Mode ("" means disabled)
+var TLSModes = []string{TLSDisabled, TLSPreferred, TLSRequired, TLSVerifyCA, TLSVerifyIdentity}
+
+// TLSSettings configures encryption of the connections to a registered database.
+type TLSSettings struct {
+	// Mode: preferred and required encrypt without checking the server certificate, verify-ca
+	// checks it against CA and verify-identity also checks its name
+	Mode string `json:"mode,omitempty"`
+	// CA is the PEM certificate bundle trusted for the server; empty uses the system roots
+	CA string `json:"ca,omitempty"`
+	// Cert is the PEM client certificate; its private key is read from the secret KeyRef
+	Cert   string `json:"cert,omitempty"`
+	KeyRef string `json:"key_ref,omitempty"`
+	// ServerName overrides the host name verified by verify-identity (and sent as SNI)
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// SSHTunnel is a bastion host the scanner connects through.
+type SSHTunnel struct {
+	Host string `json:"host,omitempty"`
+	// Port defaults to 22
+	Port int    `json:"port,omitempty"`
+	User string `json:"user,omitempty"`
+	// KeyRef is a secret reference to the PEM private key (see secrets.Providers)
+	KeyRef string `json:"key_ref,omitempty"`
+	// HostKey is the SHA256 fingerprint of the bastion's host key, as printed by ssh-keygen -lf
+	HostKey string `json:"host_key,omitempty"`
+}
+
+// TargetLimits protects a registered server from the load generated by scans.
+// Zero values mean "use the default" (see targetdb.WithDefaults).
+type TargetLimits struct {
+	// MaxConnections caps the open connections of all scans to this server
+	MaxConnections int `json:"max_connections,omitempty"`
+	// MaxQPS caps the queries per second all scans send to this server
+	MaxQPS float64 `json:"max_qps,omitempty"`
+	// MaxThreadsRunning pauses the scan while the server reports more running threads; -1 disables the check
+	MaxThreadsRunning int `json:"max_threads_running,omitempty"`
+}
+
+// SamplingConfig controls how v2 scans read sample values from a registered database.
+// Zero values mean "use the default" (see sampling.WithDefaults).
+type SamplingConfig struct {
+	// Strategy is one of first-n, pk-random, percentage or recent
+	Strategy string `json:"strategy,omitempty"`
+	// SampleSize is the number of distinct values sent to the LLM per column
+	SampleSize int `json:"sample_size,omitempty"`
+	// RowLimit caps the rows read by a single sampling query
+	RowLimit int `json:"row_limit,omitempty"`
+	// Percent is the share of rows kept by the percentage strategy (0-100]
+	Percent float64 `json:"percent,omitempty"`
+	// MaxExecutionMs is sent as a MAX_EXECUTION_TIME hint on every sampling/profiling query
+	MaxExecutionMs int `json:"max_execution_ms,omitempty"`
+}
+
+// EncryptedSecret is a value sealed with envelope encryption (see secrets.Keyring)
+type EncryptedSecret struct {
+	// KeyID is the master key that wraps the data key
+	KeyID string
+	// WrappedKey is the data key encrypted with the master key
+	WrappedKey []byte
+	// Ciphertext is the value encrypted with the data key
+	Ciphertext []byte
+}
+
+// Environments accepted in Database.Environment
+var Environments = []string{"production", "staging", "development", "test"}
+
+// ConnectionTest is the outcome of POST /database/:id/test
+type ConnectionTest struct {
+	// OK is true when the connection succeeded and every check passed
+	OK            bool             `json:"ok"`
+	ServerVersion string           `json:"server_version,omitempty"`
+	Schemas       []string         `json:"schemas"`
+	Checks        []PrivilegeCheck `json:"checks"`
+	LatencyMs     int64            `json:"latency_ms"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// PrivilegeCheck is one capability the scanner needs on a target server
+type PrivilegeCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
 }
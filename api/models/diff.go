@@ -0,0 +1,37 @@
+package models
+
+// TableRef identifies a scanned table
+type TableRef struct {
+	SchemaName string `json:"schema_name"`
+	TableName  string `json:"table_name"`
+}
+
+// ColumnChange describes a column present in either scan of a diff. FromInfoType is empty for
+// columns that only exist in the newer scan, ToInfoType for columns that disappeared.
+type ColumnChange struct {
+	SchemaName   string `json:"schema_name"`
+	TableName    string `json:"table_name"`
+	ColumnName   string `json:"column_name"`
+	FromInfoType string `json:"from_info_type,omitempty"`
+	ToInfoType   string `json:"to_info_type,omitempty"`
+}
+
+// ScanDiff compares the results of two scans
+type ScanDiff struct {
+	FromScanID     int64          `json:"from_scan_id"`
+	ToScanID       int64          `json:"to_scan_id"`
+	AddedTables    []TableRef     `json:"added_tables"`
+	RemovedTables  []TableRef     `json:"removed_tables"`
+	AddedColumns   []ColumnChange `json:"added_columns"`
+	RemovedColumns []ColumnChange `json:"removed_columns"`
+	ChangedColumns []ColumnChange `json:"changed_columns"`
+	// NewlySensitive lists columns that hold sensitive data in the newer scan but did not
+	// (or did not exist) in the older one
+	NewlySensitive []ColumnChange `json:"newly_sensitive"`
+}
+
+// Empty reports whether the two scans have the same results
+func (d ScanDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.AddedColumns) == 0 &&
+		len(d.RemovedColumns) == 0 && len(d.ChangedColumns) == 0
+}
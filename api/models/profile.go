@@ -0,0 +1,21 @@
+package models
+
+// ShapeCount is a value shape (e.g. "999-99-9999") and how many sampled values have it
+type ShapeCount struct {
+	Shape string `json:"shape"`
+	Count int    `json:"count"`
+}
+
+// ColumnProfile holds statistics computed over a bounded sample of a column's values
+type ColumnProfile struct {
+	SchemaName       string       `json:"-"`
+	TableName        string       `json:"-"`
+	ColumnName       string       `json:"-"`
+	SampledRows      int          `json:"sampled_rows"`
+	NullRatio        float64      `json:"null_ratio"`
+	DistinctCount    int          `json:"approx_distinct"`
+	MinLength        int          `json:"min_length"`
+	MaxLength        int          `json:"max_length"`
+	TopShapes        []ShapeCount `json:"top_shapes"`
+	CharClassEntropy float64      `json:"char_class_entropy"`
+}
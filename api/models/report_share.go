@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Outcomes of a ReportShareAccess
+const (
+	ShareAccessGranted = "granted"
+	ShareAccessExpired = "expired"
+	ShareAccessRevoked = "revoked"
+)
+
+// ReportShare is a time-limited link to the HTML report of a scan, for readers without an API key.
+type ReportShare struct {
+	ID        int64      `json:"id"`
+	TenantID  int64      `json:"tenant_id"`
+	ScanID    int64      `json:"scan_id"`
+	Note      string     `json:"note,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Token and URL are only returned when the link is created
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// ReportShareAccess records one request made with a share link.
+type ReportShareAccess struct {
+	ID         int64     `json:"id"`
+	ShareID    int64     `json:"share_id"`
+	AccessedAt time.Time `json:"accessed_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Path       string    `json:"path"`
+	Outcome    string    `json:"outcome"`
+}
@@ -1,7 +1,12 @@
 package models
 
+// ClassificationRule belongs either to a global rule pack (PackID) or to a tenant (TenantID).
 type ClassificationRule struct {
 	ID       int64  `json:"id"`
+	PackID   *int64 `json:"pack_id,omitempty"`
+	TenantID *int64 `json:"tenant_id,omitempty"`
 	TypeName string `json:"type_name"`
 	Regex    string `json:"regex"`
+	// Disabled tenant rules switch off the inherited rules with the same type name
+	Disabled bool `json:"disabled,omitempty"`
 }
@@ -1,17 +1,86 @@
 package models
 
+const (
+	// InfoTypeBudgetExceeded marks columns left unclassified because the scan's LLM budget was spent
+	InfoTypeBudgetExceeded = "UNCLASSIFIED_BUDGET"
+	// InfoTypeClassificationError marks columns the LLM could not classify after retries and fallback
+	InfoTypeClassificationError = "UNCLASSIFIED_ERROR"
+)
+
+// ScanOptions are the optional stages and settings of a scan run
+type ScanOptions struct {
+	// Profile computes a ColumnProfile for every scanned column
+	Profile bool `json:"profile"`
+	// Sampling is the target's sampling configuration, optionally overridden per request
+	Sampling SamplingConfig `json:"sampling"`
+	// Incremental copies forward the results of tables unchanged since the last successful scan
+	Incremental bool `json:"incremental"`
+}
+
 // ScanResult represents a raw stored result row (no ID exposed in API responses)
 type ScanResult struct {
-	TableName  string `json:"table_name"`
-	ColumnName string `json:"column_name"`
-	InfoType   string `json:"info_type"`
-	SchemaName string `json:"schema_name,omitempty"`
+	TableName          string `json:"table_name"`
+	ColumnName         string `json:"column_name"`
+	InfoType           string `json:"info_type"`
+	SchemaName         string `json:"schema_name,omitempty"`
+	InjectionSuspected bool   `json:"injection_suspected,omitempty"`
+	// RulesVersion identifies the rule set (and model, for v2) that produced InfoType
+	RulesVersion string `json:"-"`
+}
+
+// TableFingerprint records the structure of a scanned table and the rule set it was classified with.
+// Incremental scans reuse a table's results when both match the previous scan.
+type TableFingerprint struct {
+	SchemaName   string
+	TableName    string
+	Fingerprint  string
+	RulesVersion string
+}
+
+// ScanHistory describes a single scan execution as stored in scan_history
+type ScanHistory struct {
+	ID             int64  `json:"scan_id"`
+	TenantID       int64  `json:"tenant_id"`
+	DatabaseID     int64  `json:"database_id"`
+	APIVersion     string `json:"api_version"`
+	ExecutedAt     string `json:"executed_at"`
+	Status         string `json:"status"`
+	LLMCacheHits   int    `json:"llm_cache_hits"`
+	LLMCacheMisses int    `json:"llm_cache_misses"`
+	// TablesScanned/TablesReused split the tables of an incremental scan
+	TablesScanned int `json:"tables_scanned"`
+	TablesReused  int `json:"tables_reused"`
+	LLMUsage
+}
+
+// LLMUsage aggregates the LLM calls made by a scan: tokens, latency, retries and estimated cost
+type LLMUsage struct {
+	Calls            int     `json:"llm_calls"`
+	PromptTokens     int     `json:"llm_prompt_tokens"`
+	CompletionTokens int     `json:"llm_completion_tokens"`
+	LatencyMs        int64   `json:"llm_latency_ms"`
+	Retries          int     `json:"llm_retries"`
+	Errors           int     `json:"llm_errors"`
+	CostUSD          float64 `json:"llm_cost_usd"`
+	CostUnknown      bool    `json:"llm_cost_unknown"`
+	BudgetUSD        float64 `json:"llm_budget_usd"`
+	BudgetExhausted  bool    `json:"llm_budget_exhausted"`
+}
+
+// AvgLatencyMs returns the mean latency per LLM call
+func (u LLMUsage) AvgLatencyMs() int64 {
+	if u.Calls == 0 {
+		return 0
+	}
+	return u.LatencyMs / int64(u.Calls)
 }
 
 // ColumnView is used in API responses to describe a column and its detected type
 type ColumnView struct {
-	ColumnName string `json:"column_name"`
-	InfoType   string `json:"info_type"`
+	ColumnName         string         `json:"column_name"`
+	InfoType           string         `json:"info_type"`
+	InjectionSuspected bool           `json:"injection_suspected,omitempty"`
+	Profile            *ColumnProfile `json:"profile,omitempty"`
 }
 
 // TableView groups columns under a table in the API response
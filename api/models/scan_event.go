@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Scan progress event types streamed by GET /scan/:id/events
+const (
+	ScanEventStarted          = "scan_started"
+	ScanEventTableStarted     = "table_started"
+	ScanEventTableReused      = "table_reused"
+	ScanEventColumnClassified = "column_classified"
+	ScanEventLLMError         = "llm_error"
+	// ScanEventFinished is always the last event of a scan; Status holds the final status
+	ScanEventFinished = "scan_finished"
+)
+
+// ScanEvent reports progress of a running scan
+type ScanEvent struct {
+	// Seq increases by one per event of the same scan, starting at 1
+	Seq      int64     `json:"seq"`
+	ScanID   int64     `json:"scan_id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Schema   string    `json:"schema,omitempty"`
+	Table    string    `json:"table,omitempty"`
+	Column   string    `json:"column,omitempty"`
+	InfoType string    `json:"info_type,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Schedule run statuses as stored in scan_schedule_runs
+const (
+	RunStatusRunning = "running"
+	RunStatusSuccess = "success"
+	RunStatusFailed  = "failed"
+	// RunStatusSkipped is a due run not started because the previous run was still going
+	RunStatusSkipped = "skipped"
+	// RunStatusMissed records activations that passed while no scheduler was running
+	RunStatusMissed = "missed"
+)
+
+// ScanSchedule starts a scan of a registered database on a cron schedule
+type ScanSchedule struct {
+	ID         int64  `json:"id"`
+	TenantID   int64  `json:"tenant_id"`
+	DatabaseID int64  `json:"database_id"`
+	Cron       string `json:"cron"`
+	// Timezone is the IANA zone the cron expression is evaluated in (default UTC)
+	Timezone string `json:"timezone"`
+	// Version is "v1" (column names) or "v2" (sampling + LLM)
+	Version    string      `json:"version"`
+	Options    ScanOptions `json:"options"`
+	Enabled    bool        `json:"enabled"`
+	NextRunAt  time.Time   `json:"next_run_at"`
+	LastRunAt  *time.Time  `json:"last_run_at,omitempty"`
+	LastScanID int64       `json:"last_scan_id,omitempty"`
+	LastStatus string      `json:"last_status,omitempty"`
+	MissedRuns int         `json:"missed_runs"`
+}
+
+// ScheduleRun is one activation of a schedule: a started scan, a skipped run or missed runs
+type ScheduleRun struct {
+	ID          int64     `json:"id"`
+	ScheduleID  int64     `json:"schedule_id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	ScanID      int64     `json:"scan_id,omitempty"`
+	Status      string    `json:"status"`
+	Message     string    `json:"message,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// DefaultTenantID is the tenant seeded by init.sql. Data created before tenants existed,
+// the bootstrap API_KEY and AUTH_DISABLED belong to it.
+const DefaultTenantID int64 = 1
+
+// Tenant is a team or business unit sharing the deployment. Its databases, rules, scans,
+// schedules, webhooks, share links, API keys and audit log are invisible to other tenants.
+type Tenant struct {
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	// RulePacks are the global rule packs the tenant inherits
+	RulePacks []int64   `json:"rule_packs"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RulePack is a global set of classification rules that tenants subscribe to.
+type RulePack struct {
+	ID          int64                `json:"id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Rules       []ClassificationRule `json:"rules,omitempty"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Webhook events
+const (
+	EventScanSucceeded = "scan.succeeded"
+	EventScanFailed    = "scan.failed"
+	EventScanCancelled = "scan.cancelled"
+	// EventNewSensitiveColumns fires after a successful scan that found sensitive columns the
+	// previous successful scan of the same database did not have
+	EventNewSensitiveColumns = "scan.new_sensitive_columns"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{EventScanSucceeded, EventScanFailed, EventScanCancelled, EventNewSensitiveColumns}
+
+// Webhook is an outbound HTTP endpoint notified about scans. A nil DatabaseID makes it global to its tenant.
+type Webhook struct {
+	ID         int64  `json:"id"`
+	TenantID   int64  `json:"tenant_id"`
+	DatabaseID *int64 `json:"database_id"`
+	URL        string `json:"url"`
+	// Secret signs every payload (HMAC-SHA256); it is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	// EncryptedSecret replaces Secret in storage when a master key is configured
+	EncryptedSecret *EncryptedSecret `json:"-"`
+	// Events the webhook subscribes to; empty means all of them
+	Events  []string `json:"events"`
+	Enabled bool     `json:"enabled"`
+}
+
+// Subscribed reports whether the webhook wants event
+func (w Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the JSON payload posted to webhooks
+type WebhookEvent struct {
+	// ID is unique per event; retries of the same delivery keep it so receivers can deduplicate
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	DatabaseID int64     `json:"database_id"`
+	ScanID     int64     `json:"scan_id"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	// PreviousScanID and NewlySensitive are set for scan.new_sensitive_columns
+	PreviousScanID int64          `json:"previous_scan_id,omitempty"`
+	NewlySensitive []ColumnChange `json:"newly_sensitive,omitempty"`
+	Results        DatabaseResult `json:"results"`
+}
+
+// WebhookDelivery is one attempt to post an event to a webhook
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  int64     `json:"webhook_id"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	ScanID     int64     `json:"scan_id"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
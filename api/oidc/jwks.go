@@ -0,0 +1,226 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"meli-challenge/logger"
+)
+
+// jwk is the subset of RFC 7517 fields needed for RSA and EC signature keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	// alg is the algorithm the JWKS pins the key to, if any
+	alg string
+}
+
+// keySet caches the signing keys of the issuer. An unknown kid refreshes the cache (at most
+// once per minRefresh), which is how key rotation is picked up before the TTL runs out. A
+// failed refresh also waits minRefresh before the next attempt, and concurrent requests share
+// one fetch, made without holding the lock.
+type keySet struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time     // last successful fetch
+	triedAt   time.Time     // last fetch attempt
+	lastErr   error         // error of the last attempt, if it failed
+	fetching  chan struct{} // closed when the running fetch ends
+}
+
+// get returns the key with kid. An empty kid is accepted when the set has a single key.
+func (s *keySet) get(ctx context.Context, kid string) (publicKey, error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		key, found := s.lookup(kid)
+		if found && now.Sub(s.fetchedAt) < s.ttl {
+			s.mu.Unlock()
+			return key, nil
+		}
+		if now.Sub(s.triedAt) < s.minRefresh {
+			lastErr := s.lastErr
+			s.mu.Unlock()
+			switch {
+			case found:
+				// keep validating with the cached key while the issuer is unreachable
+				return key, nil
+			case lastErr != nil:
+				return publicKey{}, lastErr
+			default:
+				return publicKey{}, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+			}
+		}
+		if wait := s.fetching; wait != nil {
+			s.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return publicKey{}, ctx.Err()
+			}
+		}
+		done, triedBefore := make(chan struct{}), s.triedAt
+		s.fetching, s.triedAt = done, now
+		s.mu.Unlock()
+
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		s.fetching = nil
+		close(done)
+		switch {
+		case err == nil:
+			s.keys, s.fetchedAt, s.lastErr = keys, now, nil
+		case ctx.Err() != nil:
+			// the caller gave up: that says nothing about the issuer, let the next one retry
+			s.triedAt = triedBefore
+		default:
+			s.lastErr = err
+		}
+		key, found = s.lookup(kid)
+		s.mu.Unlock()
+
+		if err != nil {
+			if found {
+				logger.Warnf("OIDC JWKS refresh failed, using cached keys: %v", err)
+				return key, nil
+			}
+			return publicKey{}, err
+		}
+		if !found {
+			return publicKey{}, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+		}
+		return key, nil
+	}
+}
+
+func (s *keySet) lookup(kid string) (publicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+func (s *keySet) fetch(ctx context.Context) (map[string]publicKey, error) {
+	var body struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, s.client, s.url, &body); err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(body.Keys))
+	for _, k := range body.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logger.Warnf("OIDC JWKS key %q ignored: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = publicKey{key: pub, alg: k.Alg}
+	}
+	logger.Infof("OIDC JWKS loaded %d signing keys from %s", len(keys), s.url)
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA key too small or with an invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC point is not on %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
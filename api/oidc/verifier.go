@@ -0,0 +1,381 @@
+// Package oidc validates bearer JWTs issued by the corporate SSO and maps their claims to
+// API scopes.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/config"
+)
+
+// ErrInvalidToken wraps every reason a token is rejected. Other errors (an unreachable
+// issuer) mean the token could not be checked.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config of the bearer token verifier. Zero durations are used as they are; ConfigFromEnv
+// fills in the defaults.
+type Config struct {
+	// Issuer must match the iss claim; its /.well-known/openid-configuration gives the JWKS
+	// URL unless JWKSURL is set
+	Issuer   string
+	Audience string
+	JWKSURL  string
+	// ScopesClaim holds API scopes, as a space-separated string or an array
+	ScopesClaim string
+	// GroupsClaim holds groups, mapped to scopes through GroupScopes
+	GroupsClaim string
+	GroupScopes map[string][]string
+	// UsernameClaim names the caller in logs and audit records; sub is the fallback
+	UsernameClaim string
+	// TenantClaim holds the slug of the caller's tenant, turned into its id by ResolveTenant
+	// (sql.ErrNoRows for unknown slugs). Without ResolveTenant every token belongs to the
+	// default tenant.
+	TenantClaim   string
+	ResolveTenant func(slug string) (int64, error)
+	// Leeway is the clock skew tolerated for exp, nbf and iat
+	Leeway time.Duration
+	// JWKSCacheTTL is how long fetched keys are trusted; JWKSMinRefresh limits how often an
+	// unknown kid can trigger a refetch
+	JWKSCacheTTL   time.Duration
+	JWKSMinRefresh time.Duration
+	HTTPClient     *http.Client
+}
+
+// ConfigFromEnv reads OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL, OIDC_SCOPES_CLAIM (scope),
+// OIDC_GROUPS_CLAIM (groups), OIDC_GROUP_SCOPES, OIDC_USERNAME_CLAIM (email),
+// OIDC_TENANT_CLAIM (tenant), OIDC_CLOCK_SKEW_SEC (60) and OIDC_JWKS_CACHE_TTL_SEC (3600).
+func ConfigFromEnv() (Config, error) {
+	groups, err := ParseGroupScopes(os.Getenv("OIDC_GROUP_SCOPES"))
+	if err != nil {
+		return Config{}, fmt.Errorf("OIDC_GROUP_SCOPES: %w", err)
+	}
+	return Config{
+		Issuer:         os.Getenv("OIDC_ISSUER"),
+		Audience:       os.Getenv("OIDC_AUDIENCE"),
+		JWKSURL:        os.Getenv("OIDC_JWKS_URL"),
+		ScopesClaim:    config.EnvString("OIDC_SCOPES_CLAIM", "scope"),
+		GroupsClaim:    config.EnvString("OIDC_GROUPS_CLAIM", "groups"),
+		GroupScopes:    groups,
+		UsernameClaim:  config.EnvString("OIDC_USERNAME_CLAIM", "email"),
+		TenantClaim:    config.EnvString("OIDC_TENANT_CLAIM", "tenant"),
+		Leeway:         time.Duration(config.EnvInt("OIDC_CLOCK_SKEW_SEC", 60, 1)) * time.Second,
+		JWKSCacheTTL:   time.Duration(config.EnvInt("OIDC_JWKS_CACHE_TTL_SEC", 3600, 1)) * time.Second,
+		JWKSMinRefresh: 30 * time.Second,
+	}, nil
+}
+
+// Enabled reports whether bearer tokens are accepted
+func (c Config) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// ParseGroupScopes parses "group=scope,scope;other-group=scope".
+func ParseGroupScopes(s string) (map[string][]string, error) {
+	groups := map[string][]string{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, scopes, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("entry %q must be group=scope,scope", entry)
+		}
+		for _, scope := range strings.Split(scopes, ",") {
+			scope = strings.TrimSpace(scope)
+			if !slices.Contains(models.Scopes, scope) {
+				return nil, fmt.Errorf("unknown scope %q for group %q", scope, group)
+			}
+			groups[group] = append(groups[group], scope)
+		}
+	}
+	return groups, nil
+}
+
+// Verifier checks bearer tokens against the issuer's signing keys.
+type Verifier struct {
+	cfg Config
+
+	mu   sync.Mutex
+	keys *keySet
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if err := requireHTTPS(cfg.Issuer); err != nil {
+		return nil, fmt.Errorf("OIDC issuer: %w", err)
+	}
+	if cfg.JWKSURL != "" {
+		if err := requireHTTPS(cfg.JWKSURL); err != nil {
+			return nil, fmt.Errorf("OIDC JWKS URL: %w", err)
+		}
+	}
+	if cfg.Audience == "" {
+		return nil, fmt.Errorf("OIDC audience is required")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{cfg: cfg}, nil
+}
+
+// AuthenticateBearer verifies token and returns the identity it carries.
+func (v *Verifier) AuthenticateBearer(ctx context.Context, token string) (models.Identity, error) {
+	claims, err := v.Verify(ctx, token)
+	if err != nil {
+		return models.Identity{}, err
+	}
+	identity := v.identity(claims)
+	if identity.TenantID, err = v.tenant(claims); err != nil {
+		return models.Identity{}, err
+	}
+	return identity, nil
+}
+
+// tenant resolves the tenant claim. A token without one, or naming an unknown tenant, is rejected.
+func (v *Verifier) tenant(claims map[string]any) (int64, error) {
+	if v.cfg.ResolveTenant == nil {
+		return models.DefaultTenantID, nil
+	}
+	slug, _ := claims[v.cfg.TenantClaim].(string)
+	if slug == "" {
+		return 0, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.cfg.TenantClaim)
+	}
+	id, err := v.cfg.ResolveTenant(slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: unknown tenant %q", ErrInvalidToken, slug)
+	}
+	return id, err
+}
+
+// Verify checks the signature, issuer, audience and validity window of token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	if len(header.Crit) > 0 {
+		return nil, fmt.Errorf("%w: unsupported critical header %v", ErrInvalidToken, header.Crit)
+	}
+	hash, ok := algHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: algorithm %q not accepted", ErrInvalidToken, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+
+	keys, err := v.keySet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is not for %s", ErrInvalidToken, header.Kid, header.Alg)
+	}
+	if err := verifySignature(header.Alg, hash, key.key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validateClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("issuer %q not accepted", iss)
+	}
+	if !slices.Contains(stringsClaim(claims["aud"]), v.cfg.Audience) {
+		return fmt.Errorf("audience does not include %q", v.cfg.Audience)
+	}
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("exp claim is required")
+	}
+	if !now.Before(exp.Add(v.cfg.Leeway)) {
+		return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(v.cfg.Leeway).Before(iat) {
+		return fmt.Errorf("token issued in the future")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return fmt.Errorf("sub claim is required")
+	}
+	return nil
+}
+
+// identity maps claims to the caller: scopes from the scopes claim (unknown values, such as
+// "openid", are ignored) plus those of every mapped group.
+func (v *Verifier) identity(claims map[string]any) models.Identity {
+	granted := map[string]bool{}
+	for _, s := range stringsClaim(claims[v.cfg.ScopesClaim]) {
+		granted[s] = true
+	}
+	for _, g := range stringsClaim(claims[v.cfg.GroupsClaim]) {
+		for _, s := range v.cfg.GroupScopes[g] {
+			granted[s] = true
+		}
+	}
+	scopes := []string{}
+	for _, s := range models.Scopes {
+		if granted[s] {
+			scopes = append(scopes, s)
+		}
+	}
+
+	name, _ := claims[v.cfg.UsernameClaim].(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+	return models.Identity{Name: name, Owner: "oidc", Scopes: scopes}
+}
+
+// keySet returns the issuer's key cache, discovering the JWKS URL on first use.
+func (v *Verifier) keySet(ctx context.Context) (*keySet, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.keys != nil {
+		return v.keys, nil
+	}
+
+	jwksURL := v.cfg.JWKSURL
+	if jwksURL == "" {
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discovery := strings.TrimRight(v.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := getJSON(ctx, v.cfg.HTTPClient, discovery, &doc); err != nil {
+			return nil, fmt.Errorf("OIDC discovery: %w", err)
+		}
+		if doc.Issuer != v.cfg.Issuer {
+			return nil, fmt.Errorf("OIDC discovery: issuer %q does not match %q", doc.Issuer, v.cfg.Issuer)
+		}
+		if err := requireHTTPS(doc.JWKSURI); err != nil {
+			return nil, fmt.Errorf("OIDC discovery: jwks_uri: %w", err)
+		}
+		jwksURL = doc.JWKSURI
+	}
+	v.keys = &keySet{url: jwksURL, client: v.cfg.HTTPClient, ttl: v.cfg.JWKSCacheTTL, minRefresh: v.cfg.JWKSMinRefresh}
+	return v.keys, nil
+}
+
+// algHashes lists the accepted algorithms. "none" and the HMAC family are never accepted:
+// the verifier only holds public keys.
+var algHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+var esCurves = map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, input string, sig []byte) error {
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != esCurves[alg] {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid ECDSA signature length")
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("ECDSA signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("key type does not match %s", alg)
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringsClaim reads a claim that is a string of space-separated values or an array of strings.
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+func requireHTTPS(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q must be an https URL", raw)
+	}
+	return nil
+}
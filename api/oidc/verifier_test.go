@@ -0,0 +1,323 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/oidc"
+)
+
+// issuer is a stand-in SSO: discovery document plus a JWKS whose keys the test can rotate.
+type issuer struct {
+	srv     *httptest.Server
+	mu      sync.Mutex
+	jwks    []map[string]string
+	fetches atomic.Int32
+	down    atomic.Bool
+}
+
+func newIssuer(t *testing.T) *issuer {
+	is := &issuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": is.srv.URL, "jwks_uri": is.srv.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		is.fetches.Add(1)
+		if is.down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		is.mu.Lock()
+		defer is.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": is.jwks})
+	})
+	is.srv = httptest.NewTLSServer(mux)
+	t.Cleanup(is.srv.Close)
+	return is
+}
+
+func (is *issuer) publish(keys ...map[string]string) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.jwks = keys
+}
+
+func (is *issuer) config() oidc.Config {
+	return oidc.Config{
+		Issuer:        is.srv.URL,
+		Audience:      "dlp-scanner",
+		ScopesClaim:   "scope",
+		GroupsClaim:   "groups",
+		GroupScopes:   map[string][]string{"dlp-admins": {models.ScopeDatabasesAdmin, models.ScopeScanRun}},
+		UsernameClaim: "email",
+		Leeway:        time.Minute,
+		JWKSCacheTTL:  time.Hour,
+		HTTPClient:    is.srv.Client(),
+	}
+}
+
+func (is *issuer) claims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": is.srv.URL, "aud": []string{"dlp-scanner", "other"}, "sub": "u-123", "email": "ana@example.com",
+		"iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func rsaJWK(kid string, k *rsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64(sig)
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return k
+}
+
+func TestVerifier_MapsScopesAndGroups(t *testing.T) {
+	is := newIssuer(t)
+	key := rsaKey(t)
+	is.publish(rsaJWK("k1", key))
+	v, err := oidc.NewVerifier(is.config())
+	require.NoError(t, err)
+
+	claims := is.claims()
+	claims["scope"] = "openid profile scan:read"
+	claims["groups"] = []string{"dlp-admins", "everyone"}
+	identity, err := v.AuthenticateBearer(context.Background(), sign(t, "RS256", "k1", key, claims))
+	require.NoError(t, err)
+	assert.Equal(t, models.Identity{TenantID: models.DefaultTenantID, Name: "ana@example.com", Owner: "oidc",
+		Scopes: []string{models.ScopeScanRun, models.ScopeScanRead, models.ScopeDatabasesAdmin}}, identity)
+
+	// the keys are cached
+	_, err = v.AuthenticateBearer(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), is.fetches.Load())
+}
+
+func TestVerifier_ResolvesTenantClaim(t *testing.T) {
+	is := newIssuer(t)
+	key := rsaKey(t)
+	is.publish(rsaJWK("k1", key))
+	cfg := is.config()
+	cfg.TenantClaim = "tenant"
+	cfg.ResolveTenant = func(slug string) (int64, error) {
+		if slug == "acme" {
+			return 7, nil
+		}
+		return 0, sql.ErrNoRows
+	}
+	v, err := oidc.NewVerifier(cfg)
+	require.NoError(t, err)
+
+	claims := is.claims()
+	claims["tenant"] = "acme"
+	identity, err := v.AuthenticateBearer(context.Background(), sign(t, "RS256", "k1", key, claims))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), identity.TenantID)
+
+	claims["tenant"] = "globex"
+	_, err = v.AuthenticateBearer(context.Background(), sign(t, "RS256", "k1", key, claims))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	_, err = v.AuthenticateBearer(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken, "tokens without a tenant are rejected")
+}
+
+func TestVerifier_AcceptsES256(t *testing.T) {
+	is := newIssuer(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	is.publish(ecJWK("ec1", key))
+	v, err := oidc.NewVerifier(is.config())
+	require.NoError(t, err)
+
+	claims := is.claims()
+	delete(claims, "email")
+	identity, err := v.AuthenticateBearer(context.Background(), sign(t, "ES256", "ec1", key, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "u-123", identity.Name)
+	assert.Empty(t, identity.Scopes)
+}
+
+func TestVerifier_RejectsInvalidTokens(t *testing.T) {
+	is := newIssuer(t)
+	key, other := rsaKey(t), rsaKey(t)
+	is.publish(rsaJWK("k1", key))
+	v, err := oidc.NewVerifier(is.config())
+	require.NoError(t, err)
+
+	with := func(k string, val any) map[string]any {
+		c := is.claims()
+		if val == nil {
+			delete(c, k)
+		} else {
+			c[k] = val
+		}
+		return c
+	}
+	valid := sign(t, "RS256", "k1", key, is.claims())
+	parts := strings.Split(valid, ".")
+	none := b64([]byte(`{"alg":"none","kid":"k1"}`)) + "." + parts[1] + "."
+	hs := b64([]byte(`{"alg":"HS256","kid":"k1"}`)) + "." + parts[1] + "." + parts[2]
+	tampered := parts[0] + "." + b64([]byte(`{"iss":"`+is.srv.URL+`","aud":"dlp-scanner","sub":"root","exp":9999999999}`)) + "." + parts[2]
+
+	cases := map[string]string{
+		"expired":        sign(t, "RS256", "k1", key, with("exp", time.Now().Add(-2*time.Minute).Unix())),
+		"not yet valid":  sign(t, "RS256", "k1", key, with("nbf", time.Now().Add(time.Hour).Unix())),
+		"no exp":         sign(t, "RS256", "k1", key, with("exp", nil)),
+		"wrong issuer":   sign(t, "RS256", "k1", key, with("iss", "https://evil.example.com")),
+		"wrong audience": sign(t, "RS256", "k1", key, with("aud", "another-app")),
+		"other key":      sign(t, "RS256", "k1", other, is.claims()),
+		"unknown kid":    sign(t, "RS256", "k9", key, is.claims()),
+		"alg none":       none,
+		"alg HS256":      hs,
+		"tampered":       tampered,
+		"garbage":        "not.a.jwt",
+	}
+	for name, token := range cases {
+		_, err := v.Verify(context.Background(), token)
+		assert.ErrorIs(t, err, oidc.ErrInvalidToken, name)
+	}
+}
+
+func TestVerifier_PicksUpRotatedKeys(t *testing.T) {
+	is := newIssuer(t)
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+	is.publish(rsaJWK("old", oldKey))
+	v, err := oidc.NewVerifier(is.config())
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "old", oldKey, is.claims()))
+	require.NoError(t, err)
+
+	is.publish(rsaJWK("new", newKey))
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "new", newKey, is.claims()))
+	require.NoError(t, err, "an unknown kid refetches the JWKS")
+	assert.Equal(t, int32(2), is.fetches.Load())
+
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "old", oldKey, is.claims()))
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken, "retired keys stop working")
+}
+
+func TestVerifier_LimitsRefetchesForUnknownKeys(t *testing.T) {
+	is := newIssuer(t)
+	key := rsaKey(t)
+	is.publish(rsaJWK("k1", key))
+	cfg := is.config()
+	cfg.JWKSMinRefresh = time.Hour
+	v, err := oidc.NewVerifier(cfg)
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = v.Verify(context.Background(), sign(t, "RS256", "bogus", key, is.claims()))
+		assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+	}
+	assert.Equal(t, int32(1), is.fetches.Load())
+}
+
+func TestVerifier_FailedRefreshBacksOff(t *testing.T) {
+	is := newIssuer(t)
+	key := rsaKey(t)
+	is.publish(rsaJWK("k1", key))
+	cfg := is.config()
+	cfg.JWKSCacheTTL = time.Nanosecond // every request finds the keys stale
+	cfg.JWKSMinRefresh = 50 * time.Millisecond
+	v, err := oidc.NewVerifier(cfg)
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	is.down.Store(true)
+	for i := 0; i < 5; i++ {
+		_, err = v.Verify(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+		assert.NoError(t, err, "the cached key keeps working")
+	}
+	assert.Equal(t, int32(2), is.fetches.Load(), "one failed refresh, then no retry within the minimum interval")
+}
+
+func TestVerifier_UnreachableIssuerIsNotAnInvalidToken(t *testing.T) {
+	is := newIssuer(t)
+	key := rsaKey(t)
+	v, err := oidc.NewVerifier(is.config())
+	require.NoError(t, err)
+	is.srv.Close()
+
+	_, err = v.Verify(context.Background(), sign(t, "RS256", "k1", key, is.claims()))
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, oidc.ErrInvalidToken))
+}
+
+func TestNewVerifier_RequiresHTTPSAndAudience(t *testing.T) {
+	_, err := oidc.NewVerifier(oidc.Config{Issuer: "http://sso.example.com", Audience: "x"})
+	assert.Error(t, err)
+	_, err = oidc.NewVerifier(oidc.Config{Issuer: "https://sso.example.com"})
+	assert.Error(t, err)
+}
+
+func TestParseGroupScopes(t *testing.T) {
+	groups, err := oidc.ParseGroupScopes("dlp-admins=databases:admin, keys:admin; dlp-readers=scan:read")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"dlp-admins":  {models.ScopeDatabasesAdmin, models.ScopeKeysAdmin},
+		"dlp-readers": {models.ScopeScanRead},
+	}, groups)
+
+	for _, bad := range []string{"dlp-admins", "=scan:read", "dlp=scan:write"} {
+		_, err := oidc.ParseGroupScopes(bad)
+		assert.Error(t, err, bad)
+	}
+}
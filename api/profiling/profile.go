@@ -0,0 +1,120 @@
+package profiling
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"meli-challenge/api/classifiers"
+	"meli-challenge/api/models"
+)
+
+// topShapes is how many value shapes are kept per column.
+const topShapes = 5
+
+// Compute builds the statistical profile of a column from a bounded sample of its values.
+// The distinct count is exact over the sample, hence approximate for the whole column.
+func Compute(values []sql.NullString) models.ColumnProfile {
+	p := models.ColumnProfile{SampledRows: len(values)}
+	if len(values) == 0 {
+		return p
+	}
+
+	nulls := 0
+	distinct := make(map[string]struct{})
+	shapes := make(map[string]int)
+	classes := make(map[charClass]int)
+	totalChars := 0
+	p.MinLength = -1
+
+	for _, v := range values {
+		if !v.Valid {
+			nulls++
+			continue
+		}
+		distinct[v.String] = struct{}{}
+		shapes[classifiers.ValueShape(v.String)]++
+
+		n := utf8.RuneCountInString(v.String)
+		if p.MinLength < 0 || n < p.MinLength {
+			p.MinLength = n
+		}
+		if n > p.MaxLength {
+			p.MaxLength = n
+		}
+		for _, r := range v.String {
+			classes[classOf(r)]++
+			totalChars++
+		}
+	}
+	if p.MinLength < 0 {
+		p.MinLength = 0
+	}
+
+	p.NullRatio = float64(nulls) / float64(len(values))
+	p.DistinctCount = len(distinct)
+	p.TopShapes = rankShapes(shapes, topShapes)
+	p.CharClassEntropy = entropy(classes, totalChars)
+	return p
+}
+
+type charClass int
+
+const (
+	classDigit charClass = iota
+	classUpper
+	classLower
+	classSpace
+	classPunct
+	classOther
+)
+
+func classOf(r rune) charClass {
+	switch {
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsLetter(r):
+		return classLower
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		return classPunct
+	default:
+		return classOther
+	}
+}
+
+// entropy is the Shannon entropy, in bits, of the character-class distribution.
+// 0 means every character has the same class (e.g. only digits); the maximum is log2(6).
+func entropy(counts map[charClass]int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+func rankShapes(shapes map[string]int, limit int) []models.ShapeCount {
+	ranked := make([]models.ShapeCount, 0, len(shapes))
+	for s, c := range shapes {
+		ranked = append(ranked, models.ShapeCount{Shape: s, Count: c})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Shape < ranked[j].Shape
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
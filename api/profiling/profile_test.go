@@ -0,0 +1,60 @@
+package profiling_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/profiling"
+)
+
+func values(vs ...any) []sql.NullString {
+	out := make([]sql.NullString, 0, len(vs))
+	for _, v := range vs {
+		if v == nil {
+			out = append(out, sql.NullString{})
+			continue
+		}
+		out = append(out, sql.NullString{String: v.(string), Valid: true})
+	}
+	return out
+}
+
+func TestCompute_IdentifierColumn(t *testing.T) {
+	p := profiling.Compute(values("123-45-6789", "987-65-4321", "555-12-3456", nil))
+
+	assert.Equal(t, 4, p.SampledRows)
+	assert.InDelta(t, 0.25, p.NullRatio, 1e-9)
+	assert.Equal(t, 3, p.DistinctCount)
+	assert.Equal(t, 11, p.MinLength)
+	assert.Equal(t, 11, p.MaxLength)
+	assert.Equal(t, []models.ShapeCount{{Shape: "999-99-9999", Count: 3}}, p.TopShapes)
+	// digits and dashes only: low but non-zero entropy
+	assert.Greater(t, p.CharClassEntropy, 0.0)
+	assert.Less(t, p.CharClassEntropy, 1.0)
+}
+
+func TestCompute_PlaceholderDataHasSingleValue(t *testing.T) {
+	p := profiling.Compute(values("0000", "0000", "0000"))
+
+	assert.Equal(t, 1, p.DistinctCount)
+	assert.Zero(t, p.CharClassEntropy)
+	assert.Equal(t, "9999", p.TopShapes[0].Shape)
+}
+
+func TestCompute_RanksShapesAndHandlesEmptyInput(t *testing.T) {
+	p := profiling.Compute(values("ana@mail.com", "bo@mail.com", "Carl@web.org", "x", "y"))
+	assert.Equal(t, "a", p.TopShapes[0].Shape) // 2 values
+	assert.Equal(t, 1, p.MinLength)
+	assert.Equal(t, 12, p.MaxLength)
+
+	empty := profiling.Compute(nil)
+	assert.Zero(t, empty.SampledRows)
+	assert.Empty(t, empty.TopShapes)
+
+	allNull := profiling.Compute(values(nil, nil))
+	assert.InDelta(t, 1.0, allNull.NullRatio, 1e-9)
+	assert.Zero(t, allNull.MinLength)
+}
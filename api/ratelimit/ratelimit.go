@@ -0,0 +1,171 @@
+// Package ratelimit throttles API callers with token buckets kept in memory.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period: a caller can spend them in a burst and gets them back
+// evenly over the period. The zero Limit means unlimited.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Unlimited reports whether l lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+var periods = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}
+
+// ParseLimit parses "30/m" (also s, h and d) or "off".
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+	n, unit, ok := strings.Cut(s, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	period, known := periods[strings.TrimSpace(unit)]
+	if !ok || err != nil || requests < 0 || !known {
+		return Limit{}, fmt.Errorf("limit %q must be requests/unit with unit s, m, h or d, or off", s)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// Config holds the limit of each route group; groups it does not list use Default.
+type Config struct {
+	Default Limit
+	Groups  map[string]Limit
+}
+
+// DefaultConfig protects the expensive routes the most: scans hit the targets and v2 scans
+// also the LLM provider.
+func DefaultConfig() Config {
+	return Config{
+		Default: Limit{Requests: 120, Period: time.Minute},
+		Groups: map[string]Limit{
+			"read": {Requests: 600, Period: time.Minute},
+			"run":  {Requests: 30, Period: time.Minute},
+			"v2":   {Requests: 10, Period: time.Minute},
+		},
+	}
+}
+
+// ConfigFromEnv applies RATE_LIMITS, "group=limit;group=limit" (e.g. "run=10/m;v2=off;default=60/m"),
+// over DefaultConfig.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	for _, entry := range strings.Split(os.Getenv("RATE_LIMITS"), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, value, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return Config{}, fmt.Errorf("RATE_LIMITS: entry %q must be group=limit", entry)
+		}
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("RATE_LIMITS: %w", err)
+		}
+		if group == "default" {
+			cfg.Default = limit
+		} else {
+			cfg.Groups[group] = limit
+		}
+	}
+	return cfg, nil
+}
+
+// For returns the limit of a route group
+func (c Config) For(group string) Limit {
+	if l, ok := c.Groups[group]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// Limiter keeps a token bucket per caller. It is safe for concurrent use.
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Option customises a Limiter
+type Option func(*Limiter)
+
+// WithClock makes the limiter read the time from now instead of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) { l.now = now }
+}
+
+// New returns a limiter enforcing limit, or nil when limit is unlimited.
+func New(limit Limit, opts ...Option) *Limiter {
+	if limit.Unlimited() {
+		return nil
+	}
+	l := &Limiter{limit: limit, now: time.Now, buckets: map[string]*bucket{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.lastSweep = l.now()
+	return l
+}
+
+// Allow takes a request from key's bucket. When it is empty it returns false and how long
+// until the next request is allowed.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Requests), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*l.rate())
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate() * float64(time.Second))
+}
+
+// rate is the tokens per second a bucket gets back
+func (l *Limiter) rate() float64 {
+	return float64(l.limit.Requests) / l.limit.Period.Seconds()
+}
+
+// sweep forgets the callers idle for a whole period, whose buckets are full again anyway
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limit.Period {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.limit.Period {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
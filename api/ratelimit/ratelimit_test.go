@@ -0,0 +1,78 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/ratelimit"
+)
+
+func TestLimiter_BurstThenRefill(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	l := ratelimit.New(ratelimit.Limit{Requests: 3, Period: time.Minute}, ratelimit.WithClock(func() time.Time { return now }))
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("key:1")
+		assert.True(t, ok, "request %d", i)
+	}
+	ok, retryAfter := l.Allow("key:1")
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter, "one request comes back every 20s")
+
+	ok, _ = l.Allow("key:2")
+	assert.True(t, ok, "callers do not share buckets")
+
+	now = now.Add(20 * time.Second)
+	ok, _ = l.Allow("key:1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("key:1")
+	assert.False(t, ok)
+
+	// an idle caller gets the whole burst back, never more
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("key:1")
+		assert.True(t, ok)
+	}
+	ok, _ = l.Allow("key:1")
+	assert.False(t, ok)
+}
+
+func TestNew_UnlimitedIsNil(t *testing.T) {
+	assert.Nil(t, ratelimit.New(ratelimit.Limit{}))
+	assert.Nil(t, ratelimit.New(ratelimit.Limit{Requests: 0, Period: time.Minute}))
+}
+
+func TestParseLimit(t *testing.T) {
+	for in, want := range map[string]ratelimit.Limit{
+		"30/m":  {Requests: 30, Period: time.Minute},
+		" 5/s ": {Requests: 5, Period: time.Second},
+		"100/d": {Requests: 100, Period: 24 * time.Hour},
+		"off":   {},
+	} {
+		got, err := ratelimit.ParseLimit(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "30", "30/w", "-1/m", "x/m"} {
+		_, err := ratelimit.ParseLimit(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMITS", "run=10/m; v2=off;default=60/h")
+	cfg, err := ratelimit.ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Limit{Requests: 10, Period: time.Minute}, cfg.For("run"))
+	assert.True(t, cfg.For("v2").Unlimited())
+	assert.Equal(t, ratelimit.Limit{Requests: 600, Period: time.Minute}, cfg.For("read"), "groups not listed keep their default")
+	assert.Equal(t, ratelimit.Limit{Requests: 60, Period: time.Hour}, cfg.For("keys"))
+
+	t.Setenv("RATE_LIMITS", "run")
+	_, err = ratelimit.ConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// APIKeyRepository stores API keys. Management methods are scoped to a tenant; GetByPrefix
+// is not, since the key presented to the API is what tells its tenant.
+type APIKeyRepository interface {
+	// Create stores a key of k.TenantID
+	Create(k models.APIKey) (int64, error)
+	Get(tenantID, id int64) (models.APIKey, error)
+	// GetByPrefix returns the key with the given public prefix, including its hash
+	GetByPrefix(prefix string) (models.APIKey, error)
+	List(tenantID int64) ([]models.APIKey, error)
+	// Revoke marks a key revoked at the given time; revoking it again keeps the first time
+	Revoke(tenantID, id int64, at time.Time) error
+	// TouchLastUsed records a use of the key, writing at most once per minute
+	TouchLastUsed(id int64, at time.Time) error
+}
+
+type apiKeyRepository struct {
+	conn *sql.DB
+}
+
+func NewAPIKeyRepository(conn *sql.DB) APIKeyRepository {
+	return &apiKeyRepository{conn: conn}
+}
+
+const apiKeyColumns = "id, tenant_id, name, owner, prefix, key_hash, scopes, created_at, expires_at, revoked_at, last_used_at"
+
+func (r *apiKeyRepository) Create(k models.APIKey) (int64, error) {
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return 0, err
+	}
+	var expiresAt any
+	if k.ExpiresAt != nil {
+		expiresAt = k.ExpiresAt.UTC()
+	}
+	res, err := r.conn.Exec("INSERT INTO api_keys(tenant_id, name, owner, prefix, key_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		k.TenantID, k.Name, k.Owner, k.Prefix, k.Hash, string(scopes), k.CreatedAt.UTC(), expiresAt)
+	if err != nil {
+		logger.Errorf("APIKey Create exec failed for name=%s: %v", k.Name, err)
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *apiKeyRepository) Get(tenantID, id int64) (models.APIKey, error) {
+	return r.one("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ? AND tenant_id = ?", id, tenantID)
+}
+
+func (r *apiKeyRepository) GetByPrefix(prefix string) (models.APIKey, error) {
+	return r.one("SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix)
+}
+
+func (r *apiKeyRepository) List(tenantID int64) ([]models.APIKey, error) {
+	keys, err := r.query("SELECT "+apiKeyColumns+" FROM api_keys WHERE tenant_id = ? ORDER BY id", tenantID)
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	return keys, err
+}
+
+func (r *apiKeyRepository) Revoke(tenantID, id int64, at time.Time) error {
+	_, err := r.conn.Exec("UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND tenant_id = ?", at.UTC(), id, tenantID)
+	if err != nil {
+		logger.Errorf("APIKey Revoke exec failed for id=%d: %v", id, err)
+	}
+	return err
+}
+
+func (r *apiKeyRepository) TouchLastUsed(id int64, at time.Time) error {
+	at = at.UTC()
+	_, err := r.conn.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		at, id, at.Add(-time.Minute))
+	if err != nil {
+		logger.Errorf("APIKey TouchLastUsed exec failed for id=%d: %v", id, err)
+	}
+	return err
+}
+
+func (r *apiKeyRepository) one(query string, args ...any) (models.APIKey, error) {
+	keys, err := r.query(query, args...)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if len(keys) == 0 {
+		return models.APIKey{}, sql.ErrNoRows
+	}
+	return keys[0], nil
+}
+
+func (r *apiKeyRepository) query(query string, args ...any) ([]models.APIKey, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("APIKey query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var scopes, createdAt string
+		var expiresAt, revokedAt, lastUsedAt sql.NullString
+		if err := rows.Scan(&k.ID, &k.TenantID, &k.Name, &k.Owner, &k.Prefix, &k.Hash, &scopes, &createdAt, &expiresAt, &revokedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+			return nil, err
+		}
+		if k.CreatedAt, err = time.Parse(dbTimeLayout, createdAt); err != nil {
+			return nil, err
+		}
+		for _, f := range []struct {
+			src sql.NullString
+			dst **time.Time
+		}{{expiresAt, &k.ExpiresAt}, {revokedAt, &k.RevokedAt}, {lastUsedAt, &k.LastUsedAt}} {
+			if !f.src.Valid {
+				continue
+			}
+			t, err := time.Parse(dbTimeLayout, f.src.String)
+			if err != nil {
+				return nil, err
+			}
+			*f.dst = &t
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
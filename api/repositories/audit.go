@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// AuditRepository only appends and reads; audit_log triggers also reject updates and deletes.
+// Query always filters by the tenant of the filter.
+type AuditRepository interface {
+	Append(e models.AuditEntry) (int64, error)
+	Query(f models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type auditRepository struct {
+	conn *sql.DB
+}
+
+func NewAuditRepository(conn *sql.DB) AuditRepository {
+	return &auditRepository{conn: conn}
+}
+
+func (r *auditRepository) Append(e models.AuditEntry) (int64, error) {
+	var changes any
+	if len(e.Changes) > 0 {
+		b, err := json.Marshal(e.Changes)
+		if err != nil {
+			return 0, err
+		}
+		changes = string(b)
+	}
+	var keyID any
+	if e.ActorKeyID != 0 {
+		keyID = e.ActorKeyID
+	}
+	res, err := r.conn.Exec(`INSERT INTO audit_log(tenant_id, occurred_at, actor, actor_owner, actor_key_id, action, resource_type, resource_id, request_id, ip, changes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.TenantID, e.OccurredAt.UTC(), e.Actor, e.ActorOwner, keyID, e.Action, e.ResourceType, e.ResourceID, e.RequestID, e.IP, changes)
+	if err != nil {
+		logger.Errorf("Audit Append exec failed for action=%s resource=%s: %v", e.Action, e.ResourceID, err)
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *auditRepository) Query(f models.AuditFilter) ([]models.AuditEntry, error) {
+	where := []string{"tenant_id = ?"}
+	args := []any{f.TenantID}
+	for _, c := range []struct {
+		column, value string
+	}{{"actor", f.Actor}, {"action", f.Action}, {"resource_type", f.ResourceType}, {"resource_id", f.ResourceID}} {
+		if c.value != "" {
+			where = append(where, c.column+" = ?")
+			args = append(args, c.value)
+		}
+	}
+	if f.From != nil {
+		where = append(where, "occurred_at >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if f.To != nil {
+		where = append(where, "occurred_at < ?")
+		args = append(args, f.To.UTC())
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+	query := `SELECT id, tenant_id, occurred_at, actor, actor_owner, actor_key_id, action, resource_type, resource_id, request_id, ip, changes
+		FROM audit_log WHERE ` + strings.Join(where, " AND ") + " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("Audit Query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var occurredAt string
+		var keyID sql.NullInt64
+		var changes sql.NullString
+		if err := rows.Scan(&e.ID, &e.TenantID, &occurredAt, &e.Actor, &e.ActorOwner, &keyID, &e.Action, &e.ResourceType, &e.ResourceID,
+			&e.RequestID, &e.IP, &changes); err != nil {
+			return nil, err
+		}
+		if e.OccurredAt, err = time.Parse(dbTimeLayout, occurredAt); err != nil {
+			return nil, err
+		}
+		e.ActorKeyID = keyID.Int64
+		if changes.Valid {
+			if err := json.Unmarshal([]byte(changes.String), &e.Changes); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
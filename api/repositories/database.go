@@ -2,11 +2,41 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"meli-challenge/api/models"
+	"meli-challenge/logger"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// ErrDuplicate is returned by Create and Update when another live database of the tenant has
+// the same host, port and username or the same name (unique keys of external_databases).
+var ErrDuplicate = errors.New("duplicate database")
+
+// mysqlDuplicateEntry is the MySQL error number of unique key violations
+const mysqlDuplicateEntry = 1062
+
+// DatabaseRepository stores registered databases. Every method is scoped to a tenant: the
+// databases of other tenants behave as if they did not exist (sql.ErrNoRows).
 type DatabaseRepository interface {
+	// Create registers a database in dbConfig.TenantID
 	Create(dbConfig models.Database) (int64, error)
+	// GetByID returns the connection, sampling and load settings of a registered database
+	GetByID(tenantID, id int64) (models.Database, error)
+	// List returns the registered databases of a tenant, including their passwords
+	List(tenantID int64) ([]models.Database, error)
+	// Update replaces the settings of dbConfig.ID within dbConfig.TenantID
+	Update(dbConfig models.Database) error
+	// Delete unregisters a database: it is hidden, its password wiped and its schedules
+	// disabled, while its scan history is kept
+	Delete(tenantID, id int64) error
+	// FindByTarget returns the id of the registered database with this host, port and user (sql.ErrNoRows if none)
+	FindByTarget(tenantID int64, host string, port int, username string) (int64, error)
+	// FindByName returns the id of the registered database with this friendly name (sql.ErrNoRows if none)
+	FindByName(tenantID int64, name string) (int64, error)
+	// UpdatePassword stores the credential of a database, replacing the current one (see cmd/rekey)
+	UpdatePassword(tenantID, id int64, password string, encrypted *models.EncryptedSecret) error
 }
 
 type databaseRepository struct {
@@ -17,16 +47,27 @@ func NewDatabaseRepository(conn *sql.DB) DatabaseRepository {
 	return &databaseRepository{conn: conn}
 }
 
+const databaseColumns = `id, tenant_id, name, environment, owner, host, port, username, password,
+	password_key_id, password_dek, password_ciphertext, password_ref,
+	sampling_strategy, sample_size, sample_row_limit, sample_percent, max_execution_ms,
+	replica_host, replica_port, max_connections, max_qps, max_threads_running,
+	tls_mode, tls_ca, tls_cert, tls_key_ref, tls_server_name, ssh_host, ssh_port, ssh_user, ssh_key_ref, ssh_host_key`
+
 func (r *databaseRepository) Create(dbConfig models.Database) (int64, error) {
-	stmt, err := r.conn.Prepare("INSERT INTO `external_databases` (`host`, `port`, `username`, `password`) VALUES(?, ?, ?, ?)")
+	stmt, err := r.conn.Prepare("INSERT INTO `external_databases` (`tenant_id`, `name`, `environment`, `owner`, `host`, `port`, `username`, `password`, `password_key_id`, `password_dek`, `password_ciphertext`, `password_ref`, `sampling_strategy`, `sample_size`, `sample_row_limit`, `sample_percent`, `max_execution_ms`, `replica_host`, `replica_port`, `max_connections`, `max_qps`, `max_threads_running`, `tls_mode`, `tls_ca`, `tls_cert`, `tls_key_ref`, `tls_server_name`, `ssh_host`, `ssh_port`, `ssh_user`, `ssh_key_ref`, `ssh_host_key`) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password)
+	keyID, dek, ciphertext := encryptedColumns(dbConfig.EncryptedPassword)
+	result, err := stmt.Exec(dbConfig.TenantID, dbConfig.Name, dbConfig.Environment, dbConfig.Owner, dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password, keyID, dek, ciphertext, dbConfig.PasswordRef,
+		dbConfig.Sampling.Strategy, dbConfig.Sampling.SampleSize, dbConfig.Sampling.RowLimit, dbConfig.Sampling.Percent, dbConfig.Sampling.MaxExecutionMs,
+		dbConfig.ReplicaHost, dbConfig.ReplicaPort, dbConfig.Limits.MaxConnections, dbConfig.Limits.MaxQPS, dbConfig.Limits.MaxThreadsRunning,
+		dbConfig.TLS.Mode, dbConfig.TLS.CA, dbConfig.TLS.Cert, dbConfig.TLS.KeyRef, dbConfig.TLS.ServerName,
+		dbConfig.SSH.Host, dbConfig.SSH.Port, dbConfig.SSH.User, dbConfig.SSH.KeyRef, dbConfig.SSH.HostKey)
 	if err != nil {
-		return 0, err
+		return 0, duplicateKey(err)
 	}
 
 	id, err := result.LastInsertId()
@@ -37,3 +78,140 @@ func (r *databaseRepository) Create(dbConfig models.Database) (int64, error) {
 
 	return id, nil
 }
+
+func (r *databaseRepository) GetByID(tenantID, id int64) (models.Database, error) {
+	row := r.conn.QueryRow("SELECT "+databaseColumns+" FROM external_databases WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL", id, tenantID)
+	return scanDatabase(row)
+}
+
+func (r *databaseRepository) List(tenantID int64) ([]models.Database, error) {
+	rows, err := r.conn.Query("SELECT "+databaseColumns+" FROM external_databases WHERE tenant_id = ? AND deleted_at IS NULL ORDER BY id", tenantID)
+	if err != nil {
+		logger.Errorf("Database List query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	dbs := []models.Database{}
+	for rows.Next() {
+		t, err := scanDatabase(rows)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, t)
+	}
+	return dbs, rows.Err()
+}
+
+func (r *databaseRepository) Update(dbConfig models.Database) error {
+	keyID, dek, ciphertext := encryptedColumns(dbConfig.EncryptedPassword)
+	res, err := r.conn.Exec(`UPDATE external_databases SET name = ?, environment = ?, owner = ?, host = ?, port = ?, username = ?, password = ?,
+		password_key_id = ?, password_dek = ?, password_ciphertext = ?, password_ref = ?,
+		sampling_strategy = ?, sample_size = ?, sample_row_limit = ?, sample_percent = ?, max_execution_ms = ?,
+		replica_host = ?, replica_port = ?, max_connections = ?, max_qps = ?, max_threads_running = ?,
+		tls_mode = ?, tls_ca = ?, tls_cert = ?, tls_key_ref = ?, tls_server_name = ?,
+		ssh_host = ?, ssh_port = ?, ssh_user = ?, ssh_key_ref = ?, ssh_host_key = ?
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL`,
+		dbConfig.Name, dbConfig.Environment, dbConfig.Owner, dbConfig.Host, dbConfig.Port, dbConfig.Username, dbConfig.Password, keyID, dek, ciphertext, dbConfig.PasswordRef,
+		dbConfig.Sampling.Strategy, dbConfig.Sampling.SampleSize, dbConfig.Sampling.RowLimit, dbConfig.Sampling.Percent, dbConfig.Sampling.MaxExecutionMs,
+		dbConfig.ReplicaHost, dbConfig.ReplicaPort, dbConfig.Limits.MaxConnections, dbConfig.Limits.MaxQPS, dbConfig.Limits.MaxThreadsRunning,
+		dbConfig.TLS.Mode, dbConfig.TLS.CA, dbConfig.TLS.Cert, dbConfig.TLS.KeyRef, dbConfig.TLS.ServerName,
+		dbConfig.SSH.Host, dbConfig.SSH.Port, dbConfig.SSH.User, dbConfig.SSH.KeyRef, dbConfig.SSH.HostKey,
+		dbConfig.ID, dbConfig.TenantID)
+	if err != nil {
+		if err = duplicateKey(err); !errors.Is(err, ErrDuplicate) {
+			logger.Errorf("Database Update exec failed for id=%d: %v", dbConfig.ID, err)
+		}
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *databaseRepository) Delete(tenantID, id int64) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE external_databases SET deleted_at = UTC_TIMESTAMP(), password = '', password_key_id = '', password_dek = NULL, password_ciphertext = NULL, password_ref = '' WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL", id, tenantID)
+	if err != nil {
+		logger.Errorf("Database Delete exec failed for id=%d: %v", id, err)
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE scan_schedules SET enabled = FALSE WHERE database_id = ?", id); err != nil {
+		logger.Errorf("Database Delete could not disable schedules of id=%d: %v", id, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *databaseRepository) FindByTarget(tenantID int64, host string, port int, username string) (int64, error) {
+	var id int64
+	err := r.conn.QueryRow("SELECT id FROM external_databases WHERE tenant_id = ? AND host = ? AND port = ? AND username = ? AND deleted_at IS NULL LIMIT 1",
+		tenantID, host, port, username).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Errorf("Database FindByTarget query failed: %v", err)
+	}
+	return id, err
+}
+
+func (r *databaseRepository) FindByName(tenantID int64, name string) (int64, error) {
+	var id int64
+	err := r.conn.QueryRow("SELECT id FROM external_databases WHERE tenant_id = ? AND name = ? AND deleted_at IS NULL LIMIT 1", tenantID, name).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Errorf("Database FindByName query failed: %v", err)
+	}
+	return id, err
+}
+
+// duplicateKey wraps unique key violations with ErrDuplicate.
+func duplicateKey(err error) error {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number == mysqlDuplicateEntry {
+		return fmt.Errorf("%w: %s", ErrDuplicate, myErr.Message)
+	}
+	return err
+}
+
+func (r *databaseRepository) UpdatePassword(tenantID, id int64, password string, encrypted *models.EncryptedSecret) error {
+	keyID, dek, ciphertext := encryptedColumns(encrypted)
+	res, err := r.conn.Exec(`UPDATE external_databases SET password = ?, password_key_id = ?, password_dek = ?, password_ciphertext = ?
+		WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL`, password, keyID, dek, ciphertext, id, tenantID)
+	if err != nil {
+		logger.Errorf("Database UpdatePassword exec failed for id=%d: %v", id, err)
+		return err
+	}
+	return requireRow(res)
+}
+
+// encryptedColumns splits an encrypted password into its columns; nil stores no ciphertext
+func encryptedColumns(s *models.EncryptedSecret) (string, []byte, []byte) {
+	if s == nil {
+		return "", nil, nil
+	}
+	return s.KeyID, s.WrappedKey, s.Ciphertext
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDatabase(row rowScanner) (models.Database, error) {
+	var t models.Database
+	var enc models.EncryptedSecret
+	err := row.Scan(&t.ID, &t.TenantID, &t.Name, &t.Environment, &t.Owner, &t.Host, &t.Port, &t.Username, &t.Password,
+		&enc.KeyID, &enc.WrappedKey, &enc.Ciphertext, &t.PasswordRef,
+		&t.Sampling.Strategy, &t.Sampling.SampleSize, &t.Sampling.RowLimit, &t.Sampling.Percent, &t.Sampling.MaxExecutionMs,
+		&t.ReplicaHost, &t.ReplicaPort, &t.Limits.MaxConnections, &t.Limits.MaxQPS, &t.Limits.MaxThreadsRunning,
+		&t.TLS.Mode, &t.TLS.CA, &t.TLS.Cert, &t.TLS.KeyRef, &t.TLS.ServerName,
+		&t.SSH.Host, &t.SSH.Port, &t.SSH.User, &t.SSH.KeyRef, &t.SSH.HostKey)
+	if enc.KeyID != "" {
+		t.EncryptedPassword = &enc
+	}
+	return t, err
+}
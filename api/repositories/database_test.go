@@ -0,0 +1,32 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+)
+
+func TestDatabaseRepository_UniqueKeyViolationIsErrDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repositories.NewDatabaseRepository(db)
+
+	mock.ExpectExec(`UPDATE external_databases SET name = \?`).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry for key 'uq_databases_name'"})
+	err = repo.Update(models.Database{ID: 3, TenantID: 1, Name: "billing"})
+	assert.ErrorIs(t, err, repositories.ErrDuplicate)
+
+	mock.ExpectExec(`UPDATE external_databases SET name = \?`).
+		WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+	err = repo.Update(models.Database{ID: 3, TenantID: 1, Name: "billing"})
+	assert.NotErrorIs(t, err, repositories.ErrDuplicate)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"meli-challenge/logger"
+)
+
+// LeaseRepository implements named, expiring leases on the internal database so that only one
+// API replica performs a singleton task at a time.
+type LeaseRepository interface {
+	// TryAcquire takes or renews the lease for ttl and reports whether holder owns it
+	TryAcquire(name, holder string, ttl time.Duration) (bool, error)
+	Release(name, holder string) error
+}
+
+type leaseRepository struct {
+	conn *sql.DB
+}
+
+func NewLeaseRepository(conn *sql.DB) LeaseRepository {
+	return &leaseRepository{conn: conn}
+}
+
+func (r *leaseRepository) TryAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	// The holder is replaced only when the lease expired (or is already ours); expires_at is then
+	// extended only for the holder that ended up owning the row. Both use the database clock.
+	_, err := r.conn.Exec(`INSERT INTO scheduler_leases(name, holder, expires_at) VALUES (?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))
+		ON DUPLICATE KEY UPDATE
+			holder = IF(expires_at < NOW() OR holder = VALUES(holder), VALUES(holder), holder),
+			expires_at = IF(holder = VALUES(holder), VALUES(expires_at), expires_at)`,
+		name, holder, int(ttl.Seconds()))
+	if err != nil {
+		logger.Errorf("Lease TryAcquire exec failed for %s: %v", name, err)
+		return false, err
+	}
+
+	var current string
+	if err := r.conn.QueryRow("SELECT holder FROM scheduler_leases WHERE name = ?", name).Scan(&current); err != nil {
+		logger.Errorf("Lease TryAcquire query failed for %s: %v", name, err)
+		return false, err
+	}
+	return current == holder, nil
+}
+
+func (r *leaseRepository) Release(name, holder string) error {
+	_, err := r.conn.Exec("DELETE FROM scheduler_leases WHERE name = ? AND holder = ?", name, holder)
+	if err != nil {
+		logger.Errorf("Lease Release exec failed for %s: %v", name, err)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"database/sql"
+	"meli-challenge/logger"
+	"time"
+)
+
+// LLMCacheRepository persists LLM classifications so unchanged columns are not sent to the provider again.
+// Entries belong to a tenant: one tenant's answers, derived from its sampled data, are never served to another.
+type LLMCacheRepository interface {
+	// Get returns the tenant's cached info type for key, if a non-expired entry exists.
+	Get(tenantID int64, key string) (string, bool, error)
+	// Put stores (or refreshes) the tenant's classification for key with the given time-to-live.
+	Put(tenantID int64, key, model, infoType string, ttl time.Duration) error
+	// DeleteExpired removes entries whose TTL has elapsed.
+	DeleteExpired() error
+}
+
+type llmCacheRepository struct {
+	conn *sql.DB
+}
+
+func NewLLMCacheRepository(conn *sql.DB) LLMCacheRepository {
+	return &llmCacheRepository{conn: conn}
+}
+
+func (r *llmCacheRepository) Get(tenantID int64, key string) (string, bool, error) {
+	var infoType string
+	err := r.conn.QueryRow("SELECT info_type FROM llm_cache WHERE tenant_id = ? AND cache_key = ? AND expires_at > NOW()", tenantID, key).Scan(&infoType)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		logger.Errorf("LLMCache Get failed for tenant_id=%d key=%s: %v", tenantID, key, err)
+		return "", false, err
+	}
+	return infoType, true, nil
+}
+
+func (r *llmCacheRepository) Put(tenantID int64, key, model, infoType string, ttl time.Duration) error {
+	stmt, err := r.conn.Prepare(`INSERT INTO llm_cache(tenant_id, cache_key, model, info_type, expires_at)
+		VALUES (?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))
+		ON DUPLICATE KEY UPDATE model = VALUES(model), info_type = VALUES(info_type), expires_at = VALUES(expires_at)`)
+	if err != nil {
+		logger.Errorf("LLMCache Put prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tenantID, key, model, infoType, int64(ttl.Seconds()))
+	if err != nil {
+		logger.Errorf("LLMCache Put exec failed for tenant_id=%d key=%s: %v", tenantID, key, err)
+	}
+	return err
+}
+
+func (r *llmCacheRepository) DeleteExpired() error {
+	_, err := r.conn.Exec("DELETE FROM llm_cache WHERE expires_at <= NOW()")
+	if err != nil {
+		logger.Errorf("LLMCache DeleteExpired failed: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package repositories_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/repositories"
+)
+
+func TestLLMCacheRepository_EntriesAreScopedToTheTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repositories.NewLLMCacheRepository(db)
+
+	mock.ExpectPrepare(`INSERT INTO llm_cache\(tenant_id, cache_key`).ExpectExec().
+		WithArgs(int64(1), "k", "fake", "EMAIL_ADDRESS", int64(3600)).WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.Put(1, "k", "fake", "EMAIL_ADDRESS", time.Hour))
+
+	// the same key under another tenant is a miss
+	mock.ExpectQuery(`SELECT info_type FROM llm_cache WHERE tenant_id = \? AND cache_key = \?`).
+		WithArgs(int64(2), "k").WillReturnRows(sqlmock.NewRows([]string{"info_type"}))
+	_, ok, err := repo.Get(2, "k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// ReportShareRepository stores report share links, scoped to a tenant.
+type ReportShareRepository interface {
+	// Create stores a link of s.TenantID
+	Create(s models.ReportShare) (int64, error)
+	Get(tenantID, id int64) (models.ReportShare, error)
+	// Lookup returns a link of any tenant. It is only meant for ids read from a token whose
+	// signature was verified; the link tells which tenant the token gives access to.
+	Lookup(id int64) (models.ReportShare, error)
+	// ListForScan returns the links of a scan, newest first
+	ListForScan(tenantID, scanID int64) ([]models.ReportShare, error)
+	// Revoke marks a link revoked at the given time; revoking it again keeps the first time
+	Revoke(tenantID, id int64, at time.Time) error
+	LogAccess(a models.ReportShareAccess) error
+	// ListAccesses returns the latest accesses made with a link, newest first
+	ListAccesses(tenantID, shareID int64, limit int) ([]models.ReportShareAccess, error)
+}
+
+type reportShareRepository struct {
+	conn *sql.DB
+}
+
+func NewReportShareRepository(conn *sql.DB) ReportShareRepository {
+	return &reportShareRepository{conn: conn}
+}
+
+const shareColumns = "id, tenant_id, scan_id, note, created_at, expires_at, revoked_at"
+
+func (r *reportShareRepository) Create(s models.ReportShare) (int64, error) {
+	res, err := r.conn.Exec("INSERT INTO report_shares(tenant_id, scan_id, note, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		s.TenantID, s.ScanID, s.Note, s.CreatedAt.UTC(), s.ExpiresAt.UTC())
+	if err != nil {
+		logger.Errorf("ReportShare Create exec failed for scan_id=%d: %v", s.ScanID, err)
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *reportShareRepository) Get(tenantID, id int64) (models.ReportShare, error) {
+	return r.one("SELECT "+shareColumns+" FROM report_shares WHERE id = ? AND tenant_id = ?", id, tenantID)
+}
+
+func (r *reportShareRepository) Lookup(id int64) (models.ReportShare, error) {
+	return r.one("SELECT "+shareColumns+" FROM report_shares WHERE id = ?", id)
+}
+
+func (r *reportShareRepository) one(query string, args ...any) (models.ReportShare, error) {
+	shares, err := r.query(query, args...)
+	if err != nil {
+		return models.ReportShare{}, err
+	}
+	if len(shares) == 0 {
+		return models.ReportShare{}, sql.ErrNoRows
+	}
+	return shares[0], nil
+}
+
+func (r *reportShareRepository) ListForScan(tenantID, scanID int64) ([]models.ReportShare, error) {
+	return r.query("SELECT "+shareColumns+" FROM report_shares WHERE scan_id = ? AND tenant_id = ? ORDER BY id DESC", scanID, tenantID)
+}
+
+func (r *reportShareRepository) Revoke(tenantID, id int64, at time.Time) error {
+	_, err := r.conn.Exec("UPDATE report_shares SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND tenant_id = ?", at.UTC(), id, tenantID)
+	if err != nil {
+		logger.Errorf("ReportShare Revoke exec failed for id=%d: %v", id, err)
+	}
+	return err
+}
+
+func (r *reportShareRepository) LogAccess(a models.ReportShareAccess) error {
+	_, err := r.conn.Exec("INSERT INTO report_share_accesses(share_id, accessed_at, ip, user_agent, path, outcome) VALUES (?, ?, ?, ?, ?, ?)",
+		a.ShareID, a.AccessedAt.UTC(), a.IP, a.UserAgent, a.Path, a.Outcome)
+	if err != nil {
+		logger.Errorf("ReportShare LogAccess exec failed for share_id=%d: %v", a.ShareID, err)
+	}
+	return err
+}
+
+func (r *reportShareRepository) ListAccesses(tenantID, shareID int64, limit int) ([]models.ReportShareAccess, error) {
+	rows, err := r.conn.Query(`SELECT a.id, a.share_id, a.accessed_at, a.ip, a.user_agent, a.path, a.outcome
+		FROM report_share_accesses a JOIN report_shares s ON s.id = a.share_id
+		WHERE a.share_id = ? AND s.tenant_id = ? ORDER BY a.id DESC LIMIT ?`, shareID, tenantID, limit)
+	if err != nil {
+		logger.Errorf("ReportShare ListAccesses query failed for share_id=%d: %v", shareID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := []models.ReportShareAccess{}
+	for rows.Next() {
+		var a models.ReportShareAccess
+		var accessedAt string
+		if err := rows.Scan(&a.ID, &a.ShareID, &accessedAt, &a.IP, &a.UserAgent, &a.Path, &a.Outcome); err != nil {
+			return nil, err
+		}
+		if a.AccessedAt, err = time.Parse(dbTimeLayout, accessedAt); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, a)
+	}
+	return accesses, rows.Err()
+}
+
+func (r *reportShareRepository) query(query string, args ...any) ([]models.ReportShare, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("ReportShare query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.ReportShare{}
+	for rows.Next() {
+		var s models.ReportShare
+		var createdAt, expiresAt string
+		var revokedAt sql.NullString
+		if err := rows.Scan(&s.ID, &s.TenantID, &s.ScanID, &s.Note, &createdAt, &expiresAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if s.CreatedAt, err = time.Parse(dbTimeLayout, createdAt); err != nil {
+			return nil, err
+		}
+		if s.ExpiresAt, err = time.Parse(dbTimeLayout, expiresAt); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			t, err := time.Parse(dbTimeLayout, revokedAt.String)
+			if err != nil {
+				return nil, err
+			}
+			s.RevokedAt = &t
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
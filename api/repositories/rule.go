@@ -3,11 +3,22 @@ package repositories
 import (
 	"database/sql"
 	"meli-challenge/api/models"
+	"meli-challenge/logger"
 )
 
+// RuleRepository stores classification rules. A rule belongs either to a global rule pack or to
+// a tenant; tenants only see their own rules and those of the packs they subscribe to.
 type RuleRepository interface {
-	GetAllRules() ([]models.ClassificationRule, error)
+	// GetAllRules returns the rules of a tenant and of its rule packs, pack rules first. Use
+	// services.EffectiveRules to apply the tenant overrides.
+	GetAllRules(tenantID int64) ([]models.ClassificationRule, error)
+	// CreateRule stores a rule of rule.TenantID or, for global packs, of rule.PackID
 	CreateRule(rule models.ClassificationRule) (int64, error)
+	// CreatePack stores a rule pack and its rules in one transaction
+	CreatePack(pack models.RulePack) (int64, error)
+	// GetPack returns a rule pack with its rules
+	GetPack(id int64) (models.RulePack, error)
+	ListPacks() ([]models.RulePack, error)
 }
 
 type ruleRepository struct {
@@ -18,34 +29,115 @@ func NewRuleRepository(conn *sql.DB) RuleRepository {
 	return &ruleRepository{conn}
 }
 
-func (r *ruleRepository) GetAllRules() ([]models.ClassificationRule, error) {
-	rows, err := r.conn.Query("SELECT id, type_name, regex FROM classification_rules")
+const ruleColumns = "id, pack_id, tenant_id, type_name, regex, disabled"
+
+func (r *ruleRepository) GetAllRules(tenantID int64) ([]models.ClassificationRule, error) {
+	return r.queryRules(`SELECT `+ruleColumns+` FROM classification_rules
+		WHERE tenant_id = ? OR pack_id IN (SELECT pack_id FROM tenant_rule_packs WHERE tenant_id = ?)
+		ORDER BY tenant_id IS NOT NULL, id`, tenantID, tenantID)
+}
+
+func (r *ruleRepository) CreateRule(rule models.ClassificationRule) (int64, error) {
+	return createRule(r.conn, rule)
+}
+
+func createRule(conn dbtx, rule models.ClassificationRule) (int64, error) {
+	stmt, err := conn.Prepare("INSERT INTO classification_rules(pack_id, tenant_id, type_name, regex, disabled) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(rule.PackID, rule.TenantID, rule.TypeName, rule.Regex, rule.Disabled)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *ruleRepository) CreatePack(pack models.RulePack) (int64, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO rule_packs(name, description) VALUES (?, ?)", pack.Name, pack.Description)
+	if err != nil {
+		logger.Errorf("CreatePack exec failed: %v", err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, rule := range pack.Rules {
+		rule.PackID = &id
+		if _, err := createRule(tx, rule); err != nil {
+			logger.Errorf("CreatePack rule %s failed for pack id=%d: %v", rule.TypeName, id, err)
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *ruleRepository) GetPack(id int64) (models.RulePack, error) {
+	var p models.RulePack
+	err := r.conn.QueryRow("SELECT id, name, description FROM rule_packs WHERE id = ?", id).Scan(&p.ID, &p.Name, &p.Description)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Errorf("GetPack query failed for id=%d: %v", id, err)
+		}
+		return models.RulePack{}, err
+	}
+	p.Rules, err = r.queryRules("SELECT "+ruleColumns+" FROM classification_rules WHERE pack_id = ? ORDER BY id", id)
+	return p, err
+}
+
+func (r *ruleRepository) ListPacks() ([]models.RulePack, error) {
+	rows, err := r.conn.Query("SELECT id, name, description FROM rule_packs ORDER BY id")
+	if err != nil {
+		logger.Errorf("ListPacks query failed: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var rules []models.ClassificationRule
+	packs := []models.RulePack{}
 	for rows.Next() {
-		var rule models.ClassificationRule
-		if err := rows.Scan(&rule.ID, &rule.TypeName, &rule.Regex); err != nil {
+		var p models.RulePack
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
 			return nil, err
 		}
-		rules = append(rules, rule)
+		packs = append(packs, p)
 	}
-	return rules, nil
+	return packs, rows.Err()
 }
 
-func (r *ruleRepository) CreateRule(rule models.ClassificationRule) (int64, error) {
-	stmt, err := r.conn.Prepare("INSERT INTO classification_rules(type_name, regex) VALUES (?, ?)")
+func (r *ruleRepository) queryRules(query string, args ...any) ([]models.ClassificationRule, error) {
+	rows, err := r.conn.Query(query, args...)
 	if err != nil {
-		return 0, err
+		logger.Errorf("Rules query failed: %v", err)
+		return nil, err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	res, err := stmt.Exec(rule.TypeName, rule.Regex)
-	if err != nil {
-		return 0, err
+	var rules []models.ClassificationRule
+	for rows.Next() {
+		var rule models.ClassificationRule
+		var packID, tenantID sql.NullInt64
+		if err := rows.Scan(&rule.ID, &packID, &tenantID, &rule.TypeName, &rule.Regex, &rule.Disabled); err != nil {
+			return nil, err
+		}
+		if packID.Valid {
+			rule.PackID = &packID.Int64
+		}
+		if tenantID.Valid {
+			rule.TenantID = &tenantID.Int64
+		}
+		rules = append(rules, rule)
 	}
-	return res.LastInsertId()
+	return rules, rows.Err()
 }
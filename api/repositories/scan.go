@@ -2,15 +2,48 @@ package repositories
 
 import (
 	"database/sql"
+	"encoding/json"
 	"meli-challenge/api/models"
 	"meli-challenge/logger"
+	"time"
 )
 
+// ScanRepository stores scans and their results. Reads take the tenant of the caller and
+// treat scans of other tenants as missing (sql.ErrNoRows or no results); writes take a scan
+// id returned by CreateHistory, which only creates scans of databases of the given tenant.
 type ScanRepository interface {
-	CreateHistory(databaseId int64) (int64, error)
+	ScanCounter
+	// CreateHistory starts a "v1" or "v2" scan of a database of the tenant (sql.ErrNoRows if there
+	// is none). A non-nil admit runs first, in the same transaction and with the rows of the
+	// database and its tenant locked, so concurrent starts on any replica count each other; an
+	// error from admit creates nothing and is returned as is.
+	CreateHistory(tenantID, databaseID int64, apiVersion string, admit func(ScanCounter) error) (int64, error)
 	UpdateHistoryStatus(scanID int64, status string) error
 	SaveResult(scanID int64, result models.ScanResult) error
-	GetResultsByScanID(scanID int64) ([]models.ScanResult, error)
+	GetResultsByScanID(tenantID, scanID int64) ([]models.ScanResult, error)
+	UpdateCacheStats(scanID int64, hits, misses int) error
+	UpdateLLMUsage(scanID int64, usage models.LLMUsage) error
+	GetHistory(tenantID, scanID int64) (models.ScanHistory, error)
+	SaveProfile(scanID int64, profile models.ColumnProfile) error
+	GetProfilesByScanID(tenantID, scanID int64) ([]models.ColumnProfile, error)
+	// GetLastSuccessfulScanID returns the newest successful scan of a database before scanID run
+	// with apiVersion (sql.ErrNoRows if none)
+	GetLastSuccessfulScanID(tenantID, databaseID, beforeScanID int64, apiVersion string) (int64, error)
+	SaveTableFingerprint(scanID int64, fp models.TableFingerprint) error
+	GetTableFingerprints(scanID int64) ([]models.TableFingerprint, error)
+	// CopyTableResults copies a table's results and profiles from one scan to another. It copies
+	// nothing and returns 0 when the source has columns left unclassified by LLM errors or budget.
+	CopyTableResults(fromScanID, toScanID int64, schema, table string) (int64, error)
+	UpdateTableStats(scanID int64, scanned, reused int) error
+}
+
+// ScanCounter counts the scans that quotas are checked against.
+type ScanCounter interface {
+	// CountRunning counts the scans of the tenant started after since and still running, of
+	// one database or, when databaseID is 0, of all of them
+	CountRunning(tenantID, databaseID int64, since time.Time) (int, error)
+	// CountStarted counts the scans of the tenant with apiVersion started after since
+	CountStarted(tenantID int64, apiVersion string, since time.Time) (int, error)
 }
 
 type scanRepository struct {
@@ -21,17 +54,57 @@ func NewScanRepository(conn *sql.DB) ScanRepository {
 	return &scanRepository{conn: conn}
 }
 
-func (r *scanRepository) CreateHistory(databaseId int64) (int64, error) {
-	stmt, err := r.conn.Prepare("INSERT INTO scan_history(database_id, status) VALUES(?, ?)")
+func (r *scanRepository) CreateHistory(tenantID, databaseID int64, apiVersion string, admit func(ScanCounter) error) (int64, error) {
+	if admit == nil {
+		return insertHistory(r.conn, tenantID, databaseID, apiVersion)
+	}
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Other starts for the same database or tenant wait here until this one commits
+	var id int64
+	err = tx.QueryRow(`SELECT d.id FROM external_databases d JOIN tenants t ON t.id = d.tenant_id
+		WHERE d.id = ? AND d.tenant_id = ? FOR UPDATE`, databaseID, tenantID).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Errorf("CreateHistory lock failed for database_id=%d: %v", databaseID, err)
+		}
+		return 0, err
+	}
+	if err := admit(scanCounter{tx}); err != nil {
+		return 0, err
+	}
+	scanID, err := insertHistory(tx, tenantID, databaseID, apiVersion)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Errorf("CreateHistory commit failed for database_id=%d: %v", databaseID, err)
+		return 0, err
+	}
+	return scanID, nil
+}
+
+func insertHistory(db dbtx, tenantID, databaseID int64, apiVersion string) (int64, error) {
+	// The tenant is copied from the database row, so a scan can never belong to another tenant
+	stmt, err := db.Prepare(`INSERT INTO scan_history(tenant_id, database_id, api_version, status)
+		SELECT tenant_id, id, ?, ? FROM external_databases WHERE id = ? AND tenant_id = ?`)
 	if err != nil {
 		logger.Errorf("CreateHistory prepare failed: %v", err)
 		return 0, err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(databaseId, "running")
+	result, err := stmt.Exec(apiVersion, "running", databaseID, tenantID)
 	if err != nil {
-		logger.Errorf("CreateHistory exec failed for database_id=%d: %v", databaseId, err)
+		logger.Errorf("CreateHistory exec failed for database_id=%d: %v", databaseID, err)
+		return 0, err
+	}
+	if err := requireRow(result); err != nil {
 		return 0, err
 	}
 
@@ -55,22 +128,24 @@ func (r *scanRepository) UpdateHistoryStatus(scanID int64, status string) error
 
 func (r *scanRepository) SaveResult(scanID int64, result models.ScanResult) error {
 	// Insert schema_name with the result
-	stmt, err := r.conn.Prepare("INSERT INTO scan_results(scan_id, schema_name, table_name, column_name, info_type) VALUES (?, ?, ?, ?, ?)")
+	stmt, err := r.conn.Prepare("INSERT INTO scan_results(scan_id, schema_name, table_name, column_name, info_type, injection_suspected, rules_version) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		logger.Errorf("SaveResult prepare failed: %v", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(scanID, result.SchemaName, result.TableName, result.ColumnName, result.InfoType)
+	_, err = stmt.Exec(scanID, result.SchemaName, result.TableName, result.ColumnName, result.InfoType, result.InjectionSuspected, result.RulesVersion)
 	if err != nil {
 		logger.Errorf("SaveResult exec failed for scanID=%d: %v", scanID, err)
 	}
 	return err
 }
 
-func (r *scanRepository) GetResultsByScanID(scanID int64) ([]models.ScanResult, error) {
-	rows, err := r.conn.Query("SELECT schema_name, table_name, column_name, info_type FROM scan_results WHERE scan_id = ? ORDER BY schema_name, table_name, column_name", scanID)
+func (r *scanRepository) GetResultsByScanID(tenantID, scanID int64) ([]models.ScanResult, error) {
+	rows, err := r.conn.Query(`SELECT r.schema_name, r.table_name, r.column_name, r.info_type, r.injection_suspected
+		FROM scan_results r JOIN scan_history h ON h.id = r.scan_id
+		WHERE r.scan_id = ? AND h.tenant_id = ? ORDER BY r.schema_name, r.table_name, r.column_name`, scanID, tenantID)
 	if err != nil {
 		logger.Errorf("GetResultsByScanID query failed for scanID=%d: %v", scanID, err)
 		return nil, err
@@ -80,10 +155,236 @@ func (r *scanRepository) GetResultsByScanID(scanID int64) ([]models.ScanResult,
 	var results []models.ScanResult
 	for rows.Next() {
 		var result models.ScanResult
-		if err := rows.Scan(&result.SchemaName, &result.TableName, &result.ColumnName, &result.InfoType); err != nil {
+		if err := rows.Scan(&result.SchemaName, &result.TableName, &result.ColumnName, &result.InfoType, &result.InjectionSuspected); err != nil {
 			return nil, err
 		}
 		results = append(results, result)
 	}
 	return results, nil
 }
+
+func (r *scanRepository) UpdateCacheStats(scanID int64, hits, misses int) error {
+	stmt, err := r.conn.Prepare("UPDATE scan_history SET llm_cache_hits = ?, llm_cache_misses = ? WHERE id = ?")
+	if err != nil {
+		logger.Errorf("UpdateCacheStats prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(hits, misses, scanID)
+	if err != nil {
+		logger.Errorf("UpdateCacheStats exec failed for scanID=%d: %v", scanID, err)
+	}
+	return err
+}
+
+func (r *scanRepository) UpdateLLMUsage(scanID int64, usage models.LLMUsage) error {
+	stmt, err := r.conn.Prepare(`UPDATE scan_history SET llm_calls = ?, llm_prompt_tokens = ?, llm_completion_tokens = ?,
+		llm_latency_ms = ?, llm_retries = ?, llm_errors = ?, llm_cost_usd = ?, llm_cost_unknown = ?, llm_budget_usd = ?, llm_budget_exhausted = ? WHERE id = ?`)
+	if err != nil {
+		logger.Errorf("UpdateLLMUsage prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(usage.Calls, usage.PromptTokens, usage.CompletionTokens, usage.LatencyMs, usage.Retries,
+		usage.Errors, usage.CostUSD, usage.CostUnknown, usage.BudgetUSD, usage.BudgetExhausted, scanID)
+	if err != nil {
+		logger.Errorf("UpdateLLMUsage exec failed for scanID=%d: %v", scanID, err)
+	}
+	return err
+}
+
+func (r *scanRepository) CountRunning(tenantID, databaseID int64, since time.Time) (int, error) {
+	return scanCounter{r.conn}.CountRunning(tenantID, databaseID, since)
+}
+
+func (r *scanRepository) CountStarted(tenantID int64, apiVersion string, since time.Time) (int, error) {
+	return scanCounter{r.conn}.CountStarted(tenantID, apiVersion, since)
+}
+
+// scanCounter counts scans on a connection or within a transaction
+type scanCounter struct {
+	db dbtx
+}
+
+func (c scanCounter) CountRunning(tenantID, databaseID int64, since time.Time) (int, error) {
+	query, args := "SELECT COUNT(*) FROM scan_history WHERE tenant_id = ? AND status = 'running' AND executed_at > ?", []any{tenantID, since.UTC()}
+	if databaseID != 0 {
+		query, args = query+" AND database_id = ?", append(args, databaseID)
+	}
+	var n int
+	if err := c.db.QueryRow(query, args...).Scan(&n); err != nil {
+		logger.Errorf("CountRunning query failed for tenant_id=%d database_id=%d: %v", tenantID, databaseID, err)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (c scanCounter) CountStarted(tenantID int64, apiVersion string, since time.Time) (int, error) {
+	var n int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM scan_history WHERE tenant_id = ? AND api_version = ? AND executed_at >= ?",
+		tenantID, apiVersion, since.UTC()).Scan(&n)
+	if err != nil {
+		logger.Errorf("CountStarted query failed for tenant_id=%d: %v", tenantID, err)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *scanRepository) GetHistory(tenantID, scanID int64) (models.ScanHistory, error) {
+	var h models.ScanHistory
+	row := r.conn.QueryRow(`SELECT id, tenant_id, database_id, api_version, executed_at, status, llm_cache_hits, llm_cache_misses, tables_scanned, tables_reused,
+		llm_calls, llm_prompt_tokens, llm_completion_tokens, llm_latency_ms, llm_retries, llm_errors, llm_cost_usd, llm_cost_unknown, llm_budget_usd, llm_budget_exhausted
+		FROM scan_history WHERE id = ? AND tenant_id = ?`, scanID, tenantID)
+	if err := row.Scan(&h.ID, &h.TenantID, &h.DatabaseID, &h.APIVersion, &h.ExecutedAt, &h.Status, &h.LLMCacheHits, &h.LLMCacheMisses, &h.TablesScanned, &h.TablesReused,
+		&h.Calls, &h.PromptTokens, &h.CompletionTokens, &h.LatencyMs, &h.Retries, &h.Errors, &h.CostUSD, &h.CostUnknown, &h.BudgetUSD, &h.BudgetExhausted); err != nil {
+		if err != sql.ErrNoRows {
+			logger.Errorf("GetHistory query failed for scanID=%d: %v", scanID, err)
+		}
+		return models.ScanHistory{}, err
+	}
+	return h, nil
+}
+
+func (r *scanRepository) SaveProfile(scanID int64, profile models.ColumnProfile) error {
+	shapes, err := json.Marshal(profile.TopShapes)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := r.conn.Prepare(`INSERT INTO scan_column_profiles(scan_id, schema_name, table_name, column_name, sampled_rows,
+		null_ratio, approx_distinct, min_length, max_length, top_shapes, char_class_entropy) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		logger.Errorf("SaveProfile prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(scanID, profile.SchemaName, profile.TableName, profile.ColumnName, profile.SampledRows,
+		profile.NullRatio, profile.DistinctCount, profile.MinLength, profile.MaxLength, string(shapes), profile.CharClassEntropy)
+	if err != nil {
+		logger.Errorf("SaveProfile exec failed for scanID=%d: %v", scanID, err)
+	}
+	return err
+}
+
+func (r *scanRepository) GetProfilesByScanID(tenantID, scanID int64) ([]models.ColumnProfile, error) {
+	rows, err := r.conn.Query(`SELECT p.schema_name, p.table_name, p.column_name, p.sampled_rows, p.null_ratio, p.approx_distinct,
+		p.min_length, p.max_length, p.top_shapes, p.char_class_entropy
+		FROM scan_column_profiles p JOIN scan_history h ON h.id = p.scan_id
+		WHERE p.scan_id = ? AND h.tenant_id = ?`, scanID, tenantID)
+	if err != nil {
+		logger.Errorf("GetProfilesByScanID query failed for scanID=%d: %v", scanID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.ColumnProfile
+	for rows.Next() {
+		var p models.ColumnProfile
+		var shapes string
+		if err := rows.Scan(&p.SchemaName, &p.TableName, &p.ColumnName, &p.SampledRows, &p.NullRatio, &p.DistinctCount,
+			&p.MinLength, &p.MaxLength, &shapes, &p.CharClassEntropy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(shapes), &p.TopShapes); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+func (r *scanRepository) GetLastSuccessfulScanID(tenantID, databaseID, beforeScanID int64, apiVersion string) (int64, error) {
+	var id int64
+	err := r.conn.QueryRow(`SELECT id FROM scan_history WHERE tenant_id = ? AND database_id = ? AND id < ? AND status = 'success'
+		AND api_version = ? ORDER BY id DESC LIMIT 1`,
+		tenantID, databaseID, beforeScanID, apiVersion).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Errorf("GetLastSuccessfulScanID query failed for database_id=%d: %v", databaseID, err)
+	}
+	return id, err
+}
+
+func (r *scanRepository) SaveTableFingerprint(scanID int64, fp models.TableFingerprint) error {
+	stmt, err := r.conn.Prepare("INSERT INTO scan_table_fingerprints(scan_id, schema_name, table_name, fingerprint, rules_version) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		logger.Errorf("SaveTableFingerprint prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(scanID, fp.SchemaName, fp.TableName, fp.Fingerprint, fp.RulesVersion)
+	if err != nil {
+		logger.Errorf("SaveTableFingerprint exec failed for scanID=%d: %v", scanID, err)
+	}
+	return err
+}
+
+func (r *scanRepository) GetTableFingerprints(scanID int64) ([]models.TableFingerprint, error) {
+	rows, err := r.conn.Query("SELECT schema_name, table_name, fingerprint, rules_version FROM scan_table_fingerprints WHERE scan_id = ?", scanID)
+	if err != nil {
+		logger.Errorf("GetTableFingerprints query failed for scanID=%d: %v", scanID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fps []models.TableFingerprint
+	for rows.Next() {
+		var fp models.TableFingerprint
+		if err := rows.Scan(&fp.SchemaName, &fp.TableName, &fp.Fingerprint, &fp.RulesVersion); err != nil {
+			return nil, err
+		}
+		fps = append(fps, fp)
+	}
+	return fps, rows.Err()
+}
+
+func (r *scanRepository) CopyTableResults(fromScanID, toScanID int64, schema, table string) (int64, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		logger.Errorf("CopyTableResults begin failed: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO scan_results(scan_id, schema_name, table_name, column_name, info_type, injection_suspected, rules_version)
+		SELECT ?, schema_name, table_name, column_name, info_type, injection_suspected, rules_version
+		FROM scan_results WHERE scan_id = ? AND schema_name = ? AND table_name = ?
+		AND NOT EXISTS (SELECT 1 FROM scan_results u WHERE u.scan_id = ? AND u.schema_name = ? AND u.table_name = ? AND u.info_type LIKE 'UNCLASSIFIED%')`,
+		toScanID, fromScanID, schema, table, fromScanID, schema, table)
+	if err != nil {
+		logger.Errorf("CopyTableResults exec failed for scanID=%d: %v", toScanID, err)
+		return 0, err
+	}
+	copied, err := res.RowsAffected()
+	if err != nil || copied == 0 {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO scan_column_profiles(scan_id, schema_name, table_name, column_name, sampled_rows,
+		null_ratio, approx_distinct, min_length, max_length, top_shapes, char_class_entropy)
+		SELECT ?, schema_name, table_name, column_name, sampled_rows, null_ratio, approx_distinct, min_length, max_length, top_shapes, char_class_entropy
+		FROM scan_column_profiles WHERE scan_id = ? AND schema_name = ? AND table_name = ?`,
+		toScanID, fromScanID, schema, table); err != nil {
+		logger.Errorf("CopyTableResults profiles exec failed for scanID=%d: %v", toScanID, err)
+		return 0, err
+	}
+	return copied, tx.Commit()
+}
+
+func (r *scanRepository) UpdateTableStats(scanID int64, scanned, reused int) error {
+	stmt, err := r.conn.Prepare("UPDATE scan_history SET tables_scanned = ?, tables_reused = ? WHERE id = ?")
+	if err != nil {
+		logger.Errorf("UpdateTableStats prepare failed: %v", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(scanned, reused, scanID)
+	if err != nil {
+		logger.Errorf("UpdateTableStats exec failed for scanID=%d: %v", scanID, err)
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/repositories"
+)
+
+func TestScanRepository_CreateHistoryAdmitsWithinLockingTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repositories.NewScanRepository(db)
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	admit := func(counter repositories.ScanCounter) error {
+		if n, err := counter.CountRunning(1, 7, since); err != nil || n > 0 {
+			return errors.New("busy")
+		}
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT d.id FROM external_databases d JOIN tenants t .* FOR UPDATE`).
+		WithArgs(int64(7), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM scan_history WHERE tenant_id = \? AND status = 'running'`).
+		WithArgs(int64(1), since, int64(7)).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(0))
+	mock.ExpectPrepare(`INSERT INTO scan_history`).ExpectExec().
+		WithArgs("v1", "running", int64(7), int64(1)).WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectCommit()
+	scanID, err := repo.CreateHistory(1, 7, "v1", admit)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), scanID)
+
+	// a refusal rolls back without inserting
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE`).WithArgs(int64(7), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM scan_history`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	mock.ExpectRollback()
+	_, err = repo.CreateHistory(1, 7, "v1", admit)
+	assert.EqualError(t, err, "busy")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScanRepository_IncrementalBaseHasTheSameVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT id FROM scan_history WHERE .* AND api_version = \?`).
+		WithArgs(int64(1), int64(3), int64(9), "v2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(6)))
+	id, err := repositories.NewScanRepository(db).GetLastSuccessfulScanID(1, 3, 9, "v2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
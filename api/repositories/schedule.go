@@ -0,0 +1,229 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// dbTimeLayout is how DATETIME columns are returned by the driver (the DSN does not set parseTime).
+// Schedule times are always stored in UTC.
+const dbTimeLayout = "2006-01-02 15:04:05"
+
+// ScheduleRepository stores scan schedules. The methods used by the API are scoped to a
+// tenant; the scheduler works across tenants through ListDue and the run bookkeeping methods.
+type ScheduleRepository interface {
+	// Create stores a schedule of s.TenantID
+	Create(s models.ScanSchedule) (int64, error)
+	Get(tenantID, id int64) (models.ScanSchedule, error)
+	List(tenantID int64) ([]models.ScanSchedule, error)
+	// Update replaces s.ID within s.TenantID
+	Update(s models.ScanSchedule) error
+	Delete(tenantID, id int64) error
+	// ListDue returns enabled schedules of every tenant whose next run is at or before now
+	ListDue(now time.Time) ([]models.ScanSchedule, error)
+	// Claim moves next_run_at from expected to next and adds missed runs. It returns false when
+	// another scheduler already claimed this activation.
+	Claim(id int64, expected, next time.Time, missed int) (bool, error)
+	StartRun(run models.ScheduleRun) (int64, error)
+	// FinishRun stores the outcome of a run and mirrors it on the schedule's last_* columns
+	FinishRun(run models.ScheduleRun) error
+	// HasActiveRun reports whether a run of the schedule started after since is still running
+	HasActiveRun(scheduleID int64, since time.Time) (bool, error)
+	ListRuns(tenantID, scheduleID int64, limit int) ([]models.ScheduleRun, error)
+}
+
+type scheduleRepository struct {
+	conn *sql.DB
+}
+
+func NewScheduleRepository(conn *sql.DB) ScheduleRepository {
+	return &scheduleRepository{conn: conn}
+}
+
+const scheduleColumns = `id, tenant_id, database_id, cron_expr, timezone, scan_version, options, enabled, next_run_at,
+	last_run_at, last_scan_id, last_status, missed_runs`
+
+func (r *scheduleRepository) Create(s models.ScanSchedule) (int64, error) {
+	opts, err := json.Marshal(s.Options)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := r.conn.Prepare(`INSERT INTO scan_schedules(tenant_id, database_id, cron_expr, timezone, scan_version, options, enabled, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		logger.Errorf("Schedule Create prepare failed: %v", err)
+		return 0, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(s.TenantID, s.DatabaseID, s.Cron, s.Timezone, s.Version, string(opts), s.Enabled, s.NextRunAt.UTC())
+	if err != nil {
+		logger.Errorf("Schedule Create exec failed for database_id=%d: %v", s.DatabaseID, err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *scheduleRepository) Get(tenantID, id int64) (models.ScanSchedule, error) {
+	schedules, err := r.query("SELECT "+scheduleColumns+" FROM scan_schedules WHERE id = ? AND tenant_id = ?", id, tenantID)
+	if err != nil {
+		return models.ScanSchedule{}, err
+	}
+	if len(schedules) == 0 {
+		return models.ScanSchedule{}, sql.ErrNoRows
+	}
+	return schedules[0], nil
+}
+
+func (r *scheduleRepository) List(tenantID int64) ([]models.ScanSchedule, error) {
+	return r.query("SELECT "+scheduleColumns+" FROM scan_schedules WHERE tenant_id = ? ORDER BY id", tenantID)
+}
+
+func (r *scheduleRepository) ListDue(now time.Time) ([]models.ScanSchedule, error) {
+	return r.query("SELECT "+scheduleColumns+" FROM scan_schedules WHERE enabled = TRUE AND next_run_at <= ? ORDER BY next_run_at", now.UTC())
+}
+
+func (r *scheduleRepository) Update(s models.ScanSchedule) error {
+	opts, err := json.Marshal(s.Options)
+	if err != nil {
+		return err
+	}
+	res, err := r.conn.Exec(`UPDATE scan_schedules SET cron_expr = ?, timezone = ?, scan_version = ?, options = ?, enabled = ?, next_run_at = ?
+		WHERE id = ? AND tenant_id = ?`, s.Cron, s.Timezone, s.Version, string(opts), s.Enabled, s.NextRunAt.UTC(), s.ID, s.TenantID)
+	if err != nil {
+		logger.Errorf("Schedule Update exec failed for id=%d: %v", s.ID, err)
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *scheduleRepository) Delete(tenantID, id int64) error {
+	res, err := r.conn.Exec("DELETE FROM scan_schedules WHERE id = ? AND tenant_id = ?", id, tenantID)
+	if err != nil {
+		logger.Errorf("Schedule Delete exec failed for id=%d: %v", id, err)
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *scheduleRepository) Claim(id int64, expected, next time.Time, missed int) (bool, error) {
+	res, err := r.conn.Exec("UPDATE scan_schedules SET next_run_at = ?, missed_runs = missed_runs + ? WHERE id = ? AND next_run_at = ?",
+		next.UTC(), missed, id, expected.UTC())
+	if err != nil {
+		logger.Errorf("Schedule Claim exec failed for id=%d: %v", id, err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *scheduleRepository) StartRun(run models.ScheduleRun) (int64, error) {
+	res, err := r.conn.Exec("INSERT INTO scan_schedule_runs(schedule_id, scheduled_at, scan_id, status, message) VALUES (?, ?, ?, ?, ?)",
+		run.ScheduleID, run.ScheduledAt.UTC(), run.ScanID, run.Status, run.Message)
+	if err != nil {
+		logger.Errorf("Schedule StartRun exec failed for schedule_id=%d: %v", run.ScheduleID, err)
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *scheduleRepository) FinishRun(run models.ScheduleRun) error {
+	if _, err := r.conn.Exec("UPDATE scan_schedule_runs SET scan_id = ?, status = ?, message = ? WHERE id = ?",
+		run.ScanID, run.Status, run.Message, run.ID); err != nil {
+		logger.Errorf("Schedule FinishRun exec failed for run id=%d: %v", run.ID, err)
+		return err
+	}
+	_, err := r.conn.Exec("UPDATE scan_schedules SET last_run_at = ?, last_scan_id = ?, last_status = ? WHERE id = ?",
+		run.ScheduledAt.UTC(), run.ScanID, run.Status, run.ScheduleID)
+	if err != nil {
+		logger.Errorf("Schedule FinishRun exec failed for schedule_id=%d: %v", run.ScheduleID, err)
+	}
+	return err
+}
+
+func (r *scheduleRepository) HasActiveRun(scheduleID int64, since time.Time) (bool, error) {
+	var n int
+	err := r.conn.QueryRow("SELECT COUNT(*) FROM scan_schedule_runs WHERE schedule_id = ? AND status = ? AND scheduled_at > ?",
+		scheduleID, models.RunStatusRunning, since.UTC()).Scan(&n)
+	if err != nil {
+		logger.Errorf("Schedule HasActiveRun query failed for schedule_id=%d: %v", scheduleID, err)
+	}
+	return n > 0, err
+}
+
+func (r *scheduleRepository) ListRuns(tenantID, scheduleID int64, limit int) ([]models.ScheduleRun, error) {
+	rows, err := r.conn.Query(`SELECT r.id, r.schedule_id, r.scheduled_at, r.scan_id, r.status, r.message
+		FROM scan_schedule_runs r JOIN scan_schedules s ON s.id = r.schedule_id
+		WHERE r.schedule_id = ? AND s.tenant_id = ? ORDER BY r.id DESC LIMIT ?`,
+		scheduleID, tenantID, limit)
+	if err != nil {
+		logger.Errorf("Schedule ListRuns query failed for schedule_id=%d: %v", scheduleID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.ScheduleRun{}
+	for rows.Next() {
+		var run models.ScheduleRun
+		var scheduledAt string
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &scheduledAt, &run.ScanID, &run.Status, &run.Message); err != nil {
+			return nil, err
+		}
+		if run.ScheduledAt, err = time.Parse(dbTimeLayout, scheduledAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *scheduleRepository) query(query string, args ...any) ([]models.ScanSchedule, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("Schedule query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.ScanSchedule{}
+	for rows.Next() {
+		var s models.ScanSchedule
+		var opts, nextRun string
+		var lastRun sql.NullString
+		if err := rows.Scan(&s.ID, &s.TenantID, &s.DatabaseID, &s.Cron, &s.Timezone, &s.Version, &opts, &s.Enabled, &nextRun,
+			&lastRun, &s.LastScanID, &s.LastStatus, &s.MissedRuns); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(opts), &s.Options); err != nil {
+			return nil, err
+		}
+		if s.NextRunAt, err = time.Parse(dbTimeLayout, nextRun); err != nil {
+			return nil, err
+		}
+		if lastRun.Valid {
+			t, err := time.Parse(dbTimeLayout, lastRun.String)
+			if err != nil {
+				return nil, err
+			}
+			s.LastRunAt = &t
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// requireRow maps an UPDATE/DELETE that matched nothing to sql.ErrNoRows.
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
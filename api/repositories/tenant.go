@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+type TenantRepository interface {
+	// Create stores a tenant subscribed to t.RulePacks in one transaction
+	Create(t models.Tenant) (int64, error)
+	// Get returns a tenant with the rule packs it subscribes to
+	Get(id int64) (models.Tenant, error)
+	// GetBySlug returns a tenant without its rule packs
+	GetBySlug(slug string) (models.Tenant, error)
+	List() ([]models.Tenant, error)
+	// SetRulePacks replaces the rule packs a tenant inherits
+	SetRulePacks(tenantID int64, packIDs []int64) error
+}
+
+type tenantRepository struct {
+	conn *sql.DB
+}
+
+func NewTenantRepository(conn *sql.DB) TenantRepository {
+	return &tenantRepository{conn: conn}
+}
+
+func (r *tenantRepository) Create(t models.Tenant) (int64, error) {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO tenants(slug, name, created_at) VALUES (?, ?, ?)", t.Slug, t.Name, t.CreatedAt.UTC())
+	if err != nil {
+		logger.Errorf("Tenant Create exec failed for slug=%s: %v", t.Slug, err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := insertRulePacks(tx, id, t.RulePacks); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *tenantRepository) Get(id int64) (models.Tenant, error) {
+	t, err := r.one("SELECT id, slug, name, created_at FROM tenants WHERE id = ?", id)
+	if err != nil {
+		return t, err
+	}
+	rows, err := r.conn.Query("SELECT pack_id FROM tenant_rule_packs WHERE tenant_id = ? ORDER BY pack_id", id)
+	if err != nil {
+		logger.Errorf("Tenant rule packs query failed for id=%d: %v", id, err)
+		return models.Tenant{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var packID int64
+		if err := rows.Scan(&packID); err != nil {
+			return models.Tenant{}, err
+		}
+		t.RulePacks = append(t.RulePacks, packID)
+	}
+	return t, rows.Err()
+}
+
+func (r *tenantRepository) GetBySlug(slug string) (models.Tenant, error) {
+	return r.one("SELECT id, slug, name, created_at FROM tenants WHERE slug = ?", slug)
+}
+
+func (r *tenantRepository) List() ([]models.Tenant, error) {
+	return r.query("SELECT id, slug, name, created_at FROM tenants ORDER BY id")
+}
+
+func (r *tenantRepository) SetRulePacks(tenantID int64, packIDs []int64) error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tenant_rule_packs WHERE tenant_id = ?", tenantID); err != nil {
+		logger.Errorf("Tenant SetRulePacks delete failed for id=%d: %v", tenantID, err)
+		return err
+	}
+	if err := insertRulePacks(tx, tenantID, packIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertRulePacks(tx *sql.Tx, tenantID int64, packIDs []int64) error {
+	for _, packID := range packIDs {
+		if _, err := tx.Exec("INSERT INTO tenant_rule_packs(tenant_id, pack_id) VALUES (?, ?)", tenantID, packID); err != nil {
+			logger.Errorf("Tenant rule packs insert failed for id=%d pack=%d: %v", tenantID, packID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *tenantRepository) one(query string, args ...any) (models.Tenant, error) {
+	tenants, err := r.query(query, args...)
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	if len(tenants) == 0 {
+		return models.Tenant{}, sql.ErrNoRows
+	}
+	return tenants[0], nil
+}
+
+func (r *tenantRepository) query(query string, args ...any) ([]models.Tenant, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("Tenant query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		var t models.Tenant
+		var createdAt string
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &createdAt); err != nil {
+			return nil, err
+		}
+		if t.CreatedAt, err = time.Parse(dbTimeLayout, createdAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
@@ -0,0 +1,100 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+)
+
+// Tenant 2 asks for resources of tenant 1: every statement carries tenant_id, so the database
+// answers as if the rows did not exist.
+
+func TestDatabaseRepository_OtherTenantsRowsAreNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repositories.NewDatabaseRepository(db)
+
+	mock.ExpectQuery(`FROM external_databases WHERE id = \? AND tenant_id = \?`).
+		WithArgs(int64(7), int64(2)).WillReturnError(sql.ErrNoRows)
+	_, err = repo.GetByID(2, 7)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE external_databases SET deleted_at .* WHERE id = \? AND tenant_id = \?`).
+		WithArgs(int64(7), int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(2, 7))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScanRepository_OtherTenantsScansAreNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repositories.NewScanRepository(db)
+
+	// a scan takes its tenant from the database row, so none is created for a foreign database
+	mock.ExpectPrepare(`INSERT INTO scan_history\(tenant_id, database_id, api_version, status\)\s+SELECT tenant_id, id, \?, \? FROM external_databases WHERE id = \? AND tenant_id = \?`).
+		ExpectExec().WithArgs("v1", "running", int64(7), int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = repo.CreateHistory(2, 7, "v1", nil)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	mock.ExpectQuery(`FROM scan_results r JOIN scan_history h ON h.id = r.scan_id\s+WHERE r.scan_id = \? AND h.tenant_id = \?`).
+		WithArgs(int64(5), int64(2)).WillReturnRows(sqlmock.NewRows([]string{"schema_name", "table_name", "column_name", "info_type", "injection_suspected"}))
+	results, err := repo.GetResultsByScanID(2, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuditRepository_QueryIsAlwaysTenantScoped(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM audit_log WHERE tenant_id = \? AND actor = \? ORDER BY id DESC LIMIT \?`).
+		WithArgs(int64(2), "ana", 10).WillReturnRows(sqlmock.NewRows(nil))
+	_, err = repositories.NewAuditRepository(db).Query(models.AuditFilter{TenantID: 2, Actor: "ana", Limit: 10})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTenantRepository_CreateRollsBackWithoutRulePacks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO tenants`).WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(`INSERT INTO tenant_rule_packs`).WithArgs(int64(3), int64(1)).WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+	_, err = repositories.NewTenantRepository(db).Create(models.Tenant{Slug: "acme", Name: "Acme", RulePacks: []int64{1}})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRuleRepository_CreatePackIsAtomic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	pack := models.RulePack{Name: "AR", Rules: []models.ClassificationRule{{TypeName: "CUIT"}, {TypeName: "DNI"}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rule_packs`).WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectPrepare(`INSERT INTO classification_rules`).ExpectExec().WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectPrepare(`INSERT INTO classification_rules`).ExpectExec().WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+	id, err := repositories.NewRuleRepository(db).CreatePack(pack)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.Zero(t, id, "no id is returned for a pack that was rolled back")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
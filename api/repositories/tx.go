@@ -0,0 +1,12 @@
+package repositories
+
+import "database/sql"
+
+// dbtx is implemented by *sql.DB and *sql.Tx, so a statement can run alone or as part of a
+// transaction.
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
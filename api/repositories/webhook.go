@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// WebhookRepository stores webhooks and their deliveries, scoped to a tenant.
+type WebhookRepository interface {
+	// Create stores a webhook of w.TenantID
+	Create(w models.Webhook) (int64, error)
+	// Get returns a webhook including its secret, plaintext or sealed
+	Get(tenantID, id int64) (models.Webhook, error)
+	// List returns the webhooks of a tenant without their secrets
+	List(tenantID int64) ([]models.Webhook, error)
+	Delete(tenantID, id int64) error
+	// UpdateSecret replaces the stored secret, e.g. when re-wrapping it with a new master key
+	UpdateSecret(tenantID, id int64, secret string, enc *models.EncryptedSecret) error
+	// ListForDatabase returns the enabled webhooks of a database plus the global ones of its
+	// tenant, with secrets
+	ListForDatabase(databaseID int64) ([]models.Webhook, error)
+	SaveDelivery(d models.WebhookDelivery) error
+	ListDeliveries(tenantID, webhookID int64, limit int) ([]models.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	conn *sql.DB
+}
+
+func NewWebhookRepository(conn *sql.DB) WebhookRepository {
+	return &webhookRepository{conn: conn}
+}
+
+func (r *webhookRepository) Create(w models.Webhook) (int64, error) {
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return 0, err
+	}
+	keyID, dek, ciphertext := encryptedColumns(w.EncryptedSecret)
+	res, err := r.conn.Exec(`INSERT INTO webhooks(tenant_id, database_id, url, secret, secret_key_id, secret_dek, secret_ciphertext, events, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.TenantID, w.DatabaseID, w.URL, w.Secret, keyID, dek, ciphertext, string(events), w.Enabled)
+	if err != nil {
+		logger.Errorf("Webhook Create exec failed: %v", err)
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (r *webhookRepository) Get(tenantID, id int64) (models.Webhook, error) {
+	hooks, err := r.query("SELECT id, tenant_id, database_id, url, secret, secret_key_id, secret_dek, secret_ciphertext, events, enabled FROM webhooks WHERE id = ? AND tenant_id = ?", id, tenantID)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if len(hooks) == 0 {
+		return models.Webhook{}, sql.ErrNoRows
+	}
+	return hooks[0], nil
+}
+
+func (r *webhookRepository) List(tenantID int64) ([]models.Webhook, error) {
+	return r.query("SELECT id, tenant_id, database_id, url, '', '', NULL, NULL, events, enabled FROM webhooks WHERE tenant_id = ? ORDER BY id", tenantID)
+}
+
+func (r *webhookRepository) Delete(tenantID, id int64) error {
+	res, err := r.conn.Exec("DELETE FROM webhooks WHERE id = ? AND tenant_id = ?", id, tenantID)
+	if err != nil {
+		logger.Errorf("Webhook Delete exec failed for id=%d: %v", id, err)
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *webhookRepository) UpdateSecret(tenantID, id int64, secret string, enc *models.EncryptedSecret) error {
+	keyID, dek, ciphertext := encryptedColumns(enc)
+	res, err := r.conn.Exec("UPDATE webhooks SET secret = ?, secret_key_id = ?, secret_dek = ?, secret_ciphertext = ? WHERE id = ? AND tenant_id = ?",
+		secret, keyID, dek, ciphertext, id, tenantID)
+	if err != nil {
+		logger.Errorf("Webhook UpdateSecret exec failed for id=%d: %v", id, err)
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *webhookRepository) ListForDatabase(databaseID int64) ([]models.Webhook, error) {
+	return r.query(`SELECT w.id, w.tenant_id, w.database_id, w.url, w.secret, w.secret_key_id, w.secret_dek, w.secret_ciphertext, w.events, w.enabled
+		FROM webhooks w JOIN external_databases d ON d.id = ? AND d.tenant_id = w.tenant_id
+		WHERE w.enabled = TRUE AND (w.database_id IS NULL OR w.database_id = d.id) ORDER BY w.id`, databaseID)
+}
+
+func (r *webhookRepository) SaveDelivery(d models.WebhookDelivery) error {
+	_, err := r.conn.Exec(`INSERT INTO webhook_deliveries(webhook_id, event_id, event, scan_id, attempt, status_code, success, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.WebhookID, d.EventID, d.Event, d.ScanID, d.Attempt, d.StatusCode, d.Success, d.Error, d.DurationMs, d.CreatedAt.UTC())
+	if err != nil {
+		logger.Errorf("Webhook SaveDelivery exec failed for webhook_id=%d: %v", d.WebhookID, err)
+	}
+	return err
+}
+
+func (r *webhookRepository) ListDeliveries(tenantID, webhookID int64, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := r.conn.Query(`SELECT d.id, d.webhook_id, d.event_id, d.event, d.scan_id, d.attempt, d.status_code, d.success, d.error, d.duration_ms, d.created_at
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = ? AND w.tenant_id = ? ORDER BY d.id DESC LIMIT ?`, webhookID, tenantID, limit)
+	if err != nil {
+		logger.Errorf("Webhook ListDeliveries query failed for webhook_id=%d: %v", webhookID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var createdAt string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.ScanID, &d.Attempt, &d.StatusCode, &d.Success,
+			&d.Error, &d.DurationMs, &createdAt); err != nil {
+			return nil, err
+		}
+		if d.CreatedAt, err = time.Parse(dbTimeLayout, createdAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) query(query string, args ...any) ([]models.Webhook, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		logger.Errorf("Webhook query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		var databaseID sql.NullInt64
+		var enc models.EncryptedSecret
+		var events string
+		if err := rows.Scan(&w.ID, &w.TenantID, &databaseID, &w.URL, &w.Secret, &enc.KeyID, &enc.WrappedKey, &enc.Ciphertext,
+			&events, &w.Enabled); err != nil {
+			return nil, err
+		}
+		if enc.KeyID != "" {
+			w.EncryptedSecret = &enc
+		}
+		if databaseID.Valid {
+			w.DatabaseID = &databaseID.Int64
+		}
+		if err := json.Unmarshal([]byte(events), &w.Events); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
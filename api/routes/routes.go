@@ -1,11 +1,21 @@
 package routes
 
 import (
+	"context"
+	"os"
+
 	"meli-challenge/api/controllers"
+	"meli-challenge/api/llm"
 	"meli-challenge/api/middleware"
+	"meli-challenge/api/models"
+	"meli-challenge/api/oidc"
+	"meli-challenge/api/ratelimit"
 	"meli-challenge/api/repositories"
+	"meli-challenge/api/scheduler"
 	"meli-challenge/api/services"
+	"meli-challenge/api/webhook"
 	"meli-challenge/config"
+	"meli-challenge/logger"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,34 +27,169 @@ func RegisterRoutes(r *gin.Engine) {
 	repoDB := repositories.NewDatabaseRepository(db)
 	repoScan := repositories.NewScanRepository(db)
 	repoRule := repositories.NewRuleRepository(db)
+	repoCache := repositories.NewLLMCacheRepository(db)
+	repoSchedule := repositories.NewScheduleRepository(db)
+	repoWebhook := repositories.NewWebhookRepository(db)
+	repoShare := repositories.NewReportShareRepository(db)
+	repoKeys := repositories.NewAPIKeyRepository(db)
+	repoAudit := repositories.NewAuditRepository(db)
+	repoTenant := repositories.NewTenantRepository(db)
 
 	// Services
 	serviceDB := services.NewDatabaseService(repoDB)
-	serviceScan := services.NewScanService(repoScan, repoRule)
+	scanOpts := []services.ScanOption{
+		services.WithNotifier(webhook.NewDispatcher(repoWebhook, webhook.ConfigFromEnv())),
+		services.WithQuotas(services.ScanQuotasFromEnv()),
+	}
+	// One LLM client for every v2 scan, so its circuit breakers remember failures across scans
+	if client, err := llm.NewLLMClientFromEnv(); err != nil {
+		logger.Warnf("LLM client not configured, v2 scans will fail: %v", err)
+	} else {
+		scanOpts = append(scanOpts, services.WithLLMClient(client))
+	}
+	serviceScan := services.NewScanService(repoScan, repoRule, repoCache, scanOpts...)
 	serviceRule := services.NewRuleService(repoRule)
+	serviceSchedule := services.NewScheduleService(repoSchedule, repoDB)
+	serviceWebhook := services.NewWebhookService(repoWebhook, repoDB)
+	serviceShare := services.NewShareService(repoShare, repoScan, services.ShareSecretFromEnv())
+	serviceKeys := services.NewAPIKeyService(repoKeys, repoTenant, os.Getenv("API_KEY"))
+	serviceAudit := services.NewAuditService(repoAudit)
+	serviceTenant := services.NewTenantService(repoTenant, repoRule)
 
 	// Controllers
 	controllerDB := controllers.NewDatabaseController(serviceDB)
 	controllerScan := controllers.NewScanController(serviceScan, db)
 	controllerRule := controllers.NewRuleController(serviceRule)
+	controllerSchedule := controllers.NewScheduleController(serviceSchedule)
+	controllerWebhook := controllers.NewWebhookController(serviceWebhook)
+	controllerShare := controllers.NewShareController(serviceShare)
+	controllerScan.Shares = serviceShare
+	controllerKeys := controllers.NewAPIKeyController(serviceKeys)
+	controllerAudit := controllers.NewAuditController(serviceAudit)
+	controllerTenant := controllers.NewTenantController(serviceTenant)
+
+	// Recurring scans; replicas coordinate through a lease in the internal DB
+	if scheduler.Enabled() {
+		launcher := services.NewScanLauncher(repoDB, serviceScan, serviceAudit)
+		scheduler.New(repoSchedule, repositories.NewLeaseRepository(db), launcher, scheduler.ConfigFromEnv()).Start(context.Background())
+	}
+
+	// Request IDs and the audit log for every route, including shared reports
+	r.Use(middleware.RequestID(), middleware.AuditTrail(serviceAudit))
+
+	// Each caller gets its own budget of requests per route group (RATE_LIMITS)
+	limits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	limit := func(group string) gin.HandlerFunc {
+		return middleware.RateLimit(ratelimit.New(limits.For(group)))
+	}
 
-	// Apply API key middleware to all v1 routes
-	v1 := r.Group("/api/v1", middleware.APIKeyAuthMiddleware())
+	// Every v1 route needs an API key or an SSO bearer token; each group below also needs a
+	// scope. Handlers only see the data of the caller's tenant.
+	auth := middleware.AuthMiddleware(serviceKeys, bearerAuthenticator(serviceTenant))
+	v1 := r.Group("/api/v1", auth)
+	base := v1.Group("", limit("default"))
+	{
+		base.GET("/ping", controllers.Ping)
+		base.GET("/whoami", controllerKeys.WhoAmI)
+		base.GET("/tenant", controllerTenant.CurrentTenant)
+	}
+	read := v1.Group("", middleware.RequireScope(models.ScopeScanRead), limit("read"))
+	{
+		read.GET("/database/scan/:id", controllerScan.GetScanResults)
+		read.GET("/database/scan/:id/status", controllerScan.GetScanStatus)
+		read.GET("/database/scan/:id/report", controllerScan.RenderScanReport)
+		read.GET("/database/scan/:id/report/events", controllerScan.StreamScanEvents)
+		read.GET("/scan/:id/events", controllerScan.StreamScanEvents)
+		read.GET("/scans/diff", controllerScan.DiffScans)
+		read.GET("/classification/rules", controllerRule.GetAllRules)
+		read.GET("/classification/packs", controllerRule.ListPacks)
+		read.GET("/classification/packs/:id", controllerRule.GetPack)
+		read.GET("/schedules", controllerSchedule.ListSchedules)
+		read.GET("/schedules/:id", controllerSchedule.GetSchedule)
+		read.GET("/schedules/:id/runs", controllerSchedule.ListRuns)
+		read.GET("/scan/:id/shares", controllerShare.ListShares)
+		read.GET("/shares/:id/accesses", controllerShare.ListAccesses)
+	}
+	run := v1.Group("", middleware.RequireScope(models.ScopeScanRun), limit("run"))
+	{
+		run.POST("/database/scan/:id", controllerScan.ExecuteScan)
+		run.POST("/scan/:id/cancel", controllerScan.CancelScan)
+		run.POST("/schedules", controllerSchedule.CreateSchedule)
+		run.PUT("/schedules/:id", controllerSchedule.UpdateSchedule)
+		run.DELETE("/schedules/:id", controllerSchedule.DeleteSchedule)
+	}
+	// A share link hands a report to anyone holding it, so minting one needs more than read access
+	shares := v1.Group("", middleware.RequireScope(models.ScopeSharesWrite), limit("shares"))
+	{
+		shares.POST("/scan/:id/share", controllerShare.CreateShare)
+		shares.DELETE("/shares/:id", controllerShare.RevokeShare)
+	}
+	rules := v1.Group("", middleware.RequireScope(models.ScopeRulesWrite), limit("rules"))
+	{
+		rules.POST("/classification/rule", controllerRule.CreateRule)
+		rules.PUT("/tenant/packs", controllerTenant.SetRulePacks)
+	}
+	admin := v1.Group("", middleware.RequireScope(models.ScopeDatabasesAdmin), limit("admin"))
+	{
+		admin.POST("/database", controllerDB.CreateDatabase)
+		admin.GET("/database", controllerDB.ListDatabases)
+		admin.GET("/database/:id", controllerDB.GetDatabase)
+		admin.PUT("/database/:id", controllerDB.UpdateDatabase)
+		admin.DELETE("/database/:id", controllerDB.DeleteDatabase)
+		admin.POST("/database/:id/test", controllerDB.TestConnection)
+		admin.POST("/webhooks", controllerWebhook.CreateWebhook)
+		admin.GET("/webhooks", controllerWebhook.ListWebhooks)
+		admin.GET("/webhooks/:id", controllerWebhook.GetWebhook)
+		admin.DELETE("/webhooks/:id", controllerWebhook.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", controllerWebhook.ListDeliveries)
+	}
+	keys := v1.Group("/keys", middleware.RequireScope(models.ScopeKeysAdmin), limit("keys"))
 	{
-		v1.GET("/ping", controllers.Ping)
-		v1.POST("/database", controllerDB.CreateDatabase)
-		v1.POST("/database/scan/:id", controllerScan.ExecuteScan)
-		v1.GET("/database/scan/:id", controllerScan.GetScanResults)
-		v1.POST("/classification/rule", controllerRule.CreateRule)
-		v1.GET("/classification/rules", controllerRule.GetAllRules)
+		keys.POST("", controllerKeys.CreateKey)
+		keys.GET("", controllerKeys.ListKeys)
+		keys.DELETE("/:id", controllerKeys.RevokeKey)
+	}
+	v1.GET("/audit", middleware.RequireScope(models.ScopeAuditRead), limit("audit"), controllerAudit.ListAudit)
+	// Platform administration: tenants and the global rule packs they inherit
+	platform := v1.Group("", middleware.RequireScope(models.ScopeTenantsAdmin), limit("platform"))
+	{
+		platform.POST("/tenants", controllerTenant.CreateTenant)
+		platform.GET("/tenants", controllerTenant.ListTenants)
+		platform.GET("/tenants/:id", controllerTenant.GetTenant)
+		platform.POST("/classification/packs", controllerRule.CreatePack)
+		platform.POST("/classification/packs/:id/rules", controllerRule.CreatePackRule)
 	}
 
-	// Public (unauthenticated) report endpoint
-	r.GET("/api/v1/database/scan/:id/report", controllerScan.RenderScanReport)
+	// Shared reports are authorized by the signed token in the path instead of the API key;
+	// the live report's EventSource reads <link>/events, which the same token covers. Live
+	// reports opened with the API key read a stream URL whose ?token= is signed for their scan
+	shared := limit("shared")
+	r.GET(controllers.SharedReportPath+":token", controllerShare.Authorize, shared, controllerScan.RenderScanReport)
+	r.GET(controllers.SharedReportPath+":token/events", controllerShare.Authorize, shared, controllerScan.StreamScanEvents)
+	r.GET(controllers.LiveEventsPath+":id/events", controllerShare.AuthorizeEvents, shared, controllerScan.StreamScanEvents)
 
-	// Apply API key middleware also to v2 routes
-	v2 := r.Group("/api/v2", middleware.APIKeyAuthMiddleware())
+	v2 := r.Group("/api/v2", auth, middleware.RequireScope(models.ScopeScanRun), limit("v2"))
 	{
 		v2.POST("/database/scan/:id", controllerScan.ExecuteScanV2)
 	}
 }
+
+// bearerAuthenticator returns the SSO token verifier, or nil when OIDC_ISSUER is not set.
+func bearerAuthenticator(tenants services.TenantService) middleware.BearerAuthenticator {
+	cfg, err := oidc.ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	cfg.ResolveTenant = tenants.ResolveSlug
+	if !cfg.Enabled() {
+		return nil
+	}
+	verifier, err := oidc.NewVerifier(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return verifier
+}
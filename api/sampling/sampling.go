@@ -0,0 +1,271 @@
+package sampling
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"meli-challenge/api/models"
+	"meli-challenge/internal/textutil"
+)
+
+// Strategy names accepted in models.SamplingConfig.Strategy
+const (
+	FirstN     = "first-n"
+	PKRandom   = "pk-random"
+	Percentage = "percentage"
+	Recent     = "recent"
+)
+
+// Defaults applied to unset SamplingConfig fields
+const (
+	DefaultSampleSize     = 5
+	DefaultRowLimit       = 1000
+	DefaultPercent        = 1.0
+	DefaultMaxExecutionMs = 5000
+)
+
+// Column is the information_schema metadata the strategies need.
+type Column struct {
+	Name      string
+	DataType  string
+	ColumnKey string // PRI, UNI, MUL or empty
+	// ColumnType is the full type (e.g. varchar(255), enum('a','b')); only used for fingerprints
+	ColumnType string
+}
+
+// Table describes a table being sampled.
+type Table struct {
+	Schema string
+	Name   string
+	// PrimaryKey is the single integer primary key column, empty if the table has none
+	PrimaryKey string
+	// Timestamp is the column used by the "recent" strategy, empty if none was detected
+	Timestamp string
+}
+
+// Strategy reads up to cfg.SampleSize distinct non-null values of a column. Queries are abandoned
+// when ctx is done.
+type Strategy interface {
+	Sample(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig) ([]string, error)
+}
+
+var strategies = map[string]Strategy{
+	FirstN:     firstN{},
+	PKRandom:   pkRandom{},
+	Percentage: percentage{},
+	Recent:     recent{},
+}
+
+// New returns the strategy registered under name ("" selects first-n).
+func New(name string) (Strategy, error) {
+	if name == "" {
+		name = FirstN
+	}
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sampling strategy %q (valid: %s)", name, strings.Join(Names(), ", "))
+	}
+	return s, nil
+}
+
+// Names lists the registered strategy names.
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for n := range strategies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithDefaults fills unset fields of cfg.
+func WithDefaults(cfg models.SamplingConfig) models.SamplingConfig {
+	if cfg.Strategy == "" {
+		cfg.Strategy = FirstN
+	}
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = DefaultSampleSize
+	}
+	if cfg.RowLimit <= 0 {
+		cfg.RowLimit = DefaultRowLimit
+	}
+	if cfg.Percent <= 0 || cfg.Percent > 100 {
+		cfg.Percent = DefaultPercent
+	}
+	if cfg.MaxExecutionMs <= 0 {
+		cfg.MaxExecutionMs = DefaultMaxExecutionMs
+	}
+	return cfg
+}
+
+// Merge applies per-scan overrides on top of a database's sampling settings.
+func Merge(base, override models.SamplingConfig) models.SamplingConfig {
+	if override.Strategy != "" {
+		base.Strategy = override.Strategy
+	}
+	return base
+}
+
+// Hint returns the optimizer hint that makes MySQL abort a SELECT after cfg.MaxExecutionMs.
+func Hint(cfg models.SamplingConfig) string {
+	if cfg.MaxExecutionMs <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */ ", cfg.MaxExecutionMs)
+}
+
+// NewTable builds the sampling description of a table from its columns: the primary key is kept
+// only when it is a single integer column, and the timestamp prefers indexed update/creation columns.
+func NewTable(schema, name string, cols []Column) Table {
+	t := Table{Schema: schema, Name: name}
+
+	var pks []Column
+	for _, c := range cols {
+		if c.ColumnKey == "PRI" {
+			pks = append(pks, c)
+		}
+	}
+	if len(pks) == 1 && isInteger(pks[0].DataType) {
+		t.PrimaryKey = pks[0].Name
+	}
+
+	best := -1
+	for _, c := range cols {
+		if !isTemporal(c.DataType) {
+			continue
+		}
+		score := 0
+		if c.ColumnKey != "" {
+			score += 4 // indexed: ORDER BY ... DESC LIMIT does not need a filesort
+		}
+		switch n := strings.ToLower(c.Name); {
+		case strings.Contains(n, "updated") || strings.Contains(n, "modified"):
+			score += 2
+		case strings.Contains(n, "created") || strings.Contains(n, "inserted"):
+			score++
+		}
+		if score > best {
+			best, t.Timestamp = score, c.Name
+		}
+	}
+	return t
+}
+
+func isInteger(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+func isTemporal(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "timestamp", "datetime":
+		return true
+	}
+	return false
+}
+
+func qualified(t Table) string {
+	return textutil.QuoteIdent(t.Schema) + "." + textutil.QuoteIdent(t.Name)
+}
+
+// collect reads distinct non-null strings from rows, up to limit values.
+func collect(rows *sql.Rows, limit int, seen map[string]struct{}, out []string) ([]string, error) {
+	defer rows.Close()
+	for rows.Next() && len(out) < limit {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			return out, err
+		}
+		if !v.Valid {
+			continue
+		}
+		if _, dup := seen[v.String]; dup {
+			continue
+		}
+		seen[v.String] = struct{}{}
+		out = append(out, v.String)
+	}
+	return out, rows.Err()
+}
+
+// boundedDistinct runs the common "distinct values among at most RowLimit matching rows" query.
+func boundedDistinct(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig, where, orderBy string, args ...any) ([]string, error) {
+	col := textutil.QuoteIdent(column)
+	query := fmt.Sprintf("SELECT %sDISTINCT %s FROM (SELECT %s FROM %s WHERE %s IS NOT NULL%s%s LIMIT %d) AS sample LIMIT %d",
+		Hint(cfg), col, col, qualified(t), col, where, orderBy, cfg.RowLimit, cfg.SampleSize)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collect(rows, cfg.SampleSize, make(map[string]struct{}), nil)
+}
+
+// firstN takes the first values the engine returns, reading at most RowLimit rows.
+type firstN struct{}
+
+func (firstN) Sample(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig) ([]string, error) {
+	return boundedDistinct(ctx, db, t, column, cfg, "", "")
+}
+
+// percentage keeps each row with probability Percent/100, reading at most RowLimit kept rows.
+type percentage struct{}
+
+func (percentage) Sample(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig) ([]string, error) {
+	return boundedDistinct(ctx, db, t, column, cfg, " AND RAND() < ?", "", cfg.Percent/100)
+}
+
+// recent samples the newest rows by the detected timestamp column, falling back to first-n.
+type recent struct{}
+
+func (recent) Sample(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig) ([]string, error) {
+	if t.Timestamp == "" {
+		return firstN{}.Sample(ctx, db, t, column, cfg)
+	}
+	return boundedDistinct(ctx, db, t, column, cfg, "", " ORDER BY "+textutil.QuoteIdent(t.Timestamp)+" DESC")
+}
+
+// pkRandom probes SampleSize random positions of the integer primary key range. Each probe is an
+// index range read of a small window, so the cost does not depend on the table size.
+type pkRandom struct{}
+
+func (pkRandom) Sample(ctx context.Context, db *sql.DB, t Table, column string, cfg models.SamplingConfig) ([]string, error) {
+	if t.PrimaryKey == "" {
+		return firstN{}.Sample(ctx, db, t, column, cfg)
+	}
+	pk := textutil.QuoteIdent(t.PrimaryKey)
+
+	var lo, hi sql.NullInt64
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT %sMIN(%s), MAX(%s) FROM %s", Hint(cfg), pk, pk, qualified(t))).Scan(&lo, &hi); err != nil {
+		return nil, err
+	}
+	if !lo.Valid || !hi.Valid {
+		return nil, nil // empty table
+	}
+
+	window := max(1, cfg.RowLimit/cfg.SampleSize)
+	query := fmt.Sprintf("SELECT %s%s FROM %s WHERE %s >= ? ORDER BY %s LIMIT %d",
+		Hint(cfg), textutil.QuoteIdent(column), qualified(t), pk, pk, window)
+
+	seen := make(map[string]struct{})
+	var out []string
+	for probe := 0; probe < cfg.SampleSize && len(out) < cfg.SampleSize; probe++ {
+		start := lo.Int64 + rand.Int64N(hi.Int64-lo.Int64+1)
+		rows, err := db.QueryContext(ctx, query, start)
+		if err != nil {
+			return out, err
+		}
+		// one value per probe keeps the sample spread over the key range
+		before := len(out)
+		if out, err = collect(rows, before+1, seen, out); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,123 @@
+package sampling_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/sampling"
+)
+
+func TestNew_RejectsUnknownStrategy(t *testing.T) {
+	_, err := sampling.New("everything")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pk-random")
+
+	for _, name := range append(sampling.Names(), "") {
+		_, err := sampling.New(name)
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	cfg := sampling.WithDefaults(models.SamplingConfig{SampleSize: 20, Percent: 150})
+	assert.Equal(t, sampling.FirstN, cfg.Strategy)
+	assert.Equal(t, 20, cfg.SampleSize)
+	assert.Equal(t, sampling.DefaultRowLimit, cfg.RowLimit)
+	assert.Equal(t, sampling.DefaultPercent, cfg.Percent)
+	assert.Equal(t, sampling.DefaultMaxExecutionMs, cfg.MaxExecutionMs)
+}
+
+func TestNewTable_DetectsKeyAndTimestamp(t *testing.T) {
+	table := sampling.NewTable("shop", "orders", []sampling.Column{
+		{Name: "id", DataType: "bigint", ColumnKey: "PRI"},
+		{Name: "created_at", DataType: "datetime"},
+		{Name: "updated_at", DataType: "timestamp", ColumnKey: "MUL"},
+		{Name: "email", DataType: "varchar"},
+	})
+	assert.Equal(t, "id", table.PrimaryKey)
+	assert.Equal(t, "updated_at", table.Timestamp)
+
+	composite := sampling.NewTable("shop", "lines", []sampling.Column{
+		{Name: "order_id", DataType: "int", ColumnKey: "PRI"},
+		{Name: "line", DataType: "int", ColumnKey: "PRI"},
+	})
+	assert.Empty(t, composite.PrimaryKey)
+	assert.Empty(t, composite.Timestamp)
+
+	uuid := sampling.NewTable("shop", "users", []sampling.Column{{Name: "id", DataType: "char", ColumnKey: "PRI"}})
+	assert.Empty(t, uuid.PrimaryKey)
+}
+
+func TestStrategies_BoundQueries(t *testing.T) {
+	cfg := sampling.WithDefaults(models.SamplingConfig{SampleSize: 2, RowLimit: 100, MaxExecutionMs: 250})
+	table := sampling.Table{Schema: "shop", Name: "orders", PrimaryKey: "id", Timestamp: "updated_at"}
+
+	cases := []struct {
+		strategy string
+		query    string
+	}{
+		{sampling.FirstN, "SELECT /*+ MAX_EXECUTION_TIME(250) */ DISTINCT `email` FROM (SELECT `email` FROM `shop`.`orders` WHERE `email` IS NOT NULL LIMIT 100) AS sample LIMIT 2"},
+		{sampling.Percentage, "SELECT /*+ MAX_EXECUTION_TIME(250) */ DISTINCT `email` FROM (SELECT `email` FROM `shop`.`orders` WHERE `email` IS NOT NULL AND RAND() < ? LIMIT 100) AS sample LIMIT 2"},
+		{sampling.Recent, "SELECT /*+ MAX_EXECUTION_TIME(250) */ DISTINCT `email` FROM (SELECT `email` FROM `shop`.`orders` WHERE `email` IS NOT NULL ORDER BY `updated_at` DESC LIMIT 100) AS sample LIMIT 2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.strategy, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			mock.ExpectQuery(regexp.QuoteMeta(tc.query)).
+				WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("a@x.com").AddRow("b@x.com"))
+
+			s, err := sampling.New(tc.strategy)
+			require.NoError(t, err)
+			values, err := s.Sample(context.Background(), db, table, "email", cfg)
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a@x.com", "b@x.com"}, values)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPKRandom_ProbesKeyRange(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	cfg := sampling.WithDefaults(models.SamplingConfig{SampleSize: 2, RowLimit: 100})
+	table := sampling.Table{Schema: "shop", Name: "orders", PrimaryKey: "id"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(5000) */ MIN(`id`), MAX(`id`) FROM `shop`.`orders`")).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 1000000))
+	probe := regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(5000) */ `email` FROM `shop`.`orders` WHERE `id` >= ? ORDER BY `id` LIMIT 50")
+	mock.ExpectQuery(probe).WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow(nil).AddRow("a@x.com"))
+	mock.ExpectQuery(probe).WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("b@x.com"))
+
+	s, _ := sampling.New(sampling.PKRandom)
+	values, err := s.Sample(context.Background(), db, table, "email", cfg)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a@x.com", "b@x.com"}, values)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPKRandom_FallsBackWithoutIntegerKey(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("DISTINCT `email` FROM (SELECT `email` FROM `shop`.`users` WHERE `email` IS NOT NULL LIMIT 1000)")).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("a@x.com"))
+
+	s, _ := sampling.New(sampling.PKRandom)
+	values, err := s.Sample(context.Background(), db, sampling.Table{Schema: "shop", Name: "users"}, "email", sampling.WithDefaults(models.SamplingConfig{}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a@x.com"}, values)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
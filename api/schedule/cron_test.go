@@ -0,0 +1,72 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/schedule"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		expr, after, want string
+	}{
+		{"*/15 * * * *", "2025-03-10T10:07:30Z", "2025-03-10T10:15:00Z"},
+		{"*/15 * * * *", "2025-03-10T10:45:00Z", "2025-03-10T11:00:00Z"},
+		{"30 2 * * *", "2025-03-10T03:00:00Z", "2025-03-11T02:30:00Z"},
+		{"0 9 * * mon-fri", "2025-03-14T09:00:00Z", "2025-03-17T09:00:00Z"}, // Friday -> Monday
+		{"0 0 1 jan *", "2025-03-10T00:00:00Z", "2026-01-01T00:00:00Z"},
+		{"@weekly", "2025-03-10T00:00:00Z", "2025-03-16T00:00:00Z"},
+		{"0 0 * * 7", "2025-03-10T00:00:00Z", "2025-03-16T00:00:00Z"},
+		// both day fields restricted: either matches
+		{"0 0 13 * fri", "2025-03-10T00:00:00Z", "2025-03-13T00:00:00Z"},
+		{"0 0 29 2 *", "2025-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+	}
+	for _, tc := range cases {
+		c, err := schedule.Parse(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, at(tc.want), c.Next(at(tc.after)).UTC(), tc.expr)
+	}
+}
+
+func TestNext_InLocation(t *testing.T) {
+	c, err := schedule.ParseInLocation("0 9 * * *", "America/Argentina/Buenos_Aires")
+	require.NoError(t, err)
+	// 09:00 in Buenos Aires (UTC-3) is 12:00 UTC
+	assert.Equal(t, at("2025-03-10T12:00:00Z"), c.Next(at("2025-03-10T10:00:00Z")).UTC())
+
+	_, err = schedule.ParseInLocation("0 9 * * *", "Mars/Olympus")
+	assert.Error(t, err)
+}
+
+func TestNext_NeverFires(t *testing.T) {
+	c, err := schedule.Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, c.Next(at("2025-01-01T00:00:00Z")).IsZero())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := schedule.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	c, err := schedule.Parse("0 * * * *")
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Between(at("2025-03-10T10:00:00Z"), at("2025-03-10T13:30:00Z"), 100))
+	assert.Equal(t, 2, c.Between(at("2025-03-10T10:00:00Z"), at("2025-03-10T13:30:00Z"), 2))
+	assert.Equal(t, 0, c.Between(at("2025-03-10T10:00:00Z"), at("2025-03-10T10:59:00Z"), 100))
+}
@@ -0,0 +1,209 @@
+// Package scheduler starts the recurring scans stored in scan_schedules.
+//
+// Every API replica runs a Scheduler, but only the holder of the "scan-scheduler" lease in the
+// internal database starts scans. Each activation is additionally claimed with a conditional
+// UPDATE of next_run_at, so a lease handover can never start the same run twice.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/schedule"
+	"meli-challenge/api/services"
+	"meli-challenge/config"
+	"meli-challenge/internal/textutil"
+	"meli-challenge/logger"
+)
+
+const leaseName = "scan-scheduler"
+
+// maxMissedCount caps the missed activations counted after a long downtime.
+const maxMissedCount = 10000
+
+// Config tunes the scheduler loop.
+type Config struct {
+	// Interval between checks for due schedules
+	Interval time.Duration
+	// LeaseTTL is how long a replica keeps leadership without renewing it
+	LeaseTTL time.Duration
+	// StaleAfter is when a run still marked running is considered dead (e.g. the API crashed)
+	StaleAfter time.Duration
+}
+
+// ConfigFromEnv reads SCHEDULER_INTERVAL_SEC (15), SCHEDULER_LEASE_TTL_SEC (60) and
+// SCHEDULER_STALE_RUN_HOURS (12).
+func ConfigFromEnv() Config {
+	return Config{
+		Interval:   time.Duration(config.EnvInt("SCHEDULER_INTERVAL_SEC", 15, 1)) * time.Second,
+		LeaseTTL:   time.Duration(config.EnvInt("SCHEDULER_LEASE_TTL_SEC", 60, 1)) * time.Second,
+		StaleAfter: time.Duration(config.EnvInt("SCHEDULER_STALE_RUN_HOURS", 12, 1)) * time.Hour,
+	}
+}
+
+// Enabled reports whether this replica should run the scheduler (SCHEDULER_ENABLED, default true).
+func Enabled() bool {
+	v, err := strconv.ParseBool(os.Getenv("SCHEDULER_ENABLED"))
+	return err != nil || v
+}
+
+type Scheduler struct {
+	schedules repositories.ScheduleRepository
+	leases    repositories.LeaseRepository
+	launcher  services.ScanLauncher
+	cfg       Config
+	holder    string
+
+	mu      sync.Mutex
+	running map[int64]bool
+	wg      sync.WaitGroup
+}
+
+func New(schedules repositories.ScheduleRepository, leases repositories.LeaseRepository, launcher services.ScanLauncher, cfg Config) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		schedules: schedules,
+		leases:    leases,
+		launcher:  launcher,
+		cfg:       cfg,
+		holder:    fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		running:   make(map[int64]bool),
+	}
+}
+
+// Start runs the scheduler loop until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		logger.Infof("Scan scheduler started as %s (interval=%s)", s.holder, s.cfg.Interval)
+		for {
+			s.Tick(time.Now())
+			select {
+			case <-ctx.Done():
+				if err := s.leases.Release(leaseName, s.holder); err != nil {
+					logger.Warnf("Could not release scheduler lease: %v", err)
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Tick starts the schedules due at now if this replica holds the lease. Scans run in the
+// background; Wait blocks until they finish.
+func (s *Scheduler) Tick(now time.Time) {
+	leader, err := s.leases.TryAcquire(leaseName, s.holder, s.cfg.LeaseTTL)
+	if err != nil || !leader {
+		return
+	}
+
+	due, err := s.schedules.ListDue(now)
+	if err != nil {
+		return
+	}
+	for _, sched := range due {
+		s.activate(sched, now)
+	}
+}
+
+// Wait blocks until the scans started by Tick have finished.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) activate(sched models.ScanSchedule, now time.Time) {
+	cron, err := schedule.ParseInLocation(sched.Cron, sched.Timezone)
+	if err != nil {
+		logger.Errorf("Schedule id=%d has an invalid cron expression: %v", sched.ID, err)
+		return
+	}
+
+	// Activations after the due one that also passed were missed (no scheduler was running)
+	missed := cron.Between(sched.NextRunAt, now, maxMissedCount)
+	skip := s.isRunning(sched.ID)
+	if !skip {
+		active, err := s.schedules.HasActiveRun(sched.ID, now.Add(-s.cfg.StaleAfter))
+		if err != nil {
+			return
+		}
+		skip = active
+	}
+	addMissed := missed
+	if skip {
+		addMissed++
+	}
+
+	next := cron.Next(now)
+	if next.IsZero() {
+		// never fires again: park it far in the future rather than re-checking every tick
+		next = now.AddDate(100, 0, 0)
+	}
+	claimed, err := s.schedules.Claim(sched.ID, sched.NextRunAt, next, addMissed)
+	if err != nil || !claimed {
+		return
+	}
+
+	if missed > 0 {
+		logger.Warnf("Schedule id=%d missed %d runs since %s", sched.ID, missed, sched.NextRunAt.Format(time.RFC3339))
+		s.record(models.ScheduleRun{ScheduleID: sched.ID, ScheduledAt: sched.NextRunAt, Status: models.RunStatusMissed,
+			Message: fmt.Sprintf("%d runs missed while no scheduler was running", missed)})
+	}
+	if skip {
+		logger.Warnf("Schedule id=%d skipped: previous run still in progress", sched.ID)
+		s.record(models.ScheduleRun{ScheduleID: sched.ID, ScheduledAt: now, Status: models.RunStatusSkipped,
+			Message: "previous run still in progress"})
+		return
+	}
+
+	run := models.ScheduleRun{ScheduleID: sched.ID, ScheduledAt: now, Status: models.RunStatusRunning}
+	if run.ID, err = s.schedules.StartRun(run); err != nil {
+		return
+	}
+
+	s.setRunning(sched.ID, true)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.setRunning(sched.ID, false)
+
+		logger.Infof("Schedule id=%d starting %s scan of database id=%d (tenant %d)", sched.ID, sched.Version, sched.DatabaseID, sched.TenantID)
+		actor := models.Identity{TenantID: sched.TenantID, Name: fmt.Sprintf("schedule:%d", sched.ID), Owner: "scheduler"}
+		scanID, err := s.launcher.Launch(actor, sched.DatabaseID, sched.Version, sched.Options)
+		run.ScanID, run.Status = scanID, models.RunStatusSuccess
+		if err != nil {
+			logger.Errorf("Schedule id=%d scan failed: %v", sched.ID, err)
+			run.Status, run.Message = models.RunStatusFailed, textutil.Truncate(err.Error(), 255)
+		}
+		_ = s.schedules.FinishRun(run)
+	}()
+}
+
+// record stores a run that did not start a scan; the schedule's last_* columns keep
+// pointing at the last real scan.
+func (s *Scheduler) record(run models.ScheduleRun) {
+	_, _ = s.schedules.StartRun(run)
+}
+
+func (s *Scheduler) isRunning(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[id]
+}
+
+func (s *Scheduler) setRunning(id int64, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if running {
+		s.running[id] = true
+	} else {
+		delete(s.running, id)
+	}
+}
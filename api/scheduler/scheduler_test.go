@@ -0,0 +1,254 @@
+package scheduler_test
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/scheduler"
+)
+
+// fakeSchedules is an in-memory ScheduleRepository with the same claim semantics as the SQL one.
+type fakeSchedules struct {
+	mu        sync.Mutex
+	schedules map[int64]*models.ScanSchedule
+	runs      []models.ScheduleRun
+}
+
+func newFakeSchedules(s ...models.ScanSchedule) *fakeSchedules {
+	f := &fakeSchedules{schedules: make(map[int64]*models.ScanSchedule)}
+	for i := range s {
+		f.schedules[s[i].ID] = &s[i]
+	}
+	return f
+}
+
+func (f *fakeSchedules) Create(s models.ScanSchedule) (int64, error)        { return 0, nil }
+func (f *fakeSchedules) Update(s models.ScanSchedule) error                 { return nil }
+func (f *fakeSchedules) Delete(tenantID, id int64) error                    { return nil }
+func (f *fakeSchedules) List(tenantID int64) ([]models.ScanSchedule, error) { return nil, nil }
+func (f *fakeSchedules) ListRuns(int64, int64, int) ([]models.ScheduleRun, error) {
+	return nil, nil
+}
+
+func (f *fakeSchedules) Get(tenantID, id int64) (models.ScanSchedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.schedules[id]
+	if !ok {
+		return models.ScanSchedule{}, sql.ErrNoRows
+	}
+	return *s, nil
+}
+
+func (f *fakeSchedules) ListDue(now time.Time) ([]models.ScanSchedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var due []models.ScanSchedule
+	for _, s := range f.schedules {
+		if s.Enabled && !s.NextRunAt.After(now) {
+			due = append(due, *s)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeSchedules) Claim(id int64, expected, next time.Time, missed int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.schedules[id]
+	if !s.NextRunAt.Equal(expected) {
+		return false, nil
+	}
+	s.NextRunAt = next
+	s.MissedRuns += missed
+	return true, nil
+}
+
+func (f *fakeSchedules) StartRun(run models.ScheduleRun) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	run.ID = int64(len(f.runs) + 1)
+	f.runs = append(f.runs, run)
+	return run.ID, nil
+}
+
+func (f *fakeSchedules) FinishRun(run models.ScheduleRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs[run.ID-1] = run
+	s := f.schedules[run.ScheduleID]
+	s.LastScanID, s.LastStatus = run.ScanID, run.Status
+	return nil
+}
+
+func (f *fakeSchedules) HasActiveRun(scheduleID int64, since time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.runs {
+		if r.ScheduleID == scheduleID && r.Status == models.RunStatusRunning && r.ScheduledAt.After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeSchedules) statuses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, r := range f.runs {
+		out = append(out, r.Status)
+	}
+	return out
+}
+
+// fakeLeases grants the lease to the first holder until it expires at the given clock.
+type fakeLeases struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+	now     func() time.Time
+}
+
+func (l *fakeLeases) TryAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == "" || l.holder == holder || l.now().After(l.expires) {
+		l.holder, l.expires = holder, l.now().Add(ttl)
+	}
+	return l.holder == holder, nil
+}
+
+func (l *fakeLeases) Release(name, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+// alwaysLeader lets every scheduler believe it holds the lease (e.g. during a handover race).
+type alwaysLeader struct{}
+
+func (alwaysLeader) TryAcquire(string, string, time.Duration) (bool, error) { return true, nil }
+func (alwaysLeader) Release(string, string) error                           { return nil }
+
+// fakeLauncher counts launches; when release is set each scan blocks until it is closed.
+type fakeLauncher struct {
+	mu       sync.Mutex
+	launches int
+	release  chan struct{}
+}
+
+func (l *fakeLauncher) Launch(actor models.Identity, databaseID int64, version string, opts models.ScanOptions) (int64, error) {
+	l.mu.Lock()
+	l.launches++
+	n := l.launches
+	l.mu.Unlock()
+	if l.release != nil {
+		<-l.release
+	}
+	return int64(100 + n), nil
+}
+
+func (l *fakeLauncher) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.launches
+}
+
+var (
+	t0  = time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC)
+	cfg = scheduler.Config{Interval: time.Second, LeaseTTL: time.Minute, StaleAfter: time.Hour}
+)
+
+func hourly() models.ScanSchedule {
+	return models.ScanSchedule{ID: 1, DatabaseID: 3, Cron: "0 * * * *", Timezone: "UTC", Version: "v1", Enabled: true, NextRunAt: t0}
+}
+
+func TestTick_RunsDueScheduleOnlyOnLeader(t *testing.T) {
+	repo := newFakeSchedules(hourly())
+	leases := &fakeLeases{now: func() time.Time { return t0 }}
+	launcher := &fakeLauncher{}
+	leader := scheduler.New(repo, leases, launcher, cfg)
+	follower := scheduler.New(repo, leases, launcher, cfg)
+
+	leader.Tick(t0.Add(5 * time.Second))
+	follower.Tick(t0.Add(5 * time.Second))
+	leader.Wait()
+
+	assert.Equal(t, 1, launcher.count())
+	s, _ := repo.Get(models.DefaultTenantID, 1)
+	assert.Equal(t, t0.Add(time.Hour), s.NextRunAt)
+	assert.Equal(t, int64(101), s.LastScanID)
+	assert.Equal(t, []string{models.RunStatusSuccess}, repo.statuses())
+
+	// not due again within the hour
+	leader.Tick(t0.Add(30 * time.Minute))
+	leader.Wait()
+	assert.Equal(t, 1, launcher.count())
+}
+
+func TestTick_ClaimPreventsDoubleExecution(t *testing.T) {
+	repo := newFakeSchedules(hourly())
+	launcher := &fakeLauncher{}
+	a := scheduler.New(repo, alwaysLeader{}, launcher, cfg)
+	b := scheduler.New(repo, alwaysLeader{}, launcher, cfg)
+
+	var wg sync.WaitGroup
+	for _, s := range []*scheduler.Scheduler{a, b} {
+		wg.Add(1)
+		go func(s *scheduler.Scheduler) {
+			defer wg.Done()
+			s.Tick(t0)
+		}(s)
+	}
+	wg.Wait()
+	a.Wait()
+	b.Wait()
+
+	assert.Equal(t, 1, launcher.count())
+}
+
+func TestTick_SkipsWhilePreviousRunIsGoing(t *testing.T) {
+	repo := newFakeSchedules(hourly())
+	launcher := &fakeLauncher{release: make(chan struct{})}
+	s := scheduler.New(repo, alwaysLeader{}, launcher, cfg)
+
+	s.Tick(t0)
+	require.Eventually(t, func() bool { return launcher.count() == 1 }, time.Second, time.Millisecond)
+
+	// the next activation comes while the first scan is still running
+	s.Tick(t0.Add(time.Hour))
+	close(launcher.release)
+	s.Wait()
+
+	assert.Equal(t, 1, launcher.count())
+	sched, _ := repo.Get(models.DefaultTenantID, 1)
+	assert.Equal(t, 1, sched.MissedRuns)
+	assert.Equal(t, t0.Add(2*time.Hour), sched.NextRunAt)
+	assert.Equal(t, []string{models.RunStatusSuccess, models.RunStatusSkipped}, repo.statuses())
+}
+
+func TestTick_RecordsRunsMissedDuringDowntime(t *testing.T) {
+	repo := newFakeSchedules(hourly())
+	launcher := &fakeLauncher{}
+	s := scheduler.New(repo, alwaysLeader{}, launcher, cfg)
+
+	// the API was down from 10:00 to 13:20: the 11:00, 12:00 and 13:00 runs were missed
+	s.Tick(t0.Add(3*time.Hour + 20*time.Minute))
+	s.Wait()
+
+	assert.Equal(t, 1, launcher.count())
+	sched, _ := repo.Get(models.DefaultTenantID, 1)
+	assert.Equal(t, 3, sched.MissedRuns)
+	assert.Equal(t, t0.Add(4*time.Hour), sched.NextRunAt)
+	assert.Equal(t, []string{models.RunStatusMissed, models.RunStatusSuccess}, repo.statuses())
+}
@@ -0,0 +1,245 @@
+// Package secrets protects the credentials of registered databases.
+//
+// A database either references a secret kept elsewhere (see SecretProvider), resolved each
+// time a connection is opened, or has a stored password. Stored passwords are sealed with envelope encryption: each value gets a random 256-bit data key
+// that encrypts it with AES-GCM, and the data key is itself encrypted (wrapped) with a master
+// key. Rows store the id of the master key, so master keys can be rotated by re-wrapping data
+// keys (see cmd/rekey) without touching the encrypted values.
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// ErrUnknownKey is returned when a value was sealed with a master key the keyring does not have.
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Uses of sealed values. The use is bound to the ciphertext as additional data, so a value
+// sealed for one column does not open if copied into another.
+const (
+	UsePassword      = "external_databases.password"
+	UseWebhookSecret = "webhooks.secret"
+)
+
+// wrapAAD binds wrapped data keys to their master key. It predates webhook secrets and is
+// shared by every use, so Rewrap works on any sealed value.
+const wrapAAD = UsePassword
+
+// Keyring holds the master keys. The first key is active: it wraps new data keys; the
+// others only unwrap existing ones.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from "id:base64key" entries (32-byte keys), active first.
+func NewKeyring(entries []string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, e := range entries {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(e), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key entry must be id:base64key")
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, base64 encoded", id)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("master key %q is defined twice", id)
+		}
+		aead, err := newAEAD(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.active == "" {
+			k.active = id
+		}
+	}
+	return k, nil
+}
+
+// LoadKeyring reads the master keys from the file named by CREDENTIALS_KEY_FILE (one
+// id:base64key per line, # for comments) or else from CREDENTIALS_MASTER_KEY (comma separated).
+// Without either it returns an empty keyring, which stores passwords in plaintext.
+func LoadKeyring() (*Keyring, error) {
+	if path := os.Getenv("CREDENTIALS_KEY_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readKeyFile(f)
+	}
+	var entries []string
+	for _, e := range strings.Split(os.Getenv("CREDENTIALS_MASTER_KEY"), ",") {
+		if strings.TrimSpace(e) != "" {
+			entries = append(entries, e)
+		}
+	}
+	return NewKeyring(entries)
+}
+
+func readKeyFile(r io.Reader) (*Keyring, error) {
+	var entries []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewKeyring(entries)
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultKeyring *Keyring
+)
+
+// Default returns the keyring configured in the environment, loaded once. A broken
+// configuration is fatal: continuing would store new passwords unencrypted.
+func Default() *Keyring {
+	defaultOnce.Do(func() {
+		k, err := LoadKeyring()
+		if err != nil {
+			logger.Errorf("Credential master keys could not be loaded: %v", err)
+			panic(err)
+		}
+		if !k.Enabled() {
+			logger.Warnf("No CREDENTIALS_KEY_FILE or CREDENTIALS_MASTER_KEY: target passwords are stored in plaintext")
+		}
+		defaultKeyring = k
+	})
+	return defaultKeyring
+}
+
+// Enabled reports whether the keyring has a master key to seal new values.
+func (k *Keyring) Enabled() bool {
+	return k.active != ""
+}
+
+// ActiveKeyID is the id of the master key used by Seal.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Seal encrypts a database password under a fresh data key wrapped with the active master key.
+func (k *Keyring) Seal(plaintext string) (*models.EncryptedSecret, error) {
+	return k.SealAs(UsePassword, plaintext)
+}
+
+// SealAs is Seal for a value with another use (see UseWebhookSecret).
+func (k *Keyring) SealAs(use, plaintext string) (*models.EncryptedSecret, error) {
+	if !k.Enabled() {
+		return nil, errors.New("no master key configured")
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	valueAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(valueAEAD, []byte(plaintext), use)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.active], dataKey, wrapAAD+"/"+k.active)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EncryptedSecret{KeyID: k.active, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a password sealed by Seal with any key of the keyring.
+func (k *Keyring) Open(s *models.EncryptedSecret) (string, error) {
+	return k.OpenAs(UsePassword, s)
+}
+
+// OpenAs decrypts a value sealed by SealAs for the same use.
+func (k *Keyring) OpenAs(use string, s *models.EncryptedSecret) (string, error) {
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return "", err
+	}
+	valueAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(valueAEAD, s.Ciphertext, use)
+	if err != nil {
+		return "", fmt.Errorf("decrypt credential: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-encrypts the data key of s with the active master key. The encrypted value
+// itself is unchanged.
+func (k *Keyring) Rewrap(s *models.EncryptedSecret) (*models.EncryptedSecret, error) {
+	if !k.Enabled() {
+		return nil, errors.New("no master key configured")
+	}
+	dataKey, err := k.unwrap(s)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.active], dataKey, wrapAAD+"/"+k.active)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EncryptedSecret{KeyID: k.active, WrappedKey: wrapped, Ciphertext: s.Ciphertext}, nil
+}
+
+func (k *Keyring) unwrap(s *models.EncryptedSecret) ([]byte, error) {
+	master, ok := k.keys[s.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, s.KeyID)
+	}
+	dataKey, err := open(master, s.WrappedKey, wrapAAD+"/"+s.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext
+func seal(a cipher.AEAD, plaintext []byte, additional string) ([]byte, error) {
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.Seal(nonce, nonce, plaintext, []byte(additional)), nil
+}
+
+func open(a cipher.AEAD, data []byte, additional string) ([]byte, error) {
+	if len(data) < a.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return a.Open(nil, data[:a.NonceSize()], data[a.NonceSize():], []byte(additional))
+}
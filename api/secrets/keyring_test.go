@@ -0,0 +1,106 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/secrets"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSealOpen_RoundTripAndTamperDetection(t *testing.T) {
+	keys, err := secrets.NewKeyring([]string{"2025-01:" + key(1)})
+	require.NoError(t, err)
+
+	a, err := keys.Seal("p@ss")
+	require.NoError(t, err)
+	b, err := keys.Seal("p@ss")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01", a.KeyID)
+	// every value gets its own data key and nonce
+	assert.NotEqual(t, a.Ciphertext, b.Ciphertext)
+	assert.NotEqual(t, a.WrappedKey, b.WrappedKey)
+
+	plain, err := keys.Open(a)
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", plain)
+
+	tampered := *a
+	tampered.Ciphertext = append([]byte{}, a.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+	_, err = keys.Open(&tampered)
+	assert.Error(t, err)
+
+	// a sealed password cannot be copied into another column, such as a webhook secret
+	_, err = keys.OpenAs(secrets.UseWebhookSecret, a)
+	assert.Error(t, err)
+	hook, err := keys.SealAs(secrets.UseWebhookSecret, "whsec")
+	require.NoError(t, err)
+	plain, err = keys.OpenAs(secrets.UseWebhookSecret, hook)
+	require.NoError(t, err)
+	assert.Equal(t, "whsec", plain)
+
+	// a wrapped key cannot be passed off as wrapped by another master key
+	other, err := secrets.NewKeyring([]string{"2025-02:" + key(1)})
+	require.NoError(t, err)
+	relabelled := *a
+	relabelled.KeyID = "2025-02"
+	_, err = other.Open(&relabelled)
+	assert.Error(t, err)
+}
+
+func TestRewrap_RotatesMasterKeyWithoutReencryptingValue(t *testing.T) {
+	old, err := secrets.NewKeyring([]string{"old:" + key(1)})
+	require.NoError(t, err)
+	sealed, err := old.Seal("hunter2")
+	require.NoError(t, err)
+
+	rotated, err := secrets.NewKeyring([]string{"new:" + key(2), "old:" + key(1)})
+	require.NoError(t, err)
+	rewrapped, err := rotated.Rewrap(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "new", rewrapped.KeyID)
+	assert.Equal(t, sealed.Ciphertext, rewrapped.Ciphertext)
+
+	// once rewrapped the old key can be retired
+	retired, err := secrets.NewKeyring([]string{"new:" + key(2)})
+	require.NoError(t, err)
+	plain, err := retired.Open(rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", plain)
+	_, err = retired.Open(sealed)
+	assert.ErrorIs(t, err, secrets.ErrUnknownKey)
+}
+
+func TestLoadKeyring_FromFileOrEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(path, []byte("# active first\nb:"+key(2)+"\n\na:"+key(1)+"\n"), 0o600))
+	t.Setenv("CREDENTIALS_KEY_FILE", path)
+	t.Setenv("CREDENTIALS_MASTER_KEY", "ignored:"+key(3))
+	keys, err := secrets.LoadKeyring()
+	require.NoError(t, err)
+	assert.Equal(t, "b", keys.ActiveKeyID())
+
+	t.Setenv("CREDENTIALS_KEY_FILE", "")
+	keys, err = secrets.LoadKeyring()
+	require.NoError(t, err)
+	assert.Equal(t, "ignored", keys.ActiveKeyID())
+
+	t.Setenv("CREDENTIALS_MASTER_KEY", "")
+	keys, err = secrets.LoadKeyring()
+	require.NoError(t, err)
+	assert.False(t, keys.Enabled())
+
+	t.Setenv("CREDENTIALS_MASTER_KEY", "short:"+base64.StdEncoding.EncodeToString([]byte("too short")))
+	_, err = secrets.LoadKeyring()
+	assert.Error(t, err)
+}
@@ -0,0 +1,319 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"meli-challenge/config"
+)
+
+// ErrSecretNotFound is returned when a reference points to a secret that does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves the part of a secret reference after "scheme:". Check tells whether a
+// reference is one the provider accepts without reading the secret.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+	Check(ref string) error
+}
+
+// tenantScoper is implemented by providers that can be confined to the secrets of one tenant.
+type tenantScoper interface {
+	forTenant(tenantID int64) SecretProvider
+}
+
+// Providers maps reference schemes (env, file, vault) to their provider.
+type Providers map[string]SecretProvider
+
+// ParseRef splits a reference such as "vault:secret/scanner/sales#password" into its scheme
+// and the provider-specific rest.
+func ParseRef(ref string) (scheme, rest string, err error) {
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok || scheme == "" || rest == "" {
+		return "", "", fmt.Errorf("secret reference must be scheme:reference")
+	}
+	return scheme, rest, nil
+}
+
+// Resolve returns the secret a reference points to.
+func (p Providers) Resolve(ctx context.Context, ref string) (string, error) {
+	provider, rest, err := p.lookup(ref)
+	if err != nil {
+		return "", err
+	}
+	return provider.Resolve(ctx, rest)
+}
+
+// Check reports whether ref has a configured scheme and is accepted by its provider; whether the
+// secret exists is only known when it is resolved.
+func (p Providers) Check(ref string) error {
+	provider, rest, err := p.lookup(ref)
+	if err != nil {
+		return err
+	}
+	return provider.Check(rest)
+}
+
+func (p Providers) lookup(ref string) (SecretProvider, string, error) {
+	scheme, rest, err := ParseRef(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	provider, ok := p[scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("no secret provider for %q references", scheme)
+	}
+	return provider, rest, nil
+}
+
+// ForTenant returns the providers confined to the secrets of tenantID: environment variables named
+// <prefix>T<id>_*, files under the tenant-<id> subdirectory and Vault paths below
+// <path prefix>/tenants/<id>. Providers that cannot be confined are left out, so a tenant can never
+// reference another tenant's secrets.
+func (p Providers) ForTenant(tenantID int64) Providers {
+	scoped := make(Providers, len(p))
+	for scheme, provider := range p {
+		if s, ok := provider.(tenantScoper); ok {
+			scoped[scheme] = s.forTenant(tenantID)
+		}
+	}
+	return scoped
+}
+
+// Schemes lists the configured reference schemes.
+func (p Providers) Schemes() []string {
+	schemes := make([]string, 0, len(p))
+	for s := range p {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+var (
+	providersOnce    sync.Once
+	defaultProviders Providers
+)
+
+// DefaultProviders returns the providers configured in the environment: env and file are always
+// available, vault only when VAULT_ADDR is set. Database references are resolved through
+// ForTenant of these.
+func DefaultProviders() Providers {
+	providersOnce.Do(func() {
+		defaultProviders = Providers{
+			"env":  EnvProvider{Prefix: config.EnvString("SECRETS_ENV_PREFIX", "SCANNER_SECRET_")},
+			"file": FileProvider{Dir: config.EnvString("SECRETS_FILE_DIR", "/var/run/secrets/scanner")},
+		}
+		if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+			defaultProviders["vault"] = &VaultProvider{
+				Addr:       addr,
+				Token:      os.Getenv("VAULT_TOKEN"),
+				TokenFile:  os.Getenv("VAULT_TOKEN_FILE"),
+				Namespace:  os.Getenv("VAULT_NAMESPACE"),
+				KVVersion:  config.EnvString("VAULT_KV_VERSION", "2"),
+				PathPrefix: config.EnvString("VAULT_PATH_PREFIX", "secret/scanner"),
+			}
+		}
+	})
+	return defaultProviders
+}
+
+// EnvProvider reads environment variables. Only names starting with Prefix can be referenced,
+// so a registered database cannot point at the API's own credentials.
+type EnvProvider struct {
+	Prefix string
+}
+
+func (p EnvProvider) Check(name string) error {
+	if !strings.HasPrefix(name, p.Prefix) {
+		return fmt.Errorf("environment variable %q must start with %s", name, p.Prefix)
+	}
+	return nil
+}
+
+func (p EnvProvider) Resolve(_ context.Context, name string) (string, error) {
+	if err := p.Check(name); err != nil {
+		return "", err
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %s", ErrSecretNotFound, name)
+	}
+	return v, nil
+}
+
+func (p EnvProvider) forTenant(tenantID int64) SecretProvider {
+	return EnvProvider{Prefix: fmt.Sprintf("%sT%d_", p.Prefix, tenantID)}
+}
+
+// FileProvider reads files under Dir, such as the keys of a mounted Kubernetes secret.
+// The file is read on every resolution, so rotated secrets are picked up without a restart.
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Check(name string) error {
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("secret file %q must be a relative path inside %s", name, p.Dir)
+	}
+	return nil
+}
+
+func (p FileProvider) Resolve(_ context.Context, name string) (string, error) {
+	if err := p.Check(name); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	// mounted secrets and files written with echo usually end in a newline
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func (p FileProvider) forTenant(tenantID int64) SecretProvider {
+	return FileProvider{Dir: filepath.Join(p.Dir, fmt.Sprintf("tenant-%d", tenantID))}
+}
+
+// VaultProvider reads a key of a secret from a HashiCorp Vault compatible KV engine.
+// References have the form mount/path#key, e.g. secret/scanner/sales#password.
+type VaultProvider struct {
+	Addr string
+	// Token, or TokenFile when the token is rotated by an agent
+	Token     string
+	TokenFile string
+	Namespace string
+	// KVVersion is "1" or "2" (the default, used by `vault server -dev`)
+	KVVersion string
+	// PathPrefix, when set, restricts references to paths below it
+	PathPrefix string
+	Client     *http.Client
+}
+
+func (p *VaultProvider) Check(ref string) error {
+	_, _, _, err := p.parse(ref)
+	return err
+}
+
+// parse splits ref into its mount, the path inside the mount and the key, checking it is canonical
+// and below PathPrefix.
+func (p *VaultProvider) parse(ref string) (mount, rest, key string, err error) {
+	secretPath, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", "", "", fmt.Errorf("vault reference %q must be mount/path#key", ref)
+	}
+	secretPath = strings.Trim(secretPath, "/")
+	if secretPath != path.Clean(secretPath) || strings.HasPrefix(secretPath, "..") {
+		return "", "", "", fmt.Errorf("vault path %q is not canonical", secretPath)
+	}
+	if p.PathPrefix != "" && !strings.HasPrefix(secretPath+"/", strings.Trim(p.PathPrefix, "/")+"/") {
+		return "", "", "", fmt.Errorf("vault path %q must be below %s", secretPath, p.PathPrefix)
+	}
+	mount, rest, ok = strings.Cut(secretPath, "/")
+	if !ok {
+		return "", "", "", fmt.Errorf("vault reference %q must include a mount and a path", ref)
+	}
+	return mount, rest, key, nil
+}
+
+func (p *VaultProvider) forTenant(tenantID int64) SecretProvider {
+	scoped := *p
+	scoped.PathPrefix = path.Join(strings.Trim(p.PathPrefix, "/"), "tenants", strconv.FormatInt(tenantID, 10))
+	return &scoped
+}
+
+func (p *VaultProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	mount, rest, key, err := p.parse(ref)
+	if err != nil {
+		return "", err
+	}
+	secretPath := mount + "/" + rest
+	apiPath := mount + "/" + rest
+	if p.KVVersion != "1" {
+		apiPath = mount + "/data/" + rest
+	}
+
+	token, err := p.token()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.Addr, "/")+"/v1/"+(&url.URL{Path: apiPath}).EscapedPath(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: vault %s", ErrSecretNotFound, secretPath)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, secretPath)
+	}
+
+	// KV v1: {"data": {key: value}}; KV v2: {"data": {"data": {key: value}, "metadata": {...}}}
+	var payload struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := payload.Data
+	if p.KVVersion != "1" {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return "", fmt.Errorf("invalid vault response: %w", err)
+		}
+		data = v2.Data
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil || values == nil {
+		return "", fmt.Errorf("%w: vault %s has no data", ErrSecretNotFound, secretPath)
+	}
+	v, ok := values[key].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: vault %s has no string key %q", ErrSecretNotFound, secretPath, key)
+	}
+	return v, nil
+}
+
+func (p *VaultProvider) token() (string, error) {
+	if p.TokenFile == "" {
+		return p.Token, nil
+	}
+	b, err := os.ReadFile(p.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read vault token: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,141 @@
+package secrets_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/secrets"
+)
+
+func TestEnvProvider_OnlyReadsPrefixedVariables(t *testing.T) {
+	t.Setenv("SCANNER_SECRET_SALES", "s3cret")
+	t.Setenv("DB_PASS", "internal")
+	p := secrets.Providers{"env": secrets.EnvProvider{Prefix: "SCANNER_SECRET_"}}
+
+	v, err := p.Resolve(context.Background(), "env:SCANNER_SECRET_SALES")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+
+	_, err = p.Resolve(context.Background(), "env:DB_PASS")
+	assert.Error(t, err)
+	_, err = p.Resolve(context.Background(), "env:SCANNER_SECRET_MISSING")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+	_, err = p.Resolve(context.Background(), "unknown:x")
+	assert.Error(t, err)
+}
+
+func TestFileProvider_ReadsMountedSecretsInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sales"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sales", "password"), []byte("p@ss\n"), 0o600))
+	p := secrets.FileProvider{Dir: dir}
+
+	v, err := p.Resolve(context.Background(), "sales/password")
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", v)
+
+	_, err = p.Resolve(context.Background(), "../etc/passwd")
+	assert.Error(t, err)
+	_, err = p.Resolve(context.Background(), "/etc/passwd")
+	assert.Error(t, err)
+	_, err = p.Resolve(context.Background(), "sales/missing")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+}
+
+func TestVaultProvider_ReadsKVv2AndV1(t *testing.T) {
+	var gotPath, gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotToken = r.URL.Path, r.Header.Get("X-Vault-Token")
+		switch r.URL.Path {
+		case "/v1/secret/data/scanner/sales":
+			w.Write([]byte(`{"data":{"data":{"password":"v2-pass"},"metadata":{"version":3}}}`))
+		case "/v1/kv/scanner/sales":
+			w.Write([]byte(`{"data":{"password":"v1-pass"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	v2 := &secrets.VaultProvider{Addr: srv.URL, Token: "root", KVVersion: "2", PathPrefix: "secret/scanner"}
+	v, err := v2.Resolve(context.Background(), "secret/scanner/sales#password")
+	require.NoError(t, err)
+	assert.Equal(t, "v2-pass", v)
+	assert.Equal(t, "/v1/secret/data/scanner/sales", gotPath)
+	assert.Equal(t, "root", gotToken)
+
+	_, err = v2.Resolve(context.Background(), "secret/scanner/sales#user")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+	_, err = v2.Resolve(context.Background(), "secret/scanner/other#password")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+	// outside the allowed prefix: never requested
+	gotPath = ""
+	_, err = v2.Resolve(context.Background(), "secret/platform/api#token")
+	assert.Error(t, err)
+	_, err = v2.Resolve(context.Background(), "secret/scanner/../platform/api#token")
+	assert.Error(t, err)
+	assert.Empty(t, gotPath)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("agent-token\n"), 0o600))
+	v1 := &secrets.VaultProvider{Addr: srv.URL, TokenFile: tokenFile, KVVersion: "1"}
+	v, err = v1.Resolve(context.Background(), "kv/scanner/sales#password")
+	require.NoError(t, err)
+	assert.Equal(t, "v1-pass", v)
+	assert.Equal(t, "agent-token", gotToken)
+}
+
+func TestProvidersForTenant_ConfineReferencesToTheTenant(t *testing.T) {
+	t.Setenv("SCANNER_SECRET_T1_SALES", "tenant-1")
+	t.Setenv("SCANNER_SECRET_T12_SALES", "tenant-12")
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tenant-1"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tenant-1", "password"), []byte("file-1"), 0o600))
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Write([]byte(`{"data":{"data":{"password":"vault-1"}}}`))
+	}))
+	defer srv.Close()
+	all := secrets.Providers{
+		"env":   secrets.EnvProvider{Prefix: "SCANNER_SECRET_"},
+		"file":  secrets.FileProvider{Dir: dir},
+		"vault": &secrets.VaultProvider{Addr: srv.URL, Token: "root", PathPrefix: "secret/scanner"},
+	}
+
+	one := all.ForTenant(1)
+	for ref, want := range map[string]string{
+		"env:SCANNER_SECRET_T1_SALES":                   "tenant-1",
+		"file:password":                                 "file-1",
+		"vault:secret/scanner/tenants/1/sales#password": "vault-1",
+	} {
+		v, err := one.Resolve(context.Background(), ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, v)
+	}
+
+	// tenant 2 cannot reach tenant 1's (or tenant 12's) secrets through any scheme
+	gotPath = ""
+	two := all.ForTenant(2)
+	for _, ref := range []string{
+		"env:SCANNER_SECRET_T1_SALES",
+		"env:SCANNER_SECRET_SALES",
+		"file:../tenant-1/password",
+		"vault:secret/scanner/tenants/1/sales#password",
+		"vault:secret/scanner/sales#password",
+	} {
+		assert.Error(t, two.Check(ref), ref)
+		_, err := two.Resolve(context.Background(), ref)
+		assert.Error(t, err, ref)
+	}
+	assert.Error(t, all.ForTenant(1).Check("env:SCANNER_SECRET_T12_SALES"))
+	assert.Empty(t, gotPath)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/logger"
+)
+
+// Errors of API keys. ErrUnauthorized covers unknown, wrong, expired and revoked keys alike.
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrUnauthorized  = errors.New("unauthorized")
+)
+
+// apiKeyPrefix starts every key minted by the API, so leaked keys are easy to grep for
+const apiKeyPrefix = "dlp_"
+
+// BootstrapIdentity is the caller authenticated with the API_KEY env var. It has every scope,
+// so it can mint the first stored keys and create tenants, and belongs to the default tenant.
+var BootstrapIdentity = models.Identity{TenantID: models.DefaultTenantID, Name: "API_KEY", Owner: "env", Scopes: models.Scopes}
+
+type APIKeyService interface {
+	// CreateKey mints a key for k.Name, k.Owner and k.Scopes, valid for ttl (0 means no
+	// expiry). The caller can only grant scopes it has. The key belongs to the caller's tenant
+	// unless k.TenantID names another one, which requires the tenants:admin scope. The key is
+	// only returned here.
+	CreateKey(k models.APIKey, ttl time.Duration, caller models.Identity) (models.APIKey, error)
+	ListKeys(tenantID int64) ([]models.APIKey, error)
+	RevokeKey(tenantID, id int64) error
+	// Authenticate returns the identity of key, or ErrUnauthorized
+	Authenticate(key string) (models.Identity, error)
+}
+
+type apiKeyService struct {
+	repo       repositories.APIKeyRepository
+	repoTenant repositories.TenantRepository
+	// bootstrap is the API_KEY env var; empty disables it
+	bootstrap string
+	now       func() time.Time
+}
+
+func NewAPIKeyService(repo repositories.APIKeyRepository, repoTenant repositories.TenantRepository, bootstrap string) APIKeyService {
+	return &apiKeyService{repo: repo, repoTenant: repoTenant, bootstrap: bootstrap, now: time.Now}
+}
+
+func (s *apiKeyService) CreateKey(k models.APIKey, ttl time.Duration, caller models.Identity) (models.APIKey, error) {
+	k.Name, k.Owner = strings.TrimSpace(k.Name), strings.TrimSpace(k.Owner)
+	if k.Name == "" || len(k.Name) > 100 {
+		return models.APIKey{}, fmt.Errorf("%w: name is required and must have at most 100 characters", ErrInvalidAPIKey)
+	}
+	if k.Owner == "" || len(k.Owner) > 100 {
+		return models.APIKey{}, fmt.Errorf("%w: owner is required and must have at most 100 characters", ErrInvalidAPIKey)
+	}
+	if len(k.Scopes) == 0 {
+		return models.APIKey{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	scopes := []string{}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return models.APIKey{}, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+		if !caller.HasScope(scope) {
+			return models.APIKey{}, fmt.Errorf("%w: cannot grant scope %q the caller does not have", ErrInvalidAPIKey, scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if ttl < 0 {
+		return models.APIKey{}, fmt.Errorf("%w: expiry must be positive", ErrInvalidAPIKey)
+	}
+	if k.TenantID == 0 {
+		k.TenantID = caller.TenantID
+	}
+	if k.TenantID != caller.TenantID {
+		if !caller.HasScope(models.ScopeTenantsAdmin) {
+			return models.APIKey{}, fmt.Errorf("%w: minting keys for another tenant requires the %s scope", ErrInvalidAPIKey, models.ScopeTenantsAdmin)
+		}
+		if _, err := s.repoTenant.Get(k.TenantID); err == sql.ErrNoRows {
+			return models.APIKey{}, fmt.Errorf("%w: unknown tenant %d", ErrInvalidAPIKey, k.TenantID)
+		} else if err != nil {
+			return models.APIKey{}, err
+		}
+	}
+
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return models.APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKey{}, err
+	}
+	k.Scopes = scopes
+	k.Prefix = hex.EncodeToString(prefix)
+	k.Key = apiKeyPrefix + k.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hashAPIKey(k.Key)
+	k.CreatedAt = s.now().UTC().Truncate(time.Second)
+	if ttl > 0 {
+		expires := k.CreatedAt.Add(ttl)
+		k.ExpiresAt = &expires
+	}
+
+	id, err := s.repo.Create(k)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	k.ID, k.Hash = id, ""
+	logger.Infof("API key id=%d prefix=%s created for %s in tenant %d by %s, scopes %v", k.ID, k.Prefix, k.Owner, k.TenantID, caller, k.Scopes)
+	return k, nil
+}
+
+func (s *apiKeyService) ListKeys(tenantID int64) ([]models.APIKey, error) {
+	return s.repo.List(tenantID)
+}
+
+func (s *apiKeyService) RevokeKey(tenantID, id int64) error {
+	if _, err := s.repo.Get(tenantID, id); err != nil {
+		return err
+	}
+	logger.Infof("API key id=%d revoked", id)
+	return s.repo.Revoke(tenantID, id, s.now())
+}
+
+func (s *apiKeyService) Authenticate(key string) (models.Identity, error) {
+	if key == "" {
+		return models.Identity{}, ErrUnauthorized
+	}
+	if s.bootstrap != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.bootstrap)) == 1 {
+		return BootstrapIdentity, nil
+	}
+
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+		return models.Identity{}, ErrUnauthorized
+	}
+	k, err := s.repo.GetByPrefix(prefix)
+	if err == sql.ErrNoRows {
+		return models.Identity{}, ErrUnauthorized
+	}
+	if err != nil {
+		return models.Identity{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(k.Hash)) != 1 {
+		logger.Warnf("API key prefix=%s presented with a wrong secret", prefix)
+		return models.Identity{}, ErrUnauthorized
+	}
+	now := s.now()
+	if k.RevokedAt != nil {
+		logger.Warnf("Revoked API key id=%d prefix=%s used", k.ID, k.Prefix)
+		return models.Identity{}, ErrUnauthorized
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		logger.Warnf("Expired API key id=%d prefix=%s used", k.ID, k.Prefix)
+		return models.Identity{}, ErrUnauthorized
+	}
+	// best effort: a failed write must not reject the request
+	_ = s.repo.TouchLastUsed(k.ID, now)
+	return models.Identity{KeyID: k.ID, TenantID: k.TenantID, Name: k.Name, Owner: k.Owner, Scopes: k.Scopes}, nil
+}
+
+// hashAPIKey hashes a key for storage. Keys carry 256 random bits, so a fast hash is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
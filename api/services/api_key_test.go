@@ -0,0 +1,134 @@
+package services_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type MockAPIKeyRepo struct{ testifyMock.Mock }
+
+func (m *MockAPIKeyRepo) Create(k models.APIKey) (int64, error) {
+	args := m.Called(k)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockAPIKeyRepo) Get(tenantID, id int64) (models.APIKey, error) {
+	args := m.Called(tenantID, id)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+func (m *MockAPIKeyRepo) GetByPrefix(prefix string) (models.APIKey, error) {
+	args := m.Called(prefix)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+func (m *MockAPIKeyRepo) List(tenantID int64) ([]models.APIKey, error) {
+	args := m.Called(tenantID)
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+func (m *MockAPIKeyRepo) Revoke(tenantID, id int64, at time.Time) error {
+	return m.Called(tenantID, id, at).Error(0)
+}
+func (m *MockAPIKeyRepo) TouchLastUsed(id int64, at time.Time) error {
+	return m.Called(id, at).Error(0)
+}
+
+// mintKey creates key 5 with scan:read and returns the stored row and the key.
+func mintKey(t *testing.T, repo *MockAPIKeyRepo, svc services.APIKeyService, ttl time.Duration) (models.APIKey, string) {
+	t.Helper()
+	var stored models.APIKey
+	repo.On("Create", testifyMock.Anything).Run(func(args testifyMock.Arguments) {
+		stored = args.Get(0).(models.APIKey)
+	}).Return(int64(5), nil).Once()
+
+	k, err := svc.CreateKey(models.APIKey{Name: "ci", Owner: "data-team", Scopes: []string{models.ScopeScanRead, models.ScopeScanRead}},
+		ttl, services.BootstrapIdentity)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(k.Key, "dlp_"+k.Prefix+"_"))
+	assert.Equal(t, []string{models.ScopeScanRead}, k.Scopes)
+	assert.Empty(t, k.Hash)
+	assert.NotEmpty(t, stored.Hash)
+	assert.NotContains(t, stored.Hash, k.Key)
+	stored.ID = 5
+	return stored, k.Key
+}
+
+func TestAPIKeyService_AuthenticateStoredKey(t *testing.T) {
+	repo := &MockAPIKeyRepo{}
+	svc := services.NewAPIKeyService(repo, nil, "")
+	stored, key := mintKey(t, repo, svc, 0)
+	repo.On("GetByPrefix", stored.Prefix).Return(stored, nil)
+	repo.On("TouchLastUsed", int64(5), testifyMock.Anything).Return(nil)
+
+	identity, err := svc.Authenticate(key)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Identity{KeyID: 5, TenantID: models.DefaultTenantID, Name: "ci", Owner: "data-team", Scopes: []string{models.ScopeScanRead}}, identity)
+	assert.True(t, identity.HasScope(models.ScopeScanRead))
+	assert.False(t, identity.HasScope(models.ScopeScanRun))
+
+	_, err = svc.Authenticate(key[:len(key)-1] + "x")
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+}
+
+func TestAPIKeyService_AuthenticateRejectsRevokedAndExpiredKeys(t *testing.T) {
+	repo := &MockAPIKeyRepo{}
+	svc := services.NewAPIKeyService(repo, nil, "")
+	stored, key := mintKey(t, repo, svc, 24*time.Hour)
+
+	past := time.Now().Add(-time.Minute)
+	revoked := stored
+	revoked.RevokedAt = &past
+	repo.On("GetByPrefix", stored.Prefix).Return(revoked, nil).Once()
+	_, err := svc.Authenticate(key)
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+
+	expired := stored
+	expired.ExpiresAt = &past
+	repo.On("GetByPrefix", stored.Prefix).Return(expired, nil).Once()
+	_, err = svc.Authenticate(key)
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+	repo.AssertNotCalled(t, "TouchLastUsed", testifyMock.Anything, testifyMock.Anything)
+}
+
+func TestAPIKeyService_AuthenticateBootstrapAndUnknownKeys(t *testing.T) {
+	repo := &MockAPIKeyRepo{}
+	svc := services.NewAPIKeyService(repo, nil, "bootstrap-secret")
+	repo.On("GetByPrefix", "abc").Return(models.APIKey{}, sql.ErrNoRows)
+
+	identity, err := svc.Authenticate("bootstrap-secret")
+	assert.NoError(t, err)
+	assert.True(t, identity.HasScope(models.ScopeKeysAdmin))
+
+	for _, key := range []string{"", "bootstrap-secre", "dlp_abc_secret", "abc_secret"} {
+		_, err := svc.Authenticate(key)
+		assert.ErrorIs(t, err, services.ErrUnauthorized, key)
+	}
+	// without API_KEY an empty header must not match the empty bootstrap key
+	_, err = services.NewAPIKeyService(repo, nil, "").Authenticate("")
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+}
+
+func TestAPIKeyService_CreateKeyValidation(t *testing.T) {
+	repo := &MockAPIKeyRepo{}
+	svc := services.NewAPIKeyService(repo, nil, "")
+	reader := models.Identity{Name: "reader", Scopes: []string{models.ScopeScanRead, models.ScopeKeysAdmin}}
+
+	cases := []models.APIKey{
+		{Owner: "x", Scopes: []string{models.ScopeScanRead}},
+		{Name: "x", Scopes: []string{models.ScopeScanRead}},
+		{Name: "x", Owner: "x"},
+		{Name: "x", Owner: "x", Scopes: []string{"scan:delete"}},
+		// cannot grant more than the caller has
+		{Name: "x", Owner: "x", Scopes: []string{models.ScopeDatabasesAdmin}},
+	}
+	for _, k := range cases {
+		_, err := svc.CreateKey(k, 0, reader)
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey, "%+v", k)
+	}
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/logger"
+)
+
+// ErrInvalidAuditFilter wraps validation errors of audit queries.
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// redactedFields never reach the audit log with their values, only the fact that they changed
+var redactedFields = map[string]bool{"password": true, "secret": true, "key": true, "token": true}
+
+type AuditService interface {
+	// Record appends e, filling in the time and the resource type (the action prefix)
+	Record(e models.AuditEntry) error
+	List(f models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+type auditService struct {
+	repo repositories.AuditRepository
+	now  func() time.Time
+}
+
+func NewAuditService(repo repositories.AuditRepository) AuditService {
+	return &auditService{repo: repo, now: time.Now}
+}
+
+func (s *auditService) Record(e models.AuditEntry) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = s.now()
+	}
+	e.ResourceType, _, _ = strings.Cut(e.Action, ".")
+	if _, err := s.repo.Append(e); err != nil {
+		logger.Errorf("AUDIT entry lost: action=%s resource=%s actor=%s request_id=%s: %v", e.Action, e.ResourceID, e.Actor, e.RequestID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *auditService) List(f models.AuditFilter) ([]models.AuditEntry, error) {
+	if f.TenantID == 0 {
+		return nil, fmt.Errorf("%w: tenant is required", ErrInvalidAuditFilter)
+	}
+	if f.Limit == 0 {
+		f.Limit = DefaultAuditLimit
+	}
+	if f.Limit < 0 || f.Limit > MaxAuditLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidAuditFilter, MaxAuditLimit)
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidAuditFilter)
+	}
+	return s.repo.Query(f)
+}
+
+// AuditChanges diffs the JSON fields of before and after; either can be nil for creations
+// and deletions. Secrets are reported as changed without their values.
+func AuditChanges(before, after any) map[string]models.FieldChange {
+	b, a := jsonFields(before), jsonFields(after)
+	keys := make([]string, 0, len(b)+len(a))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := map[string]models.FieldChange{}
+	for _, k := range keys {
+		if reflect.DeepEqual(b[k], a[k]) {
+			continue
+		}
+		change := models.FieldChange{Before: b[k], After: a[k]}
+		if redactedFields[k] {
+			change = models.FieldChange{Before: redact(b[k]), After: redact(a[k])}
+		}
+		changes[k] = change
+	}
+	return changes
+}
+
+func jsonFields(v any) map[string]any {
+	fields := map[string]any{}
+	if v == nil {
+		return fields
+	}
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(raw, &fields)
+	}
+	if err != nil {
+		// not an object: keep the whole value under one field
+		return map[string]any{"value": v}
+	}
+	return fields
+}
+
+func redact(v any) any {
+	if v == nil {
+		return nil
+	}
+	return "[redacted]"
+}
@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type MockAuditRepo struct{ testifyMock.Mock }
+
+func (m *MockAuditRepo) Append(e models.AuditEntry) (int64, error) {
+	args := m.Called(e)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockAuditRepo) Query(f models.AuditFilter) ([]models.AuditEntry, error) {
+	args := m.Called(f)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+func TestAuditChanges_UpdateOnlyListsChangedFields(t *testing.T) {
+	before := models.Database{ID: 1, Host: "db1", Port: 3306, Username: "scanner", Environment: "staging"}
+	after := before
+	after.Host, after.Environment = "db2", "production"
+
+	changes := services.AuditChanges(before, after)
+	assert.Equal(t, map[string]models.FieldChange{
+		"host":        {Before: "db1", After: "db2"},
+		"environment": {Before: "staging", After: "production"},
+	}, changes)
+}
+
+func TestAuditChanges_CreateAndDelete(t *testing.T) {
+	rule := models.ClassificationRule{ID: 4, TypeName: "EMAIL_ADDRESS", Regex: "(?i)mail"}
+
+	created := services.AuditChanges(nil, rule)
+	assert.Equal(t, "EMAIL_ADDRESS", created["type_name"].After)
+	assert.Nil(t, created["type_name"].Before)
+
+	deleted := services.AuditChanges(rule, nil)
+	assert.Equal(t, "EMAIL_ADDRESS", deleted["type_name"].Before)
+	assert.Nil(t, deleted["type_name"].After)
+
+	assert.Empty(t, services.AuditChanges(nil, nil))
+}
+
+func TestAuditChanges_RedactsSecrets(t *testing.T) {
+	w := models.Webhook{ID: 2, URL: "https://hooks.example.com", Secret: "s3cr3t-value-1234"}
+	changes := services.AuditChanges(nil, w)
+	assert.Equal(t, "[redacted]", changes["secret"].After)
+	assert.NotContains(t, changes, "password")
+
+	k := models.APIKey{ID: 3, Prefix: "abc", Key: "dlp_abc_secret"}
+	changes = services.AuditChanges(nil, k)
+	assert.Equal(t, "[redacted]", changes["key"].After)
+	assert.Equal(t, "abc", changes["prefix"].After)
+}
+
+func TestAuditService_RecordSetsResourceTypeAndTime(t *testing.T) {
+	repo := &MockAuditRepo{}
+	repo.On("Append", testifyMock.MatchedBy(func(e models.AuditEntry) bool {
+		return e.ResourceType == "database" && e.Action == models.AuditDatabaseDelete && !e.OccurredAt.IsZero()
+	})).Return(int64(1), nil)
+
+	err := services.NewAuditService(repo).Record(models.AuditEntry{Action: models.AuditDatabaseDelete, ResourceID: "7", Actor: "ana"})
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
+func TestAuditService_ListValidatesFilter(t *testing.T) {
+	repo := &MockAuditRepo{}
+	svc := services.NewAuditService(repo)
+	repo.On("Query", models.AuditFilter{TenantID: 2, Actor: "ana", Limit: services.DefaultAuditLimit}).Return([]models.AuditEntry{{ID: 1}}, nil)
+
+	entries, err := svc.List(models.AuditFilter{TenantID: 2, Actor: "ana"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = svc.List(models.AuditFilter{Actor: "ana"})
+	assert.ErrorIs(t, err, services.ErrInvalidAuditFilter, "the log is never read across tenants")
+	_, err = svc.List(models.AuditFilter{TenantID: 2, Limit: services.MaxAuditLimit + 1})
+	assert.ErrorIs(t, err, services.ErrInvalidAuditFilter)
+	from, to := time.Now(), time.Now().Add(-time.Hour)
+	_, err = svc.List(models.AuditFilter{TenantID: 2, From: &from, To: &to})
+	assert.ErrorIs(t, err, services.ErrInvalidAuditFilter)
+}
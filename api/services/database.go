@@ -1,22 +1,422 @@
 package services
 
 import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
 	"meli-challenge/api/models"
 	"meli-challenge/api/repositories"
+	"meli-challenge/api/sampling"
+	"meli-challenge/api/secrets"
+	"meli-challenge/api/targetdb"
 )
 
+// connectionTestTimeout bounds POST /database/:id/test
+const connectionTestTimeout = 15 * time.Second
+
+// ErrProbeFailed is returned when a registration asked to probe the target and it could not connect.
+var ErrProbeFailed = errors.New("could not connect to the database")
+
+// ValidationError lists the invalid fields of a database, keyed by their JSON name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, f := range names {
+		msgs[i] = f + ": " + e.Fields[f]
+	}
+	return "invalid database: " + strings.Join(msgs, "; ")
+}
+
+// DuplicateError reports that another registered database has the same target or name.
+type DuplicateError struct {
+	ExistingID int64
+	// Field is "host" for the same host/port/username, or "name"
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Field == "name" {
+		return fmt.Sprintf("name already used by database %d", e.ExistingID)
+	}
+	return fmt.Sprintf("host, port and username already registered as database %d", e.ExistingID)
+}
+
+// DatabaseService manages the registered databases of a tenant. Passwords are write-only:
+// nothing it returns includes them.
 type DatabaseService interface {
-	RegisterDatabase(dbConfig models.Database) (int64, error)
+	// RegisterDatabase validates and stores a database of the tenant. With probe it first
+	// connects to the target and fails with ErrProbeFailed (and the test result) when it cannot.
+	RegisterDatabase(tenantID int64, dbConfig models.Database, probe bool) (int64, *models.ConnectionTest, error)
+	ListDatabases(tenantID int64) ([]models.Database, error)
+	GetDatabase(tenantID, id int64) (models.Database, error)
+	// UpdateDatabase replaces the settings of a database; without password or password_ref the
+	// current credential is kept
+	UpdateDatabase(tenantID, id int64, dbConfig models.Database) error
+	DeleteDatabase(tenantID, id int64) error
+	// TestConnection connects to the database and checks the privileges scans need
+	TestConnection(tenantID, id int64) (models.ConnectionTest, error)
 }
 
 type databaseService struct {
-	repo repositories.DatabaseRepository
+	repo  repositories.DatabaseRepository
+	probe func(models.Database) models.ConnectionTest
+	keys  *secrets.Keyring
+}
+
+// DatabaseOption customises optional collaborators of the database service.
+type DatabaseOption func(*databaseService)
+
+// WithProbe replaces the connection test run against targets (targetdb.Probe by default).
+func WithProbe(probe func(models.Database) models.ConnectionTest) DatabaseOption {
+	return func(s *databaseService) { s.probe = probe }
+}
+
+// WithKeyring replaces the master keys that seal stored passwords (secrets.Default() by default).
+func WithKeyring(keys *secrets.Keyring) DatabaseOption {
+	return func(s *databaseService) { s.keys = keys }
+}
+
+func NewDatabaseService(repo repositories.DatabaseRepository, opts ...DatabaseOption) DatabaseService {
+	s := &databaseService{repo: repo, probe: probeTarget}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.keys == nil {
+		s.keys = secrets.Default()
+	}
+	return s
+}
+
+func (s *databaseService) RegisterDatabase(tenantID int64, dbConfig models.Database, probe bool) (int64, *models.ConnectionTest, error) {
+	dbConfig.TenantID = tenantID
+	normalize(&dbConfig)
+	if err := validateDatabase(dbConfig); err != nil {
+		return 0, nil, err
+	}
+	if err := s.checkDuplicates(dbConfig); err != nil {
+		return 0, nil, err
+	}
+
+	var test *models.ConnectionTest
+	if probe {
+		res := s.probe(dbConfig)
+		test = &res
+		if res.Error != "" {
+			return 0, test, fmt.Errorf("%w: %s", ErrProbeFailed, res.Error)
+		}
+	}
+
+	if err := s.seal(&dbConfig); err != nil {
+		return 0, nil, err
+	}
+	id, err := s.repo.Create(dbConfig)
+	if err != nil {
+		return 0, test, s.duplicateKey(dbConfig, err)
+	}
+	return id, test, nil
+}
+
+func (s *databaseService) ListDatabases(tenantID int64) ([]models.Database, error) {
+	dbs, err := s.repo.List(tenantID)
+	for i := range dbs {
+		dbs[i].Password = ""
+	}
+	return dbs, err
+}
+
+func (s *databaseService) GetDatabase(tenantID, id int64) (models.Database, error) {
+	t, err := s.repo.GetByID(tenantID, id)
+	t.Password = ""
+	return t, err
+}
+
+func (s *databaseService) UpdateDatabase(tenantID, id int64, dbConfig models.Database) error {
+	current, err := s.repo.GetByID(tenantID, id)
+	if err != nil {
+		return err
+	}
+	dbConfig.ID, dbConfig.TenantID = id, tenantID
+	// a new password or reference replaces the current credential, whichever kind it was
+	rotated := dbConfig.Password != "" || dbConfig.PasswordRef != ""
+	if !rotated {
+		dbConfig.Password, dbConfig.EncryptedPassword, dbConfig.PasswordRef = current.Password, current.EncryptedPassword, current.PasswordRef
+	}
+	normalize(&dbConfig)
+	if err := validateDatabase(dbConfig); err != nil {
+		return err
+	}
+	if err := s.checkDuplicates(dbConfig); err != nil {
+		return err
+	}
+	if rotated {
+		if err := s.seal(&dbConfig); err != nil {
+			return err
+		}
+	}
+	return s.duplicateKey(dbConfig, s.repo.Update(dbConfig))
+}
+
+func (s *databaseService) DeleteDatabase(tenantID, id int64) error {
+	return s.repo.Delete(tenantID, id)
+}
+
+func (s *databaseService) TestConnection(tenantID, id int64) (models.ConnectionTest, error) {
+	target, err := s.repo.GetByID(tenantID, id)
+	if err != nil {
+		return models.ConnectionTest{}, err
+	}
+	return s.probe(target), nil
+}
+
+// checkDuplicates rejects a database whose target or name belongs to another registered one
+// of the same tenant.
+func (s *databaseService) checkDuplicates(dbConfig models.Database) error {
+	id, err := s.repo.FindByTarget(dbConfig.TenantID, dbConfig.Host, dbConfig.Port, dbConfig.Username)
+	if err == nil && id != dbConfig.ID {
+		return &DuplicateError{ExistingID: id, Field: "host"}
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if dbConfig.Name == "" {
+		return nil
+	}
+	id, err = s.repo.FindByName(dbConfig.TenantID, dbConfig.Name)
+	if err == nil && id != dbConfig.ID {
+		return &DuplicateError{ExistingID: id, Field: "name"}
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return nil
 }
 
-func NewDatabaseService(repo repositories.DatabaseRepository) DatabaseService {
-	return &databaseService{repo: repo}
+// duplicateKey turns the unique key violation of a database registered concurrently with
+// dbConfig, which checkDuplicates could not see yet, into a DuplicateError.
+func (s *databaseService) duplicateKey(dbConfig models.Database, err error) error {
+	if !errors.Is(err, repositories.ErrDuplicate) {
+		return err
+	}
+	if dup := s.checkDuplicates(dbConfig); dup != nil {
+		return dup
+	}
+	return err
 }
 
-func (s *databaseService) RegisterDatabase(dbConfig models.Database) (int64, error) {
-	return s.repo.Create(dbConfig)
+func normalize(dbConfig *models.Database) {
+	dbConfig.TLS.Mode = strings.ToLower(strings.TrimSpace(dbConfig.TLS.Mode))
+	dbConfig.TLS.ServerName = strings.ToLower(strings.TrimSpace(dbConfig.TLS.ServerName))
+	dbConfig.SSH.Host = strings.ToLower(strings.TrimSpace(dbConfig.SSH.Host))
+	dbConfig.SSH.HostKey = strings.TrimSpace(dbConfig.SSH.HostKey)
+	dbConfig.Name = strings.TrimSpace(dbConfig.Name)
+	dbConfig.Owner = strings.TrimSpace(dbConfig.Owner)
+	dbConfig.Host = strings.ToLower(strings.TrimSpace(dbConfig.Host))
+	dbConfig.ReplicaHost = strings.ToLower(strings.TrimSpace(dbConfig.ReplicaHost))
+	dbConfig.Environment = strings.ToLower(strings.TrimSpace(dbConfig.Environment))
+}
+
+// hostnamePattern accepts DNS names and container names (letters, digits, '-', '_' and dots)
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?)*$`)
+
+// validateDatabase checks the fields of a database against the limits of external_databases
+// and the values scans accept.
+func validateDatabase(d models.Database) error {
+	fields := make(map[string]string)
+	checkHost := func(field, host string) {
+		if len(host) > 100 {
+			fields[field] = "must have at most 100 characters"
+		} else if net.ParseIP(host) == nil && !hostnamePattern.MatchString(host) {
+			fields[field] = "must be a hostname or IP address"
+		}
+	}
+
+	if d.Host == "" {
+		fields["host"] = "is required"
+	} else {
+		checkHost("host", d.Host)
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		fields["port"] = "must be between 1 and 65535"
+	}
+	if d.Username == "" {
+		fields["username"] = "is required"
+	} else if len(d.Username) > 50 {
+		fields["username"] = "must have at most 50 characters"
+	}
+	if len(d.Password) > 255 {
+		fields["password"] = "must have at most 255 characters"
+	}
+	if d.PasswordRef != "" {
+		if d.Password != "" || d.EncryptedPassword != nil {
+			fields["password_ref"] = "cannot be combined with password"
+		} else if err := validateSecretRef(d.TenantID, d.PasswordRef); err != nil {
+			fields["password_ref"] = err.Error()
+		}
+	}
+	if len(d.Name) > 100 {
+		fields["name"] = "must have at most 100 characters"
+	}
+	if d.Environment != "" && !slices.Contains(models.Environments, d.Environment) {
+		fields["environment"] = "must be one of " + strings.Join(models.Environments, ", ")
+	}
+	if len(d.Owner) > 100 {
+		fields["owner"] = "must have at most 100 characters"
+	}
+
+	if d.ReplicaHost != "" {
+		checkHost("replica_host", d.ReplicaHost)
+	}
+	if d.ReplicaPort < 0 || d.ReplicaPort > 65535 {
+		fields["replica_port"] = "must be between 1 and 65535"
+	} else if d.ReplicaPort != 0 && d.ReplicaHost == "" {
+		fields["replica_port"] = "requires replica_host"
+	}
+
+	if _, err := sampling.New(d.Sampling.Strategy); err != nil {
+		fields["sampling.strategy"] = err.Error()
+	}
+	if d.Sampling.SampleSize < 0 {
+		fields["sampling.sample_size"] = "must not be negative"
+	}
+	if d.Sampling.RowLimit < 0 {
+		fields["sampling.row_limit"] = "must not be negative"
+	}
+	if d.Sampling.Percent < 0 || d.Sampling.Percent > 100 {
+		fields["sampling.percent"] = "must be between 0 and 100"
+	}
+	if d.Sampling.MaxExecutionMs < 0 {
+		fields["sampling.max_execution_ms"] = "must not be negative"
+	}
+
+	if d.Limits.MaxConnections < 0 {
+		fields["limits.max_connections"] = "must not be negative"
+	}
+	if d.Limits.MaxQPS < 0 {
+		fields["limits.max_qps"] = "must not be negative"
+	}
+	if d.Limits.MaxThreadsRunning < -1 {
+		fields["limits.max_threads_running"] = "must be -1 (disabled), 0 (default) or positive"
+	}
+
+	validateTLS(d.TenantID, d.TLS, fields, checkHost)
+	validateSSH(d.TenantID, d.SSH, fields, checkHost)
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func validateTLS(tenantID int64, t models.TLSSettings, fields map[string]string, checkHost func(field, host string)) {
+	enabled := t.Mode != "" && t.Mode != models.TLSDisabled
+	if t.Mode != "" && !slices.Contains(models.TLSModes, t.Mode) {
+		fields["tls.mode"] = "must be one of " + strings.Join(models.TLSModes, ", ")
+	} else if !enabled && (t.CA != "" || t.Cert != "" || t.KeyRef != "" || t.ServerName != "") {
+		fields["tls.mode"] = "is required with other tls settings"
+	}
+	if t.CA != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(t.CA)) {
+		fields["tls.ca"] = "must be PEM encoded certificates"
+	}
+	if (t.Cert == "") != (t.KeyRef == "") {
+		fields["tls.cert"] = "requires tls.key_ref, and the reverse"
+	} else if t.Cert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(t.Cert)) {
+		fields["tls.cert"] = "must be a PEM encoded certificate"
+	}
+	if t.KeyRef != "" {
+		if err := validateSecretRef(tenantID, t.KeyRef); err != nil {
+			fields["tls.key_ref"] = err.Error()
+		}
+	}
+	if t.ServerName != "" {
+		checkHost("tls.server_name", t.ServerName)
+	}
+}
+
+func validateSSH(tenantID int64, t models.SSHTunnel, fields map[string]string, checkHost func(field, host string)) {
+	if t == (models.SSHTunnel{}) {
+		return
+	}
+	if t.Host == "" {
+		fields["ssh.host"] = "is required with other ssh settings"
+	} else {
+		checkHost("ssh.host", t.Host)
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		fields["ssh.port"] = "must be between 1 and 65535"
+	}
+	if t.User == "" {
+		fields["ssh.user"] = "is required"
+	} else if len(t.User) > 50 {
+		fields["ssh.user"] = "must have at most 50 characters"
+	}
+	if t.KeyRef == "" {
+		fields["ssh.key_ref"] = "is required"
+	} else if err := validateSecretRef(tenantID, t.KeyRef); err != nil {
+		fields["ssh.key_ref"] = err.Error()
+	}
+	if !strings.HasPrefix(t.HostKey, "SHA256:") || len(t.HostKey) > 100 {
+		fields["ssh.host_key"] = "must be the SHA256 fingerprint of the bastion host key (ssh-keygen -lf)"
+	}
+}
+
+// validateSecretRef checks that ref has a configured scheme and stays within the secrets of
+// tenantID; whether the secret exists is only known when it is resolved (e.g. with ?probe=true).
+func validateSecretRef(tenantID int64, ref string) error {
+	if len(ref) > 255 {
+		return errors.New("must have at most 255 characters")
+	}
+	providers := secrets.DefaultProviders().ForTenant(tenantID)
+	schemes := providers.Schemes()
+	scheme, _, err := secrets.ParseRef(ref)
+	if err == nil && !slices.Contains(schemes, scheme) {
+		err = fmt.Errorf("scheme %q is not configured", scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("%v (use %s)", err, strings.Join(schemes, ":, ")+":")
+	}
+	return providers.Check(ref)
+}
+
+// seal replaces the plaintext password of dbConfig with its encrypted form. Without a master
+// key the password is stored as is.
+func (s *databaseService) seal(dbConfig *models.Database) error {
+	if !s.keys.Enabled() || dbConfig.Password == "" {
+		return nil
+	}
+	enc, err := s.keys.Seal(dbConfig.Password)
+	if err != nil {
+		return fmt.Errorf("encrypt password: %w", err)
+	}
+	dbConfig.Password, dbConfig.EncryptedPassword = "", enc
+	return nil
+}
+
+// probeTarget opens a throttled, read-only pool to target and runs targetdb.Probe on it.
+func probeTarget(target models.Database) models.ConnectionTest {
+	db, err := targetdb.Open(target)
+	if err != nil {
+		return models.ConnectionTest{Schemas: []string{}, Checks: []models.PrivilegeCheck{}, Error: err.Error()}
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+	defer cancel()
+	return targetdb.Probe(ctx, db)
 }
@@ -0,0 +1,294 @@
+package services_test
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/secrets"
+	"meli-challenge/api/services"
+)
+
+type MockDatabaseRepo struct{ testifyMock.Mock }
+
+func (m *MockDatabaseRepo) Create(db models.Database) (int64, error) {
+	args := m.Called(db)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockDatabaseRepo) GetByID(tenantID, id int64) (models.Database, error) {
+	args := m.Called(tenantID, id)
+	return args.Get(0).(models.Database), args.Error(1)
+}
+func (m *MockDatabaseRepo) List(tenantID int64) ([]models.Database, error) {
+	args := m.Called(tenantID)
+	return args.Get(0).([]models.Database), args.Error(1)
+}
+func (m *MockDatabaseRepo) Update(db models.Database) error { return m.Called(db).Error(0) }
+func (m *MockDatabaseRepo) Delete(tenantID, id int64) error { return m.Called(tenantID, id).Error(0) }
+func (m *MockDatabaseRepo) FindByTarget(tenantID int64, host string, port int, username string) (int64, error) {
+	args := m.Called(tenantID, host, port, username)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockDatabaseRepo) FindByName(tenantID int64, name string) (int64, error) {
+	args := m.Called(tenantID, name)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseRepo) UpdatePassword(tenantID, id int64, password string, enc *models.EncryptedSecret) error {
+	return m.Called(tenantID, id, password, enc).Error(0)
+}
+
+// tenant owns every resource the service tests touch
+const tenant = models.DefaultTenantID
+
+func TestListAndGetDatabases_NeverReturnPasswords(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("List", tenant).Return([]models.Database{{ID: 1, Host: "a", Password: "secret"}, {ID: 2, Host: "b", Password: "secret"}}, nil)
+	repo.On("GetByID", tenant, int64(1)).Return(models.Database{ID: 1, Host: "a", Password: "secret"}, nil)
+	svc := services.NewDatabaseService(repo)
+
+	dbs, err := svc.ListDatabases(tenant)
+	assert.NoError(t, err)
+	assert.Len(t, dbs, 2)
+	for _, d := range dbs {
+		assert.Empty(t, d.Password)
+	}
+
+	d, err := svc.GetDatabase(tenant, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", d.Host)
+	assert.Empty(t, d.Password)
+}
+
+func TestUpdateDatabase_KeepsPasswordUnlessRotated(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("GetByID", tenant, int64(1)).Return(models.Database{ID: 1, Host: "a", Port: 3306, Username: "u", Password: "old"}, nil)
+	repo.On("GetByID", tenant, int64(9)).Return(models.Database{}, sql.ErrNoRows)
+	repo.On("Update", testifyMock.Anything).Return(nil)
+	repo.On("FindByTarget", tenant, "b", 3306, "u").Return(int64(1), nil)
+	svc := services.NewDatabaseService(repo)
+
+	assert.NoError(t, svc.UpdateDatabase(tenant, 1, models.Database{Host: "b", Port: 3306, Username: "u"}))
+	assert.NoError(t, svc.UpdateDatabase(tenant, 1, models.Database{Host: "b", Port: 3306, Username: "u", Password: "new"}))
+	assert.Equal(t, sql.ErrNoRows, svc.UpdateDatabase(tenant, 9, models.Database{Host: "b"}))
+
+	kept := repo.Calls[2].Arguments.Get(0).(models.Database)
+	assert.Equal(t, int64(1), kept.ID)
+	assert.Equal(t, "b", kept.Host)
+	assert.Equal(t, "old", kept.Password)
+	rotated := repo.Calls[5].Arguments.Get(0).(models.Database)
+	assert.Equal(t, "new", rotated.Password)
+}
+
+func TestRegisterAndUpdateDatabase_SealPasswords(t *testing.T) {
+	keys, err := secrets.NewKeyring([]string{"k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	require.NoError(t, err)
+	repo := new(MockDatabaseRepo)
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows)
+	repo.On("Create", testifyMock.Anything).Return(int64(3), nil)
+	svc := services.NewDatabaseService(repo, services.WithKeyring(keys))
+
+	_, _, err = svc.RegisterDatabase(tenant, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", Password: "s3cret"}, false)
+	require.NoError(t, err)
+
+	stored := repo.Calls[1].Arguments.Get(0).(models.Database)
+	assert.Empty(t, stored.Password)
+	require.NotNil(t, stored.EncryptedPassword)
+	assert.Equal(t, "k1", stored.EncryptedPassword.KeyID)
+	assert.NotContains(t, string(stored.EncryptedPassword.Ciphertext), "s3cret")
+	plain, err := keys.Open(stored.EncryptedPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plain)
+
+	// an update without a password keeps the sealed one untouched
+	stored.ID = 3
+	repo.On("GetByID", tenant, int64(3)).Return(stored, nil)
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(3), nil)
+	repo.On("Update", testifyMock.Anything).Return(nil)
+	require.NoError(t, svc.UpdateDatabase(tenant, 3, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", Owner: "team"}))
+	updated := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Empty(t, updated.Password)
+	assert.Same(t, stored.EncryptedPassword, updated.EncryptedPassword)
+}
+
+func TestRegisterAndUpdateDatabase_PasswordRef(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows)
+	repo.On("Create", testifyMock.Anything).Return(int64(3), nil)
+	svc := services.NewDatabaseService(repo)
+
+	_, _, err := svc.RegisterDatabase(tenant, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", Password: "x", PasswordRef: "env:SCANNER_SECRET_T1_SALES"}, false)
+	var invalid *services.ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "cannot be combined with password", invalid.Fields["password_ref"])
+
+	_, _, err = svc.RegisterDatabase(tenant, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", PasswordRef: "consul:db/sales"}, false)
+	require.True(t, errors.As(err, &invalid))
+	assert.Contains(t, invalid.Fields["password_ref"], `scheme "consul" is not configured`)
+
+	_, _, err = svc.RegisterDatabase(tenant, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", PasswordRef: "env:SCANNER_SECRET_T1_SALES"}, false)
+	require.NoError(t, err)
+	stored := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Equal(t, "env:SCANNER_SECRET_T1_SALES", stored.PasswordRef)
+	assert.Empty(t, stored.Password)
+
+	// switching back to a password drops the reference
+	stored.ID = 3
+	repo.On("GetByID", tenant, int64(3)).Return(stored, nil)
+	repo.On("Update", testifyMock.Anything).Return(nil)
+	require.NoError(t, svc.UpdateDatabase(tenant, 3, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", Password: "new"}))
+	updated := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Equal(t, "new", updated.Password)
+	assert.Empty(t, updated.PasswordRef)
+}
+
+func TestRegisterDatabase_RejectsSecretRefsOfOtherTenants(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	svc := services.NewDatabaseService(repo)
+	const other = tenant + 1
+
+	// tenant 2 cannot point at tenant 1's variables or files, nor at unscoped ones
+	_, _, err := svc.RegisterDatabase(other, models.Database{
+		Host: "db.internal", Port: 3306, Username: "scanner", PasswordRef: "env:SCANNER_SECRET_T1_SALES",
+		TLS: models.TLSSettings{Mode: models.TLSVerifyIdentity, KeyRef: "file:../tenant-1/client-key.pem"},
+		SSH: models.SSHTunnel{Host: "bastion", User: "jump", KeyRef: "env:SCANNER_SECRET_BASTION", HostKey: "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"},
+	}, false)
+
+	var invalid *services.ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []string{"password_ref", "ssh.key_ref", "tls.cert", "tls.key_ref"}, sortedKeys(invalid.Fields))
+	assert.Contains(t, invalid.Fields["password_ref"], "SCANNER_SECRET_T2_")
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+}
+
+func TestRegisterDatabase_ValidatesTLSAndSSH(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	svc := services.NewDatabaseService(repo)
+
+	_, _, err := svc.RegisterDatabase(tenant, models.Database{
+		Host: "db.internal", Port: 3306, Username: "scanner",
+		TLS: models.TLSSettings{Mode: "strict", CA: "not a pem", Cert: "-----BEGIN CERTIFICATE-----"},
+		SSH: models.SSHTunnel{User: "jump", KeyRef: "env:SCANNER_SECRET_T1_BASTION", HostKey: "ab:cd"},
+	}, false)
+
+	var invalid *services.ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []string{"ssh.host", "ssh.host_key", "tls.ca", "tls.cert", "tls.mode"}, sortedKeys(invalid.Fields))
+
+	_, _, err = svc.RegisterDatabase(tenant, models.Database{
+		Host: "db.internal", Port: 3306, Username: "scanner",
+		TLS: models.TLSSettings{ServerName: "db.internal"},
+	}, false)
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []string{"tls.mode"}, sortedKeys(invalid.Fields))
+
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows)
+	repo.On("Create", testifyMock.Anything).Return(int64(8), nil)
+	id, _, err := svc.RegisterDatabase(tenant, models.Database{
+		Host: "db.internal", Port: 3306, Username: "scanner",
+		TLS: models.TLSSettings{Mode: "VERIFY-IDENTITY"},
+		SSH: models.SSHTunnel{Host: "Bastion.Example.com", User: "jump", KeyRef: "file:bastion/id_ed25519", HostKey: "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"},
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), id)
+	stored := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Equal(t, models.TLSVerifyIdentity, stored.TLS.Mode)
+	assert.Equal(t, "bastion.example.com", stored.SSH.Host)
+}
+
+func TestRegisterDatabase_ReturnsErrorsPerField(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	svc := services.NewDatabaseService(repo)
+
+	_, _, err := svc.RegisterDatabase(tenant, models.Database{
+		Host: "db host", Port: 0, Environment: "qa", ReplicaPort: 3307,
+		Sampling: models.SamplingConfig{Strategy: "everything", Percent: 120},
+		Limits:   models.TargetLimits{MaxThreadsRunning: -5},
+	}, false)
+
+	var invalid *services.ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []string{"environment", "host", "limits.max_threads_running", "port", "replica_port", "sampling.percent", "sampling.strategy", "username"},
+		sortedKeys(invalid.Fields))
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+}
+
+func TestRegisterDatabase_DetectsDuplicates(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(4), nil)
+	repo.On("FindByTarget", tenant, "other.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows)
+	repo.On("FindByName", tenant, "billing").Return(int64(5), nil)
+	svc := services.NewDatabaseService(repo)
+
+	// hosts are compared case-insensitively
+	_, _, err := svc.RegisterDatabase(tenant, models.Database{Host: "DB.internal", Port: 3306, Username: "scanner"}, false)
+	var dup *services.DuplicateError
+	require.True(t, errors.As(err, &dup))
+	assert.Equal(t, int64(4), dup.ExistingID)
+	assert.Equal(t, "host", dup.Field)
+
+	_, _, err = svc.RegisterDatabase(tenant, models.Database{Name: "billing", Host: "other.internal", Port: 3306, Username: "scanner"}, false)
+	require.True(t, errors.As(err, &dup))
+	assert.Equal(t, "name", dup.Field)
+}
+
+func TestRegisterDatabase_ConcurrentDuplicateHitsUniqueKey(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	// the other registration commits between the lookup and the insert
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows).Once()
+	repo.On("Create", testifyMock.Anything).Return(int64(0), fmt.Errorf("%w: uq_databases_target", repositories.ErrDuplicate))
+	repo.On("FindByTarget", tenant, "db.internal", 3306, "scanner").Return(int64(4), nil)
+	svc := services.NewDatabaseService(repo)
+
+	_, _, err := svc.RegisterDatabase(tenant, models.Database{Host: "db.internal", Port: 3306, Username: "scanner"}, false)
+	var dup *services.DuplicateError
+	require.True(t, errors.As(err, &dup))
+	assert.Equal(t, int64(4), dup.ExistingID)
+	assert.Equal(t, "host", dup.Field)
+}
+
+func TestRegisterDatabase_ProbesTarget(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("FindByTarget", tenant, testifyMock.Anything, testifyMock.Anything, testifyMock.Anything).Return(int64(0), sql.ErrNoRows)
+	repo.On("FindByName", tenant, "billing").Return(int64(0), sql.ErrNoRows)
+	repo.On("Create", testifyMock.Anything).Return(int64(6), nil)
+	reachable := services.WithProbe(func(d models.Database) models.ConnectionTest {
+		if d.Host == "down.internal" {
+			return models.ConnectionTest{Error: "dial tcp: connection refused"}
+		}
+		return models.ConnectionTest{OK: true, ServerVersion: "8.0.36"}
+	})
+	svc := services.NewDatabaseService(repo, reachable)
+
+	_, test, err := svc.RegisterDatabase(tenant, models.Database{Host: "down.internal", Port: 3306, Username: "scanner"}, true)
+	assert.ErrorIs(t, err, services.ErrProbeFailed)
+	assert.Equal(t, "dial tcp: connection refused", test.Error)
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+
+	id, test, err := svc.RegisterDatabase(tenant, models.Database{Name: " billing ", Environment: "Production", Owner: "payments",
+		Host: "db.internal", Port: 3306, Username: "scanner"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), id)
+	assert.Equal(t, "8.0.36", test.ServerVersion)
+	created := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Equal(t, "billing", created.Name)
+	assert.Equal(t, "production", created.Environment)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
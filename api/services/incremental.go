@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/sampling"
+	"meli-challenge/logger"
+)
+
+// tableMeta is a base table as listed from information_schema.tables.
+type tableMeta struct {
+	Schema     string
+	Name       string
+	UpdateTime sql.NullString
+	CreateTime sql.NullString
+}
+
+// listTables reads every non-system base table. Rows are read fully before returning so callers
+// can query the target while iterating without holding an extra connection.
+func listTables(ctx context.Context, externalDB *sql.DB) ([]tableMeta, error) {
+	rows, err := externalDB.QueryContext(ctx, `
+		SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME
+		FROM information_schema.tables
+		WHERE TABLE_TYPE='BASE TABLE'
+		  AND TABLE_SCHEMA NOT IN ('mysql','sys','information_schema','performance_schema')
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableMeta
+	for rows.Next() {
+		var t tableMeta
+		if err := rows.Scan(&t.Schema, &t.Name, &t.UpdateTime, &t.CreateTime); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// listColumns reads the columns of a table in ordinal order.
+func listColumns(ctx context.Context, externalDB *sql.DB, schema, table string) ([]sampling.Column, error) {
+	rows, err := externalDB.QueryContext(ctx, `
+		SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE
+		FROM information_schema.columns
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []sampling.Column
+	for rows.Next() {
+		var c sampling.Column
+		if err := rows.Scan(&c.Name, &c.DataType, &c.ColumnKey, &c.ColumnType); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// tableFingerprint hashes a table's column list, types and UPDATE_TIME/CREATE_TIME.
+func tableFingerprint(t tableMeta, columns []sampling.Column) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", t.UpdateTime.String, t.CreateTime.String)
+	for _, c := range columns {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", c.Name, c.ColumnType, c.ColumnKey)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rulesVersion hashes what decides a column's info_type besides the table itself: the scan
+// mode, the classification rules and, for v2, the LLM model.
+func rulesVersion(mode string, rules []models.ClassificationRule, model string) string {
+	sorted := append([]models.ClassificationRule(nil), rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", mode, model)
+	for _, r := range sorted {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00", r.ID, r.TypeName, r.Regex)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// incrementalBase is the previous successful scan an incremental scan copies results from.
+type incrementalBase struct {
+	scanID       int64
+	fingerprints map[string]models.TableFingerprint
+}
+
+// loadIncrementalBase finds the previous successful scan of the database run with the same API
+// version; the fingerprints of the other version never match (see rulesVersion). It returns nil
+// (full scan) when incremental mode is off, there is no previous scan or it cannot be read.
+func (s *scanService) loadIncrementalBase(tenantID, databaseID, scanID int64, apiVersion string, opts models.ScanOptions) *incrementalBase {
+	if !opts.Incremental {
+		return nil
+	}
+	prevID, err := s.repoScan.GetLastSuccessfulScanID(tenantID, databaseID, scanID, apiVersion)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Warnf("Incremental scan_id=%d falls back to a full scan: %v", scanID, err)
+		} else {
+			logger.Infof("Incremental scan_id=%d has no previous successful scan, scanning everything", scanID)
+		}
+		return nil
+	}
+	fps, err := s.repoScan.GetTableFingerprints(prevID)
+	if err != nil {
+		logger.Warnf("Incremental scan_id=%d falls back to a full scan: %v", scanID, err)
+		return nil
+	}
+	base := &incrementalBase{scanID: prevID, fingerprints: make(map[string]models.TableFingerprint, len(fps))}
+	for _, fp := range fps {
+		base.fingerprints[fp.SchemaName+"."+fp.TableName] = fp
+	}
+	logger.Infof("Incremental scan_id=%d compares against scan_id=%d (%d tables)", scanID, prevID, len(fps))
+	return base
+}
+
+// reuseTable copies the previous results of a table whose structure and rules did not change.
+// It returns false when the table must be classified again.
+func (s *scanService) reuseTable(base *incrementalBase, scanID int64, fp models.TableFingerprint) bool {
+	if base == nil {
+		return false
+	}
+	prev, ok := base.fingerprints[fp.SchemaName+"."+fp.TableName]
+	if !ok || prev.Fingerprint != fp.Fingerprint || prev.RulesVersion != fp.RulesVersion {
+		return false
+	}
+	copied, err := s.repoScan.CopyTableResults(base.scanID, scanID, fp.SchemaName, fp.TableName)
+	if err != nil {
+		logger.Warnf("Could not reuse results of %s.%s, rescanning: %v", fp.SchemaName, fp.TableName, err)
+		return false
+	}
+	return copied > 0
+}
+
+// recordTable stores a table's fingerprint so later incremental scans can compare against it.
+func (s *scanService) recordTable(scanID int64, fp models.TableFingerprint) {
+	if err := s.repoScan.SaveTableFingerprint(scanID, fp); err != nil {
+		logger.Warnf("Could not store fingerprint of %s.%s for scan_id=%d: %v", fp.SchemaName, fp.TableName, scanID, err)
+	}
+}
+
+// recordTableStats persists how many tables were classified and how many were copied forward.
+func (s *scanService) recordTableStats(scanID int64, scanned, reused int) {
+	logger.Infof("Tables for scan_id=%d: scanned=%d reused=%d", scanID, scanned, reused)
+	if err := s.repoScan.UpdateTableStats(scanID, scanned, reused); err != nil {
+		logger.Warnf("Could not persist table stats for scan_id=%d: %v", scanID, err)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/sampling"
+	"meli-challenge/api/targetdb"
+)
+
+// ScanLauncher starts a scan of a registered database outside of an HTTP request (e.g. from the scheduler).
+type ScanLauncher interface {
+	// Launch runs a "v1" or "v2" scan of a database of the actor's tenant to completion and
+	// returns its scan_id. The start is audited with actor as the caller (e.g. schedule:<id>).
+	Launch(actor models.Identity, databaseID int64, version string, opts models.ScanOptions) (int64, error)
+}
+
+type scanLauncher struct {
+	repoDB repositories.DatabaseRepository
+	scans  ScanService
+	audit  AuditService
+}
+
+func NewScanLauncher(repoDB repositories.DatabaseRepository, scans ScanService, audit AuditService) ScanLauncher {
+	return &scanLauncher{repoDB: repoDB, scans: scans, audit: audit}
+}
+
+func (l *scanLauncher) Launch(actor models.Identity, databaseID int64, version string, opts models.ScanOptions) (int64, error) {
+	tenantID := actor.TenantID
+	target, err := l.repoDB.GetByID(tenantID, databaseID)
+	if err != nil {
+		return 0, fmt.Errorf("database %d: %w", databaseID, err)
+	}
+	opts.Sampling = sampling.Merge(target.Sampling, opts.Sampling)
+
+	// a refused scan never connects to the target
+	scanID, err := l.scans.StartScan(tenantID, databaseID, version)
+	if err != nil {
+		return 0, err
+	}
+	externalDB, err := targetdb.Open(target)
+	if err != nil {
+		_ = l.scans.UpdateScanStatus(scanID, "failed")
+		return scanID, err
+	}
+	defer externalDB.Close()
+
+	// errors are logged by the audit service; the scan runs anyway
+	_ = l.audit.Record(models.AuditEntry{
+		TenantID:   tenantID,
+		Actor:      actor.Name,
+		ActorOwner: actor.Owner,
+		Action:     models.AuditScanStart,
+		ResourceID: strconv.FormatInt(scanID, 10),
+		Changes:    AuditChanges(nil, map[string]any{"api": version, "database_id": databaseID, "options": opts}),
+	})
+
+	return scanID, l.scans.RunScan(tenantID, databaseID, scanID, version, externalDB, opts)
+}
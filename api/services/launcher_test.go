@@ -0,0 +1,43 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+func TestLaunch_AuditsTheStartedScan(t *testing.T) {
+	dbRepo, scanRepo, ruleRepo, auditRepo := new(MockDatabaseRepo), new(MockScanRepo), new(MockRuleRepo), new(MockAuditRepo)
+	dbRepo.On("GetByID", tenant, int64(3)).Return(models.Database{ID: 3, TenantID: tenant, Host: "127.0.0.1", Port: 1}, nil)
+	scanRepo.On("CreateHistory", tenant, int64(3), "v1").Return(int64(8), nil)
+	scanRepo.On("UpdateHistoryStatus", int64(8), "failed").Return(nil)
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule(nil), errors.New("rules unavailable"))
+	auditRepo.On("Append", testifyMock.MatchedBy(func(e models.AuditEntry) bool {
+		return e.Action == models.AuditScanStart && e.ResourceID == "8" && e.Actor == "schedule:5" && e.TenantID == tenant
+	})).Return(int64(1), nil)
+	launcher := services.NewScanLauncher(dbRepo, services.NewScanService(scanRepo, ruleRepo, nil), services.NewAuditService(auditRepo))
+
+	scanID, err := launcher.Launch(models.Identity{TenantID: tenant, Name: "schedule:5", Owner: "scheduler"}, 3, "v1", models.ScanOptions{})
+
+	assert.Error(t, err)
+	assert.Equal(t, int64(8), scanID)
+	auditRepo.AssertExpectations(t)
+}
+
+func TestLaunch_RefusedScanIsNotAudited(t *testing.T) {
+	dbRepo, scanRepo, ruleRepo, auditRepo := new(MockDatabaseRepo), new(MockScanRepo), new(MockRuleRepo), new(MockAuditRepo)
+	dbRepo.On("GetByID", tenant, int64(3)).Return(models.Database{ID: 3, TenantID: tenant, Host: "127.0.0.1", Port: 1}, nil)
+	scanRepo.On("CountRunning", tenant, int64(3), testifyMock.Anything).Return(1, nil)
+	scans := services.NewScanService(scanRepo, ruleRepo, nil, services.WithQuotas(quotas))
+	launcher := services.NewScanLauncher(dbRepo, scans, services.NewAuditService(auditRepo))
+
+	_, err := launcher.Launch(models.Identity{TenantID: tenant, Name: "schedule:5", Owner: "scheduler"}, 3, "v1", models.ScanOptions{})
+
+	assert.ErrorIs(t, err, services.ErrQuotaExceeded)
+	auditRepo.AssertNotCalled(t, "Append", testifyMock.Anything)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	llm "meli-challenge/api/llm"
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// ErrUnpricedModel is returned when a scan has an LLM budget but its model has no price to enforce it with.
+var ErrUnpricedModel = errors.New("LLM budget set but the model has no price")
+
+// llmUsageTracker accumulates the LLM accounting of a single scan and enforces its budget.
+type llmUsageTracker struct {
+	mu     sync.Mutex
+	model  string
+	prices llm.PriceTable
+	usage  models.LLMUsage
+	// unpriced holds the models already warned about for having no price
+	unpriced map[string]bool
+}
+
+func newLLMUsageTracker(model string, prices llm.PriceTable, budgetUSD float64) *llmUsageTracker {
+	return &llmUsageTracker{model: model, prices: prices, usage: models.LLMUsage{BudgetUSD: budgetUSD}}
+}
+
+// allow reports whether another LLM call fits in the budget. A budget of 0 means unlimited.
+// Calls already in flight may overshoot the budget by at most the concurrency limit.
+func (t *llmUsageTracker) allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.usage.BudgetUSD <= 0 {
+		return true
+	}
+	if t.usage.BudgetExhausted {
+		return false
+	}
+	if t.usage.CostUSD >= t.usage.BudgetUSD {
+		t.usage.BudgetExhausted = true
+		return false
+	}
+	return true
+}
+
+// record adds one classification with its token usage, retries and latency. Each model's tokens are
+// priced at that model's price. Tokens of a model without a price mark the cost as unknown and, since
+// the budget can no longer be enforced, stop further calls when one is set.
+func (t *llmUsageTracker) record(u llm.Usage, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	model := u.Model
+	if model == "" {
+		model = t.model
+	}
+	t.usage.Calls++
+	t.usage.PromptTokens += u.PromptTokens
+	t.usage.CompletionTokens += u.CompletionTokens
+	t.usage.Retries += u.Retries
+	t.usage.LatencyMs += latency.Milliseconds()
+	cost, ok := t.prices.Cost(model, u)
+	t.usage.CostUSD += cost
+	if !ok {
+		t.usage.CostUnknown = true
+		if t.unpriced == nil {
+			t.unpriced = map[string]bool{}
+		}
+		if !t.unpriced[model] {
+			t.unpriced[model] = true
+			logger.Warnf("No price for LLM model %s (or the primary it fell back from): the scan cost is incomplete", model)
+		}
+		if t.usage.BudgetUSD > 0 {
+			t.usage.BudgetExhausted = true
+		}
+	}
+}
+
+// recordError counts a column that could not be classified.
+func (t *llmUsageTracker) recordError() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.Errors++
+}
+
+func (t *llmUsageTracker) snapshot() models.LLMUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage
+}
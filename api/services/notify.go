@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// ScanNotifier is told when a scan finishes (e.g. webhook.Dispatcher).
+type ScanNotifier interface {
+	Notify(event models.WebhookEvent)
+}
+
+// WithNotifier sends an event to n whenever a scan finishes.
+func WithNotifier(n ScanNotifier) ScanOption {
+	return func(s *scanService) { s.notifier = n }
+}
+
+// scanStatus maps the outcome of a scan to its scan_history status.
+func scanStatus(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+var statusEvents = map[string]string{
+	"success":   models.EventScanSucceeded,
+	"failed":    models.EventScanFailed,
+	"cancelled": models.EventScanCancelled,
+}
+
+// notifyFinished reports a finished scan and, when it succeeded, the sensitive columns that
+// are new since the previous successful scan of the same database and API version: a v2 scan
+// compared with regex-only v1 results would report columns v1 never classified.
+func (s *scanService) notifyFinished(tenantID, databaseID, scanID int64, apiVersion, status string, scanErr error) {
+	if s.notifier == nil || scanID == 0 {
+		return
+	}
+	results, err := s.GetScanResults(tenantID, scanID)
+	if err != nil {
+		logger.Warnf("Could not load results of scan_id=%d for notifications: %v", scanID, err)
+	}
+	event := models.WebhookEvent{
+		ID:         newEventID(),
+		Event:      statusEvents[status],
+		OccurredAt: time.Now().UTC(),
+		DatabaseID: databaseID,
+		ScanID:     scanID,
+		Status:     status,
+		Results:    results,
+	}
+	if scanErr != nil {
+		event.Error = scanErr.Error()
+	}
+	s.notifier.Notify(event)
+
+	if status != "success" {
+		return
+	}
+	previous, err := s.repoScan.GetLastSuccessfulScanID(tenantID, databaseID, scanID, apiVersion)
+	if err != nil {
+		return
+	}
+	d, err := s.DiffScans(tenantID, previous, scanID)
+	if err != nil || len(d.NewlySensitive) == 0 {
+		return
+	}
+	event.ID, event.Event = newEventID(), models.EventNewSensitiveColumns
+	event.PreviousScanID, event.NewlySensitive = previous, d.NewlySensitive
+	s.notifier.Notify(event)
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
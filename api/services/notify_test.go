@@ -0,0 +1,137 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/llm"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type recordingNotifier struct{ events []models.WebhookEvent }
+
+func (n *recordingNotifier) Notify(e models.WebhookEvent) { n.events = append(n.events, e) }
+
+func expectUsersTable(mock sqlmock.Sqlmock, column string) {
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "UPDATE_TIME", "CREATE_TIME"}).
+			AddRow("shop", "users", nil, "2025-01-01 00:00:00"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).
+			AddRow(column, "varchar", "", "varchar(50)"))
+}
+
+func TestExecuteScan_NotifiesSuccessAndNewSensitiveColumns(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectUsersTable(mock, "email")
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule{{ID: 1, TypeName: "EMAIL_ADDRESS", Regex: "(?i)mail"}}, nil)
+	scanRepo.On("CreateHistory", tenant, int64(3), "v1").Return(int64(8), nil)
+	scanRepo.On("SaveResult", int64(8), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(8), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(8), 1, 0).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(8), "success").Return(nil)
+	scanRepo.On("GetResultsByScanID", tenant, int64(8)).Return([]models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "email", InfoType: "EMAIL_ADDRESS"},
+	}, nil)
+	scanRepo.On("GetProfilesByScanID", tenant, int64(8)).Return([]models.ColumnProfile{}, nil)
+	scanRepo.On("GetLastSuccessfulScanID", tenant, int64(3), int64(8), "v1").Return(int64(5), nil)
+	scanRepo.On("GetHistory", tenant, testifyMock.Anything).Return(models.ScanHistory{}, nil)
+	scanRepo.On("GetResultsByScanID", tenant, int64(5)).Return([]models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "email", InfoType: "N/A"},
+	}, nil)
+	notifier := &recordingNotifier{}
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithNotifier(notifier))
+
+	_, err := svc.ExecuteScan(tenant, 3, db, models.ScanOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, notifier.events, 2)
+	done, found := notifier.events[0], notifier.events[1]
+	assert.Equal(t, models.EventScanSucceeded, done.Event)
+	assert.Equal(t, int64(8), done.ScanID)
+	assert.Equal(t, "email", done.Results.Database[0].SchemaTables[0].Columns[0].ColumnName)
+	assert.Equal(t, models.EventNewSensitiveColumns, found.Event)
+	assert.Equal(t, int64(5), found.PreviousScanID)
+	assert.Equal(t, "EMAIL_ADDRESS", found.NewlySensitive[0].ToInfoType)
+	assert.NotEqual(t, done.ID, found.ID)
+}
+
+func TestExecuteScan_NotifiesFailure(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule{}, errors.New("rules unavailable"))
+	scanRepo.On("CreateHistory", tenant, int64(3), "v1").Return(int64(9), nil)
+	scanRepo.On("UpdateHistoryStatus", int64(9), "failed").Return(nil)
+	scanRepo.On("GetResultsByScanID", tenant, int64(9)).Return([]models.ScanResult{}, nil)
+	scanRepo.On("GetProfilesByScanID", tenant, int64(9)).Return([]models.ColumnProfile{}, nil)
+	notifier := &recordingNotifier{}
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithNotifier(notifier))
+
+	_, err := svc.ExecuteScan(tenant, 3, db, models.ScanOptions{})
+	require.Error(t, err)
+
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, models.EventScanFailed, notifier.events[0].Event)
+	assert.Equal(t, "failed", notifier.events[0].Status)
+	assert.Equal(t, "rules unavailable", notifier.events[0].Error)
+	scanRepo.AssertNotCalled(t, "GetLastSuccessfulScanID", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything, testifyMock.Anything)
+}
+
+func TestCancelScan_FinishesAsCancelledAndNotifies(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectV2Table(mock, "shop", "customers", []v2Column{
+		{name: "email", dataType: "varchar", samples: []string{"ana@example.com"}},
+	})
+
+	// the LLM call only returns when the scan context is cancelled
+	fake := llm.NewFakeClient("fake").Default(llm.FakeResponse{Label: "EMAIL_ADDRESS", Delay: time.Minute})
+	scanRepo, ruleRepo := newV2Repos()
+	scanRepo.On("GetHistory", tenant, int64(7)).Return(models.ScanHistory{ID: 7, Status: "running"}, nil)
+	scanRepo.On("GetHistory", tenant+1, int64(7)).Return(models.ScanHistory{}, sql.ErrNoRows)
+	scanRepo.On("GetResultsByScanID", tenant, int64(7)).Return([]models.ScanResult{}, nil)
+	scanRepo.On("GetProfilesByScanID", tenant, int64(7)).Return([]models.ColumnProfile{}, nil)
+	notifier := &recordingNotifier{}
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithLLMClient(fake), services.WithNotifier(notifier))
+
+	assert.ErrorIs(t, svc.CancelScan(tenant, 7), services.ErrScanNotRunning)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := svc.ExecuteScanV2(tenant, 1, db, models.ScanOptions{})
+		result <- err
+	}()
+	require.Eventually(t, func() bool { return len(fake.Calls()) == 1 }, 5*time.Second, time.Millisecond)
+
+	// another tenant cannot see, let alone cancel, the scan
+	assert.ErrorIs(t, svc.CancelScan(tenant+1, 7), sql.ErrNoRows)
+	require.NoError(t, svc.CancelScan(tenant, 7))
+
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan did not stop after being cancelled")
+	}
+	scanRepo.AssertCalled(t, "UpdateHistoryStatus", int64(7), "cancelled")
+	scanRepo.AssertNotCalled(t, "SaveResult", int64(7), testifyMock.Anything)
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, models.EventScanCancelled, notifier.events[0].Event)
+	assert.Equal(t, "cancelled", notifier.events[0].Status)
+	// once finished the scan is no longer running
+	assert.ErrorIs(t, svc.CancelScan(tenant, 7), services.ErrScanNotRunning)
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"meli-challenge/api/repositories"
+	"meli-challenge/config"
+)
+
+// ErrQuotaExceeded is matched (errors.Is) by the QuotaError of a scan refused by a quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError reports which scan quota refused a scan and when it is worth retrying.
+type QuotaError struct {
+	Quota      string
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: %s (limit %d)", ErrQuotaExceeded, e.Quota, e.Limit)
+}
+
+func (e *QuotaError) Unwrap() error { return ErrQuotaExceeded }
+
+// ScanQuotas limits the scans a tenant can start. A zero limit means unlimited.
+type ScanQuotas struct {
+	// PerDatabase and PerTenant cap the scans running at the same time
+	PerDatabase int
+	PerTenant   int
+	// LLMScansPerDay caps the v2 scans a tenant starts per UTC day
+	LLMScansPerDay int
+	// StaleAfter is when a scan still marked running no longer counts (e.g. the API crashed)
+	StaleAfter time.Duration
+	// RetryAfter is suggested to callers refused by a concurrency quota
+	RetryAfter time.Duration
+}
+
+// ScanQuotasFromEnv reads SCAN_MAX_CONCURRENT_PER_DATABASE (1), SCAN_MAX_CONCURRENT_PER_TENANT (5),
+// LLM_SCANS_PER_DAY (0, unlimited), SCAN_STALE_HOURS (12) and SCAN_QUOTA_RETRY_AFTER_SEC (30).
+func ScanQuotasFromEnv() ScanQuotas {
+	return ScanQuotas{
+		PerDatabase:    config.EnvInt("SCAN_MAX_CONCURRENT_PER_DATABASE", 1, 0),
+		PerTenant:      config.EnvInt("SCAN_MAX_CONCURRENT_PER_TENANT", 5, 0),
+		LLMScansPerDay: config.EnvInt("LLM_SCANS_PER_DAY", 0, 0),
+		StaleAfter:     time.Duration(config.EnvInt("SCAN_STALE_HOURS", 12, 1)) * time.Hour,
+		RetryAfter:     time.Duration(config.EnvInt("SCAN_QUOTA_RETRY_AFTER_SEC", 30, 1)) * time.Second,
+	}
+}
+
+// WithQuotas refuses scans beyond q with a *QuotaError. Without it scans are not limited.
+func WithQuotas(q ScanQuotas) ScanOption {
+	return func(s *scanService) { s.quotas = q }
+}
+
+// enabled reports whether any quota applies to scans of apiVersion
+func (q ScanQuotas) enabled(apiVersion string) bool {
+	return q.PerDatabase > 0 || q.PerTenant > 0 || (apiVersion == "v2" && q.LLMScansPerDay > 0)
+}
+
+// StartScan records a running scan once the tenant's quotas allow it. The repository runs the
+// check and the insert in one transaction that locks the database and tenant rows, so
+// concurrent requests, on this or another replica, cannot both take the last slot.
+func (s *scanService) StartScan(tenantID, databaseID int64, apiVersion string) (int64, error) {
+	if !s.quotas.enabled(apiVersion) {
+		return s.repoScan.CreateHistory(tenantID, databaseID, apiVersion, nil)
+	}
+	return s.repoScan.CreateHistory(tenantID, databaseID, apiVersion, func(counter repositories.ScanCounter) error {
+		return s.checkQuotas(counter, tenantID, databaseID, apiVersion)
+	})
+}
+
+func (s *scanService) checkQuotas(counter repositories.ScanCounter, tenantID, databaseID int64, apiVersion string) error {
+	q, now := s.quotas, s.now().UTC()
+	running := []struct {
+		name       string
+		databaseID int64
+		limit      int
+	}{
+		{"concurrent scans per database", databaseID, q.PerDatabase},
+		{"concurrent scans per tenant", 0, q.PerTenant},
+	}
+	for _, r := range running {
+		if r.limit <= 0 {
+			continue
+		}
+		n, err := counter.CountRunning(tenantID, r.databaseID, now.Add(-q.StaleAfter))
+		if err != nil {
+			return err
+		}
+		if n >= r.limit {
+			return &QuotaError{Quota: r.name, Limit: r.limit, RetryAfter: q.RetryAfter}
+		}
+	}
+
+	if apiVersion == "v2" && q.LLMScansPerDay > 0 {
+		day := now.Truncate(24 * time.Hour)
+		n, err := counter.CountStarted(tenantID, apiVersion, day)
+		if err != nil {
+			return err
+		}
+		if n >= q.LLMScansPerDay {
+			return &QuotaError{Quota: "LLM scans per day", Limit: q.LLMScansPerDay, RetryAfter: day.Add(24 * time.Hour).Sub(now)}
+		}
+	}
+	return nil
+}
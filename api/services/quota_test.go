@@ -0,0 +1,61 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+var quotas = services.ScanQuotas{PerDatabase: 1, PerTenant: 3, LLMScansPerDay: 5, StaleAfter: 12 * time.Hour, RetryAfter: 30 * time.Second}
+
+func TestExecuteScan_RefusedByConcurrencyQuotas(t *testing.T) {
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithQuotas(quotas))
+	recent := testifyMock.MatchedBy(func(since time.Time) bool {
+		return time.Since(since) > 11*time.Hour && time.Since(since) < 13*time.Hour
+	})
+
+	// another scan of the same database is still running
+	scanRepo.On("CountRunning", tenant, int64(1), recent).Return(1, nil)
+	_, err := svc.ExecuteScan(tenant, 1, nil, models.ScanOptions{})
+	var quota *services.QuotaError
+	require.True(t, errors.As(err, &quota))
+	assert.ErrorIs(t, err, services.ErrQuotaExceeded)
+	assert.Equal(t, "concurrent scans per database", quota.Quota)
+	assert.Equal(t, 30*time.Second, quota.RetryAfter)
+
+	// the tenant already runs as many scans as allowed, on other databases
+	scanRepo.On("CountRunning", tenant, int64(2), recent).Return(0, nil)
+	scanRepo.On("CountRunning", tenant, int64(0), recent).Return(3, nil)
+	_, err = svc.ExecuteScanV2(tenant, 2, nil, models.ScanOptions{})
+	require.True(t, errors.As(err, &quota))
+	assert.Equal(t, "concurrent scans per tenant", quota.Quota)
+
+	scanRepo.AssertNotCalled(t, "CreateHistory", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything)
+}
+
+func TestExecuteScanV2_RefusedByDailyLLMQuota(t *testing.T) {
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithQuotas(quotas))
+	scanRepo.On("CountRunning", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything).Return(0, nil)
+	midnight := testifyMock.MatchedBy(func(since time.Time) bool {
+		return since.Equal(time.Now().UTC().Truncate(24 * time.Hour))
+	})
+	scanRepo.On("CountStarted", tenant, "v2", midnight).Return(5, nil)
+
+	_, err := svc.ExecuteScanV2(tenant, 1, nil, models.ScanOptions{})
+	var quota *services.QuotaError
+	require.True(t, errors.As(err, &quota))
+	assert.Equal(t, "LLM scans per day", quota.Quota)
+	assert.Equal(t, 5, quota.Limit)
+	nextDay := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	assert.WithinDuration(t, nextDay, time.Now().Add(quota.RetryAfter), time.Second, "retry when the UTC day ends")
+	scanRepo.AssertNotCalled(t, "CreateHistory", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything)
+}
@@ -1,13 +1,31 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"meli-challenge/api/models"
 	"meli-challenge/api/repositories"
 )
 
+// ErrInvalidRule wraps validation errors of rules and rule packs created through the API.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// RuleService manages classification rules. Scans of a tenant use its effective rules: the
+// rules of the packs it subscribes to, overridden by its own rules (see EffectiveRules).
 type RuleService interface {
-	GetAllRules() ([]models.ClassificationRule, error)
-	CreateRule(rule models.ClassificationRule) (int64, error)
+	// GetAllRules returns the effective rules of a tenant
+	GetAllRules(tenantID int64) ([]models.ClassificationRule, error)
+	// CreateRule stores a rule of the tenant. Rules with the type name of inherited ones
+	// override them, and a disabled one removes that type for the tenant.
+	CreateRule(tenantID int64, rule models.ClassificationRule) (int64, error)
+	// CreatePack stores a global rule pack with its initial rules
+	CreatePack(pack models.RulePack) (int64, error)
+	GetPack(id int64) (models.RulePack, error)
+	ListPacks() ([]models.RulePack, error)
+	// CreatePackRule adds a rule to a global pack, for every tenant that subscribes to it
+	CreatePackRule(packID int64, rule models.ClassificationRule) (int64, error)
 }
 
 type ruleService struct {
@@ -15,13 +33,94 @@ type ruleService struct {
 }
 
 func NewRuleService(repo repositories.RuleRepository) RuleService {
-	return &ruleService{repo}
+	return &ruleService{repo: repo}
+}
+
+func (s *ruleService) GetAllRules(tenantID int64) ([]models.ClassificationRule, error) {
+	rules, err := s.repo.GetAllRules(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return EffectiveRules(rules), nil
+}
+
+func (s *ruleService) CreateRule(tenantID int64, rule models.ClassificationRule) (int64, error) {
+	rule.TenantID, rule.PackID = &tenantID, nil
+	return s.create(rule)
+}
+
+func (s *ruleService) CreatePack(pack models.RulePack) (int64, error) {
+	pack.Name = strings.TrimSpace(pack.Name)
+	if pack.Name == "" || len(pack.Name) > 100 {
+		return 0, fmt.Errorf("%w: pack name is required and must have at most 100 characters", ErrInvalidRule)
+	}
+	if len(pack.Description) > 255 {
+		return 0, fmt.Errorf("%w: pack description must have at most 255 characters", ErrInvalidRule)
+	}
+	for i, rule := range pack.Rules {
+		if err := validateRule(rule); err != nil {
+			return 0, err
+		}
+		pack.Rules[i].TenantID, pack.Rules[i].Disabled = nil, false
+	}
+	return s.repo.CreatePack(pack)
 }
 
-func (s *ruleService) GetAllRules() ([]models.ClassificationRule, error) {
-	return s.repo.GetAllRules()
+func (s *ruleService) GetPack(id int64) (models.RulePack, error) {
+	return s.repo.GetPack(id)
 }
 
-func (s *ruleService) CreateRule(rule models.ClassificationRule) (int64, error) {
+func (s *ruleService) ListPacks() ([]models.RulePack, error) {
+	return s.repo.ListPacks()
+}
+
+func (s *ruleService) CreatePackRule(packID int64, rule models.ClassificationRule) (int64, error) {
+	if _, err := s.repo.GetPack(packID); err != nil {
+		return 0, err
+	}
+	// pack rules are the baseline; switching a type off is up to each tenant
+	rule.PackID, rule.TenantID, rule.Disabled = &packID, nil, false
+	return s.create(rule)
+}
+
+// create stores a rule. Cached LLM answers need no invalidation: their key includes the
+// categories the rules define (see llm.CacheKey).
+func (s *ruleService) create(rule models.ClassificationRule) (int64, error) {
+	if err := validateRule(rule); err != nil {
+		return 0, err
+	}
 	return s.repo.CreateRule(rule)
 }
+
+func validateRule(rule models.ClassificationRule) error {
+	if strings.TrimSpace(rule.TypeName) == "" || len(rule.TypeName) > 50 {
+		return fmt.Errorf("%w: type_name is required and must have at most 50 characters", ErrInvalidRule)
+	}
+	if len(rule.Regex) > 255 {
+		return fmt.Errorf("%w: regex must have at most 255 characters", ErrInvalidRule)
+	}
+	return nil
+}
+
+// EffectiveRules merges the rules of a tenant, as returned by RuleRepository.GetAllRules: the
+// tenant's rules of a type name replace the pack rules of that type, and a disabled tenant rule
+// removes the type altogether.
+func EffectiveRules(rules []models.ClassificationRule) []models.ClassificationRule {
+	// type name -> whether the tenant disabled it
+	own := map[string]bool{}
+	for _, r := range rules {
+		if r.TenantID != nil {
+			typ := strings.ToUpper(r.TypeName)
+			own[typ] = own[typ] || r.Disabled
+		}
+	}
+	effective := []models.ClassificationRule{}
+	for _, r := range rules {
+		disabled, overridden := own[strings.ToUpper(r.TypeName)]
+		if (r.TenantID == nil && overridden) || disabled {
+			continue
+		}
+		effective = append(effective, r)
+	}
+	return effective
+}
@@ -3,151 +3,303 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"meli-challenge/api/classifiers"
+	"meli-challenge/api/diff"
+	"meli-challenge/api/events"
 	llm "meli-challenge/api/llm"
 	"meli-challenge/api/models"
+	"meli-challenge/api/profiling"
 	"meli-challenge/api/repositories"
+	"meli-challenge/api/sampling"
+	"meli-challenge/config"
+	"meli-challenge/internal/textutil"
 	"meli-challenge/logger"
 )
 
 type ScanService interface {
-	// ExecuteScan scans all non-system schemas on the provided server instance
-	ExecuteScan(databaseID int64, externalDB *sql.DB) (int64, error)
-	// ExecuteScanV2 scans columns + samples data rows using LLM
-	ExecuteScanV2(databaseID int64, externalDB *sql.DB) (int64, error)
+	// StartScan records a running "v1" or "v2" scan of a registered database of the tenant, or
+	// fails with a *QuotaError when it would exceed the quotas set with WithQuotas. Callers
+	// check it before connecting to the target, then hand the scan to RunScan.
+	StartScan(tenantID, databaseID int64, apiVersion string) (int64, error)
+	// RunScan runs a scan created by StartScan on the provided server instance and records
+	// its outcome
+	RunScan(tenantID, databaseID, scanID int64, apiVersion string, externalDB *sql.DB, opts models.ScanOptions) error
+	// ExecuteScan starts and runs a v1 scan: all non-system schemas on the provided server
+	// instance, a registered database of the tenant, with the tenant's effective rules
+	ExecuteScan(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error)
+	// ExecuteScanV2 starts and runs a v2 scan: columns + samples data rows using LLM
+	ExecuteScanV2(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error)
 	// Update scan history status
 	UpdateScanStatus(scanID int64, status string) error
 	// GetScanResults returns a nested structure grouped by schema -> table -> columns
-	GetScanResults(scanID int64) (models.DatabaseResult, error)
+	GetScanResults(tenantID, scanID int64) (models.DatabaseResult, error)
+	// GetScanStatus returns the scan history record (status and counters)
+	GetScanStatus(tenantID, scanID int64) (models.ScanHistory, error)
+	// DiffScans compares the results of two scans (sql.ErrNoRows if either does not exist)
+	DiffScans(tenantID, fromScanID, toScanID int64) (models.ScanDiff, error)
+	// SubscribeEvents streams the progress of a scan run by this process
+	SubscribeEvents(scanID int64) *events.Subscription
+	// CancelScan stops a running scan of the tenant run by this process (sql.ErrNoRows if the
+	// scan does not exist, ErrScanNotRunning if it is not running here). The scan then finishes
+	// as "cancelled".
+	CancelScan(tenantID, scanID int64) error
 }
 
+// ErrScanNotRunning is returned when cancelling a scan that is not running in this process.
+var ErrScanNotRunning = errors.New("scan is not running")
+
 type scanService struct {
-	repoScan repositories.ScanRepository
-	repoRule repositories.RuleRepository
+	repoScan  repositories.ScanRepository
+	repoRule  repositories.RuleRepository
+	repoCache repositories.LLMCacheRepository
+	llmClient llm.LLMClient
+	notifier  ScanNotifier
+	bus       *events.Bus
+	quotas    ScanQuotas
+	now       func() time.Time
+
+	// running holds the cancel function of each scan run by this process
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc
+}
+
+// ScanOption customises optional collaborators of the scan service.
+type ScanOption func(*scanService)
+
+// WithLLMClient makes v2 scans use client instead of building one from the environment.
+func WithLLMClient(client llm.LLMClient) ScanOption {
+	return func(s *scanService) { s.llmClient = client }
+}
+
+// WithEventBus publishes scan progress to bus instead of a bus owned by the service.
+func WithEventBus(bus *events.Bus) ScanOption {
+	return func(s *scanService) { s.bus = bus }
+}
+
+func NewScanService(repoScan repositories.ScanRepository, repoRule repositories.RuleRepository, repoCache repositories.LLMCacheRepository, opts ...ScanOption) ScanService {
+	s := &scanService{repoScan: repoScan, repoRule: repoRule, repoCache: repoCache, bus: events.NewBus(), now: time.Now,
+		running: make(map[int64]context.CancelFunc)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *scanService) GetScanStatus(tenantID, scanID int64) (models.ScanHistory, error) {
+	return s.repoScan.GetHistory(tenantID, scanID)
+}
+
+func (s *scanService) DiffScans(tenantID, fromScanID, toScanID int64) (models.ScanDiff, error) {
+	var results [2][]models.ScanResult
+	for i, id := range []int64{fromScanID, toScanID} {
+		if _, err := s.repoScan.GetHistory(tenantID, id); err != nil {
+			return models.ScanDiff{}, err
+		}
+		r, err := s.repoScan.GetResultsByScanID(tenantID, id)
+		if err != nil {
+			return models.ScanDiff{}, err
+		}
+		results[i] = r
+	}
+	return diff.Compare(fromScanID, results[0], toScanID, results[1]), nil
+}
+
+func (s *scanService) SubscribeEvents(scanID int64) *events.Subscription {
+	return s.bus.Subscribe(scanID)
+}
+
+func (s *scanService) CancelScan(tenantID, scanID int64) error {
+	if _, err := s.repoScan.GetHistory(tenantID, scanID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	cancel, ok := s.running[scanID]
+	s.mu.Unlock()
+	if !ok {
+		return ErrScanNotRunning
+	}
+	cancel()
+	return nil
+}
+
+// begin registers a cancellable context for a scan run by this process. The returned function
+// unregisters it and must be called once the scan has finished.
+func (s *scanService) begin(scanID int64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[scanID] = cancel
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.running, scanID)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelled reports a failure of a cancelled scan as the cancellation, since queries and LLM
+// calls interrupted by it fail with driver or provider errors of their own.
+func cancelled(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
 
-func NewScanService(repoScan repositories.ScanRepository, repoRule repositories.RuleRepository) ScanService {
-	return &scanService{repoScan: repoScan, repoRule: repoRule}
+// tenantRules returns the effective classification rules of a tenant
+func (s *scanService) tenantRules(tenantID int64) ([]models.ClassificationRule, error) {
+	rules, err := s.repoRule.GetAllRules(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return EffectiveRules(rules), nil
 }
 
 func (s *scanService) UpdateScanStatus(scanID int64, status string) error {
 	return s.repoScan.UpdateHistoryStatus(scanID, status)
 }
 
-func (s *scanService) ExecuteScan(databaseID int64, externalDB *sql.DB) (scanID int64, err error) {
-	// Create history record (status = running)
-	scanID, err = s.repoScan.CreateHistory(databaseID)
+func (s *scanService) ExecuteScan(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error) {
+	scanID, err := s.StartScan(tenantID, databaseID, "v1")
 	if err != nil {
 		return 0, err
 	}
+	return scanID, s.runV1(tenantID, databaseID, scanID, externalDB, opts)
+}
 
-	// Ensure history status is updated to 'success' or 'failed'
+func (s *scanService) ExecuteScanV2(tenantID, databaseID int64, externalDB *sql.DB, opts models.ScanOptions) (int64, error) {
+	scanID, err := s.StartScan(tenantID, databaseID, "v2")
+	if err != nil {
+		return 0, err
+	}
+	return scanID, s.runV2(tenantID, databaseID, scanID, externalDB, opts)
+}
+
+func (s *scanService) RunScan(tenantID, databaseID, scanID int64, apiVersion string, externalDB *sql.DB, opts models.ScanOptions) error {
+	if apiVersion == "v2" {
+		return s.runV2(tenantID, databaseID, scanID, externalDB, opts)
+	}
+	return s.runV1(tenantID, databaseID, scanID, externalDB, opts)
+}
+
+func (s *scanService) runV1(tenantID, databaseID, scanID int64, externalDB *sql.DB, opts models.ScanOptions) (err error) {
+	ctx, done := s.begin(scanID)
+	defer done()
+	s.publishStarted(databaseID, scanID, "v1")
+
+	// Ensure history status is updated to 'success', 'failed' or 'cancelled'
 	defer func() {
-		if err != nil {
-			_ = s.repoScan.UpdateHistoryStatus(scanID, "failed")
-			return
-		}
-		_ = s.repoScan.UpdateHistoryStatus(scanID, "success")
+		err = cancelled(ctx, err)
+		status := scanStatus(err)
+		_ = s.repoScan.UpdateHistoryStatus(scanID, status)
+		s.publishFinished(scanID, status, err)
+		s.notifyFinished(tenantID, databaseID, scanID, "v1", status, err)
 	}()
 
 	// Load classification rules
-	rules, err := s.repoRule.GetAllRules()
+	rules, err := s.tenantRules(tenantID)
 	if err != nil {
-		return scanID, err
+		return err
 	}
 
 	// Build dynamic classifiers from rules
 	classifiersList, err := classifiers.BuildClassifiers(rules)
 	if err != nil {
-		return scanID, err
+		return err
 	}
 
+	// Query limits (MAX_EXECUTION_TIME) also apply to optional profiling queries
+	samplingCfg := sampling.WithDefaults(opts.Sampling)
+
 	// Determine tables to scan: scan all non-system schemas
-	tablesRows, err := externalDB.Query(`
-		SELECT TABLE_SCHEMA, TABLE_NAME
-		FROM information_schema.tables
-		WHERE TABLE_TYPE='BASE TABLE'
-		  AND TABLE_SCHEMA NOT IN ('mysql','sys','information_schema','performance_schema')
-	`)
+	tables, err := listTables(ctx, externalDB)
 	if err != nil {
-		return scanID, err
+		return err
 	}
-	defer tablesRows.Close()
-
-	for tablesRows.Next() {
-		var schemaName, tableName string
-		if err := tablesRows.Scan(&schemaName, &tableName); err != nil {
-			return scanID, err
-		}
-		// log scanning progress
-		// ...existing code...
-
-		// Use package logger for structured logs
-		// ...existing code...
 
-		// log scanning progress
-		// logger is imported at top
+	// Incremental scans copy forward tables whose structure and rules are unchanged
+	base := s.loadIncrementalBase(tenantID, databaseID, scanID, "v1", opts)
+	version := rulesVersion("v1", rules, "")
+	var scanned, reused int
 
-		logger.Infof("Scanning: %s.%s", schemaName, tableName)
-
-		// Get columns for the specific schema.table
-		cols, err := externalDB.Query(`
-			SELECT COLUMN_NAME
-			FROM information_schema.columns
-			WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
-			ORDER BY ORDINAL_POSITION
-		`, schemaName, tableName)
+	for _, t := range tables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		columns, err := listColumns(ctx, externalDB, t.Schema, t.Name)
 		if err != nil {
-			return scanID, err
+			return err
+		}
+		fp := models.TableFingerprint{SchemaName: t.Schema, TableName: t.Name, Fingerprint: tableFingerprint(t, columns), RulesVersion: version}
+		if s.reuseTable(base, scanID, fp) {
+			logger.Infof("Unchanged, reusing results: %s.%s", t.Schema, t.Name)
+			s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventTableReused, Schema: t.Schema, Table: t.Name})
+			reused++
+			s.recordTable(scanID, fp)
+			continue
 		}
 
-		for cols.Next() {
-			var columnName string
-			if err := cols.Scan(&columnName); err != nil {
-				cols.Close()
-				return scanID, err
-			}
+		logger.Infof("Scanning: %s.%s", t.Schema, t.Name)
+		s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventTableStarted, Schema: t.Schema, Table: t.Name})
+		scanned++
 
+		for _, c := range columns {
 			// Classify column name using dynamic regex-based classifiers
 			infoType := "N/A"
-			for _, c := range classifiersList {
-				if c.Match(columnName) {
-					infoType = c.InfoType()
+			for _, cl := range classifiersList {
+				if cl.Match(c.Name) {
+					infoType = cl.InfoType()
 					break
 				}
 			}
 
 			// Persist result including schema_name
 			result := models.ScanResult{
-				SchemaName: schemaName,
-				TableName:  tableName,
-				ColumnName: columnName,
-				InfoType:   infoType,
+				SchemaName:   t.Schema,
+				TableName:    t.Name,
+				ColumnName:   c.Name,
+				InfoType:     infoType,
+				RulesVersion: version,
 			}
 			if err := s.repoScan.SaveResult(scanID, result); err != nil {
-				cols.Close()
-				return scanID, err
+				return err
+			}
+			s.publishColumn(scanID, result)
+
+			if opts.Profile {
+				s.profileColumn(ctx, scanID, externalDB, t.Schema, t.Name, c.Name, samplingCfg)
 			}
 		}
-		cols.Close()
+		s.recordTable(scanID, fp)
 	}
+	s.recordTableStats(scanID, scanned, reused)
 
-	return scanID, nil
+	return nil
 }
 
-func (s *scanService) GetScanResults(scanID int64) (models.DatabaseResult, error) {
-	results, err := s.repoScan.GetResultsByScanID(scanID)
+func (s *scanService) GetScanResults(tenantID, scanID int64) (models.DatabaseResult, error) {
+	results, err := s.repoScan.GetResultsByScanID(tenantID, scanID)
 	if err != nil {
 		return models.DatabaseResult{}, err
 	}
 
+	// Attach column profiles when the scan ran with profiling enabled
+	profileList, err := s.repoScan.GetProfilesByScanID(tenantID, scanID)
+	if err != nil {
+		return models.DatabaseResult{}, err
+	}
+	profiles := make(map[string]*models.ColumnProfile, len(profileList))
+	for i := range profileList {
+		p := &profileList[i]
+		profiles[p.SchemaName+"."+p.TableName+"."+p.ColumnName] = p
+	}
+
 	// Build nested structure: schema -> table -> columns
 	schemaMap := make(map[string]map[string][]models.ColumnView)
 
@@ -160,8 +312,10 @@ func (s *scanService) GetScanResults(scanID int64) (models.DatabaseResult, error
 			schemaMap[schema] = make(map[string][]models.ColumnView)
 		}
 		schemaMap[schema][r.TableName] = append(schemaMap[schema][r.TableName], models.ColumnView{
-			ColumnName: r.ColumnName,
-			InfoType:   r.InfoType,
+			ColumnName:         r.ColumnName,
+			InfoType:           r.InfoType,
+			InjectionSuspected: r.InjectionSuspected,
+			Profile:            profiles[r.SchemaName+"."+r.TableName+"."+r.ColumnName],
 		})
 	}
 
@@ -183,66 +337,76 @@ func (s *scanService) GetScanResults(scanID int64) (models.DatabaseResult, error
 	return dbResult, nil
 }
 
-func (s *scanService) ExecuteScanV2(databaseID int64, externalDB *sql.DB) (scanID int64, err error) {
-	// Create history record (status = running)
-	scanID, err = s.repoScan.CreateHistory(databaseID)
-	if err != nil {
-		return 0, err
-	}
+func (s *scanService) runV2(tenantID, databaseID, scanID int64, externalDB *sql.DB, opts models.ScanOptions) (err error) {
+	ctx, done := s.begin(scanID)
+	defer done()
+	s.publishStarted(databaseID, scanID, "v2")
 
 	// Ensure history status is updated
 	defer func() {
-		if err != nil {
-			_ = s.repoScan.UpdateHistoryStatus(scanID, "failed")
-			return
-		}
-		_ = s.repoScan.UpdateHistoryStatus(scanID, "success")
+		err = cancelled(ctx, err)
+		status := scanStatus(err)
+		_ = s.repoScan.UpdateHistoryStatus(scanID, status)
+		s.publishFinished(scanID, status, err)
+		s.notifyFinished(tenantID, databaseID, scanID, "v2", status, err)
 	}()
 
 	// Load classification rules (valid categories)
-	rules, err := s.repoRule.GetAllRules()
+	rules, err := s.tenantRules(tenantID)
 	if err != nil {
-		return scanID, err
+		return err
 	}
 	var categories []string
 	for _, r := range rules {
 		categories = append(categories, r.TypeName)
 	}
 
-	// Init OpenAI client once
-	llmClient := llm.NewOpenAIClient()
+	// The injected client is shared by every scan; tools that do not inject one build it from env
+	llmClient := s.llmClient
+	if llmClient == nil {
+		if llmClient, err = llm.NewLLMClientFromEnv(); err != nil {
+			return err
+		}
+	}
 
 	// Configurable concurrency/timeout/rate limiting for LLM calls
-	maxConc := 4
-	if v := os.Getenv("LLM_CONCURRENCY"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			maxConc = n
+	maxConc := config.EnvInt("LLM_CONCURRENCY", 4, 1)
+	ratePerSec := config.EnvInt("LLM_RATE_PER_SEC", 0, 0)
+
+	// LLM response cache: 0 disables it
+	cacheTTL := time.Duration(config.EnvInt("LLM_CACHE_TTL_HOURS", 168, 0)) * time.Hour
+	useCache := s.repoCache != nil && cacheTTL > 0
+	if useCache {
+		if err := s.repoCache.DeleteExpired(); err != nil {
+			logger.Warnf("LLM cache cleanup failed: %v", err)
 		}
 	}
-	timeoutMs := 8000
-	if v := os.Getenv("LLM_TIMEOUT_MS"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			timeoutMs = n
-		}
+	var cacheHits, cacheMisses int64
+
+	// Token/cost accounting with an optional per-scan budget in USD (0 = unlimited)
+	prices, budget := llm.LoadPriceTable(), config.EnvFloat("LLM_BUDGET_USD", 0)
+	if budget > 0 && !prices.Has(llmClient.Model()) {
+		return fmt.Errorf("%w: %s (set its price in LLM_PRICE_TABLE)", ErrUnpricedModel, llmClient.Model())
 	}
-	ratePerSec := 0
-	if v := os.Getenv("LLM_RATE_PER_SEC"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-			ratePerSec = n
-		}
+	usage := newLLMUsageTracker(llmClient.Model(), prices, budget)
+
+	// Sampling strategy and per-query limits for this target
+	samplingCfg := sampling.WithDefaults(opts.Sampling)
+	sampler, err := sampling.New(samplingCfg.Strategy)
+	if err != nil {
+		return err
 	}
 
 	// Determine tables to scan
-	tablesRows, err := externalDB.Query(`
-		SELECT TABLE_SCHEMA, TABLE_NAME
-		FROM information_schema.tables
-		WHERE TABLE_TYPE='BASE TABLE'
-		  AND TABLE_SCHEMA NOT IN ('mysql','sys','information_schema','performance_schema')
-	`)
+	tables, err := listTables(ctx, externalDB)
 	if err != nil {
-		return scanID, err
+		return err
 	}
-	defer tablesRows.Close()
+
+	// Incremental scans copy forward tables whose structure, rules and model are unchanged
+	base := s.loadIncrementalBase(tenantID, databaseID, scanID, "v2", opts)
+	version := rulesVersion("v2", rules, llmClient.Model())
+	var scanned, reused int
 
 	// We'll classify columns concurrently using a semaphore to limit parallel LLM calls.
 	sem := make(chan struct{}, maxConc)
@@ -256,60 +420,58 @@ func (s *scanService) ExecuteScanV2(databaseID int64, externalDB *sql.DB) (scanI
 
 	// Gather columns to process so we can run them concurrently and then persist results.
 	type colWork struct {
-		schema  string
-		table   string
-		column  string
-		samples []string
+		schema   string
+		table    string
+		column   string
+		dataType string
+		samples  []string
 	}
 	var workItems []colWork
 
-	for tablesRows.Next() {
-		var schemaName, tableName string
-		if err := tablesRows.Scan(&schemaName, &tableName); err != nil {
-			return scanID, err
+	for _, t := range tables {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		logger.Infof("Scanning (v2): %s.%s", schemaName, tableName)
-
-		// Get columns
-		cols, err := externalDB.Query(`
-			SELECT COLUMN_NAME
-			FROM information_schema.columns
-			WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
-			ORDER BY ORDINAL_POSITION
-		`, schemaName, tableName)
+		// Columns carry key info so sampling strategies can use the primary key / timestamps
+		columns, err := listColumns(ctx, externalDB, t.Schema, t.Name)
 		if err != nil {
-			return scanID, err
+			return err
+		}
+		fp := models.TableFingerprint{SchemaName: t.Schema, TableName: t.Name, Fingerprint: tableFingerprint(t, columns), RulesVersion: version}
+		if s.reuseTable(base, scanID, fp) {
+			logger.Infof("Unchanged, reusing results (v2): %s.%s", t.Schema, t.Name)
+			s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventTableReused, Schema: t.Schema, Table: t.Name})
+			reused++
+			s.recordTable(scanID, fp)
+			continue
 		}
 
-		for cols.Next() {
-			var columnName string
-			if err := cols.Scan(&columnName); err != nil {
-				cols.Close()
-				return scanID, err
-			}
+		logger.Infof("Scanning (v2): %s.%s", t.Schema, t.Name)
+		s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventTableStarted, Schema: t.Schema, Table: t.Name})
+		scanned++
 
-			// Sample up to 5 values from the column
-			query := fmt.Sprintf("SELECT DISTINCT `%s` FROM `%s`.`%s` WHERE `%s` IS NOT NULL LIMIT 5", columnName, schemaName, tableName, columnName)
-			sampleRows, err := externalDB.Query(query)
+		table := sampling.NewTable(t.Schema, t.Name, columns)
+		for _, c := range columns {
+			// Sample distinct values from the column with the configured strategy
+			samples, err := sampler.Sample(ctx, externalDB, table, c.Name, samplingCfg)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err != nil {
-				// Some columns may not be selectable (e.g., blob), continue gracefully
-				logger.Warnf("Skipping column %s.%s.%s: %v", schemaName, tableName, columnName, err)
+				// Some columns may not be selectable (e.g., blob) or hit MAX_EXECUTION_TIME, continue gracefully
+				logger.Warnf("Skipping column %s.%s.%s: %v", t.Schema, t.Name, c.Name, err)
 				continue
 			}
 
-			var samples []string
-			for sampleRows.Next() {
-				var val sql.NullString
-				if err := sampleRows.Scan(&val); err == nil && val.Valid {
-					samples = append(samples, val.String)
-				}
-			}
-			sampleRows.Close()
+			workItems = append(workItems, colWork{schema: t.Schema, table: t.Name, column: c.Name, dataType: c.DataType, samples: samples})
 
-			workItems = append(workItems, colWork{schema: schemaName, table: tableName, column: columnName, samples: samples})
+			if opts.Profile {
+				s.profileColumn(ctx, scanID, externalDB, t.Schema, t.Name, c.Name, samplingCfg)
+			}
 		}
-		cols.Close()
+		s.recordTable(scanID, fp)
 	}
+	s.recordTableStats(scanID, scanned, reused)
 
 	// Process work items concurrently
 	var wg sync.WaitGroup
@@ -325,50 +487,171 @@ func (s *scanService) ExecuteScanV2(databaseID int64, externalDB *sql.DB) (scanI
 			// Acquire semaphore slot
 			sem <- struct{}{}
 			defer func() { <-sem }()
+			// Columns still queued when the scan is cancelled are left unclassified
+			if ctx.Err() != nil {
+				return
+			}
+
+			result := models.ScanResult{
+				SchemaName:   wi.schema,
+				TableName:    wi.table,
+				ColumnName:   wi.column,
+				InfoType:     "N/A",
+				RulesVersion: version,
+				// Flag samples that try to steer the model so reviewers can double-check the label
+				InjectionSuspected: llm.DetectInjection(wi.samples),
+			}
+			if result.InjectionSuspected {
+				logger.Warnf("Possible prompt injection in samples of %s.%s.%s", wi.schema, wi.table, wi.column)
+			}
+
+			// Consult the cache before calling the provider
+			var cacheKey string
+			if useCache {
+				cacheKey = llm.CacheKey(wi.column, wi.dataType, classifiers.ShapeFingerprint(wi.samples), categories, llmClient.Model())
+				cached, ok, err := s.repoCache.Get(tenantID, cacheKey)
+				if err != nil {
+					logger.Warnf("LLM cache lookup failed for %s.%s.%s: %v", wi.schema, wi.table, wi.column, err)
+				}
+				if ok {
+					atomic.AddInt64(&cacheHits, 1)
+					result.InfoType = cached
+					s.saveV2Result(scanID, result, &mu, &errs)
+					return
+				}
+				atomic.AddInt64(&cacheMisses, 1)
+			}
+
+			// Stop calling the provider once the budget is spent
+			if !usage.allow() {
+				result.InfoType = models.InfoTypeBudgetExceeded
+				s.saveV2Result(scanID, result, &mu, &errs)
+				return
+			}
 
 			// Rate limit if configured
 			if limiter != nil {
 				select {
 				case <-limiter:
+				case <-ctx.Done():
+					return
 				}
 			}
 
-			// per-call timeout
-			cctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
-			defer cancel()
-
-			sampleText := fmt.Sprintf("Column: %s\nValues: %s", wi.column, strings.Join(wi.samples, ", "))
-			infoType := "N/A"
-			label, err := llmClient.ClassifySample(cctx, sampleText, categories)
+			// Per-attempt timeouts and retries are handled by the client
+			sample := llm.ColumnSample{Column: wi.column, DataType: wi.dataType, Values: wi.samples}
+			started := time.Now()
+			label, callUsage, err := llmClient.ClassifySample(ctx, sample, categories)
+			usage.record(callUsage, time.Since(started))
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				// Only accept answers from the allowed category list
+				label, err = llm.NormalizeLabel(label, categories)
+			}
 			if err != nil {
+				// Keep scanning: the column is stored as unclassified rather than failing the scan
 				logger.Warnf("LLM classify failed for %s.%s.%s: %v", wi.schema, wi.table, wi.column, err)
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			} else if label != "" {
-				infoType = label
+				s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventLLMError, Schema: wi.schema, Table: wi.table, Column: wi.column, Message: err.Error()})
+				usage.recordError()
+				result.InfoType = models.InfoTypeClassificationError
+			} else {
+				result.InfoType = label
+				// Answers from the fallback model are not cached under the primary model's key
+				if useCache && callUsage.Model == llmClient.Model() {
+					if err := s.repoCache.Put(tenantID, cacheKey, llmClient.Model(), label, cacheTTL); err != nil {
+						logger.Warnf("LLM cache store failed for %s.%s.%s: %v", wi.schema, wi.table, wi.column, err)
+					}
+				}
 			}
 
-			result := models.ScanResult{
-				SchemaName: wi.schema,
-				TableName:  wi.table,
-				ColumnName: wi.column,
-				InfoType:   infoType,
-			}
-			if err := s.repoScan.SaveResult(scanID, result); err != nil {
-				logger.Errorf("SaveResult exec failed for scanID=%d: %v", scanID, err)
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			}
+			s.saveV2Result(scanID, result, &mu, &errs)
 		}()
 	}
 	wg.Wait()
 
+	totals := usage.snapshot()
+	logger.Infof("LLM usage for scan_id=%d: calls=%d errors=%d retries=%d prompt_tokens=%d completion_tokens=%d latency_ms=%d cost_usd=%.6f budget_exhausted=%t",
+		scanID, totals.Calls, totals.Errors, totals.Retries, totals.PromptTokens, totals.CompletionTokens, totals.LatencyMs, totals.CostUSD, totals.BudgetExhausted)
+	if err := s.repoScan.UpdateLLMUsage(scanID, totals); err != nil {
+		logger.Warnf("Could not persist LLM usage for scan_id=%d: %v", scanID, err)
+	}
+
+	if useCache {
+		hits, misses := int(atomic.LoadInt64(&cacheHits)), int(atomic.LoadInt64(&cacheMisses))
+		logger.Infof("LLM cache for scan_id=%d: hits=%d misses=%d", scanID, hits, misses)
+		if err := s.repoScan.UpdateCacheStats(scanID, hits, misses); err != nil {
+			logger.Warnf("Could not persist LLM cache stats for scan_id=%d: %v", scanID, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if len(errs) > 0 {
-		// return first error but keep results persisted
-		return scanID, errs[0]
+		// results could not be persisted: return first error but keep what was saved
+		return errs[0]
+	}
+
+	return nil
+}
+
+// saveV2Result persists a single v2 classification, collecting any error under mu.
+func (s *scanService) saveV2Result(scanID int64, result models.ScanResult, mu *sync.Mutex, errs *[]error) {
+	if err := s.repoScan.SaveResult(scanID, result); err != nil {
+		logger.Errorf("SaveResult exec failed for scanID=%d: %v", scanID, err)
+		mu.Lock()
+		*errs = append(*errs, err)
+		mu.Unlock()
+		return
 	}
+	s.publishColumn(scanID, result)
+}
 
-	return scanID, nil
+func (s *scanService) publishStarted(databaseID, scanID int64, version string) {
+	logger.Infof("Scan %s scan_id=%d started for database id=%d", version, scanID, databaseID)
+	s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventStarted, Status: "running", Message: version})
+}
+
+func (s *scanService) publishColumn(scanID int64, result models.ScanResult) {
+	s.bus.Publish(models.ScanEvent{ScanID: scanID, Type: models.ScanEventColumnClassified,
+		Schema: result.SchemaName, Table: result.TableName, Column: result.ColumnName, InfoType: result.InfoType})
+}
+
+func (s *scanService) publishFinished(scanID int64, status string, err error) {
+	e := models.ScanEvent{ScanID: scanID, Type: models.ScanEventFinished, Status: status}
+	if err != nil {
+		e.Message = err.Error()
+	}
+	s.bus.Publish(e)
+}
+
+// profileColumn computes and stores the statistics of a column over at most PROFILE_ROW_LIMIT rows.
+// Profiling is best effort: failures are logged and do not fail the scan.
+func (s *scanService) profileColumn(ctx context.Context, scanID int64, externalDB *sql.DB, schema, table, column string, cfg models.SamplingConfig) {
+	query := fmt.Sprintf("SELECT %s%s FROM %s.%s LIMIT %d",
+		sampling.Hint(cfg), textutil.QuoteIdent(column), textutil.QuoteIdent(schema), textutil.QuoteIdent(table), config.EnvInt("PROFILE_ROW_LIMIT", 10000, 1))
+	rows, err := externalDB.QueryContext(ctx, query)
+	if err != nil {
+		logger.Warnf("Profiling skipped for %s.%s.%s: %v", schema, table, column, err)
+		return
+	}
+	defer rows.Close()
+
+	var values []sql.NullString
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			logger.Warnf("Profiling skipped for %s.%s.%s: %v", schema, table, column, err)
+			return
+		}
+		values = append(values, v)
+	}
+
+	profile := profiling.Compute(values)
+	profile.SchemaName, profile.TableName, profile.ColumnName = schema, table, column
+	if err := s.repoScan.SaveProfile(scanID, profile); err != nil {
+		logger.Warnf("Could not persist profile for %s.%s.%s: %v", schema, table, column, err)
+	}
 }
@@ -0,0 +1,152 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/llm"
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+// expectTwoTables mocks the information_schema queries of a server with users(email) and orders(total).
+func expectTwoTables(mock sqlmock.Sqlmock, ordersType string) {
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "UPDATE_TIME", "CREATE_TIME"}).
+			AddRow("shop", "users", "2025-01-01 00:00:00", "2024-01-01 00:00:00").
+			AddRow("shop", "orders", nil, "2024-01-01 00:00:00"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
+		WithArgs("shop", "users").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).AddRow("email", "varchar", "", "varchar(100)"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
+		WithArgs("shop", "orders").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).AddRow("total", ordersType, "", ordersType))
+}
+
+func savedFingerprints(m *MockScanRepo) []models.TableFingerprint {
+	var out []models.TableFingerprint
+	for _, c := range m.Calls {
+		if c.Method == "SaveTableFingerprint" {
+			out = append(out, c.Arguments.Get(1).(models.TableFingerprint))
+		}
+	}
+	return out
+}
+
+var incrementalRules = []models.ClassificationRule{{ID: 1, TypeName: "EMAIL_ADDRESS", Regex: "(?i)email"}}
+
+// firstScanFingerprints runs a full v1 scan and returns the fingerprints it stored.
+func firstScanFingerprints(t *testing.T) []models.TableFingerprint {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectTwoTables(mock, "decimal")
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return(incrementalRules, nil)
+	scanRepo.On("CreateHistory", tenant, int64(1), "v1").Return(int64(1), nil)
+	scanRepo.On("SaveResult", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(1), 2, 0).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(1), "success").Return(nil)
+
+	_, err := services.NewScanService(scanRepo, ruleRepo, nil).ExecuteScan(tenant, 1, db, models.ScanOptions{})
+	require.NoError(t, err)
+	fps := savedFingerprints(scanRepo)
+	require.Len(t, fps, 2)
+	return fps
+}
+
+func TestExecuteScan_IncrementalReusesUnchangedTables(t *testing.T) {
+	previous := firstScanFingerprints(t)
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	// orders.total changed type since the previous scan
+	expectTwoTables(mock, "varchar")
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return(incrementalRules, nil)
+	scanRepo.On("CreateHistory", tenant, int64(1), "v1").Return(int64(2), nil)
+	scanRepo.On("GetLastSuccessfulScanID", tenant, int64(1), int64(2), "v1").Return(int64(1), nil)
+	scanRepo.On("GetTableFingerprints", int64(1)).Return(previous, nil)
+	scanRepo.On("CopyTableResults", int64(1), int64(2), "shop", "users").Return(int64(1), nil)
+	scanRepo.On("SaveResult", int64(2), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(2), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(2), 1, 1).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(2), "success").Return(nil)
+
+	_, err := services.NewScanService(scanRepo, ruleRepo, nil).ExecuteScan(tenant, 1, db, models.ScanOptions{Incremental: true})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	scanRepo.AssertExpectations(t)
+	// only the changed table is classified again; both tables get a fingerprint for the next run
+	scanRepo.AssertNumberOfCalls(t, "SaveResult", 1)
+	assert.Equal(t, "orders", savedResults(scanRepo)["total"].TableName)
+	assert.Len(t, savedFingerprints(scanRepo), 2)
+}
+
+func TestExecuteScan_IncrementalRescansWhenRulesChange(t *testing.T) {
+	previous := firstScanFingerprints(t)
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectTwoTables(mock, "decimal")
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return(append(incrementalRules, models.ClassificationRule{ID: 2, TypeName: "AMOUNT", Regex: "(?i)total"}), nil)
+	scanRepo.On("CreateHistory", tenant, int64(1), "v1").Return(int64(2), nil)
+	scanRepo.On("GetLastSuccessfulScanID", tenant, int64(1), int64(2), "v1").Return(int64(1), nil)
+	scanRepo.On("GetTableFingerprints", int64(1)).Return(previous, nil)
+	scanRepo.On("SaveResult", int64(2), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(2), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(2), 2, 0).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(2), "success").Return(nil)
+
+	_, err := services.NewScanService(scanRepo, ruleRepo, nil).ExecuteScan(tenant, 1, db, models.ScanOptions{Incremental: true})
+
+	require.NoError(t, err)
+	scanRepo.AssertNotCalled(t, "CopyTableResults", testifyMock.Anything, testifyMock.Anything, testifyMock.Anything, testifyMock.Anything)
+	assert.Equal(t, "AMOUNT", savedResults(scanRepo)["total"].InfoType)
+}
+
+func TestExecuteScanV2_IncrementalSkipsLLMForUnchangedTables(t *testing.T) {
+	cols := []v2Column{{name: "contact", dataType: "varchar", samples: []string{"ana@example.com"}}}
+	fake := llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...)
+
+	// first run: full scan, remember the fingerprints
+	db, mock, _ := sqlmock.New()
+	expectV2Table(mock, "shop", "customers", cols)
+	scanRepo, ruleRepo := newV2Repos()
+	_, err := services.NewScanService(scanRepo, ruleRepo, nil, services.WithLLMClient(fake)).ExecuteScanV2(tenant, 1, db, models.ScanOptions{})
+	require.NoError(t, err)
+	db.Close()
+	previous := savedFingerprints(scanRepo)
+	require.Len(t, previous, 1)
+
+	// second run: nothing changed, results are copied and the LLM is not called
+	db, mock, _ = sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "UPDATE_TIME", "CREATE_TIME"}).AddRow("shop", "customers", nil, nil))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).AddRow("contact", "varchar", "", "varchar"))
+
+	scanRepo, ruleRepo = newV2Repos()
+	scanRepo.On("GetLastSuccessfulScanID", tenant, int64(1), int64(7), "v2").Return(int64(6), nil)
+	scanRepo.On("GetTableFingerprints", int64(6)).Return(previous, nil)
+	scanRepo.On("CopyTableResults", int64(6), int64(7), "shop", "customers").Return(int64(1), nil)
+	callsBefore := len(fake.Calls())
+
+	_, err = services.NewScanService(scanRepo, ruleRepo, nil, services.WithLLMClient(fake)).ExecuteScanV2(tenant, 1, db, models.ScanOptions{Incremental: true})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, callsBefore, len(fake.Calls()))
+	scanRepo.AssertNotCalled(t, "SaveResult", testifyMock.Anything, testifyMock.Anything)
+	scanRepo.AssertCalled(t, "UpdateTableStats", int64(7), 0, 1)
+}
@@ -1,13 +1,19 @@
 package services_test
 
 import (
+	"database/sql"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	"meli-challenge/api/events"
 	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
 	"meli-challenge/api/services"
 )
 
@@ -16,67 +22,135 @@ type MockScanRepo struct{ testifyMock.Mock }
 type MockRuleRepo struct{ testifyMock.Mock }
 
 // --- ScanRepo methods ---
-func (m *MockScanRepo) CreateHistory(databaseID int64) (int64, error) {
-	args := m.Called(databaseID)
+// CreateHistory runs admit against the mock's own counters, as the repository does in its transaction
+func (m *MockScanRepo) CreateHistory(tenantID, databaseID int64, apiVersion string, admit func(repositories.ScanCounter) error) (int64, error) {
+	if admit != nil {
+		if err := admit(m); err != nil {
+			return 0, err
+		}
+	}
+	args := m.Called(tenantID, databaseID, apiVersion)
 	return args.Get(0).(int64), args.Error(1)
 }
+func (m *MockScanRepo) CountRunning(tenantID, databaseID int64, since time.Time) (int, error) {
+	args := m.Called(tenantID, databaseID, since)
+	return args.Int(0), args.Error(1)
+}
+func (m *MockScanRepo) CountStarted(tenantID int64, apiVersion string, since time.Time) (int, error) {
+	args := m.Called(tenantID, apiVersion, since)
+	return args.Int(0), args.Error(1)
+}
 func (m *MockScanRepo) SaveResult(scanID int64, result models.ScanResult) error {
 	args := m.Called(scanID, result)
 	return args.Error(0)
 }
-func (m *MockScanRepo) GetResultsByScanID(scanID int64) ([]models.ScanResult, error) {
-	args := m.Called(scanID)
+func (m *MockScanRepo) GetResultsByScanID(tenantID, scanID int64) ([]models.ScanResult, error) {
+	args := m.Called(tenantID, scanID)
 	return args.Get(0).([]models.ScanResult), args.Error(1)
 }
 func (m *MockScanRepo) UpdateHistoryStatus(scanID int64, status string) error {
 	args := m.Called(scanID, status)
 	return args.Error(0)
 }
+func (m *MockScanRepo) UpdateCacheStats(scanID int64, hits, misses int) error {
+	args := m.Called(scanID, hits, misses)
+	return args.Error(0)
+}
+func (m *MockScanRepo) UpdateLLMUsage(scanID int64, usage models.LLMUsage) error {
+	args := m.Called(scanID, usage)
+	return args.Error(0)
+}
+func (m *MockScanRepo) SaveProfile(scanID int64, profile models.ColumnProfile) error {
+	args := m.Called(scanID, profile)
+	return args.Error(0)
+}
+func (m *MockScanRepo) GetProfilesByScanID(tenantID, scanID int64) ([]models.ColumnProfile, error) {
+	args := m.Called(tenantID, scanID)
+	return args.Get(0).([]models.ColumnProfile), args.Error(1)
+}
+func (m *MockScanRepo) GetHistory(tenantID, scanID int64) (models.ScanHistory, error) {
+	args := m.Called(tenantID, scanID)
+	return args.Get(0).(models.ScanHistory), args.Error(1)
+}
+func (m *MockScanRepo) GetLastSuccessfulScanID(tenantID, databaseID, beforeScanID int64, apiVersion string) (int64, error) {
+	args := m.Called(tenantID, databaseID, beforeScanID, apiVersion)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockScanRepo) SaveTableFingerprint(scanID int64, fp models.TableFingerprint) error {
+	args := m.Called(scanID, fp)
+	return args.Error(0)
+}
+func (m *MockScanRepo) GetTableFingerprints(scanID int64) ([]models.TableFingerprint, error) {
+	args := m.Called(scanID)
+	return args.Get(0).([]models.TableFingerprint), args.Error(1)
+}
+func (m *MockScanRepo) CopyTableResults(fromScanID, toScanID int64, schema, table string) (int64, error) {
+	args := m.Called(fromScanID, toScanID, schema, table)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockScanRepo) UpdateTableStats(scanID int64, scanned, reused int) error {
+	args := m.Called(scanID, scanned, reused)
+	return args.Error(0)
+}
 
 // --- RuleRepo methods ---
 func (m *MockRuleRepo) CreateRule(rule models.ClassificationRule) (int64, error) {
 	args := m.Called(rule)
 	return args.Get(0).(int64), args.Error(1)
 }
-func (m *MockRuleRepo) GetAllRules() ([]models.ClassificationRule, error) {
-	args := m.Called()
+func (m *MockRuleRepo) GetAllRules(tenantID int64) ([]models.ClassificationRule, error) {
+	args := m.Called(tenantID)
 	return args.Get(0).([]models.ClassificationRule), args.Error(1)
 }
+func (m *MockRuleRepo) CreatePack(pack models.RulePack) (int64, error) {
+	args := m.Called(pack)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockRuleRepo) GetPack(id int64) (models.RulePack, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.RulePack), args.Error(1)
+}
+func (m *MockRuleRepo) ListPacks() ([]models.RulePack, error) {
+	args := m.Called()
+	return args.Get(0).([]models.RulePack), args.Error(1)
+}
 
 func TestExecuteScan(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
 	// Mock query for listing tables in schema
-	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.tables").
-		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME"}).
-			AddRow("target_sample_db", "users"))
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "UPDATE_TIME", "CREATE_TIME"}).
+			AddRow("target_sample_db", "users", nil, "2025-01-01 00:00:00"))
 
 	// Mock query for listing columns in "users"
-	mock.ExpectQuery("SELECT COLUMN_NAME FROM information_schema.columns").
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
 		WithArgs("target_sample_db", "users").
-		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).
-			AddRow("username"))
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).
+			AddRow("username", "varchar", "", "varchar(50)"))
 
 	scanRepo := new(MockScanRepo)
 	ruleRepo := new(MockRuleRepo)
 
 	// Setup mock expectations
-	ruleRepo.On("GetAllRules").Return([]models.ClassificationRule{
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule{
 		{ID: 1, TypeName: "USERNAME", Regex: "(?i)^user(name)?$"},
 	}, nil)
 
 	// Return scanID = 1 for history
-	scanRepo.On("CreateHistory", int64(1)).Return(int64(1), nil)
+	scanRepo.On("CreateHistory", tenant, int64(1), "v1").Return(int64(1), nil)
 	// Accept any column scan results
 	scanRepo.On("SaveResult", int64(1), testifyMock.Anything).Return(nil)
 	// Accept either "success" or "failed" status
 	scanRepo.On("UpdateHistoryStatus", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(1), 1, 0).Return(nil)
 
-	svc := services.NewScanService(scanRepo, ruleRepo)
+	svc := services.NewScanService(scanRepo, ruleRepo, nil)
 
 	// Run ExecuteScan
-	scanID, err := svc.ExecuteScan(1, db)
+	scanID, err := svc.ExecuteScan(tenant, 1, db, models.ScanOptions{})
 
 	// Assertions
 	assert.NoError(t, err)
@@ -86,3 +160,113 @@ func TestExecuteScan(t *testing.T) {
 	scanRepo.AssertCalled(t, "SaveResult", int64(1), testifyMock.Anything)
 	scanRepo.AssertCalled(t, "UpdateHistoryStatus", int64(1), testifyMock.Anything)
 }
+
+func TestExecuteScan_WithProfiling(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT TABLE_SCHEMA, TABLE_NAME, UPDATE_TIME, CREATE_TIME FROM information_schema.tables").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "UPDATE_TIME", "CREATE_TIME"}).
+			AddRow("target_sample_db", "users", nil, "2025-01-01 00:00:00"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_KEY, COLUMN_TYPE FROM information_schema.columns").
+		WithArgs("target_sample_db", "users").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_KEY", "COLUMN_TYPE"}).AddRow("phone", "varchar", "", "varchar(20)"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT /*+ MAX_EXECUTION_TIME(5000) */ `phone` FROM `target_sample_db`.`users` LIMIT 10000")).
+		WillReturnRows(sqlmock.NewRows([]string{"phone"}).AddRow("555-0100").AddRow("555-0199").AddRow(nil))
+
+	scanRepo := new(MockScanRepo)
+	ruleRepo := new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule{
+		{ID: 1, TypeName: "PHONE_NUMBER", Regex: "(?i)^phone$"},
+	}, nil)
+	scanRepo.On("CreateHistory", tenant, int64(1), "v1").Return(int64(1), nil)
+	scanRepo.On("SaveResult", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveProfile", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(1), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(1), 1, 0).Return(nil)
+
+	svc := services.NewScanService(scanRepo, ruleRepo, nil)
+	_, err := svc.ExecuteScan(tenant, 1, db, models.ScanOptions{Profile: true})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	scanRepo.AssertCalled(t, "SaveProfile", int64(1), testifyMock.MatchedBy(func(p models.ColumnProfile) bool {
+		return p.ColumnName == "phone" && p.SampledRows == 3 && p.DistinctCount == 2 && p.TopShapes[0].Shape == "999-9999"
+	}))
+}
+
+func TestGetScanResults_AttachesProfiles(t *testing.T) {
+	scanRepo := new(MockScanRepo)
+	scanRepo.On("GetResultsByScanID", tenant, int64(5)).Return([]models.ScanResult{
+		{SchemaName: "db", TableName: "users", ColumnName: "phone", InfoType: "PHONE_NUMBER"},
+		{SchemaName: "db", TableName: "users", ColumnName: "id", InfoType: "N/A"},
+	}, nil)
+	scanRepo.On("GetProfilesByScanID", tenant, int64(5)).Return([]models.ColumnProfile{
+		{SchemaName: "db", TableName: "users", ColumnName: "phone", SampledRows: 10, DistinctCount: 9},
+	}, nil)
+
+	svc := services.NewScanService(scanRepo, new(MockRuleRepo), nil)
+	res, err := svc.GetScanResults(tenant, 5)
+
+	assert.NoError(t, err)
+	cols := res.Database[0].SchemaTables[0].Columns
+	for _, c := range cols {
+		if c.ColumnName == "phone" {
+			assert.Equal(t, 9, c.Profile.DistinctCount)
+		} else {
+			assert.Nil(t, c.Profile)
+		}
+	}
+}
+
+func TestDiffScans(t *testing.T) {
+	scanRepo := new(MockScanRepo)
+	scanRepo.On("GetHistory", tenant, int64(1)).Return(models.ScanHistory{ID: 1}, nil)
+	scanRepo.On("GetHistory", tenant, int64(2)).Return(models.ScanHistory{ID: 2}, nil)
+	scanRepo.On("GetHistory", tenant, int64(3)).Return(models.ScanHistory{}, sql.ErrNoRows)
+	scanRepo.On("GetResultsByScanID", tenant, int64(1)).Return([]models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "nick", InfoType: "N/A"},
+	}, nil)
+	scanRepo.On("GetResultsByScanID", tenant, int64(2)).Return([]models.ScanResult{
+		{SchemaName: "shop", TableName: "users", ColumnName: "nick", InfoType: "USERNAME"},
+	}, nil)
+	svc := services.NewScanService(scanRepo, new(MockRuleRepo), nil)
+
+	d, err := svc.DiffScans(tenant, 1, 2)
+	assert.NoError(t, err)
+	assert.Len(t, d.ChangedColumns, 1)
+	assert.Len(t, d.NewlySensitive, 1)
+
+	_, err = svc.DiffScans(tenant, 1, 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestExecuteScan_PublishesProgress(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectUsersTable(mock, "email")
+
+	scanRepo, ruleRepo := new(MockScanRepo), new(MockRuleRepo)
+	ruleRepo.On("GetAllRules", tenant).Return([]models.ClassificationRule{{ID: 1, TypeName: "EMAIL_ADDRESS", Regex: "(?i)mail"}}, nil)
+	scanRepo.On("CreateHistory", tenant, int64(3), "v1").Return(int64(8), nil)
+	scanRepo.On("SaveResult", int64(8), testifyMock.Anything).Return(nil)
+	scanRepo.On("SaveTableFingerprint", int64(8), testifyMock.Anything).Return(nil)
+	scanRepo.On("UpdateTableStats", int64(8), 1, 0).Return(nil)
+	scanRepo.On("UpdateHistoryStatus", int64(8), "success").Return(nil)
+	bus := events.NewBus()
+	svc := services.NewScanService(scanRepo, ruleRepo, nil, services.WithEventBus(bus))
+
+	_, err := svc.ExecuteScan(tenant, 3, db, models.ScanOptions{})
+	require.NoError(t, err)
+
+	sub := svc.SubscribeEvents(8)
+	defer sub.Close()
+	var types []string
+	for _, e := range sub.History {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{models.ScanEventStarted, models.ScanEventTableStarted, models.ScanEventColumnClassified, models.ScanEventFinished}, types)
+	assert.Equal(t, "EMAIL_ADDRESS", sub.History[2].InfoType)
+	assert.Equal(t, "success", sub.History[3].Status)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/sampling"
+	"meli-challenge/api/schedule"
+)
+
+// ErrInvalidSchedule wraps validation errors of schedules created or updated through the API.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ScheduleService manages the scan schedules of a tenant.
+type ScheduleService interface {
+	CreateSchedule(tenantID int64, s models.ScanSchedule) (int64, error)
+	GetSchedule(tenantID, id int64) (models.ScanSchedule, error)
+	ListSchedules(tenantID int64) ([]models.ScanSchedule, error)
+	UpdateSchedule(tenantID, id int64, s models.ScanSchedule) error
+	DeleteSchedule(tenantID, id int64) error
+	// ListRuns returns the latest runs of a schedule, newest first
+	ListRuns(tenantID, id int64, limit int) ([]models.ScheduleRun, error)
+}
+
+type scheduleService struct {
+	repo   repositories.ScheduleRepository
+	repoDB repositories.DatabaseRepository
+	now    func() time.Time
+}
+
+func NewScheduleService(repo repositories.ScheduleRepository, repoDB repositories.DatabaseRepository) ScheduleService {
+	return &scheduleService{repo: repo, repoDB: repoDB, now: time.Now}
+}
+
+func (s *scheduleService) CreateSchedule(tenantID int64, sched models.ScanSchedule) (int64, error) {
+	sched.TenantID = tenantID
+	if err := s.prepare(&sched); err != nil {
+		return 0, err
+	}
+	return s.repo.Create(sched)
+}
+
+func (s *scheduleService) GetSchedule(tenantID, id int64) (models.ScanSchedule, error) {
+	return s.repo.Get(tenantID, id)
+}
+
+func (s *scheduleService) ListSchedules(tenantID int64) ([]models.ScanSchedule, error) {
+	return s.repo.List(tenantID)
+}
+
+func (s *scheduleService) UpdateSchedule(tenantID, id int64, sched models.ScanSchedule) error {
+	current, err := s.repo.Get(tenantID, id)
+	if err != nil {
+		return err
+	}
+	// the target database of a schedule cannot change
+	sched.ID, sched.TenantID, sched.DatabaseID = id, tenantID, current.DatabaseID
+	if err := s.prepare(&sched); err != nil {
+		return err
+	}
+	return s.repo.Update(sched)
+}
+
+func (s *scheduleService) DeleteSchedule(tenantID, id int64) error {
+	return s.repo.Delete(tenantID, id)
+}
+
+func (s *scheduleService) ListRuns(tenantID, id int64, limit int) ([]models.ScheduleRun, error) {
+	if _, err := s.repo.Get(tenantID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListRuns(tenantID, id, limit)
+}
+
+// prepare validates sched, fills defaults and computes its next run.
+func (s *scheduleService) prepare(sched *models.ScanSchedule) error {
+	if sched.Timezone == "" {
+		sched.Timezone = "UTC"
+	}
+	if sched.Version == "" {
+		sched.Version = "v1"
+	}
+	if sched.Version != "v1" && sched.Version != "v2" {
+		return fmt.Errorf("%w: version must be v1 or v2", ErrInvalidSchedule)
+	}
+	if _, err := sampling.New(sched.Options.Sampling.Strategy); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	cron, err := schedule.ParseInLocation(sched.Cron, sched.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	next := cron.Next(s.now())
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron expression %q never fires", ErrInvalidSchedule, sched.Cron)
+	}
+	sched.NextRunAt = next.UTC()
+
+	if _, err := s.repoDB.GetByID(sched.TenantID, sched.DatabaseID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: database %d not found", ErrInvalidSchedule, sched.DatabaseID)
+		}
+		return err
+	}
+	return nil
+}
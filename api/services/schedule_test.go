@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type MockScheduleRepo struct{ testifyMock.Mock }
+
+func (m *MockScheduleRepo) Create(s models.ScanSchedule) (int64, error) {
+	args := m.Called(s)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockScheduleRepo) Get(tenantID, id int64) (models.ScanSchedule, error) {
+	args := m.Called(tenantID, id)
+	return args.Get(0).(models.ScanSchedule), args.Error(1)
+}
+func (m *MockScheduleRepo) List(tenantID int64) ([]models.ScanSchedule, error) {
+	args := m.Called(tenantID)
+	return args.Get(0).([]models.ScanSchedule), args.Error(1)
+}
+func (m *MockScheduleRepo) Update(s models.ScanSchedule) error { return m.Called(s).Error(0) }
+func (m *MockScheduleRepo) Delete(tenantID, id int64) error    { return m.Called(tenantID, id).Error(0) }
+func (m *MockScheduleRepo) ListDue(now time.Time) ([]models.ScanSchedule, error) {
+	args := m.Called(now)
+	return args.Get(0).([]models.ScanSchedule), args.Error(1)
+}
+func (m *MockScheduleRepo) Claim(id int64, expected, next time.Time, missed int) (bool, error) {
+	args := m.Called(id, expected, next, missed)
+	return args.Bool(0), args.Error(1)
+}
+func (m *MockScheduleRepo) StartRun(run models.ScheduleRun) (int64, error) {
+	args := m.Called(run)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockScheduleRepo) FinishRun(run models.ScheduleRun) error { return m.Called(run).Error(0) }
+func (m *MockScheduleRepo) HasActiveRun(scheduleID int64, since time.Time) (bool, error) {
+	args := m.Called(scheduleID, since)
+	return args.Bool(0), args.Error(1)
+}
+func (m *MockScheduleRepo) ListRuns(tenantID, scheduleID int64, limit int) ([]models.ScheduleRun, error) {
+	args := m.Called(tenantID, scheduleID, limit)
+	return args.Get(0).([]models.ScheduleRun), args.Error(1)
+}
+
+func TestCreateSchedule_ComputesNextRun(t *testing.T) {
+	repo, repoDB := new(MockScheduleRepo), new(MockDatabaseRepo)
+	repoDB.On("GetByID", tenant, int64(3)).Return(models.Database{ID: 3}, nil)
+	repo.On("Create", testifyMock.Anything).Return(int64(9), nil)
+	svc := services.NewScheduleService(repo, repoDB)
+
+	id, err := svc.CreateSchedule(tenant, models.ScanSchedule{DatabaseID: 3, Cron: "*/5 * * * *", Enabled: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), id)
+	saved := repo.Calls[0].Arguments.Get(0).(models.ScanSchedule)
+	assert.Equal(t, "v1", saved.Version)
+	assert.Equal(t, "UTC", saved.Timezone)
+	assert.True(t, saved.NextRunAt.After(time.Now()))
+	assert.Zero(t, saved.NextRunAt.Minute()%5)
+}
+
+func TestCreateSchedule_Validation(t *testing.T) {
+	repo, repoDB := new(MockScheduleRepo), new(MockDatabaseRepo)
+	repoDB.On("GetByID", tenant, int64(3)).Return(models.Database{ID: 3}, nil)
+	repoDB.On("GetByID", tenant, int64(4)).Return(models.Database{}, sql.ErrNoRows)
+	svc := services.NewScheduleService(repo, repoDB)
+
+	for name, s := range map[string]models.ScanSchedule{
+		"bad cron":      {DatabaseID: 3, Cron: "every day"},
+		"bad version":   {DatabaseID: 3, Cron: "@daily", Version: "v3"},
+		"bad timezone":  {DatabaseID: 3, Cron: "@daily", Timezone: "Nowhere/City"},
+		"bad sampling":  {DatabaseID: 3, Cron: "@daily", Options: models.ScanOptions{Sampling: models.SamplingConfig{Strategy: "all"}}},
+		"never fires":   {DatabaseID: 3, Cron: "0 0 31 2 *"},
+		"missing db id": {DatabaseID: 4, Cron: "@daily"},
+	} {
+		_, err := svc.CreateSchedule(tenant, s)
+		assert.True(t, errors.Is(err, services.ErrInvalidSchedule), name)
+	}
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+}
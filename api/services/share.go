@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/logger"
+)
+
+// Errors of share links. Invalid covers malformed and forged tokens and unknown links.
+var (
+	ErrInvalidShare = errors.New("invalid share link")
+	ErrShareExpired = errors.New("share link expired")
+	ErrShareRevoked = errors.New("share link revoked")
+)
+
+// Errors of the event stream tokens embedded in live reports.
+var (
+	ErrInvalidEventsToken = errors.New("invalid events token")
+	ErrEventsTokenExpired = errors.New("events token expired")
+)
+
+const (
+	DefaultShareTTL = 72 * time.Hour
+	MaxShareTTL     = 30 * 24 * time.Hour
+	// EventsTokenTTL is how long the event stream URL of a live report can be (re)connected to
+	EventsTokenTTL = time.Hour
+)
+
+// HMAC domains, so a token of one kind is never accepted as the other
+const (
+	shareDomain  = "report-share."
+	eventsDomain = "scan-events."
+)
+
+// ShareService creates and checks HMAC-signed links to scan reports. A token is
+// "<share id>.<scan id>.<expiry unix>.<signature>"; the signature is checked before the link
+// is looked up, and revocation and expiry are checked against the stored link. Links belong to
+// the tenant of their scan.
+type ShareService interface {
+	// CreateShare creates a link to the report of scanID valid for ttl (DefaultShareTTL when 0).
+	// The token is only returned here.
+	CreateShare(tenantID, scanID int64, ttl time.Duration, note string) (models.ReportShare, error)
+	ListShares(tenantID, scanID int64) ([]models.ReportShare, error)
+	RevokeShare(tenantID, id int64) error
+	// OpenShare checks token, records the access and returns the link, whose TenantID is the
+	// tenant the token gives access to
+	OpenShare(token string, access models.ReportShareAccess) (models.ReportShare, error)
+	ListAccesses(tenantID, shareID int64, limit int) ([]models.ReportShareAccess, error)
+	// EventsToken signs access to the event stream of scanID for EventsTokenTTL. Live reports
+	// embed it in their stream URL because EventSource cannot send the API key.
+	EventsToken(tenantID, scanID int64) string
+	// OpenEventsToken checks a token of EventsToken and returns the tenant and scan it gives
+	// access to
+	OpenEventsToken(token string) (tenantID, scanID int64, err error)
+}
+
+type shareService struct {
+	repo     repositories.ReportShareRepository
+	repoScan repositories.ScanRepository
+	secret   []byte
+	now      func() time.Time
+}
+
+func NewShareService(repo repositories.ReportShareRepository, repoScan repositories.ScanRepository, secret []byte) ShareService {
+	return &shareService{repo: repo, repoScan: repoScan, secret: secret, now: time.Now}
+}
+
+// ShareSecretFromEnv returns REPORT_SHARE_SECRET. Without it links are signed with a random
+// key and stop working when the API restarts (and on other replicas).
+func ShareSecretFromEnv() []byte {
+	if s := os.Getenv("REPORT_SHARE_SECRET"); s != "" {
+		return []byte(s)
+	}
+	logger.Warnf("REPORT_SHARE_SECRET not set: report share links are only valid on this process until it restarts")
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (s *shareService) CreateShare(tenantID, scanID int64, ttl time.Duration, note string) (models.ReportShare, error) {
+	if ttl == 0 {
+		ttl = DefaultShareTTL
+	}
+	if ttl < time.Minute || ttl > MaxShareTTL {
+		return models.ReportShare{}, fmt.Errorf("%w: expiry must be between 1 minute and %d hours", ErrInvalidShare, int(MaxShareTTL.Hours()))
+	}
+	if len(note) > 255 {
+		return models.ReportShare{}, fmt.Errorf("%w: note must have at most 255 characters", ErrInvalidShare)
+	}
+	if _, err := s.repoScan.GetHistory(tenantID, scanID); err != nil {
+		return models.ReportShare{}, err
+	}
+
+	// DATETIME keeps seconds, and the token must match the stored expiry
+	now := s.now().UTC().Truncate(time.Second)
+	share := models.ReportShare{TenantID: tenantID, ScanID: scanID, Note: note, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	id, err := s.repo.Create(share)
+	if err != nil {
+		return models.ReportShare{}, err
+	}
+	share.ID = id
+	share.Token = s.sign(share)
+	logger.Infof("Report share id=%d created for scan_id=%d, expires %s", id, scanID, share.ExpiresAt.Format(time.RFC3339))
+	return share, nil
+}
+
+func (s *shareService) ListShares(tenantID, scanID int64) ([]models.ReportShare, error) {
+	return s.repo.ListForScan(tenantID, scanID)
+}
+
+func (s *shareService) RevokeShare(tenantID, id int64) error {
+	if _, err := s.repo.Get(tenantID, id); err != nil {
+		return err
+	}
+	logger.Infof("Report share id=%d revoked", id)
+	return s.repo.Revoke(tenantID, id, s.now())
+}
+
+func (s *shareService) OpenShare(token string, access models.ReportShareAccess) (models.ReportShare, error) {
+	ids, ok := s.verify(shareDomain, token)
+	shareID, scanID, expires := ids[0], ids[1], ids[2]
+	if !ok {
+		logger.Warnf("Report share access refused: invalid token from %s", access.IP)
+		return models.ReportShare{}, ErrInvalidShare
+	}
+	share, err := s.repo.Lookup(shareID)
+	if err != nil || share.ScanID != scanID || share.ExpiresAt.Unix() != expires {
+		// a signed token for a deleted link, or (with a leaked secret) a crafted one
+		logger.Warnf("Report share access refused: unknown share id=%d from %s", shareID, access.IP)
+		return models.ReportShare{}, ErrInvalidShare
+	}
+
+	now := s.now()
+	access.ShareID, access.AccessedAt, access.Outcome = shareID, now, models.ShareAccessGranted
+	switch {
+	case share.RevokedAt != nil:
+		access.Outcome = models.ShareAccessRevoked
+		err = ErrShareRevoked
+	case !now.Before(share.ExpiresAt):
+		access.Outcome = models.ShareAccessExpired
+		err = ErrShareExpired
+	}
+	logger.Infof("Report share id=%d scan_id=%d %s %s from %s (%s)", shareID, scanID, access.Outcome, access.Path, access.IP, access.UserAgent)
+	if logErr := s.repo.LogAccess(access); logErr != nil && err == nil {
+		// an access that cannot be audited is not served
+		return models.ReportShare{}, logErr
+	}
+	return share, err
+}
+
+func (s *shareService) ListAccesses(tenantID, shareID int64, limit int) ([]models.ReportShareAccess, error) {
+	if _, err := s.repo.Get(tenantID, shareID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAccesses(tenantID, shareID, limit)
+}
+
+func (s *shareService) EventsToken(tenantID, scanID int64) string {
+	payload := fmt.Sprintf("%d.%d.%d", tenantID, scanID, s.now().Add(EventsTokenTTL).Unix())
+	return payload + "." + s.mac(eventsDomain, payload)
+}
+
+func (s *shareService) OpenEventsToken(token string) (tenantID, scanID int64, err error) {
+	ids, ok := s.verify(eventsDomain, token)
+	if !ok {
+		return 0, 0, ErrInvalidEventsToken
+	}
+	if !s.now().Before(time.Unix(ids[2], 0)) {
+		return 0, 0, ErrEventsTokenExpired
+	}
+	return ids[0], ids[1], nil
+}
+
+func (s *shareService) sign(share models.ReportShare) string {
+	payload := fmt.Sprintf("%d.%d.%d", share.ID, share.ScanID, share.ExpiresAt.Unix())
+	return payload + "." + s.mac(shareDomain, payload)
+}
+
+// verify checks the signature of a "<a>.<b>.<c>.<signature>" token and returns its numbers.
+func (s *shareService) verify(domain, token string) (ids [3]int64, ok bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return ids, false
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.mac(domain, payload))) {
+		return ids, false
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return ids, false
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return [3]int64{}, false
+		}
+		ids[i] = n
+	}
+	return ids, true
+}
+
+func (s *shareService) mac(domain, payload string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(domain + payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package services_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type MockShareRepo struct{ testifyMock.Mock }
+
+func (m *MockShareRepo) Create(s models.ReportShare) (int64, error) {
+	args := m.Called(s)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockShareRepo) Get(tenantID, id int64) (models.ReportShare, error) {
+	args := m.Called(tenantID, id)
+	return args.Get(0).(models.ReportShare), args.Error(1)
+}
+func (m *MockShareRepo) Lookup(id int64) (models.ReportShare, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.ReportShare), args.Error(1)
+}
+func (m *MockShareRepo) ListForScan(tenantID, scanID int64) ([]models.ReportShare, error) {
+	args := m.Called(tenantID, scanID)
+	return args.Get(0).([]models.ReportShare), args.Error(1)
+}
+func (m *MockShareRepo) Revoke(tenantID, id int64, at time.Time) error {
+	return m.Called(tenantID, id, at).Error(0)
+}
+func (m *MockShareRepo) LogAccess(a models.ReportShareAccess) error {
+	return m.Called(a).Error(0)
+}
+func (m *MockShareRepo) ListAccesses(tenantID, shareID int64, limit int) ([]models.ReportShareAccess, error) {
+	args := m.Called(tenantID, shareID, limit)
+	return args.Get(0).([]models.ReportShareAccess), args.Error(1)
+}
+
+var shareSecret = []byte("test-share-secret")
+
+// createShare creates share 7 of scan 3 and returns the stored row and its token.
+func createShare(t *testing.T, repo *MockShareRepo, svc services.ShareService) (models.ReportShare, string) {
+	t.Helper()
+	repo.On("Create", testifyMock.Anything).Return(int64(7), nil).Once()
+	share, err := svc.CreateShare(tenant, 3, 0, "auditoría Q3")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, share.Token)
+	stored := share
+	stored.Token = ""
+	return stored, share.Token
+}
+
+func newShareService() (*MockShareRepo, *MockScanRepo, services.ShareService) {
+	repo, scans := &MockShareRepo{}, &MockScanRepo{}
+	scans.On("GetHistory", tenant, int64(3)).Return(models.ScanHistory{ID: 3}, nil)
+	return repo, scans, services.NewShareService(repo, scans, shareSecret)
+}
+
+func TestShareService_CreateShareDefaultsExpiry(t *testing.T) {
+	repo, _, svc := newShareService()
+	share, _ := createShare(t, repo, svc)
+
+	assert.Equal(t, int64(7), share.ID)
+	assert.Equal(t, services.DefaultShareTTL, share.ExpiresAt.Sub(share.CreatedAt))
+	assert.Equal(t, 0, share.ExpiresAt.Nanosecond(), "expiry must round-trip through DATETIME")
+}
+
+func TestShareService_CreateShareRejectsBadInput(t *testing.T) {
+	repo, scans, svc := newShareService()
+	scans.On("GetHistory", tenant, int64(99)).Return(models.ScanHistory{}, sql.ErrNoRows)
+
+	_, err := svc.CreateShare(tenant, 3, 31*24*time.Hour, "")
+	assert.ErrorIs(t, err, services.ErrInvalidShare)
+	_, err = svc.CreateShare(tenant, 99, time.Hour, "")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	repo.AssertNotCalled(t, "Create", testifyMock.Anything)
+}
+
+func TestShareService_OpenShareGrantsAndLogsAccess(t *testing.T) {
+	repo, _, svc := newShareService()
+	share, token := createShare(t, repo, svc)
+	repo.On("Lookup", int64(7)).Return(share, nil)
+	repo.On("LogAccess", testifyMock.MatchedBy(func(a models.ReportShareAccess) bool {
+		return a.ShareID == 7 && a.Outcome == models.ShareAccessGranted && a.IP == "10.0.0.5"
+	})).Return(nil)
+
+	opened, err := svc.OpenShare(token, models.ReportShareAccess{IP: "10.0.0.5", Path: "/api/v1/shared/reports/:token"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), opened.ScanID)
+	repo.AssertExpectations(t)
+}
+
+func TestShareService_OpenShareRejectsTamperedTokens(t *testing.T) {
+	repo, _, svc := newShareService()
+	_, token := createShare(t, repo, svc)
+
+	parts := strings.Split(token, ".")
+	otherScan := strings.Join([]string{parts[0], "4", parts[2], parts[3]}, ".")
+	for _, tok := range []string{"", "garbage", otherScan, token + "x"} {
+		_, err := svc.OpenShare(tok, models.ReportShareAccess{})
+		assert.ErrorIs(t, err, services.ErrInvalidShare, tok)
+	}
+	// a token signed with another secret
+	other := services.NewShareService(repo, &MockScanRepo{}, []byte("other"))
+	_, err := other.OpenShare(token, models.ReportShareAccess{})
+	assert.ErrorIs(t, err, services.ErrInvalidShare)
+	repo.AssertNotCalled(t, "Lookup", testifyMock.Anything)
+	repo.AssertNotCalled(t, "LogAccess", testifyMock.Anything)
+}
+
+func TestShareService_OpenShareRevoked(t *testing.T) {
+	repo, _, svc := newShareService()
+	share, token := createShare(t, repo, svc)
+	revoked := time.Now()
+	share.RevokedAt = &revoked
+	repo.On("Lookup", int64(7)).Return(share, nil)
+	repo.On("LogAccess", testifyMock.MatchedBy(func(a models.ReportShareAccess) bool {
+		return a.Outcome == models.ShareAccessRevoked
+	})).Return(nil)
+
+	_, err := svc.OpenShare(token, models.ReportShareAccess{})
+	assert.ErrorIs(t, err, services.ErrShareRevoked)
+	repo.AssertExpectations(t)
+}
+
+func TestShareService_OpenShareExpired(t *testing.T) {
+	repo, _, svc := newShareService()
+	expires := time.Now().Add(-time.Hour).Truncate(time.Second)
+	payload := fmt.Sprintf("7.3.%d", expires.Unix())
+	mac := hmac.New(sha256.New, shareSecret)
+	mac.Write([]byte("report-share." + payload))
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	repo.On("Lookup", int64(7)).Return(models.ReportShare{ID: 7, ScanID: 3, ExpiresAt: expires}, nil)
+	repo.On("LogAccess", testifyMock.MatchedBy(func(a models.ReportShareAccess) bool {
+		return a.Outcome == models.ShareAccessExpired
+	})).Return(nil)
+
+	_, err := svc.OpenShare(token, models.ReportShareAccess{})
+	assert.ErrorIs(t, err, services.ErrShareExpired)
+	repo.AssertExpectations(t)
+}
+
+func TestShareService_OpenShareUnknownLink(t *testing.T) {
+	repo, _, svc := newShareService()
+	_, token := createShare(t, repo, svc)
+	repo.On("Lookup", int64(7)).Return(models.ReportShare{}, sql.ErrNoRows)
+
+	_, err := svc.OpenShare(token, models.ReportShareAccess{})
+	assert.ErrorIs(t, err, services.ErrInvalidShare)
+	repo.AssertNotCalled(t, "LogAccess", testifyMock.Anything)
+}
+
+func TestShareService_EventsTokenRoundTripAndRejections(t *testing.T) {
+	repo, _, svc := newShareService()
+	token := svc.EventsToken(tenant, 3)
+
+	tenantID, scanID, err := svc.OpenEventsToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, tenant, tenantID)
+	assert.Equal(t, int64(3), scanID)
+
+	parts := strings.Split(token, ".")
+	otherScan := strings.Join([]string{parts[0], "4", parts[2], parts[3]}, ".")
+	for _, tok := range []string{"", "garbage", otherScan, token + "x"} {
+		_, _, err := svc.OpenEventsToken(tok)
+		assert.ErrorIs(t, err, services.ErrInvalidEventsToken, tok)
+	}
+
+	// a share link token is not an events token, nor the other way round
+	_, shareToken := createShare(t, repo, svc)
+	_, _, err = svc.OpenEventsToken(shareToken)
+	assert.ErrorIs(t, err, services.ErrInvalidEventsToken)
+	_, err = svc.OpenShare(token, models.ReportShareAccess{})
+	assert.ErrorIs(t, err, services.ErrInvalidShare)
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	payload := fmt.Sprintf("%d.3.%d", tenant, expires)
+	mac := hmac.New(sha256.New, shareSecret)
+	mac.Write([]byte("scan-events." + payload))
+	_, _, err = svc.OpenEventsToken(payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	assert.ErrorIs(t, err, services.ErrEventsTokenExpired)
+}
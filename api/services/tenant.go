@@ -0,0 +1,114 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/logger"
+)
+
+// ErrInvalidTenant wraps validation errors of tenants created or updated through the API.
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// DefaultRulePackID is the baseline pack seeded by init.sql, inherited by new tenants unless
+// they name their packs.
+const DefaultRulePackID int64 = 1
+
+// slugPattern is the format of tenant slugs, which OIDC tokens carry in their tenant claim
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+type TenantService interface {
+	// CreateTenant stores a tenant subscribed to t.RulePacks (the baseline pack when nil)
+	CreateTenant(t models.Tenant) (models.Tenant, error)
+	GetTenant(id int64) (models.Tenant, error)
+	ListTenants() ([]models.Tenant, error)
+	// SetRulePacks replaces the global rule packs a tenant inherits
+	SetRulePacks(tenantID int64, packIDs []int64) error
+	// ResolveSlug returns the id of the tenant with slug (sql.ErrNoRows if none)
+	ResolveSlug(slug string) (int64, error)
+}
+
+type tenantService struct {
+	repo     repositories.TenantRepository
+	repoRule repositories.RuleRepository
+	now      func() time.Time
+}
+
+func NewTenantService(repo repositories.TenantRepository, repoRule repositories.RuleRepository) TenantService {
+	return &tenantService{repo: repo, repoRule: repoRule, now: time.Now}
+}
+
+func (s *tenantService) CreateTenant(t models.Tenant) (models.Tenant, error) {
+	t.Slug, t.Name = strings.ToLower(strings.TrimSpace(t.Slug)), strings.TrimSpace(t.Name)
+	if !slugPattern.MatchString(t.Slug) {
+		return models.Tenant{}, fmt.Errorf("%w: slug must be 1 to 50 lowercase letters, digits or dashes", ErrInvalidTenant)
+	}
+	if t.Name == "" || len(t.Name) > 100 {
+		return models.Tenant{}, fmt.Errorf("%w: name is required and must have at most 100 characters", ErrInvalidTenant)
+	}
+	if _, err := s.repo.GetBySlug(t.Slug); err == nil {
+		return models.Tenant{}, fmt.Errorf("%w: slug %q already used", ErrInvalidTenant, t.Slug)
+	} else if err != sql.ErrNoRows {
+		return models.Tenant{}, err
+	}
+	if t.RulePacks == nil {
+		t.RulePacks = []int64{DefaultRulePackID}
+	}
+	if err := s.checkPacks(t.RulePacks); err != nil {
+		return models.Tenant{}, err
+	}
+
+	t.CreatedAt = s.now().UTC().Truncate(time.Second)
+	id, err := s.repo.Create(t)
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	t.ID = id
+	logger.Infof("Tenant id=%d slug=%s created with rule packs %v", id, t.Slug, t.RulePacks)
+	return t, nil
+}
+
+func (s *tenantService) GetTenant(id int64) (models.Tenant, error) {
+	return s.repo.Get(id)
+}
+
+func (s *tenantService) ListTenants() ([]models.Tenant, error) {
+	return s.repo.List()
+}
+
+func (s *tenantService) SetRulePacks(tenantID int64, packIDs []int64) error {
+	if _, err := s.repo.Get(tenantID); err != nil {
+		return err
+	}
+	if err := s.checkPacks(packIDs); err != nil {
+		return err
+	}
+	return s.repo.SetRulePacks(tenantID, packIDs)
+}
+
+func (s *tenantService) ResolveSlug(slug string) (int64, error) {
+	t, err := s.repo.GetBySlug(slug)
+	return t.ID, err
+}
+
+// checkPacks rejects unknown and repeated rule packs
+func (s *tenantService) checkPacks(packIDs []int64) error {
+	for i, id := range packIDs {
+		if slices.Contains(packIDs[:i], id) {
+			return fmt.Errorf("%w: rule pack %d listed twice", ErrInvalidTenant, id)
+		}
+		if _, err := s.repoRule.GetPack(id); err == sql.ErrNoRows {
+			return fmt.Errorf("%w: rule pack %d not found", ErrInvalidTenant, id)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
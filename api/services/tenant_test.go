@@ -0,0 +1,117 @@
+package services_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testifyMock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/services"
+)
+
+type MockTenantRepo struct{ testifyMock.Mock }
+
+func (m *MockTenantRepo) Create(t models.Tenant) (int64, error) {
+	args := m.Called(t)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockTenantRepo) Get(id int64) (models.Tenant, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Tenant), args.Error(1)
+}
+func (m *MockTenantRepo) GetBySlug(slug string) (models.Tenant, error) {
+	args := m.Called(slug)
+	return args.Get(0).(models.Tenant), args.Error(1)
+}
+func (m *MockTenantRepo) List() ([]models.Tenant, error) {
+	args := m.Called()
+	return args.Get(0).([]models.Tenant), args.Error(1)
+}
+func (m *MockTenantRepo) SetRulePacks(tenantID int64, packIDs []int64) error {
+	return m.Called(tenantID, packIDs).Error(0)
+}
+
+func ptr(id int64) *int64 { return &id }
+
+func TestEffectiveRules_TenantRulesOverridePacks(t *testing.T) {
+	rules := []models.ClassificationRule{
+		{ID: 1, PackID: ptr(1), TypeName: "EMAIL_ADDRESS", Regex: "(?i)mail"},
+		{ID: 2, PackID: ptr(1), TypeName: "PHONE_NUMBER", Regex: "(?i)phone"},
+		{ID: 3, PackID: ptr(2), TypeName: "CREDIT_CARD_NUMBER", Regex: "(?i)card"},
+		{ID: 4, TenantID: ptr(5), TypeName: "email_address", Regex: "(?i)correo"},
+		{ID: 5, TenantID: ptr(5), TypeName: "PHONE_NUMBER", Disabled: true},
+		{ID: 6, TenantID: ptr(5), TypeName: "CUIT", Regex: "(?i)cuit"},
+	}
+
+	var ids []int64
+	for _, r := range services.EffectiveRules(rules) {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []int64{3, 4, 6}, ids)
+}
+
+func TestRuleService_ScopesRules(t *testing.T) {
+	repo := &MockRuleRepo{}
+	svc := services.NewRuleService(repo)
+	repo.On("CreateRule", testifyMock.MatchedBy(func(r models.ClassificationRule) bool {
+		return r.TenantID != nil && *r.TenantID == 5 && r.PackID == nil
+	})).Return(int64(11), nil)
+	repo.On("GetPack", int64(9)).Return(models.RulePack{}, sql.ErrNoRows)
+
+	// a pack id sent by a tenant is ignored: tenants never write into global packs
+	id, err := svc.CreateRule(5, models.ClassificationRule{PackID: ptr(1), TypeName: "CUIT", Regex: "(?i)cuit"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), id)
+
+	_, err = svc.CreateRule(5, models.ClassificationRule{Regex: "(?i)cuit"})
+	assert.ErrorIs(t, err, services.ErrInvalidRule)
+	_, err = svc.CreatePackRule(9, models.ClassificationRule{TypeName: "CUIT"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	repo.AssertNumberOfCalls(t, "CreateRule", 1)
+}
+
+func TestTenantService_CreateTenant(t *testing.T) {
+	repo, rules := &MockTenantRepo{}, &MockRuleRepo{}
+	svc := services.NewTenantService(repo, rules)
+	repo.On("GetBySlug", "acme").Return(models.Tenant{}, sql.ErrNoRows)
+	repo.On("GetBySlug", "globex").Return(models.Tenant{ID: 2, Slug: "globex"}, nil)
+	rules.On("GetPack", services.DefaultRulePackID).Return(models.RulePack{ID: 1}, nil)
+	rules.On("GetPack", int64(8)).Return(models.RulePack{}, sql.ErrNoRows)
+	repo.On("Create", testifyMock.MatchedBy(func(t models.Tenant) bool {
+		return len(t.RulePacks) == 1 && t.RulePacks[0] == services.DefaultRulePackID
+	})).Return(int64(3), nil)
+
+	created, err := svc.CreateTenant(models.Tenant{Slug: " ACME ", Name: "Acme"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), created.ID)
+	assert.Equal(t, "acme", created.Slug)
+	assert.Equal(t, []int64{services.DefaultRulePackID}, created.RulePacks, "new tenants inherit the baseline pack")
+
+	for _, bad := range []models.Tenant{
+		{Slug: "-acme", Name: "Acme"},
+		{Slug: "acme", Name: " "},
+		{Slug: "globex", Name: "Globex"},
+		{Slug: "acme", Name: "Acme", RulePacks: []int64{8}},
+		{Slug: "acme", Name: "Acme", RulePacks: []int64{1, 1}},
+	} {
+		_, err := svc.CreateTenant(bad)
+		assert.ErrorIs(t, err, services.ErrInvalidTenant, bad)
+	}
+	repo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestRegisterDatabase_BelongsToCallersTenant(t *testing.T) {
+	repo := new(MockDatabaseRepo)
+	repo.On("FindByTarget", int64(2), "db.internal", 3306, "scanner").Return(int64(0), sql.ErrNoRows)
+	repo.On("Create", testifyMock.Anything).Return(int64(4), nil)
+	svc := services.NewDatabaseService(repo)
+
+	// duplicates are looked up in the caller's tenant only, and a tenant_id in the body is ignored
+	_, _, err := svc.RegisterDatabase(2, models.Database{Host: "db.internal", Port: 3306, Username: "scanner", TenantID: 1}, false)
+	require.NoError(t, err)
+	created := repo.Calls[len(repo.Calls)-1].Arguments.Get(0).(models.Database)
+	assert.Equal(t, int64(2), created.TenantID)
+}
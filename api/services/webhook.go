@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/secrets"
+)
+
+// ErrInvalidWebhook wraps validation errors of webhooks created through the API.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// WebhookService manages the webhooks of a tenant.
+type WebhookService interface {
+	// CreateWebhook stores w, generating a secret when none is given, and returns it with the secret
+	CreateWebhook(tenantID int64, w models.Webhook) (models.Webhook, error)
+	// GetWebhook and ListWebhooks never return secrets
+	GetWebhook(tenantID, id int64) (models.Webhook, error)
+	ListWebhooks(tenantID int64) ([]models.Webhook, error)
+	DeleteWebhook(tenantID, id int64) error
+	// ListDeliveries returns the latest delivery attempts of a webhook, newest first
+	ListDeliveries(tenantID, id int64, limit int) ([]models.WebhookDelivery, error)
+}
+
+type webhookService struct {
+	repo   repositories.WebhookRepository
+	repoDB repositories.DatabaseRepository
+	keys   *secrets.Keyring
+}
+
+// WebhookOption customises optional collaborators of the webhook service.
+type WebhookOption func(*webhookService)
+
+// WithWebhookKeyring replaces the master keys that seal webhook secrets (secrets.Default() by default).
+func WithWebhookKeyring(keys *secrets.Keyring) WebhookOption {
+	return func(s *webhookService) { s.keys = keys }
+}
+
+func NewWebhookService(repo repositories.WebhookRepository, repoDB repositories.DatabaseRepository, opts ...WebhookOption) WebhookService {
+	s := &webhookService{repo: repo, repoDB: repoDB}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.keys == nil {
+		s.keys = secrets.Default()
+	}
+	return s
+}
+
+func (s *webhookService) CreateWebhook(tenantID int64, w models.Webhook) (models.Webhook, error) {
+	w.TenantID = tenantID
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.Webhook{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(models.WebhookEvents, e) {
+			return models.Webhook{}, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	if w.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return models.Webhook{}, err
+		}
+		w.Secret = hex.EncodeToString(b)
+	} else if len(w.Secret) < 16 {
+		return models.Webhook{}, fmt.Errorf("%w: secret must have at least 16 characters", ErrInvalidWebhook)
+	}
+	if w.DatabaseID != nil {
+		if _, err := s.repoDB.GetByID(tenantID, *w.DatabaseID); err != nil {
+			if err == sql.ErrNoRows {
+				return models.Webhook{}, fmt.Errorf("%w: database %d not found", ErrInvalidWebhook, *w.DatabaseID)
+			}
+			return models.Webhook{}, err
+		}
+	}
+
+	stored := w
+	if s.keys.Enabled() {
+		if stored.EncryptedSecret, err = s.keys.SealAs(secrets.UseWebhookSecret, w.Secret); err != nil {
+			return models.Webhook{}, fmt.Errorf("encrypt webhook secret: %w", err)
+		}
+		stored.Secret = ""
+	}
+	if w.ID, err = s.repo.Create(stored); err != nil {
+		return models.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s *webhookService) GetWebhook(tenantID, id int64) (models.Webhook, error) {
+	w, err := s.repo.Get(tenantID, id)
+	w.Secret, w.EncryptedSecret = "", nil
+	return w, err
+}
+
+func (s *webhookService) ListWebhooks(tenantID int64) ([]models.Webhook, error) {
+	return s.repo.List(tenantID)
+}
+
+func (s *webhookService) DeleteWebhook(tenantID, id int64) error {
+	return s.repo.Delete(tenantID, id)
+}
+
+func (s *webhookService) ListDeliveries(tenantID, id int64, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.repo.Get(tenantID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(tenantID, id, limit)
+}
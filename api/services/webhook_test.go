@@ -0,0 +1,43 @@
+package services_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/secrets"
+	"meli-challenge/api/services"
+)
+
+// createdWebhooks records the webhooks stored through Create.
+type createdWebhooks struct {
+	repositories.WebhookRepository
+	stored []models.Webhook
+}
+
+func (r *createdWebhooks) Create(w models.Webhook) (int64, error) {
+	r.stored = append(r.stored, w)
+	return int64(len(r.stored)), nil
+}
+
+func TestCreateWebhook_SealsSecret(t *testing.T) {
+	keys, err := secrets.NewKeyring([]string{"k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32))})
+	require.NoError(t, err)
+	repo := &createdWebhooks{}
+	svc := services.NewWebhookService(repo, nil, services.WithWebhookKeyring(keys))
+
+	created, err := svc.CreateWebhook(tenant, models.Webhook{URL: "https://hooks.example.com/dlp"})
+	require.NoError(t, err)
+	assert.Len(t, created.Secret, 64, "the generated secret is returned once")
+
+	require.Len(t, repo.stored, 1)
+	assert.Empty(t, repo.stored[0].Secret)
+	require.NotNil(t, repo.stored[0].EncryptedSecret)
+	plain, err := keys.OpenAs(secrets.UseWebhookSecret, repo.stored[0].EncryptedSecret)
+	require.NoError(t, err)
+	assert.Equal(t, created.Secret, plain)
+}
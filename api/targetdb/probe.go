@@ -0,0 +1,148 @@
+package targetdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"meli-challenge/api/models"
+)
+
+// Probe connects through db and checks what the scanner needs on the server: metadata in
+// information_schema, SELECT on the data (v2 sampling and profiling), a read-only session and
+// the Threads_running status used for load protection.
+func Probe(ctx context.Context, db *sql.DB) models.ConnectionTest {
+	start := time.Now()
+	res := models.ConnectionTest{Schemas: []string{}, Checks: []models.PrivilegeCheck{}}
+	defer func() { res.LatencyMs = time.Since(start).Milliseconds() }()
+
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&res.ServerVersion); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	schemas, err := stringColumn(ctx, db, `SELECT SCHEMA_NAME FROM information_schema.SCHEMATA
+		WHERE SCHEMA_NAME NOT IN ('mysql','sys','information_schema','performance_schema') ORDER BY SCHEMA_NAME`)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Schemas = schemas
+
+	res.Checks = append(res.Checks, metadataCheck(ctx, db), selectCheck(ctx, db), readOnlyCheck(ctx, db), statusCheck(ctx, db))
+	res.OK = true
+	for _, c := range res.Checks {
+		res.OK = res.OK && c.OK
+	}
+	return res
+}
+
+func metadataCheck(ctx context.Context, db *sql.DB) models.PrivilegeCheck {
+	c := models.PrivilegeCheck{Name: "metadata"}
+	var tables int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA NOT IN ('mysql','sys','information_schema','performance_schema')`).Scan(&tables)
+	switch {
+	case err != nil:
+		c.Detail = err.Error()
+	case tables == 0:
+		c.Detail = "no tables visible: the user has no privileges on any user table"
+	default:
+		c.OK, c.Detail = true, fmt.Sprintf("%d tables visible", tables)
+	}
+	return c
+}
+
+// selectCheck reads the user's grants and lists the scopes where it may read data.
+func selectCheck(ctx context.Context, db *sql.DB) models.PrivilegeCheck {
+	c := models.PrivilegeCheck{Name: "select"}
+	grants, err := stringColumn(ctx, db, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	scopes := SelectScopes(grants)
+	if len(scopes) == 0 {
+		c.Detail = "no SELECT grant: v2 scans and profiling cannot sample data"
+		return c
+	}
+	c.OK, c.Detail = true, "SELECT on "+strings.Join(scopes, ", ")
+	return c
+}
+
+// SelectScopes returns the objects (e.g. *.* or `shop`.*) on which a list of SHOW GRANTS
+// lines allows SELECT.
+func SelectScopes(grants []string) []string {
+	var scopes []string
+	for _, g := range grants {
+		if !strings.HasPrefix(g, "GRANT ") {
+			continue
+		}
+		on := strings.Index(g, " ON ")
+		to := strings.LastIndex(g, " TO ")
+		if on < 0 || to < on {
+			continue
+		}
+		privs := strings.ToUpper(g[len("GRANT "):on])
+		if strings.Contains(privs, "ALL PRIVILEGES") || containsPriv(privs, "SELECT") {
+			scopes = append(scopes, strings.TrimSpace(g[on+len(" ON "):to]))
+		}
+	}
+	return scopes
+}
+
+func containsPriv(privs, priv string) bool {
+	for _, p := range strings.Split(privs, ",") {
+		// column privileges look like "SELECT (`email`)"
+		if f := strings.Fields(p); len(f) > 0 && f[0] == priv {
+			return true
+		}
+	}
+	return false
+}
+
+func readOnlyCheck(ctx context.Context, db *sql.DB) models.PrivilegeCheck {
+	c := models.PrivilegeCheck{Name: "read_only_session"}
+	var readOnly int
+	if err := db.QueryRowContext(ctx, "SELECT @@SESSION.transaction_read_only").Scan(&readOnly); err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if readOnly != 1 {
+		c.Detail = "session is not read-only"
+		return c
+	}
+	c.OK, c.Detail = true, "transaction_read_only=1"
+	return c
+}
+
+func statusCheck(ctx context.Context, db *sql.DB) models.PrivilegeCheck {
+	c := models.PrivilegeCheck{Name: "threads_running"}
+	var name, value string
+	if err := db.QueryRowContext(ctx, "SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&name, &value); err != nil {
+		c.Detail = "load checks unavailable: " + err.Error()
+		return c
+	}
+	c.OK, c.Detail = true, "Threads_running="+value
+	return c
+}
+
+func stringColumn(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
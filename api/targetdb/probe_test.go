@@ -0,0 +1,57 @@
+package targetdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/targetdb"
+)
+
+func TestProbe_ReportsVersionSchemasAndChecks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow("8.0.36"))
+	mock.ExpectQuery("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA").
+		WillReturnRows(sqlmock.NewRows([]string{"SCHEMA_NAME"}).AddRow("billing").AddRow("shop"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM information_schema.TABLES").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(12))
+	mock.ExpectQuery("SHOW GRANTS FOR CURRENT_USER()").WillReturnRows(sqlmock.NewRows([]string{"Grants"}).
+		AddRow("GRANT USAGE ON *.* TO `scanner`@`%`").
+		AddRow("GRANT SELECT, SHOW VIEW ON `shop`.* TO `scanner`@`%`"))
+	mock.ExpectQuery("SELECT @@SESSION.transaction_read_only").WillReturnRows(sqlmock.NewRows([]string{"ro"}).AddRow(1))
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("4"))
+
+	res := targetdb.Probe(context.Background(), db)
+
+	assert.True(t, res.OK)
+	assert.Equal(t, "8.0.36", res.ServerVersion)
+	assert.Equal(t, []string{"billing", "shop"}, res.Schemas)
+	require.Len(t, res.Checks, 4)
+	assert.Equal(t, "select", res.Checks[1].Name)
+	assert.Equal(t, "SELECT on `shop`.*", res.Checks[1].Detail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProbe_ConnectionFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT VERSION()").WillReturnError(errors.New("Access denied for user 'scanner'"))
+
+	res := targetdb.Probe(context.Background(), db)
+
+	assert.False(t, res.OK)
+	assert.Equal(t, "Access denied for user 'scanner'", res.Error)
+	assert.Empty(t, res.Checks)
+}
+
+func TestSelectScopes(t *testing.T) {
+	assert.Equal(t, []string{"*.*"}, targetdb.SelectScopes([]string{"GRANT ALL PRIVILEGES ON *.* TO `root`@`%` WITH GRANT OPTION"}))
+	assert.Equal(t, []string{"`shop`.`users`"}, targetdb.SelectScopes([]string{"GRANT SELECT (`email`), INSERT ON `shop`.`users` TO `u`@`%`"}))
+	assert.Empty(t, targetdb.SelectScopes([]string{"GRANT USAGE ON *.* TO `u`@`%`", "GRANT INSERT, UPDATE ON `shop`.* TO `u`@`%`"}))
+}
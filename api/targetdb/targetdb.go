@@ -0,0 +1,171 @@
+// Package targetdb opens connection pools to registered databases that keep the scan's load
+// on the target server bounded: few connections, paced queries, read-only sessions and a
+// back-off while the server is busy.
+package targetdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/secrets"
+)
+
+// Defaults applied to unset TargetLimits fields
+const (
+	DefaultMaxConnections    = 2
+	DefaultMaxQPS            = 20
+	DefaultMaxThreadsRunning = 50
+)
+
+// idleConnTimeout closes pooled connections a scan is not using (e.g. while waiting on the LLM)
+const idleConnTimeout = 30 * time.Second
+
+// secretTimeout bounds the resolution of a secret reference
+const secretTimeout = 10 * time.Second
+
+// sessionParams are sent as SET statements on every new connection: the session cannot write,
+// and dirty reads avoid taking or waiting for row locks held by the application.
+var sessionParams = map[string]string{
+	"transaction_read_only":    "1",
+	"transaction_isolation":    "'READ-UNCOMMITTED'",
+	"innodb_lock_wait_timeout": "1",
+}
+
+// WithDefaults fills unset fields of l.
+func WithDefaults(l models.TargetLimits) models.TargetLimits {
+	if l.MaxConnections <= 0 {
+		l.MaxConnections = DefaultMaxConnections
+	}
+	if l.MaxQPS <= 0 {
+		l.MaxQPS = DefaultMaxQPS
+	}
+	if l.MaxThreadsRunning == 0 {
+		l.MaxThreadsRunning = DefaultMaxThreadsRunning
+	}
+	return l
+}
+
+// Address returns the host and port scans connect to: the replica when one is registered.
+func Address(t models.Database) (string, int) {
+	if t.ReplicaHost == "" {
+		return t.Host, t.Port
+	}
+	if t.ReplicaPort == 0 {
+		return t.ReplicaHost, t.Port
+	}
+	return t.ReplicaHost, t.ReplicaPort
+}
+
+// Config builds the driver configuration for a scan of t. It always connects to
+// information_schema so the service can query any schema on the server.
+func Config(t models.Database) *mysql.Config {
+	host, port := Address(t)
+	cfg := mysql.NewConfig()
+	cfg.User = t.Username
+	cfg.Passwd = t.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.DBName = "information_schema"
+	cfg.Timeout = 10 * time.Second
+	// placeholders are expanded client-side so every query is a single round trip (and a single throttle slot)
+	cfg.InterpolateParams = true
+	cfg.Params = make(map[string]string, len(sessionParams))
+	for k, v := range sessionParams {
+		cfg.Params[k] = v
+	}
+	return cfg
+}
+
+// Open returns a throttled, read-only pool to the server registered as t, with its TLS
+// settings and through its SSH tunnel if any. Secret references are resolved and encrypted
+// passwords decrypted here, right before connecting, and only kept by the driver configuration.
+func Open(t models.Database) (*sql.DB, error) {
+	password, err := credentials(t)
+	if err != nil {
+		return nil, fmt.Errorf("database %d credentials: %w", t.ID, err)
+	}
+	t.Password = password
+	cfg := Config(t)
+
+	if t.TLS.Mode != "" && t.TLS.Mode != models.TLSDisabled {
+		var clientKey string
+		if t.TLS.KeyRef != "" {
+			if clientKey, err = resolve(t.TenantID, t.TLS.KeyRef); err != nil {
+				return nil, fmt.Errorf("database %d TLS key: %w", t.ID, err)
+			}
+		}
+		host, _ := Address(t)
+		if cfg.TLS, err = TLSConfig(t.TLS, host, clientKey); err != nil {
+			return nil, fmt.Errorf("database %d TLS: %w", t.ID, err)
+		}
+		cfg.AllowFallbackToPlaintext = t.TLS.Mode == models.TLSPreferred
+	}
+
+	var tunnel *Tunnel
+	if t.SSH.Host != "" {
+		key, err := resolve(t.TenantID, t.SSH.KeyRef)
+		if err != nil {
+			return nil, fmt.Errorf("database %d SSH key: %w", t.ID, err)
+		}
+		if tunnel, err = NewTunnel(t.SSH, key); err != nil {
+			return nil, fmt.Errorf("database %d: %w", t.ID, err)
+		}
+		cfg.DialFunc = tunnel.Dial
+	}
+
+	var connector driver.Connector
+	if connector, err = mysql.NewConnector(cfg); err != nil {
+		return nil, err
+	}
+	if tunnel != nil {
+		connector = &tunnelConnector{Connector: connector, tunnel: tunnel}
+	}
+	return OpenConnectorFor(t.ID, connector, t.Limits), nil
+}
+
+func credentials(t models.Database) (string, error) {
+	switch {
+	case t.PasswordRef != "":
+		return resolve(t.TenantID, t.PasswordRef)
+	case t.EncryptedPassword != nil:
+		return secrets.Default().Open(t.EncryptedPassword)
+	default:
+		return t.Password, nil
+	}
+}
+
+// resolve reads ref within the secrets of tenantID, so a reference stored before scoping (or
+// written straight to the table) cannot reach another tenant's secrets either.
+func resolve(tenantID int64, ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	return secrets.DefaultProviders().ForTenant(tenantID).Resolve(ctx, ref)
+}
+
+// OpenConnector wraps any driver connector with the limits of l.
+func OpenConnector(connector driver.Connector, l models.TargetLimits) *sql.DB {
+	return open(connector, newGate(WithDefaults(l)))
+}
+
+// OpenConnectorFor is OpenConnector for the registered database databaseID: the pools of
+// concurrent scans of the same database share its query pace, load check and connections.
+func OpenConnectorFor(databaseID int64, connector driver.Connector, l models.TargetLimits) *sql.DB {
+	return open(connector, gateFor(databaseID, WithDefaults(l)))
+}
+
+func open(connector driver.Connector, g *gate) *sql.DB {
+	db := sql.OpenDB(&throttledConnector{Connector: connector, gate: g})
+	db.SetMaxOpenConns(g.limits.MaxConnections)
+	db.SetMaxIdleConns(g.limits.MaxConnections)
+	// an idle connection holds one of the database's slots: give it back to other scans
+	db.SetConnMaxIdleTime(idleConnTimeout)
+	return db
+}
@@ -0,0 +1,126 @@
+package targetdb_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/targetdb"
+)
+
+// mockConnector hands out the sqlmock connection registered under dsn.
+type mockConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c mockConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c mockConnector) Driver() driver.Driver                        { return c.drv }
+
+func newMock(t *testing.T) (mockConnector, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.NewWithDSN(t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return mockConnector{dsn: t.Name(), drv: db.Driver()}, mock
+}
+
+func statusRows(running string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_running", running)
+}
+
+func TestConfig_UsesReplicaAndReadOnlySession(t *testing.T) {
+	cfg := targetdb.Config(models.Database{Host: "primary", Port: 3306, Username: "u", Password: "p@ss:word", ReplicaHost: "replica"})
+
+	assert.Equal(t, "replica:3306", cfg.Addr)
+	assert.Equal(t, "information_schema", cfg.DBName)
+	assert.True(t, cfg.InterpolateParams)
+	assert.Equal(t, "1", cfg.Params["transaction_read_only"])
+	assert.Equal(t, "'READ-UNCOMMITTED'", cfg.Params["transaction_isolation"])
+
+	host, port := targetdb.Address(models.Database{Host: "primary", Port: 3306, ReplicaHost: "replica", ReplicaPort: 3307})
+	assert.Equal(t, "replica", host)
+	assert.Equal(t, 3307, port)
+}
+
+func TestOpenConnector_PacesQueries(t *testing.T) {
+	connector, mock := newMock(t)
+	for i := 0; i < 5; i++ {
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	}
+
+	db := targetdb.OpenConnector(connector, models.TargetLimits{MaxQPS: 50, MaxThreadsRunning: -1})
+	defer db.Close()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		rows, err := db.Query("SELECT 1")
+		require.NoError(t, err)
+		rows.Close()
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenConnector_BacksOffWhileTargetIsBusy(t *testing.T) {
+	t.Setenv("TARGET_LOAD_CHECK_MS", "0")
+	t.Setenv("TARGET_BACKOFF_BASE_MS", "30")
+	connector, mock := newMock(t)
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("80"))
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("3"))
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	db := targetdb.OpenConnector(connector, models.TargetLimits{MaxQPS: 1000, MaxThreadsRunning: 10})
+	defer db.Close()
+
+	start := time.Now()
+	rows, err := db.Query("SELECT 1")
+	require.NoError(t, err)
+	rows.Close()
+
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenConnector_GivesUpWhenTargetStaysBusy(t *testing.T) {
+	t.Setenv("TARGET_BACKOFF_BASE_MS", "1000")
+	t.Setenv("TARGET_MAX_PAUSE_MS", "10")
+	connector, mock := newMock(t)
+	mock.ExpectQuery("SHOW GLOBAL STATUS LIKE 'Threads_running'").WillReturnRows(statusRows("80"))
+
+	db := targetdb.OpenConnector(connector, models.TargetLimits{MaxThreadsRunning: 10})
+	defer db.Close()
+
+	_, err := db.Query("SELECT 1")
+
+	assert.ErrorIs(t, err, targetdb.ErrTargetBusy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOpenConnectorFor_ScansOfOneDatabaseShareConnections(t *testing.T) {
+	connector, mock := newMock(t)
+	mock.ExpectClose()
+	limits := models.TargetLimits{MaxConnections: 1, MaxThreadsRunning: -1}
+	first := targetdb.OpenConnectorFor(900, connector, limits)
+	second := targetdb.OpenConnectorFor(900, connector, limits)
+	defer second.Close()
+
+	conn, err := first.Conn(context.Background())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = second.Conn(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the only connection is taken by the other scan")
+
+	conn.Close()
+	require.NoError(t, first.Close())
+	other, err := second.Conn(context.Background())
+	require.NoError(t, err)
+	other.Close()
+}
@@ -0,0 +1,319 @@
+package targetdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/config"
+	"meli-challenge/logger"
+)
+
+// ErrTargetBusy is returned when the server stays above MaxThreadsRunning for longer than
+// TARGET_MAX_PAUSE_MS.
+var ErrTargetBusy = errors.New("target server is busy")
+
+// throttle paces the queries of one pool and pauses them while the server is overloaded.
+type throttle struct {
+	interval   time.Duration // minimum spacing between queries (1/MaxQPS)
+	maxThreads int           // <= 0 disables the load check
+	checkEvery time.Duration
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	maxPause   time.Duration
+
+	mu          sync.Mutex
+	next        time.Time // next free query slot
+	nextCheck   time.Time
+	pausedUntil time.Time
+	backoff     time.Duration
+}
+
+func newThrottle(l models.TargetLimits) *throttle {
+	return &throttle{
+		interval:   time.Duration(float64(time.Second) / l.MaxQPS),
+		maxThreads: l.MaxThreadsRunning,
+		checkEvery: time.Duration(config.EnvInt("TARGET_LOAD_CHECK_MS", 5000, 0)) * time.Millisecond,
+		baseDelay:  time.Duration(config.EnvInt("TARGET_BACKOFF_BASE_MS", 1000, 0)) * time.Millisecond,
+		maxDelay:   time.Duration(config.EnvInt("TARGET_BACKOFF_MAX_MS", 30000, 0)) * time.Millisecond,
+		maxPause:   time.Duration(config.EnvInt("TARGET_MAX_PAUSE_MS", 120000, 0)) * time.Millisecond,
+	}
+}
+
+// gate holds what every pool to one database shares: the throttle and MaxConnections slots.
+type gate struct {
+	limits models.TargetLimits
+	t      *throttle
+	slots  chan struct{}
+}
+
+func newGate(l models.TargetLimits) *gate {
+	return &gate{limits: l, t: newThrottle(l), slots: make(chan struct{}, l.MaxConnections)}
+}
+
+var (
+	gatesMu sync.Mutex
+	gates   = map[int64]*gate{}
+)
+
+// gateFor returns the gate of the registered database id. Changed limits take a new gate;
+// scans already running keep the old one until they finish. Unregistered targets (id 0)
+// are not shared.
+func gateFor(id int64, l models.TargetLimits) *gate {
+	if id == 0 {
+		return newGate(l)
+	}
+	gatesMu.Lock()
+	defer gatesMu.Unlock()
+	if g, ok := gates[id]; ok && g.limits == l {
+		return g
+	}
+	g := newGate(l)
+	gates[id] = g
+	return g
+}
+
+// acquire takes a connection slot, waiting for one to be released.
+func (g *gate) acquire(ctx context.Context) error {
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *gate) release() {
+	<-g.slots
+}
+
+// wait blocks until conn may send its next query.
+func (t *throttle) wait(ctx context.Context, conn driver.Conn) error {
+	if err := t.checkLoad(ctx, conn); err != nil {
+		return err
+	}
+	return t.pace(ctx)
+}
+
+// pace hands out query slots spaced by interval.
+func (t *throttle) pace(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.next
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next = slot.Add(t.interval)
+	t.mu.Unlock()
+	return sleep(ctx, slot.Sub(now))
+}
+
+// checkLoad reads Threads_running at most every checkEvery and, while it is above maxThreads,
+// holds every query of the pool with an exponential back-off.
+func (t *throttle) checkLoad(ctx context.Context, conn driver.Conn) error {
+	if t.maxThreads <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(t.maxPause)
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		if now.Before(t.pausedUntil) {
+			d := t.pausedUntil.Sub(now)
+			t.mu.Unlock()
+			if now.Add(d).After(deadline) {
+				return ErrTargetBusy
+			}
+			if err := sleep(ctx, d); err != nil {
+				return err
+			}
+			continue
+		}
+		if now.Before(t.nextCheck) {
+			t.mu.Unlock()
+			return nil
+		}
+		t.nextCheck = now.Add(t.checkEvery)
+		t.mu.Unlock()
+
+		running, err := threadsRunning(ctx, conn)
+		if err != nil {
+			// the check is best effort: lacking it must not block the scan
+			logger.Warnf("Threads_running check failed: %v", err)
+			return nil
+		}
+
+		t.mu.Lock()
+		if running <= t.maxThreads {
+			t.backoff = 0
+			t.mu.Unlock()
+			return nil
+		}
+		t.backoff = min(max(2*t.backoff, t.baseDelay), t.maxDelay)
+		t.pausedUntil = now.Add(t.backoff)
+		t.nextCheck = t.pausedUntil
+		logger.Warnf("Target busy (Threads_running=%d > %d), pausing scan queries for %s", running, t.maxThreads, t.backoff)
+		t.mu.Unlock()
+	}
+}
+
+// threadsRunning queries the server status on conn directly, bypassing the throttle.
+func threadsRunning(ctx context.Context, conn driver.Conn) (int, error) {
+	q, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return 0, fmt.Errorf("driver does not support queries without prepare")
+	}
+	rows, err := q.QueryContext(ctx, "SHOW GLOBAL STATUS LIKE 'Threads_running'", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	dest := make([]driver.Value, len(rows.Columns()))
+	if len(dest) < 2 {
+		return 0, fmt.Errorf("unexpected status columns %v", rows.Columns())
+	}
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return 0, fmt.Errorf("Threads_running not reported")
+		}
+		return 0, err
+	}
+	var s string
+	switch v := dest[1].(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprint(v)
+	}
+	return strconv.Atoi(s)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledConnector hands out connections whose queries go through a shared throttle, each
+// holding one of the gate's connection slots until it is closed.
+type throttledConnector struct {
+	driver.Connector
+	gate *gate
+}
+
+// Close is called by sql.DB.Close and releases what the wrapped connector holds (e.g. an SSH tunnel).
+func (c *throttledConnector) Close() error {
+	if closer, ok := c.Connector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *throttledConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.gate.acquire(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		c.gate.release()
+		return nil, err
+	}
+	return &throttledConn{Conn: conn, t: c.gate.t, release: sync.OnceFunc(c.gate.release)}, nil
+}
+
+// throttledConn forwards the optional driver interfaces of the wrapped connection, waiting
+// on the throttle before anything that reaches the server as a statement.
+type throttledConn struct {
+	driver.Conn
+	t       *throttle
+	release func()
+}
+
+func (c *throttledConn) Close() error {
+	defer c.release()
+	return c.Conn.Close()
+}
+
+func (c *throttledConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.t.wait(ctx, c.Conn); err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *throttledConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.t.wait(ctx, c.Conn); err != nil {
+		return nil, err
+	}
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *throttledConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := c.t.wait(ctx, c.Conn); err != nil {
+		return nil, err
+	}
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *throttledConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() // drivers without BeginTx
+}
+
+func (c *throttledConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *throttledConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *throttledConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *throttledConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
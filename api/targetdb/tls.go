@@ -0,0 +1,66 @@
+package targetdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"meli-challenge/api/models"
+)
+
+// TLSConfig builds the client TLS configuration of s for a server reached as host; clientKey is
+// the resolved PEM key of s.Cert. It returns nil when TLS is disabled.
+func TLSConfig(s models.TLSSettings, host, clientKey string) (*tls.Config, error) {
+	if s.Mode == "" || s.Mode == models.TLSDisabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}
+	if s.ServerName != "" {
+		cfg.ServerName = s.ServerName
+	}
+	if s.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(s.Cert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if s.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(s.CA)) {
+			return nil, errors.New("ca has no PEM certificates")
+		}
+		cfg.RootCAs = pool
+	}
+
+	switch s.Mode {
+	case models.TLSPreferred, models.TLSRequired:
+		// like MySQL's ssl-mode: encrypted, but the server certificate is not checked
+		cfg.InsecureSkipVerify = true
+	case models.TLSVerifyCA:
+		// the chain is checked in VerifyConnection, without the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = verifyChain(cfg.RootCAs)
+	case models.TLSVerifyIdentity:
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", s.Mode)
+	}
+	return cfg, nil
+}
+
+// verifyChain checks the server certificate against roots (the system pool when nil).
+func verifyChain(roots *x509.CertPool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, c := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(c)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
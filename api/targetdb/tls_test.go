@@ -0,0 +1,141 @@
+package targetdb_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/targetdb"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// issue returns a PEM certificate and key for name signed by the CA.
+func (ca testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: name}, DNSNames: []string{name},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// handshake runs a TLS handshake between client and a server presenting cert, and returns
+// how many certificates the client presented and the client error.
+func handshake(t *testing.T, client *tls.Config, certPEM, keyPEM string, clientCAs *x509.CertPool) (int, error) {
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	require.NoError(t, err)
+	// a loopback socket rather than net.Pipe: both ends may write at once (e.g. an alert)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	clientSide, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	serverSide, err := ln.Accept()
+	require.NoError(t, err)
+	server := tls.Server(serverSide, &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven})
+	peers := make(chan int, 1)
+	go func() {
+		defer serverSide.Close()
+		_ = server.Handshake()
+		peers <- len(server.ConnectionState().PeerCertificates)
+	}()
+	c := tls.Client(clientSide, client)
+	err = c.Handshake()
+	clientSide.Close()
+	return <-peers, err
+}
+
+func TestTLSConfig_Modes(t *testing.T) {
+	ca, other := newCA(t), newCA(t)
+	serverCert, serverKey := ca.issue(t, "db.internal", x509.ExtKeyUsageServerAuth)
+
+	cfg, err := targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSDisabled}, "db.internal", "")
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	// required encrypts without checking the certificate
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSRequired}, "db.internal", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.NoError(t, err)
+
+	// verify-identity checks chain and name
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyIdentity, CA: ca.pem}, "db.internal", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.NoError(t, err)
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyIdentity, CA: ca.pem}, "10.0.0.5", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.Error(t, err)
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyIdentity, CA: ca.pem, ServerName: "db.internal"}, "10.0.0.5", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.NoError(t, err)
+
+	// verify-ca checks only the chain
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyCA, CA: ca.pem}, "10.0.0.5", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.NoError(t, err)
+	cfg, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyCA, CA: other.pem}, "db.internal", "")
+	require.NoError(t, err)
+	_, err = handshake(t, cfg, serverCert, serverKey, nil)
+	assert.Error(t, err)
+}
+
+func TestTLSConfig_ClientCertificate(t *testing.T) {
+	ca := newCA(t)
+	serverCert, serverKey := ca.issue(t, "db.internal", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "scanner", x509.ExtKeyUsageClientAuth)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	cfg, err := targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSVerifyIdentity, CA: ca.pem, Cert: clientCert}, "db.internal", clientKey)
+	require.NoError(t, err)
+	presented, err := handshake(t, cfg, serverCert, serverKey, pool)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, presented)
+
+	_, err = targetdb.TLSConfig(models.TLSSettings{Mode: models.TLSRequired, Cert: clientCert}, "db.internal", serverKey)
+	assert.Error(t, err)
+}
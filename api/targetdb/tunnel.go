@@ -0,0 +1,140 @@
+package targetdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"meli-challenge/api/models"
+	"meli-challenge/logger"
+)
+
+// DefaultSSHPort is used when SSHTunnel.Port is unset
+const DefaultSSHPort = 22
+
+// Tunnel forwards the connections of one pool through a bastion host. The SSH session is
+// opened by the first Dial and closed with the pool; a broken session is re-opened by the
+// next Dial.
+type Tunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// NewTunnel prepares a tunnel through t authenticated with the PEM privateKey; it connects lazily.
+func NewTunnel(t models.SSHTunnel, privateKey string) (*Tunnel, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("ssh key: %w", err)
+	}
+	port := t.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+	return &Tunnel{
+		addr: net.JoinHostPort(t.Host, strconv.Itoa(port)),
+		config: &ssh.ClientConfig{
+			User:            t.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: checkHostKey(t.HostKey),
+			Timeout:         10 * time.Second,
+		},
+	}, nil
+}
+
+// checkHostKey accepts only the host key with the given SHA256 fingerprint.
+func checkHostKey(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		if got := ssh.FingerprintSHA256(key); got != fingerprint {
+			return fmt.Errorf("ssh host key of %s is %s, expected %s", hostname, got, fingerprint)
+		}
+		return nil
+	}
+}
+
+// Dial opens a connection to addr from the bastion host.
+func (t *Tunnel) Dial(ctx context.Context, _, addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		// a refused target leaves the session usable for the other connections of the pool;
+		// only a dead session (bastion restarted, idle timeout) is started over next time
+		if sessionLost(client, err) {
+			t.reset(client)
+		}
+		return nil, fmt.Errorf("ssh tunnel to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+func (t *Tunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("ssh tunnel closed")
+	}
+	if t.client == nil {
+		client, err := ssh.Dial("tcp", t.addr, t.config)
+		if err != nil {
+			return nil, fmt.Errorf("ssh bastion %s: %w", t.addr, err)
+		}
+		logger.Infof("SSH tunnel opened through %s", t.addr)
+		t.client = client
+	}
+	return t.client, nil
+}
+
+// sessionLost reports whether a failed dial means the SSH session itself is gone: the
+// transport was closed, or the bastion no longer answers a keepalive.
+func sessionLost(client *ssh.Client, err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	_, _, err = client.SendRequest("keepalive@openssh.com", true, nil)
+	return err != nil
+}
+
+func (t *Tunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.client == nil {
+		return nil
+	}
+	err := t.client.Close()
+	t.client = nil
+	return err
+}
+
+// tunnelConnector closes the tunnel of its connections when the pool is closed.
+type tunnelConnector struct {
+	driver.Connector
+	tunnel *Tunnel
+}
+
+func (c *tunnelConnector) Close() error {
+	return c.tunnel.Close()
+}
@@ -0,0 +1,166 @@
+package targetdb_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/targetdb"
+)
+
+// startBastion runs an SSH server that accepts clientKey and forwards direct-tcpip channels.
+// It returns its address, host key fingerprint and a counter of the SSH sessions it accepted.
+func startBastion(t *testing.T, clientKey ssh.PublicKey) (string, int, string, *atomic.Int32) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+	cfg := &ssh.ServerConfig{PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if string(key.Marshal()) != string(clientKey.Marshal()) {
+			return nil, fmt.Errorf("unknown key")
+		}
+		return nil, nil
+	}}
+	cfg.AddHostKey(hostSigner)
+	sessions := new(atomic.Int32)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			sessions.Add(1)
+			go serveSSH(conn, cfg)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, ssh.FingerprintSHA256(hostSigner.PublicKey()), sessions
+}
+
+func serveSSH(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		var dest struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &dest) != nil {
+			nc.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port))))
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, reqs, _ := nc.Accept()
+		go ssh.DiscardRequests(reqs)
+		go func() { io.Copy(ch, target); ch.Close() }()
+		go func() { io.Copy(target, ch); target.Close() }()
+	}
+}
+
+func clientKey(t *testing.T) (ssh.PublicKey, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return sshPub, string(pem.EncodeToMemory(block))
+}
+
+func TestTunnel_ForwardsThroughBastion(t *testing.T) {
+	// a target only the bastion "reaches": an echo server
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+
+	pub, key := clientKey(t)
+	host, port, fingerprint, _ := startBastion(t, pub)
+	tunnel, err := targetdb.NewTunnel(models.SSHTunnel{Host: host, Port: port, User: "scanner", HostKey: fingerprint}, key)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := tunnel.Dial(context.Background(), "tcp", echo.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+		conn.Close()
+	}
+
+	require.NoError(t, tunnel.Close())
+	_, err = tunnel.Dial(context.Background(), "tcp", echo.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestTunnel_RejectsUnexpectedHostKey(t *testing.T) {
+	pub, key := clientKey(t)
+	host, port, _, _ := startBastion(t, pub)
+	tunnel, err := targetdb.NewTunnel(models.SSHTunnel{Host: host, Port: port, User: "scanner", HostKey: "SHA256:AAAA"}, key)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	_, err = tunnel.Dial(context.Background(), "tcp", "127.0.0.1:3306")
+	assert.ErrorContains(t, err, "host key")
+}
+
+func TestTunnel_RefusedTargetKeepsSession(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := closed.Addr().String()
+	closed.Close()
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+
+	pub, key := clientKey(t)
+	host, port, fingerprint, sessions := startBastion(t, pub)
+	tunnel, err := targetdb.NewTunnel(models.SSHTunnel{Host: host, Port: port, User: "scanner", HostKey: fingerprint}, key)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	_, err = tunnel.Dial(context.Background(), "tcp", refused)
+	assert.Error(t, err)
+	conn, err := tunnel.Dial(context.Background(), "tcp", echo.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, int32(1), sessions.Load(), "the bastion session is reused")
+}
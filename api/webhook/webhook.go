@@ -0,0 +1,326 @@
+// Package webhook posts scan events to the webhooks registered in the internal database.
+//
+// Every request carries the headers X-Webhook-Event, X-Webhook-ID (the event id, stable across
+// retries), X-Webhook-Timestamp (unix seconds) and X-Webhook-Signature, which is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)). Failed deliveries are retried
+// with exponential back-off and every attempt is stored in webhook_deliveries.
+//
+// Deliveries never reach loopback, private, link-local or other internal addresses, checked
+// after DNS resolution, unless the network is listed in WEBHOOK_ALLOWED_CIDRS.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/secrets"
+	"meli-challenge/config"
+	"meli-challenge/internal/textutil"
+	"meli-challenge/logger"
+)
+
+// ErrAddressNotAllowed is returned for deliveries to an internal address that is not allowed.
+var ErrAddressNotAllowed = errors.New("webhook address not allowed")
+
+// Config tunes deliveries.
+type Config struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+	// AllowedNetworks are internal networks deliveries may reach anyway
+	AllowedNetworks []*net.IPNet
+}
+
+// ConfigFromEnv reads WEBHOOK_MAX_ATTEMPTS (5), WEBHOOK_BACKOFF_BASE_MS (1000),
+// WEBHOOK_BACKOFF_MAX_MS (60000), WEBHOOK_TIMEOUT_SEC (10) and WEBHOOK_ALLOWED_CIDRS (comma
+// separated networks or addresses, none by default).
+func ConfigFromEnv() Config {
+	return Config{
+		MaxAttempts:     config.EnvInt("WEBHOOK_MAX_ATTEMPTS", 5, 1),
+		BaseDelay:       time.Duration(config.EnvInt("WEBHOOK_BACKOFF_BASE_MS", 1000, 1)) * time.Millisecond,
+		MaxDelay:        time.Duration(config.EnvInt("WEBHOOK_BACKOFF_MAX_MS", 60000, 1)) * time.Millisecond,
+		Timeout:         time.Duration(config.EnvInt("WEBHOOK_TIMEOUT_SEC", 10, 1)) * time.Second,
+		AllowedNetworks: parseNetworks(os.Getenv("WEBHOOK_ALLOWED_CIDRS")),
+	}
+}
+
+// parseNetworks reads comma separated CIDRs or single addresses, skipping invalid entries.
+func parseNetworks(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Warnf("Ignoring invalid WEBHOOK_ALLOWED_CIDRS entry %q", entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// reserved are special-purpose IPv4 ranges not covered by the net.IP predicates
+var reserved = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("192.0.0.0/24"),
+	mustCIDR("198.18.0.0/15"),
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// internal reports whether ip belongs to the host or its private networks, e.g. 127.0.0.1,
+// 10.0.0.0/8 or the 169.254.169.254 metadata endpoint of cloud providers.
+func internal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range reserved {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether deliveries may connect to ip.
+func (cfg Config) allowed(ip net.IP) bool {
+	if !internal(ip) {
+		return true
+	}
+	for _, network := range cfg.AllowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newClient returns an HTTP client that checks every address it dials, after DNS resolution
+// and on redirects, so a webhook host cannot resolve to an internal service. Proxies are not
+// used: the proxy, not the webhook, would be the address checked.
+func newClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !cfg.allowed(ip) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}
+}
+
+// Sign returns the X-Webhook-Signature value of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign in constant time.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher delivers events in the background; it implements services.ScanNotifier.
+type Dispatcher struct {
+	repo   repositories.WebhookRepository
+	client *http.Client
+	cfg    Config
+	keys   *secrets.Keyring
+	wg     sync.WaitGroup
+}
+
+// Option customises optional collaborators of a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithKeyring replaces the master keys that open sealed webhook secrets (secrets.Default() by default).
+func WithKeyring(keys *secrets.Keyring) Option {
+	return func(d *Dispatcher) { d.keys = keys }
+}
+
+func NewDispatcher(repo repositories.WebhookRepository, cfg Config, opts ...Option) *Dispatcher {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	d := &Dispatcher{repo: repo, client: newClient(cfg), cfg: cfg}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.keys == nil {
+		d.keys = secrets.Default()
+	}
+	return d
+}
+
+// Notify posts event to every enabled webhook of its database (and the global ones) that
+// subscribes to it. It returns before the deliveries finish.
+func (d *Dispatcher) Notify(event models.WebhookEvent) {
+	hooks, err := d.repo.ListForDatabase(event.DatabaseID)
+	if err != nil {
+		return
+	}
+	var body []byte
+	for _, hook := range hooks {
+		if !hook.Subscribed(event.Event) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(event); err != nil {
+				logger.Errorf("Webhook payload for scan_id=%d could not be encoded: %v", event.ScanID, err)
+				return
+			}
+		}
+		d.wg.Add(1)
+		go func(hook models.Webhook) {
+			defer d.wg.Done()
+			d.deliver(hook, event, body)
+		}(hook)
+	}
+}
+
+// Wait blocks until the pending deliveries (including retries) have finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(hook models.Webhook, event models.WebhookEvent, body []byte) {
+	secret, err := d.secret(hook)
+	if err != nil {
+		logger.Errorf("Webhook id=%d secret could not be decrypted: %v", hook.ID, err)
+		_ = d.repo.SaveDelivery(models.WebhookDelivery{
+			WebhookID: hook.ID, EventID: event.ID, Event: event.Event, ScanID: event.ScanID, Attempt: 1,
+			Error: "webhook secret could not be decrypted", CreatedAt: time.Now(),
+		})
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		code, retryAfter, err := d.post(hook.URL, secret, event, body)
+		delivery := models.WebhookDelivery{
+			WebhookID:  hook.ID,
+			EventID:    event.ID,
+			Event:      event.Event,
+			ScanID:     event.ScanID,
+			Attempt:    attempt,
+			StatusCode: code,
+			Success:    err == nil,
+			DurationMs: time.Since(start).Milliseconds(),
+			CreatedAt:  start,
+		}
+		if err != nil {
+			delivery.Error = textutil.Truncate(err.Error(), 255)
+		}
+		_ = d.repo.SaveDelivery(delivery)
+
+		if err == nil {
+			return
+		}
+		if attempt >= d.cfg.MaxAttempts || !retryable(code) || errors.Is(err, ErrAddressNotAllowed) {
+			logger.Warnf("Webhook id=%d gave up on %s for scan_id=%d after %d attempts: %v", hook.ID, event.Event, event.ScanID, attempt, err)
+			return
+		}
+		time.Sleep(d.backoff(attempt, retryAfter))
+	}
+}
+
+// secret returns the signing secret of hook, opening it when it is sealed.
+func (d *Dispatcher) secret(hook models.Webhook) (string, error) {
+	if hook.EncryptedSecret == nil {
+		return hook.Secret, nil
+	}
+	return d.keys.OpenAs(secrets.UseWebhookSecret, hook.EncryptedSecret)
+}
+
+// post sends one attempt; it returns the HTTP status (0 on network errors) and any Retry-After delay.
+func (d *Dispatcher) post(url, secret string, event models.WebhookEvent, body []byte) (int, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "meli-challenge-webhooks/1")
+	req.Header.Set("X-Webhook-Event", event.Event)
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		retryAfter = time.Duration(secs) * time.Second
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+func (d *Dispatcher) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := d.cfg.BaseDelay << (attempt - 1)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > d.cfg.MaxDelay || delay < 0 {
+		delay = d.cfg.MaxDelay
+	}
+	return delay
+}
+
+// retryable reports whether a failed attempt may succeed later: network errors, timeouts,
+// throttling and server errors. Other 4xx responses mean the receiver rejected the payload.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,179 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/secrets"
+	"meli-challenge/api/webhook"
+)
+
+// fakeRepo serves fixed webhooks and records delivery attempts.
+type fakeRepo struct {
+	hooks []models.Webhook
+
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+}
+
+func (r *fakeRepo) Create(models.Webhook) (int64, error)     { return 0, nil }
+func (r *fakeRepo) Get(int64, int64) (models.Webhook, error) { return models.Webhook{}, nil }
+func (r *fakeRepo) List(int64) ([]models.Webhook, error)     { return r.hooks, nil }
+func (r *fakeRepo) Delete(int64, int64) error                { return nil }
+func (r *fakeRepo) UpdateSecret(int64, int64, string, *models.EncryptedSecret) error {
+	return nil
+}
+func (r *fakeRepo) ListForDatabase(int64) ([]models.Webhook, error) {
+	return r.hooks, nil
+}
+func (r *fakeRepo) ListDeliveries(int64, int64, int) ([]models.WebhookDelivery, error) {
+	return r.deliveries, nil
+}
+func (r *fakeRepo) SaveDelivery(d models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, d)
+	return nil
+}
+
+// fastRetries allows loopback, where the httptest receivers listen
+var fastRetries = webhook.Config{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Timeout: time.Second,
+	AllowedNetworks: []*net.IPNet{{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}}
+
+func event(name string) models.WebhookEvent {
+	return models.WebhookEvent{ID: "evt-1", Event: name, DatabaseID: 3, ScanID: 8, Status: "success"}
+}
+
+func TestNotify_SignsPayload(t *testing.T) {
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+	}))
+	defer srv.Close()
+	keys, err := secrets.NewKeyring([]string{"k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))})
+	require.NoError(t, err)
+	sealed, err := keys.SealAs(secrets.UseWebhookSecret, "0123456789abcdef")
+	require.NoError(t, err)
+	repo := &fakeRepo{hooks: []models.Webhook{{ID: 1, URL: srv.URL, EncryptedSecret: sealed, Enabled: true}}}
+	d := webhook.NewDispatcher(repo, fastRetries, webhook.WithKeyring(keys))
+
+	d.Notify(event(models.EventScanSucceeded))
+	d.Wait()
+
+	ts, err := strconv.ParseInt(header.Get("X-Webhook-Timestamp"), 10, 64)
+	require.NoError(t, err)
+	assert.True(t, webhook.Verify("0123456789abcdef", ts, body, header.Get("X-Webhook-Signature")))
+	assert.False(t, webhook.Verify("another-secret-value", ts, body, header.Get("X-Webhook-Signature")))
+	assert.Equal(t, models.EventScanSucceeded, header.Get("X-Webhook-Event"))
+	assert.Equal(t, "evt-1", header.Get("X-Webhook-ID"))
+
+	var got models.WebhookEvent
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, int64(8), got.ScanID)
+	require.Len(t, repo.deliveries, 1)
+	assert.True(t, repo.deliveries[0].Success)
+	assert.Equal(t, http.StatusOK, repo.deliveries[0].StatusCode)
+}
+
+func TestNotify_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	repo := &fakeRepo{hooks: []models.Webhook{{ID: 1, URL: srv.URL, Secret: "s", Enabled: true}}}
+	d := webhook.NewDispatcher(repo, fastRetries)
+
+	d.Notify(event(models.EventScanFailed))
+	d.Wait()
+
+	assert.Equal(t, int32(3), calls.Load())
+	require.Len(t, repo.deliveries, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{repo.deliveries[0].Attempt, repo.deliveries[1].Attempt, repo.deliveries[2].Attempt})
+	assert.Equal(t, http.StatusServiceUnavailable, repo.deliveries[0].StatusCode)
+	assert.False(t, repo.deliveries[0].Success)
+	assert.True(t, repo.deliveries[2].Success)
+}
+
+func TestNotify_DoesNotRetryRejectedPayloads(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	repo := &fakeRepo{hooks: []models.Webhook{{ID: 1, URL: srv.URL, Secret: "s", Enabled: true}}}
+	d := webhook.NewDispatcher(repo, fastRetries)
+
+	d.Notify(event(models.EventScanFailed))
+	d.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	require.Len(t, repo.deliveries, 1)
+	assert.Equal(t, "unexpected status 400", repo.deliveries[0].Error)
+}
+
+func TestNotify_OnlySubscribedWebhooks(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+	repo := &fakeRepo{hooks: []models.Webhook{
+		{ID: 1, URL: srv.URL, Secret: "s", Events: []string{models.EventNewSensitiveColumns}},
+		{ID: 2, URL: srv.URL, Secret: "s"},
+	}}
+	d := webhook.NewDispatcher(repo, fastRetries)
+
+	d.Notify(event(models.EventScanSucceeded))
+	d.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	require.Len(t, repo.deliveries, 1)
+	assert.Equal(t, int64(2), repo.deliveries[0].WebhookID)
+}
+
+func TestNotify_RefusesInternalAddresses(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+	defer srv.Close()
+	// localhost resolves to loopback: the address is checked after DNS, not on the URL
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	repo := &fakeRepo{hooks: []models.Webhook{{ID: 1, URL: url, Secret: "s"}}}
+	cfg := fastRetries
+	cfg.AllowedNetworks = nil
+	d := webhook.NewDispatcher(repo, cfg)
+
+	d.Notify(event(models.EventScanSucceeded))
+	d.Wait()
+
+	assert.Zero(t, calls.Load())
+	require.Len(t, repo.deliveries, 1, "a refused address is not retried")
+	assert.Contains(t, repo.deliveries[0].Error, "webhook address not allowed")
+}
+
+func TestConfigFromEnv_AllowedNetworks(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOWED_CIDRS", "10.1.0.0/16, 192.168.1.20, not-a-network")
+	cfg := webhook.ConfigFromEnv()
+	require.Len(t, cfg.AllowedNetworks, 2)
+	assert.True(t, cfg.AllowedNetworks[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, cfg.AllowedNetworks[1].Contains(net.ParseIP("192.168.1.20")))
+	assert.False(t, cfg.AllowedNetworks[1].Contains(net.ParseIP("192.168.1.21")))
+}
@@ -0,0 +1,46 @@
+// Command fakellm runs an OpenAI-compatible chat-completions stand-in for offline development.
+// Point the API at it with OPENAI_BASE_URL=http://localhost:8089/v1 (any OPENAI_API_KEY works).
+//
+// Environment:
+//   - FAKE_LLM_PORT: listen port (default 8089)
+//   - FAKE_LLM_DELAY_MS: artificial latency added to every answer
+//   - FAKE_LLM_ERROR_STATUS: when set (e.g. 429 or 503) every call fails with that status
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"meli-challenge/api/llm"
+	"meli-challenge/config"
+	"meli-challenge/logger"
+)
+
+func main() {
+	port := config.EnvString("FAKE_LLM_PORT", "8089")
+
+	client := llm.NewFakeClient("fake").WithRules(llm.DefaultFakeRules()...)
+	if status := config.EnvInt("FAKE_LLM_ERROR_STATUS", 0, 400); status != 0 {
+		// Errors must win over rule-based answers
+		client = llm.NewFakeClient("fake").Default(llm.FakeResponse{
+			Err: &llm.ProviderError{StatusCode: status, RetryAfter: time.Second, Err: errors.New("simulated provider error")},
+		})
+	}
+
+	handler := llm.NewFakeServer(client)
+	if ms := config.EnvInt("FAKE_LLM_DELAY_MS", 0, 1); ms > 0 {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	logger.Infof("Fake LLM server listening on :%s", port)
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
+		logger.Errorf("fake LLM server stopped: %v", err)
+		os.Exit(1)
+	}
+}
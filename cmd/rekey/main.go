@@ -0,0 +1,135 @@
+// Command rekey migrates the stored passwords of registered databases and the webhook secrets
+// to the active master key: plaintext values are encrypted and values sealed with an older key
+// get their data key re-wrapped. It reads the same DB_* and CREDENTIALS_* variables (or .env) as the API.
+//
+// Usage:
+//
+//	rekey [-dry-run]
+//
+// Run it after adding a new master key at the top of CREDENTIALS_KEY_FILE (or
+// CREDENTIALS_MASTER_KEY); once it reports no pending rows the old keys can be removed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/secrets"
+	"meli-challenge/config"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	dryRun := flag.Bool("dry-run", false, "only report which rows would change")
+	flag.Parse()
+
+	keys, err := secrets.LoadKeyring()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if !keys.Enabled() {
+		fmt.Fprintln(os.Stderr, "no master key configured: set CREDENTIALS_KEY_FILE or CREDENTIALS_MASTER_KEY")
+		return 1
+	}
+
+	db := config.InitDB()
+	defer db.Close()
+	repo := repositories.NewDatabaseRepository(db)
+	hooks := repositories.NewWebhookRepository(db)
+
+	tenants, err := repositories.NewTenantRepository(db).List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var dbs []models.Database
+	for _, t := range tenants {
+		list, err := repo.List(t.ID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		dbs = append(dbs, list...)
+	}
+
+	var encrypted, rewrapped, current, failed int
+	for _, d := range dbs {
+		var enc *models.EncryptedSecret
+		counter := &encrypted
+		switch {
+		case d.EncryptedPassword == nil && d.Password == "":
+			// uses a secret reference: nothing stored to encrypt
+			current++
+			continue
+		case d.EncryptedPassword == nil:
+			enc, err = keys.Seal(d.Password)
+		case d.EncryptedPassword.KeyID != keys.ActiveKeyID():
+			enc, err = keys.Rewrap(d.EncryptedPassword)
+			counter = &rewrapped
+		default:
+			current++
+			continue
+		}
+		if err == nil && !*dryRun {
+			err = repo.UpdatePassword(d.TenantID, d.ID, "", enc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "database %d: %v\n", d.ID, err)
+			failed++
+			continue
+		}
+		*counter++
+	}
+
+	for _, t := range tenants {
+		list, err := hooks.List(t.ID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, h := range list {
+			// List leaves secrets out
+			stored, err := hooks.Get(t.ID, h.ID)
+			var enc *models.EncryptedSecret
+			counter := &encrypted
+			switch {
+			case err != nil:
+			case stored.EncryptedSecret == nil:
+				enc, err = keys.SealAs(secrets.UseWebhookSecret, stored.Secret)
+			case stored.EncryptedSecret.KeyID != keys.ActiveKeyID():
+				enc, err = keys.Rewrap(stored.EncryptedSecret)
+				counter = &rewrapped
+			default:
+				current++
+				continue
+			}
+			if err == nil && !*dryRun {
+				err = hooks.UpdateSecret(t.ID, h.ID, "", enc)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "webhook %d: %v\n", h.ID, err)
+				failed++
+				continue
+			}
+			*counter++
+		}
+	}
+
+	verb := "updated"
+	if *dryRun {
+		verb = "would update"
+	}
+	fmt.Printf("%s %d rows: %d encrypted, %d re-wrapped with key %q; %d already current, %d failed\n",
+		verb, encrypted+rewrapped, encrypted, rewrapped, keys.ActiveKeyID(), current, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+// Command scandiff compares the results of two scans stored in the internal database, like
+// GET /api/v1/scans/diff. It reads the same DB_* variables (or .env) as the API.
+//
+// Usage:
+//
+//	scandiff -from 12 -to 15 [-tenant 1] [-format json|html]
+//
+// Both scans must belong to the tenant (the default tenant unless -tenant is given).
+//
+// The exit status is 0 when the command succeeds, 1 on errors and 2 when the newer scan has
+// newly sensitive columns, so it can gate CI jobs.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"meli-challenge/api/diff"
+	"meli-challenge/api/models"
+	"meli-challenge/api/repositories"
+	"meli-challenge/api/services"
+	"meli-challenge/config"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	from := flag.Int64("from", 0, "older scan id")
+	to := flag.Int64("to", 0, "newer scan id")
+	tenant := flag.Int64("tenant", models.DefaultTenantID, "tenant id the scans belong to")
+	format := flag.String("format", "json", "output format: json or html")
+	flag.Parse()
+
+	if *from <= 0 || *to <= 0 || (*format != "json" && *format != "html") {
+		flag.Usage()
+		return 1
+	}
+
+	db := config.InitDB()
+	defer db.Close()
+	svc := services.NewScanService(repositories.NewScanRepository(db), repositories.NewRuleRepository(db), nil)
+
+	d, err := svc.DiffScans(*tenant, *from, *to)
+	if err == sql.ErrNoRows {
+		fmt.Fprintln(os.Stderr, "scan not found")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *format == "html" {
+		err = diff.WriteHTML(os.Stdout, d)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(d.NewlySensitive) > 0 {
+		return 2
+	}
+	return 0
+}
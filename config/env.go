@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// EnvString reads an environment variable, falling back to def when unset or empty.
+func EnvString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// EnvInt reads an integer environment variable, falling back to def when unset, invalid or below min.
+func EnvInt(name string, def, min int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= min {
+			return n
+		}
+	}
+	return def
+}
+
+// EnvFloat reads a non-negative float environment variable, falling back to def when unset or invalid.
+func EnvFloat(name string, def float64) float64 {
+	if v := os.Getenv(name); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			return f
+		}
+	}
+	return def
+}
@@ -3,23 +3,103 @@
 CREATE DATABASE IF NOT EXISTS classifier_db;
 USE classifier_db;
 
+-- Teams or business units sharing the deployment; every registered database, scan, rule,
+-- API key and their dependents belong to one
+CREATE TABLE tenants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    slug VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_tenants_slug (slug)
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default');
+
 -- Table of registered databases for scanning
 CREATE TABLE `external_databases` (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    -- optional friendly name, environment tag and owner
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    environment VARCHAR(20) NOT NULL DEFAULT '',
+    owner VARCHAR(100) NOT NULL DEFAULT '',
     host VARCHAR(100) NOT NULL,
     port INT NOT NULL,
     username VARCHAR(50) NOT NULL,
+    -- plaintext only while no master key is configured; otherwise '' and the password is
+    -- sealed below: AES-GCM ciphertext plus its data key wrapped by master key password_key_id
     password VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    password_key_id VARCHAR(64) NOT NULL DEFAULT '',
+    password_dek VARBINARY(128) NULL,
+    password_ciphertext VARBINARY(512) NULL,
+    -- reference to a secret resolved at connection time (env:, file: or vault:), instead of a password
+    password_ref VARCHAR(255) NOT NULL DEFAULT '',
+    -- v2 sampling settings; empty/0 means "use the default" (see sampling.WithDefaults)
+    sampling_strategy VARCHAR(20) NOT NULL DEFAULT '',
+    sample_size INT NOT NULL DEFAULT 0,
+    sample_row_limit INT NOT NULL DEFAULT 0,
+    sample_percent DOUBLE NOT NULL DEFAULT 0,
+    max_execution_ms INT NOT NULL DEFAULT 0,
+    -- optional read replica used by scans instead of host/port
+    replica_host VARCHAR(100) NOT NULL DEFAULT '',
+    replica_port INT NOT NULL DEFAULT 0,
+    -- load protection; 0 means "use the default" (see targetdb.WithDefaults)
+    max_connections INT NOT NULL DEFAULT 0,
+    max_qps DOUBLE NOT NULL DEFAULT 0,
+    max_threads_running INT NOT NULL DEFAULT 0,
+    -- TLS: mode as in MySQL's ssl-mode, PEM CA bundle and client certificate, secret
+    -- reference to the client key and an optional name to verify
+    tls_mode VARCHAR(20) NOT NULL DEFAULT '',
+    tls_ca TEXT NOT NULL DEFAULT (''),
+    tls_cert TEXT NOT NULL DEFAULT (''),
+    tls_key_ref VARCHAR(255) NOT NULL DEFAULT '',
+    tls_server_name VARCHAR(255) NOT NULL DEFAULT '',
+    -- optional SSH bastion; the key is a secret reference, the host key a SHA256 fingerprint
+    ssh_host VARCHAR(100) NOT NULL DEFAULT '',
+    ssh_port INT NOT NULL DEFAULT 0,
+    ssh_user VARCHAR(50) NOT NULL DEFAULT '',
+    ssh_key_ref VARCHAR(255) NOT NULL DEFAULT '',
+    ssh_host_key VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- deleted databases keep their scan history; their password (plain or sealed) is wiped
+    deleted_at DATETIME NULL,
+    -- NULL for deleted rows (and unnamed ones), so the unique keys only cover live databases
+    live TINYINT AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL,
+    live_name VARCHAR(100) AS (IF(deleted_at IS NULL AND name <> '', name, NULL)) VIRTUAL,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    INDEX idx_databases_tenant (tenant_id),
+    UNIQUE KEY uq_databases_target (tenant_id, host, port, username, live),
+    UNIQUE KEY uq_databases_name (tenant_id, live_name)
 );
 
 -- Scan executions history
 CREATE TABLE scan_history (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    -- copied from the database when the scan starts
+    tenant_id INT NOT NULL,
     database_id INT NOT NULL,
+    -- v1 (regex) or v2 (LLM), counted by the daily LLM scan quota
+    api_version VARCHAR(2) NOT NULL DEFAULT 'v1',
     executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     status VARCHAR(20) NOT NULL DEFAULT 'running',
-    FOREIGN KEY (database_id) REFERENCES `external_databases`(id)
+    llm_cache_hits INT NOT NULL DEFAULT 0,
+    llm_cache_misses INT NOT NULL DEFAULT 0,
+    llm_calls INT NOT NULL DEFAULT 0,
+    llm_prompt_tokens INT NOT NULL DEFAULT 0,
+    llm_completion_tokens INT NOT NULL DEFAULT 0,
+    llm_latency_ms BIGINT NOT NULL DEFAULT 0,
+    llm_retries INT NOT NULL DEFAULT 0,
+    llm_errors INT NOT NULL DEFAULT 0,
+    llm_cost_usd DECIMAL(12,6) NOT NULL DEFAULT 0,
+    llm_cost_unknown BOOLEAN NOT NULL DEFAULT FALSE,
+    llm_budget_usd DECIMAL(12,6) NOT NULL DEFAULT 0,
+    llm_budget_exhausted BOOLEAN NOT NULL DEFAULT FALSE,
+    tables_scanned INT NOT NULL DEFAULT 0,
+    tables_reused INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (database_id) REFERENCES `external_databases`(id),
+    INDEX idx_history_tenant (tenant_id, id),
+    INDEX idx_history_quota (tenant_id, status, executed_at)
 );
 
 -- Detailed results per scan (now includes schema_name)
@@ -30,44 +110,269 @@ CREATE TABLE scan_results (
     table_name VARCHAR(100) NOT NULL,
     column_name VARCHAR(100) NOT NULL,
     info_type VARCHAR(50) NOT NULL,
+    injection_suspected BOOLEAN NOT NULL DEFAULT FALSE,
+    rules_version CHAR(64) NOT NULL DEFAULT '',
+    FOREIGN KEY (scan_id) REFERENCES scan_history(id),
+    INDEX idx_results_scan_table (scan_id, schema_name, table_name)
+);
+
+-- Structure fingerprint of every table seen by a scan, used by incremental scans
+CREATE TABLE scan_table_fingerprints (
+    scan_id INT NOT NULL,
+    schema_name VARCHAR(100) NOT NULL,
+    table_name VARCHAR(100) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    rules_version CHAR(64) NOT NULL,
+    PRIMARY KEY (scan_id, schema_name, table_name),
     FOREIGN KEY (scan_id) REFERENCES scan_history(id)
 );
 
+-- Optional statistical profile of each scanned column (see profiling.Compute)
+CREATE TABLE scan_column_profiles (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    scan_id INT NOT NULL,
+    schema_name VARCHAR(100) NOT NULL,
+    table_name VARCHAR(100) NOT NULL,
+    column_name VARCHAR(100) NOT NULL,
+    sampled_rows INT NOT NULL,
+    null_ratio DOUBLE NOT NULL,
+    approx_distinct INT NOT NULL,
+    min_length INT NOT NULL,
+    max_length INT NOT NULL,
+    top_shapes TEXT NOT NULL,
+    char_class_entropy DOUBLE NOT NULL,
+    FOREIGN KEY (scan_id) REFERENCES scan_history(id),
+    INDEX idx_profiles_scan (scan_id)
+);
+
+-- Recurring scans (see api/scheduler)
+CREATE TABLE scan_schedules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    database_id INT NOT NULL,
+    cron_expr VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    scan_version VARCHAR(2) NOT NULL DEFAULT 'v1',
+    options JSON NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at DATETIME NOT NULL,
+    last_run_at DATETIME NULL,
+    last_scan_id INT NOT NULL DEFAULT 0,
+    last_status VARCHAR(20) NOT NULL DEFAULT '',
+    missed_runs INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (database_id) REFERENCES `external_databases`(id),
+    INDEX idx_schedules_tenant (tenant_id),
+    INDEX idx_schedules_due (enabled, next_run_at)
+);
+
+CREATE TABLE scan_schedule_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    schedule_id INT NOT NULL,
+    scheduled_at DATETIME NOT NULL,
+    scan_id INT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL,
+    message VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (schedule_id) REFERENCES scan_schedules(id) ON DELETE CASCADE,
+    INDEX idx_runs_schedule (schedule_id, status)
+);
+
+-- Leader lease so only one API replica runs the scheduler at a time
+CREATE TABLE scheduler_leases (
+    name VARCHAR(50) PRIMARY KEY,
+    holder VARCHAR(100) NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+-- Outbound notifications about scans (see api/webhook)
+-- Webhooks without database_id are global to their tenant
+CREATE TABLE webhooks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    database_id INT NULL,
+    url VARCHAR(2048) NOT NULL,
+    -- plaintext only while no master key is configured; otherwise '' and sealed like
+    -- external_databases.password
+    secret VARCHAR(128) NOT NULL,
+    secret_key_id VARCHAR(64) NOT NULL DEFAULT '',
+    secret_dek VARBINARY(128) NULL,
+    secret_ciphertext VARBINARY(512) NULL,
+    events JSON NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (database_id) REFERENCES `external_databases`(id) ON DELETE CASCADE,
+    INDEX idx_webhooks_tenant (tenant_id)
+);
+
+-- One row per delivery attempt
+CREATE TABLE webhook_deliveries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    webhook_id INT NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    scan_id INT NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    duration_ms INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+    INDEX idx_deliveries_webhook (webhook_id, id)
+);
+
+-- Signed, revocable links to scan reports; the token itself is not stored
+CREATE TABLE report_shares (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    scan_id INT NOT NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (scan_id) REFERENCES scan_history(id) ON DELETE CASCADE,
+    INDEX idx_report_shares_scan (tenant_id, scan_id)
+);
+
+-- Every request made with a share link, including refused ones
+CREATE TABLE report_share_accesses (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    share_id INT NOT NULL,
+    accessed_at DATETIME NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    path VARCHAR(255) NOT NULL DEFAULT '',
+    outcome VARCHAR(20) NOT NULL,
+    FOREIGN KEY (share_id) REFERENCES report_shares(id) ON DELETE CASCADE,
+    INDEX idx_share_accesses_share (share_id, id)
+);
+
+-- API keys; only the SHA-256 of the key is stored, prefix is the public part used to find it
+CREATE TABLE api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    owner VARCHAR(100) NOT NULL,
+    prefix CHAR(12) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    UNIQUE KEY uq_api_keys_prefix (prefix),
+    INDEX idx_api_keys_tenant (tenant_id)
+);
+
+-- Append-only audit log of administrative and scan actions; changes holds the before/after
+-- values of the fields an action changed
+CREATE TABLE audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    occurred_at DATETIME NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    actor_owner VARCHAR(100) NOT NULL DEFAULT '',
+    actor_key_id INT NULL,
+    action VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(30) NOT NULL,
+    resource_id VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    changes JSON NULL,
+    INDEX idx_audit_occurred (tenant_id, occurred_at),
+    INDEX idx_audit_actor (tenant_id, actor, id),
+    INDEX idx_audit_action (tenant_id, action, id),
+    INDEX idx_audit_resource (tenant_id, resource_type, resource_id, id)
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+-- Global rule packs; tenants inherit the rules of the packs they subscribe to
+CREATE TABLE rule_packs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_rule_packs_name (name)
+);
+
+CREATE TABLE tenant_rule_packs (
+    tenant_id INT NOT NULL,
+    pack_id INT NOT NULL,
+    PRIMARY KEY (tenant_id, pack_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+    FOREIGN KEY (pack_id) REFERENCES rule_packs(id) ON DELETE CASCADE
+);
+
+-- A rule belongs to a pack or to a tenant. Tenant rules override the pack rules with the
+-- same type_name; a disabled one removes that type for the tenant.
 CREATE TABLE classification_rules (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    pack_id INT NULL,
+    tenant_id INT NULL,
     type_name VARCHAR(50) NOT NULL,
     regex VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (pack_id) REFERENCES rule_packs(id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    CHECK ((pack_id IS NULL) <> (tenant_id IS NULL)),
+    INDEX idx_rules_tenant (tenant_id),
+    INDEX idx_rules_pack (pack_id)
+);
+
+-- Cached LLM classifications keyed by tenant and column fingerprint (see llm.CacheKey)
+CREATE TABLE llm_cache (
+    tenant_id INT NOT NULL,
+    cache_key CHAR(64) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    info_type VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant_id, cache_key),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE,
+    INDEX idx_llm_cache_expires (expires_at)
 );
 
--- Initial rules insertion
-INSERT INTO classification_rules (type_name, regex) VALUES
+-- Initial rules: the baseline pack, inherited by the default tenant
+INSERT INTO rule_packs (id, name, description) VALUES (1, 'baseline', 'PII, contact, credentials, PCI and technical identifiers');
+INSERT INTO tenant_rule_packs (tenant_id, pack_id) VALUES (1, 1);
+
+INSERT INTO classification_rules (pack_id, type_name, regex) VALUES
 -- Personal Information (PII)
-('FIRST_NAME', '(?i)^first(_?name)?$'),
-('LAST_NAME', '(?i)^last(_?name)?$'),
-('DATE_OF_BIRTH', '(?i)^(dob|date[_ ]?of[_ ]?birth|birth[_ ]?date)$'),
-('GENDER', '(?i)^(gender|sex)$'),
-('SSN', '(?i)^(ssn|social[_ ]?security[_ ]?number|national[_ ]?id)$'),
+(1, 'FIRST_NAME', '(?i)^first(_?name)?$'),
+(1, 'LAST_NAME', '(?i)^last(_?name)?$'),
+(1, 'DATE_OF_BIRTH', '(?i)^(dob|date[_ ]?of[_ ]?birth|birth[_ ]?date)$'),
+(1, 'GENDER', '(?i)^(gender|sex)$'),
+(1, 'SSN', '(?i)^(ssn|social[_ ]?security[_ ]?number|national[_ ]?id)$'),
 
 -- Contact Information
-('EMAIL_ADDRESS', '(?i)email'),
-('PHONE_NUMBER', '(?i)^(phone|mobile|contact[_ ]?number)$'),
-('ADDRESS', '(?i)^address(_.*)?$'),
-('POSTAL_CODE', '(?i)^(postal|zip)_?code$'),
+(1, 'EMAIL_ADDRESS', '(?i)email'),
+(1, 'PHONE_NUMBER', '(?i)^(phone|mobile|contact[_ ]?number)$'),
+(1, 'ADDRESS', '(?i)^address(_.*)?$'),
+(1, 'POSTAL_CODE', '(?i)^(postal|zip)_?code$'),
 
 -- Authentication / Security Data
-('USERNAME', '(?i)^user(name)?$'),
-('PASSWORD', '(?i)^password$'),
-('SECURITY_QUESTION', '(?i)^security[_ ]?(question|answer)$'),
-('API_KEY', '(?i)^(api[_ ]?key|auth[_ ]?token|secret)$'),
+(1, 'USERNAME', '(?i)^user(name)?$'),
+(1, 'PASSWORD', '(?i)^password$'),
+(1, 'SECURITY_QUESTION', '(?i)^security[_ ]?(question|answer)$'),
+(1, 'API_KEY', '(?i)^(api[_ ]?key|auth[_ ]?token|secret)$'),
 
 -- Financial Information (PCI)
-('CREDIT_CARD_NUMBER', '(?i)^(credit[_ ]?card(_?number)?|card[_ ]?number)$'),
-('BANK_ACCOUNT', '(?i)^(account[_ ]?number|iban|acct)$'),
-('ROUTING_NUMBER', '(?i)^routing[_ ]?number$'),
-('SWIFT_CODE', '(?i)^swift[_ ]?code$'),
+(1, 'CREDIT_CARD_NUMBER', '(?i)^(credit[_ ]?card(_?number)?|card[_ ]?number)$'),
+(1, 'BANK_ACCOUNT', '(?i)^(account[_ ]?number|iban|acct)$'),
+(1, 'ROUTING_NUMBER', '(?i)^routing[_ ]?number$'),
+(1, 'SWIFT_CODE', '(?i)^swift[_ ]?code$'),
 
 -- Technical Identifiers
-('IP_ADDRESS', '(?i)^ip(_address)?$'),
-('MAC_ADDRESS', '(?i)^mac[_ ]?address$'),
-('HOSTNAME', '(?i)^host[_ ]?name$');
\ No newline at end of file
+(1, 'IP_ADDRESS', '(?i)^ip(_address)?$'),
+(1, 'MAC_ADDRESS', '(?i)^mac[_ ]?address$'),
+(1, 'HOSTNAME', '(?i)^host[_ ]?name$');
\ No newline at end of file
@@ -0,0 +1,26 @@
+// Package textutil holds the small string helpers shared by the API packages.
+package textutil
+
+import "strings"
+
+// Truncate cuts s to at most n runes.
+func Truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// Ellipsize cuts s to at most n runes, marking the cut with an ellipsis.
+func Ellipsize(s string, n int) string {
+	if t := Truncate(s, n); t != s {
+		return t + "…"
+	}
+	return s
+}
+
+// QuoteIdent quotes a MySQL identifier, escaping embedded backticks.
+func QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,21 @@
+package textutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"meli-challenge/internal/textutil"
+)
+
+func TestTruncate_CountsRunes(t *testing.T) {
+	assert.Equal(t, "año", textutil.Truncate("año", 3))
+	assert.Equal(t, "añ", textutil.Truncate("año", 2))
+	assert.Equal(t, "añ…", textutil.Ellipsize("año", 2))
+	assert.Equal(t, "año", textutil.Ellipsize("año", 5))
+}
+
+func TestQuoteIdent_EscapesBackticks(t *testing.T) {
+	assert.Equal(t, "`users`", textutil.QuoteIdent("users"))
+	assert.Equal(t, "`a``b`", textutil.QuoteIdent("a`b"))
+}